@@ -0,0 +1,369 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AccountToken je jednokratni token za reset lozinke ili verifikaciju
+// email adrese. U bazi se cuva samo hes tokena.
+type AccountToken struct {
+	TokenHash string     `bson:"token_hash"`
+	Email     string     `bson:"email"`
+	Purpose   string     `bson:"purpose"`
+	ExpiresAt time.Time  `bson:"expires_at"`
+	CreatedAt time.Time  `bson:"created_at"`
+	UsedAt    *time.Time `bson:"used_at,omitempty"`
+}
+
+type PasswordResetRequest struct {
+	Email string `json:"email"`
+}
+
+type PasswordResetConfirmRequest struct {
+	Token       string `json:"token"`
+	NewPassword string `json:"new_password"`
+}
+
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
+const (
+	tokenPurposeReset  = "reset_lozinke"
+	tokenPurposeVerify = "verifikacija"
+
+	resetTokenTTL  = time.Hour
+	verifyTokenTTL = 48 * time.Hour
+)
+
+var errInvalidAccountToken = errors.New("Neispravan, iskoriscen ili istekao token")
+
+var accountTokensCollection *mongo.Collection
+
+func init() {
+	http.HandleFunc("/auth/password-reset/request", handlePasswordResetRequest)
+	http.HandleFunc("/auth/password-reset/confirm", handlePasswordResetConfirm)
+	http.HandleFunc("/auth/verify-email", handleVerifyEmail)
+	http.HandleFunc("/auth/verify-email/resend", handleResendVerification)
+}
+
+func handlePasswordResetRequest(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PasswordResetRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+		return
+	}
+
+	// Odgovor je isti bez obzira da li nalog postoji, da se email adrese
+	// ne bi mogle nabrajati.
+	user, err := getUserByEmail(r.Context(), req.Email)
+	if err == nil && !user.Disabled {
+		if err := sendPasswordResetMail(r.Context(), user); err != nil {
+			log.Printf("Password reset warning for %s: %v", user.Email, err)
+		}
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func handlePasswordResetConfirm(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req PasswordResetConfirmRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+		return
+	}
+	if err := validatePassword(req.NewPassword); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	email, err := consumeAccountToken(r.Context(), req.Token, tokenPurposeReset)
+	if err != nil {
+		if errors.Is(err, errInvalidAccountToken) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Greska pri resetovanju lozinke", http.StatusInternalServerError)
+		return
+	}
+	user, err := getUserByEmail(r.Context(), email)
+	if err != nil || user.Disabled {
+		http.Error(w, errInvalidAccountToken.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := setUserPassword(r.Context(), user, req.NewPassword, false); err != nil {
+		http.Error(w, "Greska pri resetovanju lozinke", http.StatusInternalServerError)
+		return
+	}
+	// Uspesan reset preko linka iz maila dokazuje i vlasnistvo nad adresom.
+	if err := markEmailVerified(r.Context(), user.Email); err != nil {
+		log.Printf("Email verification warning for %s: %v", user.Email, err)
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleVerifyEmail: GET sa linka iz maila samo prikazuje stranicu za
+// potvrdu, jer skeneri linkova u mail klijentima otvaraju linkove i time bi
+// potrosili jednokratni token. Token se trosi tek na POST (forma sa te
+// stranice ili JSON iz frontenda).
+func handleVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var token string
+	fromForm := false
+	switch r.Method {
+	case http.MethodGet:
+		token = r.URL.Query().Get("token")
+		if _, err := lookupAccountToken(r.Context(), token, tokenPurposeVerify); err != nil {
+			if errors.Is(err, errInvalidAccountToken) {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			http.Error(w, "Greska pri verifikaciji", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		verifyEmailTemplate.Execute(w, token)
+		return
+	case http.MethodPost:
+		if strings.HasPrefix(r.Header.Get("Content-Type"), "application/x-www-form-urlencoded") {
+			fromForm = true
+			token = r.PostFormValue("token")
+			break
+		}
+		var req VerifyEmailRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+			return
+		}
+		token = req.Token
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	email, err := consumeAccountToken(r.Context(), token, tokenPurposeVerify)
+	if err != nil {
+		if errors.Is(err, errInvalidAccountToken) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Greska pri verifikaciji", http.StatusInternalServerError)
+		return
+	}
+	if err := markEmailVerified(r.Context(), email); err != nil {
+		http.Error(w, "Greska pri verifikaciji", http.StatusInternalServerError)
+		return
+	}
+
+	if fromForm {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte("Email adresa je potvrdjena. Prijavite se ponovo da biste podneli zahtev za upis."))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+var verifyEmailTemplate = template.Must(template.New("verify").Parse(`<!doctype html>
+<html lang="sr">
+<head><meta charset="utf-8"><meta name="robots" content="noindex"><title>Potvrda email adrese - E-Uprava</title></head>
+<body>
+<h1>Potvrda email adrese</h1>
+<form method="post" action="/auth/verify-email">
+<input type="hidden" name="token" value="{{.}}">
+<button type="submit">Potvrdi email adresu</button>
+</form>
+</body>
+</html>
+`))
+
+func handleResendVerification(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	user, err := getUserByEmail(r.Context(), claimString(claims, "sub"))
+	if err != nil {
+		http.Error(w, "Korisnik nije pronadjen", http.StatusNotFound)
+		return
+	}
+	if user.EmailVerified {
+		http.Error(w, "Email adresa je vec potvrdjena", http.StatusBadRequest)
+		return
+	}
+	if err := sendVerificationMail(r.Context(), user); err != nil {
+		http.Error(w, "Greska pri slanju poruke", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusAccepted)
+}
+
+func sendPasswordResetMail(ctx context.Context, user *User) error {
+	token, err := createAccountToken(ctx, user.Email, tokenPurposeReset, resetTokenTTL)
+	if err != nil {
+		return err
+	}
+	link := getenvDefault("PASSWORD_RESET_URL", "http://localhost:5500/login.html?reset_token=") + token
+	sendMail(ctx, user.Email, "Reset lozinke - E-Uprava",
+		"Primili smo zahtev za reset lozinke.\n\nNovu lozinku mozete postaviti preko linka (vazi 1 sat):\n"+link+
+			"\n\nAko niste trazili reset, ignorisite ovu poruku.")
+	return nil
+}
+
+func sendVerificationMail(ctx context.Context, user *User) error {
+	token, err := createAccountToken(ctx, user.Email, tokenPurposeVerify, verifyTokenTTL)
+	if err != nil {
+		return err
+	}
+	link := getenvDefault("AUTH_PUBLIC_URL", "http://localhost:8083") + "/auth/verify-email?token=" + token
+	sendMail(ctx, user.Email, "Potvrda email adrese - E-Uprava",
+		"Dobrodosli na E-Uprava portal.\n\nPotvrdite email adresu preko linka (vazi 48 sati):\n"+link)
+	return nil
+}
+
+// createAccountToken ponistava ranije neiskoriscene tokene iste namene,
+// pa vazi samo poslednji poslati link.
+func createAccountToken(ctx context.Context, email, purpose string, ttl time.Duration) (string, error) {
+	token, err := newRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	_, err = accountTokensCollection.UpdateMany(ctx,
+		bson.M{"email": email, "purpose": purpose, "used_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"used_at": now}},
+	)
+	if err != nil {
+		return "", err
+	}
+	_, err = accountTokensCollection.InsertOne(ctx, AccountToken{
+		TokenHash: hashRefreshToken(token),
+		Email:     email,
+		Purpose:   purpose,
+		ExpiresAt: now.Add(ttl),
+		CreatedAt: now,
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+func consumeAccountToken(ctx context.Context, token, purpose string) (string, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", errInvalidAccountToken
+	}
+	now := time.Now()
+	var item AccountToken
+	err := accountTokensCollection.FindOneAndUpdate(ctx,
+		bson.M{
+			"token_hash": hashRefreshToken(token),
+			"purpose":    purpose,
+			"used_at":    bson.M{"$exists": false},
+			"expires_at": bson.M{"$gt": now},
+		},
+		bson.M{"$set": bson.M{"used_at": now}},
+	).Decode(&item)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", errInvalidAccountToken
+	}
+	if err != nil {
+		return "", err
+	}
+	return item.Email, nil
+}
+
+// lookupAccountToken proverava token bez trosenja, za tokove u kojima se
+// token potrosi tek kada i ostatak zahteva prodje proveru.
+func lookupAccountToken(ctx context.Context, token, purpose string) (string, error) {
+	token = strings.TrimSpace(token)
+	if token == "" {
+		return "", errInvalidAccountToken
+	}
+	var item AccountToken
+	err := accountTokensCollection.FindOne(ctx, bson.M{
+		"token_hash": hashRefreshToken(token),
+		"purpose":    purpose,
+		"used_at":    bson.M{"$exists": false},
+		"expires_at": bson.M{"$gt": time.Now()},
+	}).Decode(&item)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return "", errInvalidAccountToken
+	}
+	if err != nil {
+		return "", err
+	}
+	return item.Email, nil
+}
+
+func markEmailVerified(ctx context.Context, email string) error {
+	_, err := usersCollection.UpdateOne(ctx, bson.M{"email": email}, bson.M{"$set": bson.M{"email_verified": true, "updated_at": time.Now()}})
+	return err
+}
+
+func ensureAccountTokenIndexes(ctx context.Context) {
+	_, err := accountTokensCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "email", Value: 1}, {Key: "purpose", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("Account tokens index warning: %v", err)
+	}
+}
+
+// ensureEmailVerificationMigration oznacava naloge nastale pre uvodjenja
+// verifikacije kao potvrdjene, da postojeci korisnici ne bi bili blokirani.
+func ensureEmailVerificationMigration(ctx context.Context) {
+	_, err := usersCollection.UpdateMany(ctx, bson.M{"email_verified": bson.M{"$exists": false}}, bson.M{"$set": bson.M{"email_verified": true}})
+	if err != nil {
+		log.Printf("Users email verification migration warning: %v", err)
+	}
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestAccountTokenLifecycle(t *testing.T) {
+	ctx := testMongo(t)
+	const email = "roditelj@example.com"
+
+	first, err := createAccountToken(ctx, email, tokenPurposeReset, time.Hour)
+	if err != nil {
+		t.Fatalf("createAccountToken: %v", err)
+	}
+	if got, err := lookupAccountToken(ctx, first, tokenPurposeReset); err != nil || got != email {
+		t.Fatalf("lookupAccountToken = (%q, %v), want (%q, nil)", got, err, email)
+	}
+	if _, err := consumeAccountToken(ctx, first, tokenPurposeVerify); !errors.Is(err, errInvalidAccountToken) {
+		t.Fatalf("token druge namene: err = %v, want errInvalidAccountToken", err)
+	}
+
+	// Novi token iste namene ponistava prethodni.
+	second, err := createAccountToken(ctx, email, tokenPurposeReset, time.Hour)
+	if err != nil {
+		t.Fatalf("createAccountToken: %v", err)
+	}
+	if _, err := consumeAccountToken(ctx, first, tokenPurposeReset); !errors.Is(err, errInvalidAccountToken) {
+		t.Fatalf("ponisten token: err = %v, want errInvalidAccountToken", err)
+	}
+	if got, err := consumeAccountToken(ctx, second, tokenPurposeReset); err != nil || got != email {
+		t.Fatalf("consumeAccountToken = (%q, %v), want (%q, nil)", got, err, email)
+	}
+	if _, err := consumeAccountToken(ctx, second, tokenPurposeReset); !errors.Is(err, errInvalidAccountToken) {
+		t.Fatalf("ponovna upotreba: err = %v, want errInvalidAccountToken", err)
+	}
+
+	expired, err := createAccountToken(ctx, email, tokenPurposeVerify, -time.Minute)
+	if err != nil {
+		t.Fatalf("createAccountToken: %v", err)
+	}
+	if _, err := lookupAccountToken(ctx, expired, tokenPurposeVerify); !errors.Is(err, errInvalidAccountToken) {
+		t.Fatalf("istekao token (lookup): err = %v, want errInvalidAccountToken", err)
+	}
+	if _, err := consumeAccountToken(ctx, expired, tokenPurposeVerify); !errors.Is(err, errInvalidAccountToken) {
+		t.Fatalf("istekao token: err = %v, want errInvalidAccountToken", err)
+	}
+	if _, err := consumeAccountToken(ctx, "  ", tokenPurposeVerify); !errors.Is(err, errInvalidAccountToken) {
+		t.Fatalf("prazan token: err = %v, want errInvalidAccountToken", err)
+	}
+}
+
+func TestVerifyEmailConsumesTokenOnlyOnPost(t *testing.T) {
+	ctx := testMongo(t)
+	user := &User{Email: "roditelj@example.com", Role: "roditelj", CreatedAt: time.Now()}
+	if _, err := usersCollection.InsertOne(ctx, user); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	token, err := createAccountToken(ctx, user.Email, tokenPurposeVerify, time.Hour)
+	if err != nil {
+		t.Fatalf("createAccountToken: %v", err)
+	}
+
+	// Skener linkova moze otvoriti link vise puta.
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handleVerifyEmail(rec, httptest.NewRequest(http.MethodGet, "/auth/verify-email?token="+url.QueryEscape(token), nil))
+		if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), `method="post"`) {
+			t.Fatalf("GET: status %d, body %q", rec.Code, rec.Body.String())
+		}
+	}
+	if got, _ := getUserByEmail(ctx, user.Email); got == nil || got.EmailVerified {
+		t.Fatalf("GET je potvrdio email adresu")
+	}
+
+	post := func() int {
+		req := httptest.NewRequest(http.MethodPost, "/auth/verify-email", strings.NewReader(url.Values{"token": {token}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		rec := httptest.NewRecorder()
+		handleVerifyEmail(rec, req)
+		return rec.Code
+	}
+	if code := post(); code != http.StatusOK {
+		t.Fatalf("POST: status %d, want 200", code)
+	}
+	if got, err := getUserByEmail(ctx, user.Email); err != nil || !got.EmailVerified {
+		t.Fatalf("email nije potvrdjen posle POST-a: %v", err)
+	}
+	if code := post(); code != http.StatusBadRequest {
+		t.Fatalf("ponovljen POST: status %d, want 400", code)
+	}
+}
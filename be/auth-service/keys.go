@@ -0,0 +1,281 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"log"
+	"math/big"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Tokeni se potpisuju RS256 kljucem iz kolekcije signing_keys. Aktivan je
+// uvek najnoviji kljuc, a prethodni ostaju objavljeni u JWKS dok ne isteknu
+// svi tokeni koje su potpisali, pa drugi servisi mogu samo da proveravaju
+// tokene, ne i da ih izdaju.
+type SigningKey struct {
+	KID        string     `bson:"kid"`
+	Algorithm  string     `bson:"algorithm"`
+	PrivatePEM string     `bson:"private_pem"`
+	CreatedAt  time.Time  `bson:"created_at"`
+	RetiredAt  *time.Time `bson:"retired_at,omitempty"`
+
+	privateKey *rsa.PrivateKey
+}
+
+type JWK struct {
+	KTY string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	KID string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+const (
+	signingKeyBits     = 2048
+	keyRefreshInterval = 5 * time.Minute
+)
+
+var signingKeysCollection *mongo.Collection
+
+var keyStore = struct {
+	sync.RWMutex
+	active *SigningKey
+	byKID  map[string]*SigningKey
+}{byKID: map[string]*SigningKey{}}
+
+func init() {
+	http.HandleFunc("/.well-known/jwks.json", func(w http.ResponseWriter, r *http.Request) {
+		enableCORS(w)
+		if r.Method == http.MethodOptions {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", "public, max-age=300")
+		json.NewEncoder(w).Encode(currentJWKS())
+	})
+}
+
+func keyRotationInterval() time.Duration {
+	d, err := time.ParseDuration(getenvDefault("JWT_KEY_ROTATION", "720h"))
+	if err != nil || d <= 0 {
+		return 30 * 24 * time.Hour
+	}
+	return d
+}
+
+func initSigningKeys(ctx context.Context) {
+	_, err := signingKeysCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "kid", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("Signing keys index warning: %v", err)
+	}
+
+	if err := rotateSigningKeyIfNeeded(ctx); err != nil {
+		log.Fatalf("Signing key error: %v", err)
+	}
+
+	go func() {
+		ticker := time.NewTicker(keyRefreshInterval)
+		defer ticker.Stop()
+		for range ticker.C {
+			ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+			if err := rotateSigningKeyIfNeeded(ctx); err != nil {
+				log.Printf("Signing key rotation warning: %v", err)
+			}
+			cancel()
+		}
+	}()
+}
+
+// rotateSigningKeyIfNeeded ucitava kljuceve iz baze, pravi novi kada je
+// aktivni stariji od JWT_KEY_ROTATION i penzionise stare kljuceve kada vise
+// ne mogu postojati vazeci tokeni potpisani njima.
+func rotateSigningKeyIfNeeded(ctx context.Context) error {
+	keys, err := loadSigningKeys(ctx)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	if len(keys) == 0 || now.Sub(keys[0].CreatedAt) >= keyRotationInterval() {
+		key, err := generateSigningKey(ctx)
+		if err != nil {
+			return err
+		}
+		log.Printf("Generated new signing key %s", key.KID)
+		keys = append([]*SigningKey{key}, keys...)
+	}
+
+	active := keys[0]
+	for _, key := range keys[1:] {
+		if key.RetiredAt == nil {
+			retiredAt := now
+			key.RetiredAt = &retiredAt
+			_, err := signingKeysCollection.UpdateOne(ctx, bson.M{"kid": key.KID}, bson.M{"$set": bson.M{"retired_at": retiredAt}})
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	byKID := map[string]*SigningKey{active.KID: active}
+	for _, key := range keys[1:] {
+		if now.Sub(*key.RetiredAt) < accessTokenTTL {
+			byKID[key.KID] = key
+		}
+	}
+
+	keyStore.Lock()
+	keyStore.active = active
+	keyStore.byKID = byKID
+	keyStore.Unlock()
+	return nil
+}
+
+func loadSigningKeys(ctx context.Context) ([]*SigningKey, error) {
+	cursor, err := signingKeysCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	keys := make([]*SigningKey, 0)
+	for cursor.Next(ctx) {
+		var key SigningKey
+		if err := cursor.Decode(&key); err != nil {
+			return nil, err
+		}
+		if err := key.parse(); err != nil {
+			log.Printf("Signing key %s warning: %v", key.KID, err)
+			continue
+		}
+		keys = append(keys, &key)
+	}
+	return keys, cursor.Err()
+}
+
+func generateSigningKey(ctx context.Context) (*SigningKey, error) {
+	privateKey, err := rsa.GenerateKey(rand.Reader, signingKeyBits)
+	if err != nil {
+		return nil, err
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(privateKey)
+	if err != nil {
+		return nil, err
+	}
+	kidBytes := make([]byte, 8)
+	if _, err := rand.Read(kidBytes); err != nil {
+		return nil, err
+	}
+
+	key := &SigningKey{
+		KID:        hex.EncodeToString(kidBytes),
+		Algorithm:  jwt.SigningMethodRS256.Alg(),
+		PrivatePEM: string(pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})),
+		CreatedAt:  time.Now(),
+		privateKey: privateKey,
+	}
+	if _, err := signingKeysCollection.InsertOne(ctx, key); err != nil {
+		return nil, err
+	}
+	return key, nil
+}
+
+func (k *SigningKey) parse() error {
+	block, _ := pem.Decode([]byte(k.PrivatePEM))
+	if block == nil {
+		return errors.New("neispravan PEM")
+	}
+	parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return err
+	}
+	privateKey, ok := parsed.(*rsa.PrivateKey)
+	if !ok {
+		return errors.New("kljuc nije RSA")
+	}
+	k.privateKey = privateKey
+	return nil
+}
+
+func activeSigningKey() (*SigningKey, error) {
+	keyStore.RLock()
+	defer keyStore.RUnlock()
+	if keyStore.active == nil {
+		return nil, errors.New("Nema aktivnog kljuca za potpisivanje")
+	}
+	return keyStore.active, nil
+}
+
+func signClaims(claims jwt.MapClaims) (string, error) {
+	key, err := activeSigningKey()
+	if err != nil {
+		return "", err
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = key.KID
+	return token.SignedString(key.privateKey)
+}
+
+func verificationKey(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, errors.New("Neispravan algoritam")
+	}
+	kid, _ := token.Header["kid"].(string)
+
+	keyStore.RLock()
+	defer keyStore.RUnlock()
+	key, ok := keyStore.byKID[kid]
+	if !ok {
+		return nil, errors.New("Nepoznat kljuc")
+	}
+	return &key.privateKey.PublicKey, nil
+}
+
+func currentJWKS() JWKSet {
+	keyStore.RLock()
+	defer keyStore.RUnlock()
+
+	set := JWKSet{Keys: make([]JWK, 0, len(keyStore.byKID))}
+	for _, key := range keyStore.byKID {
+		pub := key.privateKey.PublicKey
+		set.Keys = append(set.Keys, JWK{
+			KTY: "RSA",
+			Use: "sig",
+			Alg: key.Algorithm,
+			KID: key.KID,
+			N:   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		})
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].KID < set.Keys[j].KID })
+	return set
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"context"
+	"log"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Neuspesne prijave se broje posebno po email adresi i po IP adresi.
+// Posle praga slobodnih pokusaja svaki sledeci neuspeh zakljucava kljuc
+// na eksponencijalno duze vreme (loginBaseLockout * 2^n, najvise
+// loginMaxLockout). Brojaci su u Mongu da prezive restart servisa.
+type LoginAttempt struct {
+	Key         string     `bson:"key"`
+	Failures    int        `bson:"failures"`
+	LastFailure time.Time  `bson:"last_failure"`
+	LockedUntil *time.Time `bson:"locked_until,omitempty"`
+	ExpiresAt   time.Time  `bson:"expires_at"`
+}
+
+type AuditEvent struct {
+	Type      string    `bson:"type"`
+	Email     string    `bson:"email,omitempty"`
+	IP        string    `bson:"ip,omitempty"`
+	Details   bson.M    `bson:"details,omitempty"`
+	CreatedAt time.Time `bson:"created_at"`
+}
+
+const (
+	loginEmailFreeAttempts = 5
+	loginIPFreeAttempts    = 20
+	loginBaseLockout       = 30 * time.Second
+	loginMaxLockout        = 30 * time.Minute
+	loginAttemptsWindow    = 24 * time.Hour
+)
+
+var loginAttemptsCollection *mongo.Collection
+var auditCollection *mongo.Collection
+
+func emailAttemptKey(email string) string {
+	return "email:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipAttemptKey(ip string) string {
+	return "ip:" + ip
+}
+
+// loginRetryAfter vraca koliko jos treba cekati ako je email ili IP
+// trenutno zakljucan, odnosno 0 ako je prijava dozvoljena.
+func loginRetryAfter(ctx context.Context, email, ip string) (time.Duration, error) {
+	cursor, err := loginAttemptsCollection.Find(ctx, bson.M{
+		"key":          bson.M{"$in": []string{emailAttemptKey(email), ipAttemptKey(ip)}},
+		"locked_until": bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return 0, err
+	}
+	defer cursor.Close(ctx)
+
+	var wait time.Duration
+	for cursor.Next(ctx) {
+		var item LoginAttempt
+		if err := cursor.Decode(&item); err != nil {
+			return 0, err
+		}
+		if d := time.Until(*item.LockedUntil); d > wait {
+			wait = d
+		}
+	}
+	return wait, cursor.Err()
+}
+
+func recordLoginFailure(ctx context.Context, email, ip string) {
+	if until, locked := registerFailure(ctx, emailAttemptKey(email), loginEmailFreeAttempts); locked {
+		recordAuditEvent(ctx, AuditEvent{
+			Type:    "account_locked",
+			Email:   strings.ToLower(strings.TrimSpace(email)),
+			IP:      ip,
+			Details: bson.M{"locked_until": until},
+		})
+	}
+	if until, locked := registerFailure(ctx, ipAttemptKey(ip), loginIPFreeAttempts); locked {
+		recordAuditEvent(ctx, AuditEvent{
+			Type:    "ip_locked",
+			IP:      ip,
+			Details: bson.M{"locked_until": until},
+		})
+	}
+}
+
+// Uspesna prijava brise brojac za email, ali ne i za IP, da napadac sa
+// sopstvenim nalogom ne bi mogao da resetuje IP ogranicenje.
+func recordLoginSuccess(ctx context.Context, email string) {
+	if _, err := loginAttemptsCollection.DeleteOne(ctx, bson.M{"key": emailAttemptKey(email)}); err != nil {
+		log.Printf("Login attempts reset warning: %v", err)
+	}
+}
+
+func registerFailure(ctx context.Context, key string, freeAttempts int) (time.Time, bool) {
+	now := time.Now()
+	var item LoginAttempt
+	err := loginAttemptsCollection.FindOneAndUpdate(ctx,
+		bson.M{"key": key},
+		bson.M{
+			"$inc": bson.M{"failures": 1},
+			"$set": bson.M{"last_failure": now, "expires_at": now.Add(loginAttemptsWindow)},
+		},
+		options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After),
+	).Decode(&item)
+	if err != nil {
+		log.Printf("Login attempts warning for %s: %v", key, err)
+		return time.Time{}, false
+	}
+	if item.Failures < freeAttempts {
+		return time.Time{}, false
+	}
+
+	// $max: istovremeni neuspeh sa manjim brojem pokusaja ne sme da skrati
+	// zakljucavanje koje je drugi zahtev vec produzio.
+	until := now.Add(lockoutDuration(item.Failures - freeAttempts))
+	_, err = loginAttemptsCollection.UpdateOne(ctx, bson.M{"key": key}, bson.M{"$max": bson.M{"locked_until": until}})
+	if err != nil {
+		log.Printf("Login attempts warning for %s: %v", key, err)
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+func lockoutDuration(step int) time.Duration {
+	if step > 16 {
+		return loginMaxLockout
+	}
+	d := time.Duration(float64(loginBaseLockout) * math.Pow(2, float64(step)))
+	if d > loginMaxLockout {
+		return loginMaxLockout
+	}
+	return d
+}
+
+func writeThrottled(w http.ResponseWriter, wait time.Duration) {
+	seconds := int(math.Ceil(wait.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	http.Error(w, "Previse neuspesnih pokusaja prijave. Pokusajte ponovo kasnije.", http.StatusTooManyRequests)
+}
+
+// clientIP koristi X-Forwarded-For samo kada je TRUST_PROXY ukljucen,
+// inace bi klijent mogao sam da bira IP pod kojim se broji.
+func clientIP(r *http.Request) string {
+	if getenvDefault("TRUST_PROXY", "false") == "true" {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			return strings.TrimSpace(strings.Split(forwarded, ",")[0])
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func recordAuditEvent(ctx context.Context, event AuditEvent) {
+	event.CreatedAt = time.Now()
+	if _, err := auditCollection.InsertOne(ctx, event); err != nil {
+		log.Printf("Audit event warning (%s): %v", event.Type, err)
+	}
+}
+
+func ensureLoginAttemptIndexes(ctx context.Context) {
+	_, err := loginAttemptsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "key", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("Login attempts index warning: %v", err)
+	}
+
+	_, err = auditCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "type", Value: 1}, {Key: "created_at", Value: -1}}},
+		{Keys: bson.D{{Key: "email", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Audit index warning: %v", err)
+	}
+}
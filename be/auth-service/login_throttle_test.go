@@ -0,0 +1,92 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestLockoutDuration(t *testing.T) {
+	tests := []struct {
+		step int
+		want time.Duration
+	}{
+		{0, loginBaseLockout},
+		{1, 2 * loginBaseLockout},
+		{3, 8 * loginBaseLockout},
+		{5, 32 * loginBaseLockout},
+		{6, loginMaxLockout},
+		{16, loginMaxLockout},
+		{17, loginMaxLockout},
+		{1000, loginMaxLockout},
+	}
+	for _, tt := range tests {
+		if got := lockoutDuration(tt.step); got != tt.want {
+			t.Errorf("lockoutDuration(%d) = %v, want %v", tt.step, got, tt.want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	tests := []struct {
+		name       string
+		trustProxy string
+		remoteAddr string
+		forwarded  string
+		want       string
+	}{
+		{"bez proksija", "false", "10.0.0.5:4431", "", "10.0.0.5"},
+		{"lazni X-Forwarded-For se ignorise", "false", "10.0.0.5:4431", "1.2.3.4", "10.0.0.5"},
+		{"TRUST_PROXY nije postavljen", "", "10.0.0.5:4431", "1.2.3.4", "10.0.0.5"},
+		{"proksi", "true", "172.18.0.2:80", "203.0.113.7", "203.0.113.7"},
+		{"proksi lanac", "true", "172.18.0.2:80", " 203.0.113.7 , 172.18.0.9", "203.0.113.7"},
+		{"proksi bez zaglavlja", "true", "172.18.0.2:80", "", "172.18.0.2"},
+		{"IPv6", "false", "[2001:db8::1]:4431", "", "2001:db8::1"},
+		{"adresa bez porta", "false", "10.0.0.5", "", "10.0.0.5"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("TRUST_PROXY", tt.trustProxy)
+			r := httptest.NewRequest("POST", "/auth/login", nil)
+			r.RemoteAddr = tt.remoteAddr
+			if tt.forwarded != "" {
+				r.Header.Set("X-Forwarded-For", tt.forwarded)
+			}
+			if got := clientIP(r); got != tt.want {
+				t.Fatalf("clientIP = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRegisterFailureNeverShortensLock(t *testing.T) {
+	ctx := testMongo(t)
+	const key = "email:roditelj@example.com"
+
+	for i := 1; i < loginEmailFreeAttempts; i++ {
+		if _, locked := registerFailure(ctx, key, loginEmailFreeAttempts); locked {
+			t.Fatalf("pokusaj %d: zakljucano pre praga", i)
+		}
+	}
+	until, locked := registerFailure(ctx, key, loginEmailFreeAttempts)
+	if !locked || time.Until(until) > loginBaseLockout {
+		t.Fatalf("registerFailure = (%v, %v), want zakljucavanje od %v", until, locked, loginBaseLockout)
+	}
+
+	// Drugi zahtev je u medjuvremenu produzio zakljucavanje.
+	later := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	if _, err := loginAttemptsCollection.UpdateOne(ctx, bson.M{"key": key}, bson.M{"$set": bson.M{"locked_until": later}}); err != nil {
+		t.Fatal(err)
+	}
+	registerFailure(ctx, key, loginEmailFreeAttempts)
+
+	var item LoginAttempt
+	if err := loginAttemptsCollection.FindOne(ctx, bson.M{"key": key}).Decode(&item); err != nil {
+		t.Fatal(err)
+	}
+	if item.LockedUntil == nil || !item.LockedUntil.Equal(later) {
+		t.Fatalf("locked_until = %v, want %v", item.LockedUntil, later)
+	}
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/smtp"
+	"os"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Mailer salje sistemske poruke (verifikacija naloga, reset lozinke).
+// MAIL_DRIVER bira implementaciju: "smtp" za pravi ili lazni SMTP server
+// (npr. MailHog), "file" za upis u MAIL_FILE i "log" za razvoj. Bez
+// podesenog drajvera poruke se ne salju. U log nikada ne ide link sa
+// tokenom, jer bi svako sa pristupom logovima mogao da preuzme nalog.
+type Mailer interface {
+	Send(ctx context.Context, to, subject, body string) error
+}
+
+type SMTPMailer struct {
+	Addr     string
+	From     string
+	Username string
+	Password string
+}
+
+type FileMailer struct {
+	Path string
+
+	mu sync.Mutex
+}
+
+// LogMailer je drajver za razvoj: loguje poruku sa skrivenim tokenima.
+type LogMailer struct{}
+
+// NoopMailer se koristi kada MAIL_DRIVER nije podesen.
+type NoopMailer struct{}
+
+var mailer Mailer
+
+func initMailer() {
+	switch driver := strings.ToLower(strings.TrimSpace(os.Getenv("MAIL_DRIVER"))); driver {
+	case "smtp":
+		mailer = &SMTPMailer{
+			Addr:     getenvDefault("SMTP_ADDR", "localhost:1025"),
+			From:     getenvDefault("SMTP_FROM", "no-reply@euprava.local"),
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+		}
+	case "file":
+		mailer = &FileMailer{Path: getenvDefault("MAIL_FILE", "mail.log")}
+	case "log":
+		log.Print("MAIL_DRIVER=log: poruke se samo loguju, koristiti samo za razvoj")
+		mailer = LogMailer{}
+	default:
+		if driver != "" {
+			log.Printf("Nepoznat MAIL_DRIVER %q, poruke se ne salju", driver)
+		} else {
+			log.Print("MAIL_DRIVER nije podesen, poruke se ne salju")
+		}
+		mailer = NoopMailer{}
+	}
+}
+
+func (m *SMTPMailer) Send(ctx context.Context, to, subject, body string) error {
+	var auth smtp.Auth
+	if m.Username != "" {
+		host := m.Addr
+		if i := strings.LastIndex(host, ":"); i >= 0 {
+			host = host[:i]
+		}
+		auth = smtp.PlainAuth("", m.Username, m.Password, host)
+	}
+
+	msg := strings.Join([]string{
+		"From: " + m.From,
+		"To: " + to,
+		"Subject: " + subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		body,
+	}, "\r\n")
+
+	done := make(chan error, 1)
+	go func() {
+		done <- smtp.SendMail(m.Addr, auth, m.From, []string{to}, []byte(msg))
+	}()
+	select {
+	case err := <-done:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (m *FileMailer) Send(_ context.Context, to, subject, body string) error {
+	entry := fmt.Sprintf("[%s] To: %s\nSubject: %s\n\n%s\n\n", time.Now().Format(time.RFC3339), to, subject, body)
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	f, err := os.OpenFile(m.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	_, err = f.WriteString(entry)
+	return err
+}
+
+func (LogMailer) Send(_ context.Context, to, subject, body string) error {
+	log.Printf("Mail: To: %s\nSubject: %s\n\n%s", to, subject, redactTokens(body))
+	return nil
+}
+
+func (NoopMailer) Send(_ context.Context, to, subject, _ string) error {
+	log.Printf("Mail nije poslat (MAIL_DRIVER nije podesen): To: %s, Subject: %s", to, subject)
+	return nil
+}
+
+var tokenParamPattern = regexp.MustCompile(`(?i)(\b[a-z_]*token=)[^\s&"'<>]+`)
+
+// redactTokens skriva vrednosti token parametara u linkovima.
+func redactTokens(body string) string {
+	return tokenParamPattern.ReplaceAllString(body, "${1}[skriveno]")
+}
+
+func sendMail(ctx context.Context, to, subject, body string) {
+	if mailer == nil {
+		initMailer()
+	}
+	if err := mailer.Send(ctx, to, subject, body); err != nil {
+		log.Printf("Mail warning for %s: %v", to, err)
+	}
+}
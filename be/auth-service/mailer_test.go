@@ -0,0 +1,46 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRedactTokens(t *testing.T) {
+	tests := []struct {
+		name string
+		body string
+		want string
+	}{
+		{
+			name: "verifikacija",
+			body: "Link:\nhttp://localhost:8083/auth/verify-email?token=abcDEF-123_x\nHvala",
+			want: "Link:\nhttp://localhost:8083/auth/verify-email?token=[skriveno]\nHvala",
+		},
+		{
+			name: "reset lozinke",
+			body: "http://localhost:5500/login.html?reset_token=Zx9-_q (vazi 1 sat)",
+			want: "http://localhost:5500/login.html?reset_token=[skriveno] (vazi 1 sat)",
+		},
+		{
+			name: "ostali parametri ostaju",
+			body: "https://x/?a=1&token=tajna&b=2",
+			want: "https://x/?a=1&token=[skriveno]&b=2",
+		},
+		{
+			name: "bez tokena",
+			body: "Dobrodosli na E-Uprava portal.",
+			want: "Dobrodosli na E-Uprava portal.",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := redactTokens(tt.body)
+			if got != tt.want {
+				t.Fatalf("redactTokens = %q, want %q", got, tt.want)
+			}
+			if strings.Contains(got, "tajna") {
+				t.Fatalf("token je ostao u logu: %q", got)
+			}
+		})
+	}
+}
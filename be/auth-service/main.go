@@ -10,6 +10,7 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -21,11 +22,22 @@ import (
 )
 
 type User struct {
-	ID           primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Email        string             `json:"email" bson:"email"`
-	Role         string             `json:"role" bson:"role"`
-	PasswordHash string             `json:"-" bson:"password_hash"`
-	CreatedAt    time.Time          `json:"created_at" bson:"created_at"`
+	ID                    primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Email                 string             `json:"email" bson:"email"`
+	Role                  string             `json:"role" bson:"role"`
+	VrticIDs              []string           `json:"vrtic_ids,omitempty" bson:"vrtic_ids,omitempty"`
+	PasswordHash          string             `json:"-" bson:"password_hash"`
+	PasswordResetRequired bool               `json:"password_reset_required" bson:"password_reset_required,omitempty"`
+	EmailVerified         bool               `json:"email_verified" bson:"email_verified"`
+	TOTPEnabled           bool               `json:"two_factor_enabled" bson:"totp_enabled,omitempty"`
+	TOTPSecret            string             `json:"-" bson:"totp_secret,omitempty"`
+	TOTPPendingSecret     string             `json:"-" bson:"totp_pending_secret,omitempty"`
+	TOTPLastStep          int64              `json:"-" bson:"totp_last_step,omitempty"`
+	TOTPRecoveryCodes     []string           `json:"-" bson:"totp_recovery_codes,omitempty"`
+	Disabled              bool               `json:"disabled" bson:"disabled,omitempty"`
+	DisabledAt            *time.Time         `json:"disabled_at,omitempty" bson:"disabled_at,omitempty"`
+	CreatedAt             time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt             *time.Time         `json:"updated_at,omitempty" bson:"updated_at,omitempty"`
 }
 
 type RegisterRequest struct {
@@ -40,23 +52,32 @@ type LoginRequest struct {
 }
 
 type AuthResponse struct {
-	AccessToken string `json:"access_token"`
-	TokenType   string `json:"token_type"`
-	ExpiresIn   int64  `json:"expires_in"`
-	Email       string `json:"email"`
-	Role        string `json:"role"`
+	AccessToken      string `json:"access_token"`
+	TokenType        string `json:"token_type"`
+	ExpiresIn        int64  `json:"expires_in"`
+	RefreshToken     string `json:"refresh_token,omitempty"`
+	RefreshExpiresIn int64  `json:"refresh_expires_in,omitempty"`
+	Email            string `json:"email"`
+	Role             string `json:"role"`
 }
 
 type ProfileResponse struct {
-	Email     string    `json:"email"`
-	Role      string    `json:"role"`
-	CreatedAt time.Time `json:"created_at"`
+	Email            string    `json:"email"`
+	Role             string    `json:"role"`
+	VrticIDs         []string  `json:"vrtic_ids,omitempty"`
+	EmailVerified    bool      `json:"email_verified"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	CreatedAt        time.Time `json:"created_at"`
 }
 
 type UserListItem struct {
-	Email     string    `json:"email"`
-	Role      string    `json:"role"`
-	CreatedAt time.Time `json:"created_at"`
+	ID                    primitive.ObjectID `json:"id"`
+	Email                 string             `json:"email"`
+	Role                  string             `json:"role"`
+	VrticIDs              []string           `json:"vrtic_ids,omitempty"`
+	Status                string             `json:"status"`
+	PasswordResetRequired bool               `json:"password_reset_required"`
+	CreatedAt             time.Time          `json:"created_at"`
 }
 
 var usersCollection *mongo.Collection
@@ -90,10 +111,15 @@ func main() {
 			return
 		}
 
-		if err := registerUser(r.Context(), req.Email, req.Password, "roditelj"); err != nil {
+		if err := insertUser(r.Context(), req.Email, req.Password, "roditelj", newUserOptions{}); err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		if user, err := getUserByEmail(r.Context(), req.Email); err == nil {
+			if err := sendVerificationMail(r.Context(), user); err != nil {
+				log.Printf("Verification mail warning for %s: %v", user.Email, err)
+			}
+		}
 
 		w.WriteHeader(http.StatusCreated)
 	})
@@ -115,26 +141,48 @@ func main() {
 			return
 		}
 
+		ip := clientIP(r)
+		wait, err := loginRetryAfter(r.Context(), req.Email, ip)
+		if err != nil {
+			http.Error(w, "Greska pri proveri prijave", http.StatusInternalServerError)
+			return
+		}
+		if wait > 0 {
+			writeThrottled(w, wait)
+			return
+		}
+
 		user, err := authenticate(r.Context(), req.Email, req.Password)
 		if err != nil {
+			if errors.Is(err, errUserDisabled) || errors.Is(err, errPasswordResetRequired) {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
+			recordLoginFailure(r.Context(), req.Email, ip)
 			http.Error(w, "Neispravni kredencijali", http.StatusUnauthorized)
 			return
 		}
+		recordLoginSuccess(r.Context(), user.Email)
 
-		token, exp, err := issueToken(user.Email, user.Role)
+		challenge, err := loginChallenge(r.Context(), user)
+		if err != nil {
+			http.Error(w, "Greska pri generisanju tokena", http.StatusInternalServerError)
+			return
+		}
+		if challenge != nil {
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(challenge)
+			return
+		}
+
+		resp, err := startSession(r.Context(), user)
 		if err != nil {
 			http.Error(w, "Greska pri generisanju tokena", http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
-		json.NewEncoder(w).Encode(AuthResponse{
-			AccessToken: token,
-			TokenType:   "Bearer",
-			ExpiresIn:   exp,
-			Email:       user.Email,
-			Role:        user.Role,
-		})
+		json.NewEncoder(w).Encode(resp)
 	})
 
 	http.HandleFunc("/auth/profile", func(w http.ResponseWriter, r *http.Request) {
@@ -168,9 +216,12 @@ func main() {
 
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(ProfileResponse{
-			Email:     user.Email,
-			Role:      user.Role,
-			CreatedAt: user.CreatedAt,
+			Email:            user.Email,
+			Role:             user.Role,
+			VrticIDs:         user.VrticIDs,
+			EmailVerified:    user.EmailVerified,
+			TwoFactorEnabled: user.TOTPEnabled,
+			CreatedAt:        user.CreatedAt,
 		})
 	})
 
@@ -180,7 +231,7 @@ func main() {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
-		if r.Method != http.MethodGet {
+		if r.Method != http.MethodGet && r.Method != http.MethodPost {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
@@ -196,18 +247,28 @@ func main() {
 			return
 		}
 
-		roleFilter := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("role")))
-		filter := bson.M{}
-		if roleFilter != "" {
-			filter["role"] = roleFilter
+		if r.Method == http.MethodPost {
+			handleCreateUser(w, r)
+			return
+		}
+
+		query, err := parseUserListQuery(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
-		items, err := listUsers(r.Context(), filter)
+		items, total, err := listUsersPage(r.Context(), query)
 		if err != nil {
 			http.Error(w, "Greska pri citanju korisnika", http.StatusInternalServerError)
 			return
 		}
 
 		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("X-Total-Count", strconv.FormatInt(total, 10))
+		if query.PageSize > 0 {
+			w.Header().Set("X-Page", strconv.Itoa(query.Page))
+			w.Header().Set("X-Page-Size", strconv.Itoa(query.PageSize))
+		}
 		json.NewEncoder(w).Encode(items)
 	})
 
@@ -224,18 +285,31 @@ func normalizeRole(role string) (string, error) {
 		return "admin", nil
 	case "vaspitac":
 		return "vaspitac", nil
+	case "direktor":
+		return "direktor", nil
 	default:
-		return "", errors.New("Neispravna rola (roditelj, admin, vaspitac)")
+		return "", errors.New("Neispravna rola (roditelj, admin, vaspitac, direktor)")
 	}
 }
 
+type newUserOptions struct {
+	ResetRequired bool
+	EmailVerified bool
+	VrticIDs      []string
+}
+
+// registerUser se koristi za seed naloge, koji su unapred potvrdjeni.
 func registerUser(ctx context.Context, email, password, role string) error {
+	return insertUser(ctx, email, password, role, newUserOptions{EmailVerified: true})
+}
+
+func insertUser(ctx context.Context, email, password, role string, opts newUserOptions) error {
 	email = strings.TrimSpace(strings.ToLower(email))
 	if email == "" || password == "" {
 		return errors.New("Email i lozinka su obavezni")
 	}
-	if len(password) < 6 {
-		return errors.New("Lozinka mora imati najmanje 6 karaktera")
+	if err := validatePassword(password); err != nil {
+		return err
 	}
 
 	exists, err := usersCollection.CountDocuments(ctx, bson.M{"email": email})
@@ -246,85 +320,126 @@ func registerUser(ctx context.Context, email, password, role string) error {
 		return errors.New("Korisnik vec postoji")
 	}
 
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+
 	_, err = usersCollection.InsertOne(ctx, User{
-		Email:        email,
-		Role:         role,
-		PasswordHash: hashPassword(email, password),
-		CreatedAt:    time.Now(),
+		Email:                 email,
+		Role:                  role,
+		VrticIDs:              opts.VrticIDs,
+		PasswordHash:          hash,
+		PasswordResetRequired: opts.ResetRequired,
+		EmailVerified:         opts.EmailVerified,
+		CreatedAt:             time.Now(),
 	})
 	return err
 }
 
+func validatePassword(password string) error {
+	if len(password) < 6 {
+		return errors.New("Lozinka mora imati najmanje 6 karaktera")
+	}
+	if len(password) > maxPasswordLength {
+		return errors.New("Lozinka moze imati najvise 72 karaktera")
+	}
+	return nil
+}
+
+// authenticate proverava kredencijale za prijavu; nalog kome je admin
+// resetovao lozinku mora prvo da je promeni preko /auth/change-password.
 func authenticate(ctx context.Context, email, password string) (*User, error) {
-	email = strings.TrimSpace(strings.ToLower(email))
-	var user User
-	if err := usersCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
+	user, err := verifyCredentials(ctx, email, password)
+	if err != nil {
 		return nil, err
 	}
-	if user.PasswordHash != hashPassword(email, password) {
-		return nil, errors.New("pogresna lozinka")
+	if user.PasswordResetRequired {
+		return nil, errPasswordResetRequired
 	}
-	return &user, nil
+	return user, nil
 }
 
-func getUserByEmail(ctx context.Context, email string) (*User, error) {
+func verifyCredentials(ctx context.Context, email, password string) (*User, error) {
 	email = strings.TrimSpace(strings.ToLower(email))
 	var user User
 	if err := usersCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
 		return nil, err
 	}
+	ok, needsRehash := verifyPassword(user.PasswordHash, email, password)
+	if !ok {
+		return nil, errors.New("pogresna lozinka")
+	}
+	if user.Disabled {
+		return nil, errUserDisabled
+	}
+	if needsRehash {
+		rehashPassword(ctx, &user, password)
+	}
 	return &user, nil
 }
 
-func listUsers(ctx context.Context, filter bson.M) ([]UserListItem, error) {
-	cursor, err := usersCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "email", Value: 1}}))
+func rehashPassword(ctx context.Context, user *User, password string) {
+	hash, err := hashPassword(password)
 	if err != nil {
-		return nil, err
+		log.Printf("Password rehash warning for %s: %v", user.Email, err)
+		return
 	}
-	defer cursor.Close(ctx)
-
-	items := make([]UserListItem, 0)
-	for cursor.Next(ctx) {
-		var user User
-		if err := cursor.Decode(&user); err != nil {
-			return nil, err
-		}
-		items = append(items, UserListItem{
-			Email:     user.Email,
-			Role:      user.Role,
-			CreatedAt: user.CreatedAt,
-		})
+	_, err = usersCollection.UpdateOne(ctx, bson.M{"_id": user.ID, "password_hash": user.PasswordHash}, bson.M{"$set": bson.M{"password_hash": hash}})
+	if err != nil {
+		log.Printf("Password rehash warning for %s: %v", user.Email, err)
+		return
 	}
-	return items, cursor.Err()
+	user.PasswordHash = hash
 }
 
-func hashPassword(email, password string) string {
-	salt := getenvDefault("AUTH_SALT", "dev-salt")
-	val := sha256.Sum256([]byte(email + ":" + password + ":" + salt))
-	return hex.EncodeToString(val[:])
+func getUserByEmail(ctx context.Context, email string) (*User, error) {
+	email = strings.TrimSpace(strings.ToLower(email))
+	var user User
+	if err := usersCollection.FindOne(ctx, bson.M{"email": email}).Decode(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
-func issueToken(email, role string) (string, int64, error) {
-	secret := getenvDefault("JWT_SECRET", "dev-secret")
-	exp := time.Now().Add(2 * time.Hour).Unix()
+func issueToken(user *User, jti string) (string, int64, error) {
+	exp := time.Now().Add(accessTokenTTL).Unix()
 
 	claims := jwt.MapClaims{
-		"sub":  email,
-		"role": role,
-		"exp":  exp,
-		"iss":  "auth-service",
-		"aud":  "frontend",
-		"jti":  tokenID(email),
+		"sub":            user.Email,
+		"role":           user.Role,
+		"email_verified": user.EmailVerified,
+		"exp":            exp,
+		"iss":            accessTokenIssuer,
+		"aud":            accessTokenAudience,
+		"typ":            tokenTypeAccess,
+		"jti":            jti,
+	}
+	// Direktor upravlja samo svojim vrticima; preschool servis cita
+	// vrtic_ids claim pri proveri dozvola.
+	if len(user.VrticIDs) > 0 {
+		claims["vrtic_ids"] = user.VrticIDs
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	signed, err := token.SignedString([]byte(secret))
+	signed, err := signClaims(claims)
 	if err != nil {
 		return "", 0, err
 	}
 	return signed, exp, nil
 }
 
+// validateAccessClaims prihvata samo access tokene ovog servisa; id_token
+// i tokeni bez jti (koji ne mogu biti opozvani) se odbijaju.
+func validateAccessClaims(claims jwt.MapClaims) error {
+	if !claims.VerifyIssuer(accessTokenIssuer, true) || !claims.VerifyAudience(accessTokenAudience, true) {
+		return errors.New("Token nije izdat za ovaj servis")
+	}
+	if claimString(claims, "typ") != tokenTypeAccess || claimString(claims, "jti") == "" {
+		return errors.New("Neispravan tip tokena")
+	}
+	return nil
+}
+
 func tokenID(email string) string {
 	s := sha256.Sum256([]byte(email + time.Now().String()))
 	return hex.EncodeToString(s[:])
@@ -342,6 +457,14 @@ func claimString(claims jwt.MapClaims, key string) string {
 	return s
 }
 
+func claimExpiry(claims jwt.MapClaims) time.Time {
+	exp, ok := claims["exp"].(float64)
+	if !ok {
+		return time.Time{}
+	}
+	return time.Unix(int64(exp), 0)
+}
+
 func initMongo() {
 	uri := getenvDefault("MONGO_URI", "mongodb://mongo:27017")
 	dbName := getenvDefault("MONGO_DB", "euprava")
@@ -358,7 +481,17 @@ func initMongo() {
 		log.Fatalf("Mongo ping error: %v", err)
 	}
 
-	usersCollection = client.Database(dbName).Collection("users")
+	db := client.Database(dbName)
+	usersCollection = db.Collection("users")
+	sessionsCollection = db.Collection("sessions")
+	revokedTokensCollection = db.Collection("revoked_tokens")
+	signingKeysCollection = db.Collection("signing_keys")
+	accountTokensCollection = db.Collection("account_tokens")
+	loginAttemptsCollection = db.Collection("login_attempts")
+	auditCollection = db.Collection("audit_events")
+	oidcClientsCollection = db.Collection("oidc_clients")
+	oidcCodesCollection = db.Collection("oidc_codes")
+	oidcFormTokensCollection = db.Collection("oidc_form_tokens")
 
 	_, err = usersCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
 		Keys:    bson.D{{Key: "email", Value: 1}},
@@ -368,7 +501,14 @@ func initMongo() {
 		log.Printf("Users index warning: %v", err)
 	}
 
+	initSigningKeys(ctx)
+	initMailer()
+	ensureSessionIndexes(ctx)
+	ensureAccountTokenIndexes(ctx)
+	ensureLoginAttemptIndexes(ctx)
+	ensureOIDCIndexes(ctx)
 	ensureRoleMigration(ctx)
+	ensureEmailVerificationMigration(ctx)
 	ensureSeedUser(ctx)
 }
 
@@ -398,7 +538,6 @@ func ensureSeedUser(ctx context.Context) {
 }
 
 func requireAuth(r *http.Request) (jwt.MapClaims, error) {
-	secret := getenvDefault("JWT_SECRET", "dev-secret")
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
 		return nil, errors.New("Nedostaje Authorization header")
@@ -410,15 +549,21 @@ func requireAuth(r *http.Request) (jwt.MapClaims, error) {
 	}
 
 	claims := jwt.MapClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("Neispravan algoritam")
-		}
-		return []byte(secret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, verificationKey)
 	if err != nil || !token.Valid {
 		return nil, errors.New("Neispravan ili istekao token")
 	}
+	if err := validateAccessClaims(claims); err != nil {
+		return nil, err
+	}
+
+	revoked, err := isTokenRevoked(r.Context(), claimString(claims, "jti"))
+	if err != nil {
+		return nil, errors.New("Greska pri proveri tokena")
+	}
+	if revoked {
+		return nil, errors.New("Token je opozvan")
+	}
 
 	return claims, nil
 }
@@ -435,4 +580,5 @@ func enableCORS(w http.ResponseWriter) {
 	w.Header().Set("Access-Control-Allow-Origin", "*")
 	w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
 	w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+	w.Header().Set("Access-Control-Expose-Headers", "X-Total-Count, X-Page, X-Page-Size, Retry-After")
 }
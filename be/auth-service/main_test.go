@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/golang-jwt/jwt/v4"
+)
+
+func TestValidateAccessClaims(t *testing.T) {
+	access := func(override jwt.MapClaims) jwt.MapClaims {
+		claims := jwt.MapClaims{
+			"sub": "roditelj@example.com",
+			"iss": accessTokenIssuer,
+			"aud": accessTokenAudience,
+			"typ": tokenTypeAccess,
+			"jti": "abc",
+		}
+		for k, v := range override {
+			if v == nil {
+				delete(claims, k)
+				continue
+			}
+			claims[k] = v
+		}
+		return claims
+	}
+
+	tests := []struct {
+		name    string
+		claims  jwt.MapClaims
+		wantErr bool
+	}{
+		{"access token", access(nil), false},
+		{"aud kao niz", access(jwt.MapClaims{"aud": []interface{}{"drugi", accessTokenAudience}}), false},
+		{"id_token", access(jwt.MapClaims{"aud": "klijent", "typ": tokenTypeID}), true},
+		{"id_token sa aud frontend", access(jwt.MapClaims{"typ": tokenTypeID}), true},
+		{"bez typ", access(jwt.MapClaims{"typ": nil}), true},
+		{"prazan jti", access(jwt.MapClaims{"jti": ""}), true},
+		{"bez jti", access(jwt.MapClaims{"jti": nil}), true},
+		{"drugi izdavalac", access(jwt.MapClaims{"iss": "http://drugi"}), true},
+		{"bez aud", access(jwt.MapClaims{"aud": nil}), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateAccessClaims(tt.claims); (err != nil) != tt.wantErr {
+				t.Fatalf("validateAccessClaims = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
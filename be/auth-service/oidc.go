@@ -0,0 +1,756 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"html/template"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Minimalni OpenID Connect provajder: authorization code tok sa obaveznim
+// PKCE (S256). Klijenti (drugi e-uprava moduli) se registruju kod admina,
+// a id_token nosi iste sub/role claim-ove koje citaju ostali servisi.
+type OIDCClient struct {
+	ClientID     string    `json:"client_id" bson:"client_id"`
+	SecretHash   string    `json:"-" bson:"secret_hash,omitempty"`
+	Name         string    `json:"name" bson:"name"`
+	RedirectURIs []string  `json:"redirect_uris" bson:"redirect_uris"`
+	Public       bool      `json:"public" bson:"public"`
+	CreatedBy    string    `json:"created_by" bson:"created_by"`
+	CreatedAt    time.Time `json:"created_at" bson:"created_at"`
+}
+
+type OIDCClientRequest struct {
+	Name         string   `json:"name"`
+	RedirectURIs []string `json:"redirect_uris"`
+	Public       bool     `json:"public"`
+}
+
+type OIDCClientResponse struct {
+	OIDCClient
+	ClientSecret string `json:"client_secret,omitempty"`
+}
+
+type OIDCAuthCode struct {
+	CodeHash      string     `bson:"code_hash"`
+	ClientID      string     `bson:"client_id"`
+	RedirectURI   string     `bson:"redirect_uri"`
+	Email         string     `bson:"email"`
+	Scope         string     `bson:"scope"`
+	Nonce         string     `bson:"nonce,omitempty"`
+	CodeChallenge string     `bson:"code_challenge"`
+	AuthTime      time.Time  `bson:"auth_time"`
+	ExpiresAt     time.Time  `bson:"expires_at"`
+	UsedAt        *time.Time `bson:"used_at,omitempty"`
+}
+
+// OIDCFormToken je jednokratni token forme za prijavu, vezan za parametre
+// autorizacije i (preko kolacica) za pregledac kome je forma prikazana, da
+// tudja stranica ne bi mogla da posalje prijavu u ime korisnika.
+type OIDCFormToken struct {
+	TokenHash     string    `bson:"token_hash"`
+	ClientID      string    `bson:"client_id"`
+	RedirectURI   string    `bson:"redirect_uri"`
+	State         string    `bson:"state"`
+	CodeChallenge string    `bson:"code_challenge"`
+	ExpiresAt     time.Time `bson:"expires_at"`
+}
+
+type OIDCTokenResponse struct {
+	AccessToken  string `json:"access_token"`
+	TokenType    string `json:"token_type"`
+	ExpiresIn    int64  `json:"expires_in"`
+	IDToken      string `json:"id_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	Scope        string `json:"scope"`
+}
+
+type OIDCUserInfo struct {
+	Sub           string `json:"sub"`
+	Email         string `json:"email"`
+	EmailVerified bool   `json:"email_verified"`
+	Role          string `json:"role"`
+}
+
+type oidcAuthorizeParams struct {
+	ClientID            string
+	RedirectURI         string
+	Scope               string
+	State               string
+	Nonce               string
+	CodeChallenge       string
+	CodeChallengeMethod string
+}
+
+const (
+	oidcCodeTTL      = 2 * time.Minute
+	oidcFormTokenTTL = 10 * time.Minute
+	oidcFormCookie   = "oidc_form"
+)
+
+var oidcClientsCollection *mongo.Collection
+var oidcCodesCollection *mongo.Collection
+var oidcFormTokensCollection *mongo.Collection
+
+var errInvalidFormToken = errors.New("Forma za prijavu je istekla ili je vec poslata, pokusajte ponovo")
+
+var oidcLoginTemplate = template.Must(template.New("login").Parse(`<!DOCTYPE html>
+<html lang="sr">
+<head><meta charset="utf-8"><title>E-Uprava prijava</title></head>
+<body>
+<h1>Prijava na E-Uprava</h1>
+<p>Aplikacija <strong>{{.ClientName}}</strong> trazi pristup vasem nalogu.</p>
+{{if .Error}}<p style="color:#b00">{{.Error}}</p>{{end}}
+<form method="post" action="/authorize">
+<input type="hidden" name="form_token" value="{{.FormToken}}">
+<input type="hidden" name="response_type" value="code">
+<input type="hidden" name="client_id" value="{{.Params.ClientID}}">
+<input type="hidden" name="redirect_uri" value="{{.Params.RedirectURI}}">
+<input type="hidden" name="scope" value="{{.Params.Scope}}">
+<input type="hidden" name="state" value="{{.Params.State}}">
+<input type="hidden" name="nonce" value="{{.Params.Nonce}}">
+<input type="hidden" name="code_challenge" value="{{.Params.CodeChallenge}}">
+<input type="hidden" name="code_challenge_method" value="{{.Params.CodeChallengeMethod}}">
+<p><label>Email <input type="email" name="email" value="{{.Email}}" required></label></p>
+<p><label>Lozinka <input type="password" name="password" required></label></p>
+<p><label>Kod za dvofaktorsku prijavu (ako je ukljucena) <input type="text" name="code" autocomplete="one-time-code"></label></p>
+<p><button type="submit">Prijavi se</button></p>
+</form>
+</body>
+</html>`))
+
+func init() {
+	http.HandleFunc("/.well-known/openid-configuration", handleOIDCDiscovery)
+	http.HandleFunc("/authorize", handleOIDCAuthorize)
+	http.HandleFunc("/token", handleOIDCToken)
+	http.HandleFunc("/userinfo", handleOIDCUserInfo)
+	http.HandleFunc("/auth/oidc/clients", handleOIDCClients)
+}
+
+func oidcIssuer() string {
+	return strings.TrimRight(getenvDefault("OIDC_ISSUER", "http://localhost:8083"), "/")
+}
+
+func handleOIDCDiscovery(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	issuer := oidcIssuer()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"issuer":                                issuer,
+		"authorization_endpoint":                issuer + "/authorize",
+		"token_endpoint":                        issuer + "/token",
+		"userinfo_endpoint":                     issuer + "/userinfo",
+		"jwks_uri":                              issuer + "/.well-known/jwks.json",
+		"response_types_supported":              []string{"code"},
+		"grant_types_supported":                 []string{"authorization_code", "refresh_token"},
+		"subject_types_supported":               []string{"public"},
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+		"scopes_supported":                      []string{"openid", "email", "profile"},
+		"token_endpoint_auth_methods_supported": []string{"client_secret_basic", "client_secret_post", "none"},
+		"code_challenge_methods_supported":      []string{"S256"},
+		"claims_supported":                      []string{"sub", "email", "email_verified", "role", "nonce", "auth_time"},
+	})
+}
+
+func handleOIDCAuthorize(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if err := r.ParseForm(); err != nil {
+		http.Error(w, "Neispravan zahtev", http.StatusBadRequest)
+		return
+	}
+
+	params := oidcAuthorizeParams{
+		ClientID:            r.Form.Get("client_id"),
+		RedirectURI:         r.Form.Get("redirect_uri"),
+		Scope:               r.Form.Get("scope"),
+		State:               r.Form.Get("state"),
+		Nonce:               r.Form.Get("nonce"),
+		CodeChallenge:       r.Form.Get("code_challenge"),
+		CodeChallengeMethod: r.Form.Get("code_challenge_method"),
+	}
+
+	// Dok klijent i redirect_uri nisu provereni greska se ne sme slati
+	// preusmeravanjem, da provajder ne bi postao open redirect.
+	client, err := getOIDCClient(r.Context(), params.ClientID)
+	if err != nil {
+		http.Error(w, "Nepoznat klijent", http.StatusBadRequest)
+		return
+	}
+	if !containsString(client.RedirectURIs, params.RedirectURI) {
+		http.Error(w, "Neispravan redirect_uri", http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case r.Form.Get("response_type") != "code":
+		redirectOIDCError(w, r, params, "unsupported_response_type", "Podrzan je samo response_type=code")
+		return
+	case !containsString(strings.Fields(params.Scope), "openid"):
+		redirectOIDCError(w, r, params, "invalid_scope", "Scope mora sadrzati openid")
+		return
+	case params.CodeChallenge == "" || params.CodeChallengeMethod != "S256":
+		redirectOIDCError(w, r, params, "invalid_request", "PKCE (S256) je obavezan")
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		renderOIDCLogin(w, r, client, params, "", "")
+		return
+	}
+
+	email := strings.TrimSpace(strings.ToLower(r.Form.Get("email")))
+	if err := consumeOIDCFormToken(r, params); err != nil {
+		if !errors.Is(err, errInvalidFormToken) {
+			http.Error(w, "Greska pri proveri forme", http.StatusInternalServerError)
+			return
+		}
+		renderOIDCLogin(w, r, client, params, email, err.Error())
+		return
+	}
+
+	ip := clientIP(r)
+	wait, err := loginRetryAfter(r.Context(), email, ip)
+	if err != nil {
+		http.Error(w, "Greska pri proveri prijave", http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		writeThrottled(w, wait)
+		return
+	}
+
+	user, err := authenticate(r.Context(), email, r.Form.Get("password"))
+	if err != nil {
+		if errors.Is(err, errUserDisabled) || errors.Is(err, errPasswordResetRequired) {
+			renderOIDCLogin(w, r, client, params, email, err.Error())
+			return
+		}
+		recordLoginFailure(r.Context(), email, ip)
+		renderOIDCLogin(w, r, client, params, email, "Neispravni kredencijali")
+		return
+	}
+	if user.TOTPEnabled {
+		if err := verifySecondFactor(r.Context(), user, r.Form.Get("code")); err != nil {
+			if errors.Is(err, errInvalidTwoFactorCode) {
+				recordLoginFailure(r.Context(), email, ip)
+				renderOIDCLogin(w, r, client, params, email, "Unesite ispravan kod za dvofaktorsku prijavu")
+				return
+			}
+			http.Error(w, "Greska pri proveri koda", http.StatusInternalServerError)
+			return
+		}
+	} else if twoFactorRequiredForRole(user.Role) {
+		renderOIDCLogin(w, r, client, params, email, "Vasa rola zahteva dvofaktorsku prijavu. Podesite je prvo na portalu.")
+		return
+	}
+	recordLoginSuccess(r.Context(), user.Email)
+
+	code, err := createOIDCAuthCode(r.Context(), user, params)
+	if err != nil {
+		redirectOIDCError(w, r, params, "server_error", "Greska pri izdavanju koda")
+		return
+	}
+
+	target, _ := url.Parse(params.RedirectURI)
+	q := target.Query()
+	q.Set("code", code)
+	if params.State != "" {
+		q.Set("state", params.State)
+	}
+	target.RawQuery = q.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func handleOIDCToken(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("Pragma", "no-cache")
+
+	if err := r.ParseForm(); err != nil {
+		writeOIDCTokenError(w, http.StatusBadRequest, "invalid_request", "Neispravan zahtev")
+		return
+	}
+	grantType := r.PostForm.Get("grant_type")
+	if grantType != "authorization_code" && grantType != "refresh_token" {
+		writeOIDCTokenError(w, http.StatusBadRequest, "unsupported_grant_type", "Podrzani su authorization_code i refresh_token")
+		return
+	}
+
+	client, err := authenticateOIDCClient(r)
+	if err != nil {
+		writeOIDCTokenError(w, http.StatusUnauthorized, "invalid_client", err.Error())
+		return
+	}
+	if grantType == "refresh_token" {
+		handleOIDCRefresh(w, r, client)
+		return
+	}
+
+	code, err := consumeOIDCAuthCode(r.Context(), r.PostForm.Get("code"))
+	if err != nil {
+		writeOIDCTokenError(w, http.StatusBadRequest, "invalid_grant", "Neispravan ili istekao kod")
+		return
+	}
+	if code.ClientID != client.ClientID || code.RedirectURI != r.PostForm.Get("redirect_uri") {
+		writeOIDCTokenError(w, http.StatusBadRequest, "invalid_grant", "Kod nije izdat ovom klijentu")
+		return
+	}
+	if !verifyPKCE(code.CodeChallenge, r.PostForm.Get("code_verifier")) {
+		writeOIDCTokenError(w, http.StatusBadRequest, "invalid_grant", "Neispravan code_verifier")
+		return
+	}
+
+	user, err := getUserByEmail(r.Context(), code.Email)
+	if err != nil || user.Disabled {
+		writeOIDCTokenError(w, http.StatusBadRequest, "invalid_grant", "Korisnik nije aktivan")
+		return
+	}
+
+	session, err := startClientSession(r.Context(), user, client.ClientID)
+	if err != nil {
+		writeOIDCTokenError(w, http.StatusInternalServerError, "server_error", "Greska pri generisanju tokena")
+		return
+	}
+	idToken, err := issueIDToken(user, client.ClientID, code.Nonce, code.AuthTime)
+	if err != nil {
+		writeOIDCTokenError(w, http.StatusInternalServerError, "server_error", "Greska pri generisanju tokena")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OIDCTokenResponse{
+		AccessToken:  session.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+		IDToken:      idToken,
+		RefreshToken: session.RefreshToken,
+		Scope:        code.Scope,
+	})
+}
+
+// handleOIDCRefresh menja refresh token klijenta po istim pravilima kao
+// /auth/refresh, ukljucujuci gasenje sesije pri ponovnoj upotrebi.
+func handleOIDCRefresh(w http.ResponseWriter, r *http.Request, client *OIDCClient) {
+	session, err := rotateSession(r.Context(), r.PostForm.Get("refresh_token"), client.ClientID)
+	if errors.Is(err, errInvalidRefreshToken) {
+		writeOIDCTokenError(w, http.StatusBadRequest, "invalid_grant", err.Error())
+		return
+	}
+	if err != nil {
+		writeOIDCTokenError(w, http.StatusInternalServerError, "server_error", "Greska pri osvezavanju sesije")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OIDCTokenResponse{
+		AccessToken:  session.AccessToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int64(accessTokenTTL.Seconds()),
+		RefreshToken: session.RefreshToken,
+	})
+}
+
+func handleOIDCUserInfo(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	user, err := getUserByEmail(r.Context(), claimString(claims, "sub"))
+	if err != nil || user.Disabled {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "Korisnik nije aktivan", http.StatusUnauthorized)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(OIDCUserInfo{
+		Sub:           user.Email,
+		Email:         user.Email,
+		EmailVerified: user.EmailVerified,
+		Role:          user.Role,
+	})
+}
+
+func handleOIDCClients(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err := requireAdminClaim(claims); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		items, err := listOIDCClients(r.Context())
+		if err != nil {
+			http.Error(w, "Greska pri citanju klijenata", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(items)
+		return
+	}
+
+	var req OIDCClientRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+		return
+	}
+	item, err := registerOIDCClient(r.Context(), req, claimString(claims, "sub"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(item)
+}
+
+func registerOIDCClient(ctx context.Context, req OIDCClientRequest, createdBy string) (*OIDCClientResponse, error) {
+	name := strings.TrimSpace(req.Name)
+	if name == "" {
+		return nil, errors.New("Naziv klijenta je obavezan")
+	}
+	if len(req.RedirectURIs) == 0 {
+		return nil, errors.New("Potreban je bar jedan redirect_uri")
+	}
+	for _, raw := range req.RedirectURIs {
+		u, err := url.Parse(raw)
+		if err != nil || u.Scheme == "" || u.Host == "" || u.Fragment != "" {
+			return nil, errors.New("Neispravan redirect_uri: " + raw)
+		}
+	}
+
+	clientID, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	item := OIDCClientResponse{OIDCClient: OIDCClient{
+		ClientID:     clientID,
+		Name:         name,
+		RedirectURIs: req.RedirectURIs,
+		Public:       req.Public,
+		CreatedBy:    strings.ToLower(strings.TrimSpace(createdBy)),
+		CreatedAt:    time.Now(),
+	}}
+	if !req.Public {
+		secret, err := newRefreshToken()
+		if err != nil {
+			return nil, err
+		}
+		item.ClientSecret = secret
+		item.SecretHash = hashRefreshToken(secret)
+	}
+	if _, err := oidcClientsCollection.InsertOne(ctx, item.OIDCClient); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func listOIDCClients(ctx context.Context) ([]OIDCClient, error) {
+	cursor, err := oidcClientsCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	items := make([]OIDCClient, 0)
+	for cursor.Next(ctx) {
+		var item OIDCClient
+		if err := cursor.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, cursor.Err()
+}
+
+func getOIDCClient(ctx context.Context, clientID string) (*OIDCClient, error) {
+	if strings.TrimSpace(clientID) == "" {
+		return nil, mongo.ErrNoDocuments
+	}
+	var item OIDCClient
+	if err := oidcClientsCollection.FindOne(ctx, bson.M{"client_id": clientID}).Decode(&item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+// authenticateOIDCClient prihvata client_secret_basic, client_secret_post i,
+// za javne klijente (SPA, mobilne aplikacije), samo client_id uz PKCE.
+func authenticateOIDCClient(r *http.Request) (*OIDCClient, error) {
+	clientID, secret, hasBasic := r.BasicAuth()
+	if !hasBasic {
+		clientID = r.PostForm.Get("client_id")
+		secret = r.PostForm.Get("client_secret")
+	}
+	client, err := getOIDCClient(r.Context(), clientID)
+	if err != nil {
+		return nil, errors.New("Nepoznat klijent")
+	}
+	if client.Public {
+		return client, nil
+	}
+	if secret == "" || subtle.ConstantTimeCompare([]byte(hashRefreshToken(secret)), []byte(client.SecretHash)) != 1 {
+		return nil, errors.New("Neispravna tajna klijenta")
+	}
+	return client, nil
+}
+
+func createOIDCAuthCode(ctx context.Context, user *User, params oidcAuthorizeParams) (string, error) {
+	code, err := newRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	_, err = oidcCodesCollection.InsertOne(ctx, OIDCAuthCode{
+		CodeHash:      hashRefreshToken(code),
+		ClientID:      params.ClientID,
+		RedirectURI:   params.RedirectURI,
+		Email:         user.Email,
+		Scope:         params.Scope,
+		Nonce:         params.Nonce,
+		CodeChallenge: params.CodeChallenge,
+		AuthTime:      now,
+		ExpiresAt:     now.Add(oidcCodeTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return code, nil
+}
+
+// createOIDCFormToken izdaje token za jedno slanje forme za prijavu sa
+// zadatim parametrima autorizacije.
+func createOIDCFormToken(ctx context.Context, params oidcAuthorizeParams) (string, error) {
+	token, err := newRefreshToken()
+	if err != nil {
+		return "", err
+	}
+	_, err = oidcFormTokensCollection.InsertOne(ctx, OIDCFormToken{
+		TokenHash:     hashRefreshToken(token),
+		ClientID:      params.ClientID,
+		RedirectURI:   params.RedirectURI,
+		State:         params.State,
+		CodeChallenge: params.CodeChallenge,
+		ExpiresAt:     time.Now().Add(oidcFormTokenTTL),
+	})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
+
+// consumeOIDCFormToken brise token forme ako odgovara kolacicu pregledaca i
+// parametrima autorizacije; svaki token vazi za tacno jedno slanje.
+func consumeOIDCFormToken(r *http.Request, params oidcAuthorizeParams) error {
+	token := r.PostForm.Get("form_token")
+	cookie, err := r.Cookie(oidcFormCookie)
+	if token == "" || err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(token)) != 1 {
+		return errInvalidFormToken
+	}
+	res, err := oidcFormTokensCollection.DeleteOne(r.Context(), bson.M{
+		"token_hash":     hashRefreshToken(token),
+		"client_id":      params.ClientID,
+		"redirect_uri":   params.RedirectURI,
+		"state":          params.State,
+		"code_challenge": params.CodeChallenge,
+		"expires_at":     bson.M{"$gt": time.Now()},
+	})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return errInvalidFormToken
+	}
+	return nil
+}
+
+func consumeOIDCAuthCode(ctx context.Context, code string) (*OIDCAuthCode, error) {
+	if strings.TrimSpace(code) == "" {
+		return nil, mongo.ErrNoDocuments
+	}
+	now := time.Now()
+	var item OIDCAuthCode
+	err := oidcCodesCollection.FindOneAndUpdate(ctx,
+		bson.M{"code_hash": hashRefreshToken(code), "used_at": bson.M{"$exists": false}, "expires_at": bson.M{"$gt": now}},
+		bson.M{"$set": bson.M{"used_at": now}},
+	).Decode(&item)
+	if err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func verifyPKCE(challenge, verifier string) bool {
+	if len(verifier) < 43 || len(verifier) > 128 {
+		return false
+	}
+	sum := sha256.Sum256([]byte(verifier))
+	expected := base64.RawURLEncoding.EncodeToString(sum[:])
+	return subtle.ConstantTimeCompare([]byte(expected), []byte(challenge)) == 1
+}
+
+func issueIDToken(user *User, clientID, nonce string, authTime time.Time) (string, error) {
+	now := time.Now()
+	claims := jwt.MapClaims{
+		"iss":            oidcIssuer(),
+		"sub":            user.Email,
+		"aud":            clientID,
+		"typ":            tokenTypeID,
+		"exp":            now.Add(accessTokenTTL).Unix(),
+		"iat":            now.Unix(),
+		"auth_time":      authTime.Unix(),
+		"email":          user.Email,
+		"email_verified": user.EmailVerified,
+		"role":           user.Role,
+	}
+	if nonce != "" {
+		claims["nonce"] = nonce
+	}
+	return signClaims(claims)
+}
+
+func renderOIDCLogin(w http.ResponseWriter, r *http.Request, client *OIDCClient, params oidcAuthorizeParams, email, message string) {
+	formToken, err := createOIDCFormToken(r.Context(), params)
+	if err != nil {
+		http.Error(w, "Greska pri prikazu prijave", http.StatusInternalServerError)
+		return
+	}
+	http.SetCookie(w, &http.Cookie{
+		Name:     oidcFormCookie,
+		Value:    formToken,
+		Path:     "/authorize",
+		MaxAge:   int(oidcFormTokenTTL.Seconds()),
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(oidcIssuer(), "https://"),
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("X-Frame-Options", "DENY")
+	if message != "" {
+		w.WriteHeader(http.StatusUnauthorized)
+	}
+	err = oidcLoginTemplate.Execute(w, map[string]interface{}{
+		"ClientName": client.Name,
+		"Params":     params,
+		"Email":      email,
+		"Error":      message,
+		"FormToken":  formToken,
+	})
+	if err != nil {
+		log.Printf("OIDC login render warning: %v", err)
+	}
+}
+
+func redirectOIDCError(w http.ResponseWriter, r *http.Request, params oidcAuthorizeParams, code, description string) {
+	target, err := url.Parse(params.RedirectURI)
+	if err != nil {
+		http.Error(w, description, http.StatusBadRequest)
+		return
+	}
+	q := target.Query()
+	q.Set("error", code)
+	q.Set("error_description", description)
+	if params.State != "" {
+		q.Set("state", params.State)
+	}
+	target.RawQuery = q.Encode()
+	http.Redirect(w, r, target.String(), http.StatusFound)
+}
+
+func writeOIDCTokenError(w http.ResponseWriter, status int, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"error": code, "error_description": description})
+}
+
+func containsString(items []string, value string) bool {
+	for _, item := range items {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+func ensureOIDCIndexes(ctx context.Context) {
+	_, err := oidcClientsCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "client_id", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("OIDC clients index warning: %v", err)
+	}
+	_, err = oidcCodesCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "code_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("OIDC codes index warning: %v", err)
+	}
+	_, err = oidcFormTokensCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "token_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("OIDC form tokens index warning: %v", err)
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestVerifyPKCE(t *testing.T) {
+	// Primer iz RFC 7636, dodatak B.
+	const verifier = "dBjftJeZ4CVP-mB92K27uhbUJU1p1r_wW1gFWFOEjXk"
+	const challenge = "E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"
+
+	tests := []struct {
+		name      string
+		challenge string
+		verifier  string
+		want      bool
+	}{
+		{"RFC 7636 primer", challenge, verifier, true},
+		{"pogresan verifier", challenge, verifier[:42] + "Y", false},
+		{"plain metod nije podrzan", verifier, verifier, false},
+		{"prazan challenge", "", verifier, false},
+		{"prekratak verifier", challenge, verifier[:42], false},
+		{"predugacak verifier", challenge, strings.Repeat("a", 129), false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := verifyPKCE(tt.challenge, tt.verifier); got != tt.want {
+				t.Fatalf("verifyPKCE = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestOIDCAuthorizeRequiresFormToken(t *testing.T) {
+	ctx := testMongo(t)
+	hash, err := hashPassword("Lozinka123!")
+	if err != nil {
+		t.Fatal(err)
+	}
+	user := &User{Email: "roditelj@example.com", Role: "roditelj", PasswordHash: hash, EmailVerified: true, CreatedAt: time.Now()}
+	if _, err := usersCollection.InsertOne(ctx, user); err != nil {
+		t.Fatal(err)
+	}
+	client := OIDCClient{ClientID: "vrtici", Name: "Vrtici", RedirectURIs: []string{"https://vrtici.example/cb"}, Public: true}
+	if _, err := oidcClientsCollection.InsertOne(ctx, client); err != nil {
+		t.Fatal(err)
+	}
+
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {client.ClientID},
+		"redirect_uri":          {client.RedirectURIs[0]},
+		"scope":                 {"openid email"},
+		"state":                 {"s1"},
+		"code_challenge":        {"E9Melhoa2OwvFrEMTJguCHaoeK1t8URWbuGJSstw-cM"},
+		"code_challenge_method": {"S256"},
+	}
+	render := func() (string, *http.Cookie) {
+		t.Helper()
+		rec := httptest.NewRecorder()
+		handleOIDCAuthorize(rec, httptest.NewRequest(http.MethodGet, "/authorize?"+params.Encode(), nil))
+		if rec.Code != http.StatusOK {
+			t.Fatalf("GET /authorize = %d", rec.Code)
+		}
+		cookies := rec.Result().Cookies()
+		if len(cookies) != 1 || cookies[0].Name != oidcFormCookie {
+			t.Fatalf("kolacic forme = %v", cookies)
+		}
+		if !strings.Contains(rec.Body.String(), `name="form_token" value="`+cookies[0].Value+`"`) {
+			t.Fatal("forma ne sadrzi token")
+		}
+		return cookies[0].Value, cookies[0]
+	}
+	post := func(form url.Values, cookie *http.Cookie) *httptest.ResponseRecorder {
+		t.Helper()
+		req := httptest.NewRequest(http.MethodPost, "/authorize", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if cookie != nil {
+			req.AddCookie(cookie)
+		}
+		rec := httptest.NewRecorder()
+		handleOIDCAuthorize(rec, req)
+		return rec
+	}
+	login := func(token, state string) url.Values {
+		form := url.Values{}
+		for k, v := range params {
+			form[k] = v
+		}
+		form.Set("state", state)
+		form.Set("form_token", token)
+		form.Set("email", user.Email)
+		form.Set("password", "Lozinka123!")
+		return form
+	}
+
+	token, cookie := render()
+	tests := []struct {
+		name   string
+		form   url.Values
+		cookie *http.Cookie
+	}{
+		{"bez tokena", login("", "s1"), cookie},
+		{"bez kolacica", login(token, "s1"), nil},
+		{"drugi state", login(token, "s2"), cookie},
+	}
+	for _, tt := range tests {
+		if rec := post(tt.form, tt.cookie); rec.Code != http.StatusUnauthorized || rec.Header().Get("Location") != "" {
+			t.Fatalf("%s: status %d, Location %q; ocekivana ponovo prikazana forma", tt.name, rec.Code, rec.Header().Get("Location"))
+		}
+	}
+
+	token, cookie = render()
+	rec := post(login(token, "s1"), cookie)
+	if rec.Code != http.StatusFound || !strings.HasPrefix(rec.Header().Get("Location"), client.RedirectURIs[0]+"?code=") {
+		t.Fatalf("prijava: status %d, Location %q", rec.Code, rec.Header().Get("Location"))
+	}
+	if rec := post(login(token, "s1"), cookie); rec.Code != http.StatusUnauthorized {
+		t.Fatalf("ponovno slanje iste forme: status %d, want 401", rec.Code)
+	}
+}
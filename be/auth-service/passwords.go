@@ -0,0 +1,61 @@
+package main
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+// Hesevi lozinki nose prefiks formata ("bcrypt$..."), a stari SHA-256 hesevi
+// bez prefiksa se i dalje prihvataju i prepisuju pri sledecoj prijavi.
+const (
+	passwordFormatBcrypt = "bcrypt$"
+	passwordFormatSHA256 = "sha256$"
+
+	bcryptCost        = 12
+	maxPasswordLength = 72
+)
+
+func hashPassword(password string) (string, error) {
+	if len(password) > maxPasswordLength {
+		return "", errors.New("Lozinka moze imati najvise 72 karaktera")
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcryptCost)
+	if err != nil {
+		return "", err
+	}
+	return passwordFormatBcrypt + string(hash), nil
+}
+
+// verifyPassword vraca da li lozinka odgovara hesu i da li hes treba
+// ponovo izracunati (stari format ili slabiji bcrypt cost).
+func verifyPassword(stored, email, password string) (bool, bool) {
+	switch {
+	case strings.HasPrefix(stored, passwordFormatBcrypt):
+		hash := []byte(strings.TrimPrefix(stored, passwordFormatBcrypt))
+		if bcrypt.CompareHashAndPassword(hash, []byte(password)) != nil {
+			return false, false
+		}
+		cost, err := bcrypt.Cost(hash)
+		return true, err != nil || cost < bcryptCost
+	case strings.HasPrefix(stored, passwordFormatSHA256):
+		return legacyPasswordMatches(strings.TrimPrefix(stored, passwordFormatSHA256), email, password), true
+	default:
+		return legacyPasswordMatches(stored, email, password), true
+	}
+}
+
+func legacyPasswordMatches(stored, email, password string) bool {
+	expected := legacyHashPassword(email, password)
+	return subtle.ConstantTimeCompare([]byte(stored), []byte(expected)) == 1
+}
+
+func legacyHashPassword(email, password string) string {
+	salt := getenvDefault("AUTH_SALT", "dev-salt")
+	val := sha256.Sum256([]byte(email + ":" + password + ":" + salt))
+	return hex.EncodeToString(val[:])
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestVerifyPassword(t *testing.T) {
+	const email, password = "roditelj@example.com", "Lozinka123!"
+
+	current, err := hashPassword(password)
+	if err != nil {
+		t.Fatalf("hashPassword: %v", err)
+	}
+	weak, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		t.Fatalf("bcrypt: %v", err)
+	}
+	legacy := legacyHashPassword(email, password)
+
+	tests := []struct {
+		name       string
+		stored     string
+		password   string
+		wantOK     bool
+		wantRehash bool
+	}{
+		{"bcrypt trenutni cost", current, password, true, false},
+		{"bcrypt pogresna lozinka", current, "pogresna", false, false},
+		{"bcrypt slabiji cost", passwordFormatBcrypt + string(weak), password, true, true},
+		{"sha256 sa prefiksom", passwordFormatSHA256 + legacy, password, true, true},
+		{"sha256 bez prefiksa", legacy, password, true, true},
+		{"sha256 pogresna lozinka", legacy, "pogresna", false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ok, rehash := verifyPassword(tt.stored, email, tt.password)
+			if ok != tt.wantOK || (tt.wantOK && rehash != tt.wantRehash) {
+				t.Fatalf("verifyPassword = (%v, %v), want (%v, %v)", ok, rehash, tt.wantOK, tt.wantRehash)
+			}
+		})
+	}
+}
+
+func TestHashPasswordFormat(t *testing.T) {
+	hash, err := hashPassword("Lozinka123!")
+	if err != nil {
+		t.Fatalf("hashPassword: %v", err)
+	}
+	if !strings.HasPrefix(hash, passwordFormatBcrypt) {
+		t.Fatalf("hash %q nema prefiks %q", hash, passwordFormatBcrypt)
+	}
+	cost, err := bcrypt.Cost([]byte(strings.TrimPrefix(hash, passwordFormatBcrypt)))
+	if err != nil || cost != bcryptCost {
+		t.Fatalf("cost = %d (%v), want %d", cost, err, bcryptCost)
+	}
+	if _, err := hashPassword(strings.Repeat("a", maxPasswordLength+1)); err == nil {
+		t.Fatal("ocekivana greska za lozinku duzu od 72 karaktera")
+	}
+}
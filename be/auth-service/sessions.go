@@ -0,0 +1,457 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Sesija vezuje neprovidni refresh token (cuva se samo njegov hes) za
+// poslednji izdati access token, da bi se pri odjavi ili opozivu znalo
+// koji jti treba staviti na listu opozvanih tokena. Svaka rotacija upisuje
+// novu sesiju iste porodice (family_id), a zamenjena ostaje sa replaced_at
+// do isteka, tako da se ponovna upotreba bilo kog ranijeg tokena prepozna.
+type Session struct {
+	ID          primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	FamilyID    primitive.ObjectID `json:"family_id,omitempty" bson:"family_id,omitempty"`
+	Email       string             `json:"email" bson:"email"`
+	RefreshHash string             `json:"-" bson:"refresh_hash"`
+	// Postoji samo na sesijama iz vremena kada se rotiralo u mestu; cita se
+	// samo radi prepoznavanja ponovne upotrebe.
+	PreviousRefreshHash string     `json:"-" bson:"previous_refresh_hash,omitempty"`
+	ClientID            string     `json:"client_id,omitempty" bson:"client_id,omitempty"`
+	AccessJTI           string     `json:"-" bson:"access_jti"`
+	AccessExpiresAt     time.Time  `json:"-" bson:"access_expires_at"`
+	ExpiresAt           time.Time  `json:"expires_at" bson:"expires_at"`
+	CreatedAt           time.Time  `json:"created_at" bson:"created_at"`
+	RotatedAt           *time.Time `json:"rotated_at,omitempty" bson:"rotated_at,omitempty"`
+	ReplacedAt          *time.Time `json:"-" bson:"replaced_at,omitempty"`
+	RevokedAt           *time.Time `json:"revoked_at,omitempty" bson:"revoked_at,omitempty"`
+}
+
+type RevokedToken struct {
+	JTI       string    `bson:"jti"`
+	Email     string    `bson:"email"`
+	Reason    string    `bson:"reason"`
+	ExpiresAt time.Time `bson:"expires_at"`
+	RevokedAt time.Time `bson:"revoked_at"`
+}
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token"`
+}
+
+type RevokeSessionsRequest struct {
+	Email string `json:"email"`
+}
+
+const (
+	accessTokenTTL  = 2 * time.Hour
+	refreshTokenTTL = 30 * 24 * time.Hour
+
+	accessTokenIssuer   = "auth-service"
+	accessTokenAudience = "frontend"
+	tokenTypeAccess     = "access"
+	tokenTypeID         = "id"
+)
+
+var errInvalidRefreshToken = errors.New("Neispravan ili istekao refresh token")
+
+var sessionsCollection *mongo.Collection
+var revokedTokensCollection *mongo.Collection
+
+func init() {
+	http.HandleFunc("/auth/refresh", handleRefresh)
+	http.HandleFunc("/auth/logout", handleLogout)
+	http.HandleFunc("/auth/users/revoke-sessions", handleRevokeSessions)
+}
+
+func handleRefresh(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req RefreshRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+		return
+	}
+
+	resp, err := rotateSession(r.Context(), req.RefreshToken, "")
+	if err != nil {
+		if errors.Is(err, errInvalidRefreshToken) {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Greska pri osvezavanju sesije", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func handleLogout(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	var req RefreshRequest
+	if r.Body != nil {
+		defer r.Body.Close()
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := logoutSession(r.Context(), claimString(claims, "sub"), claimString(claims, "jti"), claimExpiry(claims), req.RefreshToken); err != nil {
+		http.Error(w, "Greska pri odjavi", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func handleRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if strings.ToLower(strings.TrimSpace(claimString(claims, "role"))) != "admin" {
+		http.Error(w, "Samo admin moze da opozove sesije", http.StatusForbidden)
+		return
+	}
+
+	var req RevokeSessionsRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+		return
+	}
+	email := strings.ToLower(strings.TrimSpace(req.Email))
+	if email == "" {
+		http.Error(w, "Email je obavezan", http.StatusBadRequest)
+		return
+	}
+	if _, err := getUserByEmail(r.Context(), email); err != nil {
+		http.Error(w, "Korisnik nije pronadjen", http.StatusNotFound)
+		return
+	}
+
+	if err := revokeAllSessions(r.Context(), email, "admin_revoke"); err != nil {
+		http.Error(w, "Greska pri opozivu sesija", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// startSession izdaje access token i novi refresh token i pamti sesiju.
+func startSession(ctx context.Context, user *User) (*AuthResponse, error) {
+	return startClientSession(ctx, user, "")
+}
+
+// startClientSession vezuje sesiju za OIDC klijenta; njen refresh token
+// vazi samo na /token tog klijenta.
+func startClientSession(ctx context.Context, user *User, clientID string) (*AuthResponse, error) {
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+	jti := tokenID(user.Email)
+	token, exp, err := issueToken(user, jti)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	_, err = sessionsCollection.InsertOne(ctx, Session{
+		FamilyID:        primitive.NewObjectID(),
+		Email:           user.Email,
+		ClientID:        clientID,
+		RefreshHash:     hashRefreshToken(refreshToken),
+		AccessJTI:       jti,
+		AccessExpiresAt: time.Unix(exp, 0),
+		ExpiresAt:       now.Add(refreshTokenTTL),
+		CreatedAt:       now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newAuthResponse(user, token, exp, refreshToken), nil
+}
+
+// rotateSession menja refresh token novim i opoziva prethodni access token.
+// Ponovna upotreba bilo kog vec zamenjenog refresh tokena se tretira kao
+// kradja i gasi celu porodicu sesija. clientID je prazan za sesije prijave
+// na frontend.
+func rotateSession(ctx context.Context, refreshToken, clientID string) (*AuthResponse, error) {
+	refreshToken = strings.TrimSpace(refreshToken)
+	if refreshToken == "" {
+		return nil, errInvalidRefreshToken
+	}
+	hash := hashRefreshToken(refreshToken)
+	now := time.Now()
+
+	newToken, err := newRefreshToken()
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{
+		"refresh_hash": hash,
+		"replaced_at":  bson.M{"$exists": false},
+		"revoked_at":   bson.M{"$exists": false},
+		"expires_at":   bson.M{"$gt": now},
+	}
+	if clientID == "" {
+		filter["client_id"] = bson.M{"$exists": false}
+	} else {
+		filter["client_id"] = clientID
+	}
+
+	var session Session
+	err = sessionsCollection.FindOneAndUpdate(ctx,
+		filter,
+		bson.M{"$set": bson.M{"replaced_at": now}},
+	).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		revokeReusedSession(ctx, hash)
+		return nil, errInvalidRefreshToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	user, err := getUserByEmail(ctx, session.Email)
+	if err != nil || user.Disabled || user.PasswordResetRequired {
+		revokeSession(ctx, session, "user_inactive")
+		return nil, errInvalidRefreshToken
+	}
+
+	revokeAccessToken(ctx, session.Email, session.AccessJTI, session.AccessExpiresAt, "refresh")
+
+	jti := tokenID(user.Email)
+	token, exp, err := issueToken(user, jti)
+	if err != nil {
+		return nil, err
+	}
+	// Porodica zadrzava prvobitni rok, pa rotacija ne produzava sesiju.
+	_, err = sessionsCollection.InsertOne(ctx, Session{
+		FamilyID:        sessionFamily(session),
+		Email:           session.Email,
+		ClientID:        session.ClientID,
+		RefreshHash:     hashRefreshToken(newToken),
+		AccessJTI:       jti,
+		AccessExpiresAt: time.Unix(exp, 0),
+		ExpiresAt:       session.ExpiresAt,
+		CreatedAt:       session.CreatedAt,
+		RotatedAt:       &now,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return newAuthResponse(user, token, exp, newToken), nil
+}
+
+// revokeReusedSession gasi porodicu kojoj pripada vec zamenjeni token.
+func revokeReusedSession(ctx context.Context, hash string) {
+	var session Session
+	err := sessionsCollection.FindOne(ctx, bson.M{"$or": bson.A{
+		bson.M{"refresh_hash": hash, "replaced_at": bson.M{"$exists": true}},
+		bson.M{"previous_refresh_hash": hash},
+	}}).Decode(&session)
+	if err != nil {
+		return
+	}
+	log.Printf("Refresh token reuse detected for %s, revoking session family", session.Email)
+	if err := revokeSessionFamily(ctx, sessionFamily(session), "refresh_reuse"); err != nil {
+		log.Printf("Session family revoke warning for %s: %v", session.Email, err)
+	}
+}
+
+// sessionFamily vraca porodicu sesije; sesije nastale pre uvodjenja
+// porodica su same svoja porodica.
+func sessionFamily(session Session) primitive.ObjectID {
+	if session.FamilyID.IsZero() {
+		return session.ID
+	}
+	return session.FamilyID
+}
+
+func revokeSessionFamily(ctx context.Context, familyID primitive.ObjectID, reason string) error {
+	return revokeMatchingSessions(ctx, bson.M{
+		"$or":        bson.A{bson.M{"family_id": familyID}, bson.M{"_id": familyID}},
+		"revoked_at": bson.M{"$exists": false},
+	}, reason)
+}
+
+func logoutSession(ctx context.Context, email, jti string, exp time.Time, refreshToken string) error {
+	email = strings.ToLower(strings.TrimSpace(email))
+	if err := revokeAccessToken(ctx, email, jti, exp, "logout"); err != nil {
+		return err
+	}
+
+	filter := bson.M{"email": email, "access_jti": jti, "revoked_at": bson.M{"$exists": false}}
+	if strings.TrimSpace(refreshToken) != "" {
+		filter = bson.M{"email": email, "refresh_hash": hashRefreshToken(strings.TrimSpace(refreshToken)), "replaced_at": bson.M{"$exists": false}, "revoked_at": bson.M{"$exists": false}}
+	}
+	var session Session
+	err := sessionsCollection.FindOne(ctx, filter).Decode(&session)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return revokeSession(ctx, session, "logout")
+}
+
+func revokeAllSessions(ctx context.Context, email, reason string) error {
+	return revokeMatchingSessions(ctx, bson.M{"email": email, "revoked_at": bson.M{"$exists": false}}, reason)
+}
+
+func revokeMatchingSessions(ctx context.Context, filter bson.M, reason string) error {
+	cursor, err := sessionsCollection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var session Session
+		if err := cursor.Decode(&session); err != nil {
+			return err
+		}
+		if err := revokeSession(ctx, session, reason); err != nil {
+			return err
+		}
+	}
+	return cursor.Err()
+}
+
+func revokeSession(ctx context.Context, session Session, reason string) error {
+	now := time.Now()
+	_, err := sessionsCollection.UpdateOne(ctx, bson.M{"_id": session.ID}, bson.M{"$set": bson.M{"revoked_at": now}})
+	if err != nil {
+		return err
+	}
+	return revokeAccessToken(ctx, session.Email, session.AccessJTI, session.AccessExpiresAt, reason)
+}
+
+// revokeAccessToken upisuje jti na listu opozvanih tokena. Zapis se cuva
+// samo dok token ne istekne (TTL indeks na expires_at).
+func revokeAccessToken(ctx context.Context, email, jti string, exp time.Time, reason string) error {
+	if jti == "" || !exp.After(time.Now()) {
+		return nil
+	}
+	_, err := revokedTokensCollection.UpdateOne(ctx,
+		bson.M{"jti": jti},
+		bson.M{"$setOnInsert": RevokedToken{
+			JTI:       jti,
+			Email:     email,
+			Reason:    reason,
+			ExpiresAt: exp,
+			RevokedAt: time.Now(),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+func isTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	if jti == "" {
+		return false, nil
+	}
+	count, err := revokedTokensCollection.CountDocuments(ctx, bson.M{"jti": jti})
+	return count > 0, err
+}
+
+func newAuthResponse(user *User, token string, exp int64, refreshToken string) *AuthResponse {
+	return &AuthResponse{
+		AccessToken:      token,
+		TokenType:        "Bearer",
+		ExpiresIn:        exp,
+		RefreshToken:     refreshToken,
+		RefreshExpiresIn: int64(refreshTokenTTL.Seconds()),
+		Email:            user.Email,
+		Role:             user.Role,
+	}
+}
+
+func newRefreshToken() (string, error) {
+	buf := make([]byte, 32)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+func hashRefreshToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func ensureSessionIndexes(ctx context.Context) {
+	_, err := sessionsCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "refresh_hash", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "previous_refresh_hash", Value: 1}}, Options: options.Index().SetSparse(true)},
+		{Keys: bson.D{{Key: "family_id", Value: 1}}},
+		{Keys: bson.D{{Key: "email", Value: 1}}},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("Sessions index warning: %v", err)
+	}
+
+	_, err = revokedTokensCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "jti", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "expires_at", Value: 1}}, Options: options.Index().SetExpireAfterSeconds(0)},
+	})
+	if err != nil {
+		log.Printf("Revoked tokens index warning: %v", err)
+	}
+}
@@ -0,0 +1,225 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testMongo povezuje kolekcije na privremenu bazu na TEST_MONGO_URI. Bez
+// dostupnog Mongo servera test se preskace.
+func testMongo(t *testing.T) context.Context {
+	t.Helper()
+	uri := os.Getenv("TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGO_URI nije postavljen")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	t.Cleanup(cancel)
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetServerSelectionTimeout(2*time.Second))
+	if err != nil {
+		t.Skipf("Mongo nije dostupan: %v", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Skipf("Mongo nije dostupan: %v", err)
+	}
+
+	db := client.Database(fmt.Sprintf("auth_test_%d", time.Now().UnixNano()))
+	t.Cleanup(func() {
+		db.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+	usersCollection = db.Collection("users")
+	sessionsCollection = db.Collection("sessions")
+	revokedTokensCollection = db.Collection("revoked_tokens")
+	signingKeysCollection = db.Collection("signing_keys")
+	accountTokensCollection = db.Collection("account_tokens")
+	loginAttemptsCollection = db.Collection("login_attempts")
+	auditCollection = db.Collection("audit_events")
+	oidcClientsCollection = db.Collection("oidc_clients")
+	oidcCodesCollection = db.Collection("oidc_codes")
+	oidcFormTokensCollection = db.Collection("oidc_form_tokens")
+	if err := rotateSigningKeyIfNeeded(ctx); err != nil {
+		t.Fatalf("rotateSigningKeyIfNeeded: %v", err)
+	}
+	ensureSessionIndexes(ctx)
+	return ctx
+}
+
+func TestRotateSessionDetectsReuse(t *testing.T) {
+	ctx := testMongo(t)
+	user := &User{Email: "roditelj@example.com", Role: "roditelj", CreatedAt: time.Now()}
+	if _, err := usersCollection.InsertOne(ctx, user); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+
+	first, err := startSession(ctx, user)
+	if err != nil {
+		t.Fatalf("startSession: %v", err)
+	}
+	second, err := rotateSession(ctx, first.RefreshToken, "")
+	if err != nil {
+		t.Fatalf("rotateSession: %v", err)
+	}
+	if second.RefreshToken == first.RefreshToken {
+		t.Fatal("rotacija mora izdati novi refresh token")
+	}
+
+	// Ponovna upotreba zamenjenog tokena gasi celu sesiju, pa ni
+	// poslednji izdati refresh token vise ne vazi.
+	if _, err := rotateSession(ctx, first.RefreshToken, ""); !errors.Is(err, errInvalidRefreshToken) {
+		t.Fatalf("ponovna upotreba: err = %v, want errInvalidRefreshToken", err)
+	}
+	if _, err := rotateSession(ctx, second.RefreshToken, ""); !errors.Is(err, errInvalidRefreshToken) {
+		t.Fatalf("token posle opoziva: err = %v, want errInvalidRefreshToken", err)
+	}
+
+	assertFamilyRevoked(t, ctx, user.Email)
+}
+
+func TestRotateSessionRevokesFamilyOnOlderReuse(t *testing.T) {
+	ctx := testMongo(t)
+	user := &User{Email: "vaspitac@example.com", Role: "vaspitac", CreatedAt: time.Now()}
+	if _, err := usersCollection.InsertOne(ctx, user); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	other, err := startSession(ctx, user)
+	if err != nil {
+		t.Fatalf("startSession: %v", err)
+	}
+
+	tokens := []string{}
+	resp, err := startSession(ctx, user)
+	if err != nil {
+		t.Fatalf("startSession: %v", err)
+	}
+	tokens = append(tokens, resp.RefreshToken)
+	for i := 0; i < 3; i++ {
+		resp, err = rotateSession(ctx, resp.RefreshToken, "")
+		if err != nil {
+			t.Fatalf("rotateSession #%d: %v", i, err)
+		}
+		tokens = append(tokens, resp.RefreshToken)
+	}
+
+	// Token zamenjen pre tri rotacije i dalje gasi celu porodicu.
+	if _, err := rotateSession(ctx, tokens[0], ""); !errors.Is(err, errInvalidRefreshToken) {
+		t.Fatalf("ponovna upotreba: err = %v, want errInvalidRefreshToken", err)
+	}
+	if _, err := rotateSession(ctx, tokens[len(tokens)-1], ""); !errors.Is(err, errInvalidRefreshToken) {
+		t.Fatalf("poslednji token porodice: err = %v, want errInvalidRefreshToken", err)
+	}
+
+	// Druga sesija istog korisnika nije deo porodice i ostaje vazeca.
+	if _, err := rotateSession(ctx, other.RefreshToken, ""); err != nil {
+		t.Fatalf("druga sesija: %v", err)
+	}
+}
+
+func TestRotateSessionRevokesLegacySessionOnReuse(t *testing.T) {
+	ctx := testMongo(t)
+	user := &User{Email: "admin@example.com", Role: "admin", CreatedAt: time.Now()}
+	if _, err := usersCollection.InsertOne(ctx, user); err != nil {
+		t.Fatalf("insert user: %v", err)
+	}
+	current, err := newRefreshToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	// Sesija rotirana u mestu, pre uvodjenja porodica.
+	_, err = sessionsCollection.InsertOne(ctx, bson.M{
+		"email":                 user.Email,
+		"refresh_hash":          hashRefreshToken(current),
+		"previous_refresh_hash": hashRefreshToken("stari-token"),
+		"access_jti":            "legacy-jti",
+		"access_expires_at":     now.Add(time.Hour),
+		"expires_at":            now.Add(refreshTokenTTL),
+		"created_at":            now,
+		"rotated_at":            now,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next, err := rotateSession(ctx, current, "")
+	if err != nil {
+		t.Fatalf("rotacija stare sesije: %v", err)
+	}
+	if _, err := rotateSession(ctx, "stari-token", ""); !errors.Is(err, errInvalidRefreshToken) {
+		t.Fatalf("ponovna upotreba: err = %v, want errInvalidRefreshToken", err)
+	}
+	if _, err := rotateSession(ctx, next.RefreshToken, ""); !errors.Is(err, errInvalidRefreshToken) {
+		t.Fatalf("token posle opoziva: err = %v, want errInvalidRefreshToken", err)
+	}
+	assertFamilyRevoked(t, ctx, user.Email)
+}
+
+func assertFamilyRevoked(t *testing.T, ctx context.Context, email string) {
+	t.Helper()
+	cursor, err := sessionsCollection.Find(ctx, bson.M{"email": email})
+	if err != nil {
+		t.Fatalf("find sessions: %v", err)
+	}
+	var sessions []Session
+	if err := cursor.All(ctx, &sessions); err != nil {
+		t.Fatalf("decode sessions: %v", err)
+	}
+	if len(sessions) == 0 {
+		t.Fatal("nema sesija")
+	}
+	for _, session := range sessions {
+		if session.RevokedAt == nil {
+			t.Fatalf("sesija %s nije opozvana", session.ID.Hex())
+		}
+		revoked, err := isTokenRevoked(ctx, session.AccessJTI)
+		if err != nil || !revoked {
+			t.Fatalf("access token sesije %s nije opozvan (%v)", session.ID.Hex(), err)
+		}
+	}
+}
+
+func TestRotateSessionRejectsUnknownToken(t *testing.T) {
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"prazan", ""},
+		{"razmaci", "   "},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := rotateSession(context.Background(), tt.token, ""); !errors.Is(err, errInvalidRefreshToken) {
+				t.Fatalf("err = %v, want errInvalidRefreshToken", err)
+			}
+		})
+	}
+}
+
+func TestHashRefreshToken(t *testing.T) {
+	a, err := newRefreshToken()
+	if err != nil {
+		t.Fatalf("newRefreshToken: %v", err)
+	}
+	b, err := newRefreshToken()
+	if err != nil {
+		t.Fatalf("newRefreshToken: %v", err)
+	}
+	if a == b {
+		t.Fatal("refresh tokeni moraju biti jedinstveni")
+	}
+	if hashRefreshToken(a) != hashRefreshToken(a) || hashRefreshToken(a) == hashRefreshToken(b) {
+		t.Fatal("hes refresh tokena mora biti deterministican i razlicit za razlicite tokene")
+	}
+	if hashRefreshToken(a) == a {
+		t.Fatal("refresh token se ne sme cuvati u izvornom obliku")
+	}
+}
@@ -0,0 +1,65 @@
+package main
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// Test vektori iz RFC 6238, dodatak B (SHA1, kljuc "12345678901234567890").
+// RFC navodi 8 cifara; poredi se poslednjih 6.
+var rfc6238Vectors = []struct {
+	unix int64
+	code string
+}{
+	{59, "94287082"},
+	{1111111109, "07081804"},
+	{1111111111, "14050471"},
+	{1234567890, "89005924"},
+	{2000000000, "69279037"},
+	{20000000000, "65353130"},
+}
+
+const rfc6238Key = "12345678901234567890"
+
+func TestTOTPCodeRFC6238(t *testing.T) {
+	for _, tt := range rfc6238Vectors {
+		want := tt.code[len(tt.code)-totpDigits:]
+		if got := totpCode([]byte(rfc6238Key), tt.unix/totpPeriod); got != want {
+			t.Errorf("totpCode(t=%d) = %s, want %s", tt.unix, got, want)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte(rfc6238Key))
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+	key := []byte(rfc6238Key)
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"trenutni korak", secret, "050471", step, true},
+		{"prethodni korak", secret, totpCode(key, step-1), step - 1, true},
+		{"sledeci korak", secret, totpCode(key, step+1), step + 1, true},
+		{"van dozvoljenog odstupanja", secret, totpCode(key, step-2), 0, false},
+		{"razmaci u kodu", secret, " 050 471 ", step, true},
+		{"mala slova u tajni", strings.ToLower(secret), "050471", step, true},
+		{"pogresan kod", secret, "000000", 0, false},
+		{"kratak kod", secret, "05047", 0, false},
+		{"neispravna tajna", "!!!", "050471", 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := verifyTOTP(tt.secret, tt.code, now)
+			if ok != tt.wantOK || got != tt.wantStep {
+				t.Fatalf("verifyTOTP = (%d, %v), want (%d, %v)", got, ok, tt.wantStep, tt.wantOK)
+			}
+		})
+	}
+}
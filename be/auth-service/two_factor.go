@@ -0,0 +1,414 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type TwoFactorChallengeResponse struct {
+	TwoFactorRequired      bool   `json:"two_factor_required"`
+	TwoFactorSetupRequired bool   `json:"two_factor_setup_required,omitempty"`
+	ChallengeToken         string `json:"challenge_token"`
+	ExpiresIn              int64  `json:"expires_in"`
+}
+
+type TwoFactorSetupResponse struct {
+	Secret          string `json:"secret"`
+	ProvisioningURI string `json:"provisioning_uri"`
+}
+
+type TwoFactorActivateResponse struct {
+	RecoveryCodes []string      `json:"recovery_codes"`
+	Auth          *AuthResponse `json:"auth,omitempty"`
+}
+
+type TwoFactorRequest struct {
+	ChallengeToken string `json:"challenge_token"`
+	Code           string `json:"code"`
+}
+
+const (
+	tokenPurposeLogin2FA = "prijava_2fa"
+	tokenPurposeSetup2FA = "podesavanje_2fa"
+
+	twoFactorChallengeTTL = 5 * time.Minute
+	recoveryCodeCount     = 10
+)
+
+var errInvalidTwoFactorCode = errors.New("Neispravan kod")
+
+func init() {
+	http.HandleFunc("/auth/login/2fa", handleLoginTwoFactor)
+	http.HandleFunc("/auth/2fa/setup", handleTwoFactorSetup)
+	http.HandleFunc("/auth/2fa/activate", handleTwoFactorActivate)
+	http.HandleFunc("/auth/2fa/disable", handleTwoFactorDisable)
+}
+
+// twoFactorRequiredForRole cita TOTP_REQUIRED_ROLES (npr. "admin,vaspitac").
+func twoFactorRequiredForRole(role string) bool {
+	for _, item := range strings.Split(getenvDefault("TOTP_REQUIRED_ROLES", ""), ",") {
+		if strings.EqualFold(strings.TrimSpace(item), role) {
+			return true
+		}
+	}
+	return false
+}
+
+// loginChallenge vraca izazov za drugi korak prijave kada korisnik ima
+// ukljucen 2FA, ili kada ga njegova rola zahteva a jos ga nije podesio.
+func loginChallenge(ctx context.Context, user *User) (*TwoFactorChallengeResponse, error) {
+	purpose := ""
+	switch {
+	case user.TOTPEnabled:
+		purpose = tokenPurposeLogin2FA
+	case twoFactorRequiredForRole(user.Role):
+		purpose = tokenPurposeSetup2FA
+	default:
+		return nil, nil
+	}
+	token, err := createAccountToken(ctx, user.Email, purpose, twoFactorChallengeTTL)
+	if err != nil {
+		return nil, err
+	}
+	return &TwoFactorChallengeResponse{
+		TwoFactorRequired:      true,
+		TwoFactorSetupRequired: purpose == tokenPurposeSetup2FA,
+		ChallengeToken:         token,
+		ExpiresIn:              int64(twoFactorChallengeTTL.Seconds()),
+	}, nil
+}
+
+func handleLoginTwoFactor(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+		return
+	}
+
+	user, err := userForChallenge(r.Context(), req.ChallengeToken, tokenPurposeLogin2FA)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	ip := clientIP(r)
+	wait, err := loginRetryAfter(r.Context(), user.Email, ip)
+	if err != nil {
+		http.Error(w, "Greska pri proveri prijave", http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		writeThrottled(w, wait)
+		return
+	}
+
+	if err := verifySecondFactor(r.Context(), user, req.Code); err != nil {
+		if errors.Is(err, errInvalidTwoFactorCode) {
+			recordLoginFailure(r.Context(), user.Email, ip)
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		http.Error(w, "Greska pri proveri koda", http.StatusInternalServerError)
+		return
+	}
+	if _, err := consumeAccountToken(r.Context(), req.ChallengeToken, tokenPurposeLogin2FA); err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	recordLoginSuccess(r.Context(), user.Email)
+
+	resp, err := startSession(r.Context(), user)
+	if err != nil {
+		http.Error(w, "Greska pri generisanju tokena", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func handleTwoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TwoFactorRequest
+	if r.Body != nil {
+		defer r.Body.Close()
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+			return
+		}
+	}
+	user, _, err := twoFactorSubject(r, req.ChallengeToken)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if user.TOTPEnabled {
+		http.Error(w, "Dvofaktorska prijava je vec ukljucena", http.StatusBadRequest)
+		return
+	}
+
+	secret, err := newTOTPSecret()
+	if err != nil {
+		http.Error(w, "Greska pri generisanju tajne", http.StatusInternalServerError)
+		return
+	}
+	_, err = usersCollection.UpdateOne(r.Context(), bson.M{"_id": user.ID}, bson.M{"$set": bson.M{"totp_pending_secret": secret}})
+	if err != nil {
+		http.Error(w, "Greska pri cuvanju tajne", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(TwoFactorSetupResponse{
+		Secret:          secret,
+		ProvisioningURI: totpProvisioningURI(secret, user.Email),
+	})
+}
+
+func handleTwoFactorActivate(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req TwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+		return
+	}
+	user, fromChallenge, err := twoFactorSubject(r, req.ChallengeToken)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if user.TOTPEnabled {
+		http.Error(w, "Dvofaktorska prijava je vec ukljucena", http.StatusBadRequest)
+		return
+	}
+	if user.TOTPPendingSecret == "" {
+		http.Error(w, "Prvo pokrenite podesavanje dvofaktorske prijave", http.StatusBadRequest)
+		return
+	}
+	step, ok := verifyTOTP(user.TOTPPendingSecret, req.Code, time.Now())
+	if !ok {
+		http.Error(w, errInvalidTwoFactorCode.Error(), http.StatusBadRequest)
+		return
+	}
+	if fromChallenge {
+		if _, err := consumeAccountToken(r.Context(), req.ChallengeToken, tokenPurposeSetup2FA); err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Greska pri generisanju kodova", http.StatusInternalServerError)
+		return
+	}
+	_, err = usersCollection.UpdateOne(r.Context(), bson.M{"_id": user.ID}, bson.M{
+		"$set": bson.M{
+			"totp_secret":         user.TOTPPendingSecret,
+			"totp_enabled":        true,
+			"totp_last_step":      step,
+			"totp_recovery_codes": hashes,
+			"updated_at":          time.Now(),
+		},
+		"$unset": bson.M{"totp_pending_secret": ""},
+	})
+	if err != nil {
+		http.Error(w, "Greska pri ukljucivanju dvofaktorske prijave", http.StatusInternalServerError)
+		return
+	}
+	recordAuditEvent(r.Context(), AuditEvent{Type: "2fa_enabled", Email: user.Email, IP: clientIP(r)})
+
+	resp := TwoFactorActivateResponse{RecoveryCodes: codes}
+	if fromChallenge {
+		user.TOTPEnabled = true
+		resp.Auth, err = startSession(r.Context(), user)
+		if err != nil {
+			http.Error(w, "Greska pri generisanju tokena", http.StatusInternalServerError)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+func handleTwoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	var req TwoFactorRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+		return
+	}
+	user, err := getUserByEmail(r.Context(), claimString(claims, "sub"))
+	if err != nil {
+		http.Error(w, "Korisnik nije pronadjen", http.StatusNotFound)
+		return
+	}
+	if !user.TOTPEnabled {
+		http.Error(w, "Dvofaktorska prijava nije ukljucena", http.StatusBadRequest)
+		return
+	}
+	if twoFactorRequiredForRole(user.Role) {
+		http.Error(w, "Dvofaktorska prijava je obavezna za vasu rolu", http.StatusForbidden)
+		return
+	}
+	if err := verifySecondFactor(r.Context(), user, req.Code); err != nil {
+		if errors.Is(err, errInvalidTwoFactorCode) {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		http.Error(w, "Greska pri proveri koda", http.StatusInternalServerError)
+		return
+	}
+	if err := clearTwoFactor(r.Context(), user); err != nil {
+		http.Error(w, "Greska pri iskljucivanju dvofaktorske prijave", http.StatusInternalServerError)
+		return
+	}
+	recordAuditEvent(r.Context(), AuditEvent{Type: "2fa_disabled", Email: user.Email, IP: clientIP(r)})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// twoFactorSubject odredjuje korisnika iz Bearer tokena ili, tokom prve
+// prijave naloga kome je 2FA obavezan, iz challenge tokena.
+func twoFactorSubject(r *http.Request, challengeToken string) (*User, bool, error) {
+	if strings.TrimSpace(challengeToken) != "" {
+		user, err := userForChallenge(r.Context(), challengeToken, tokenPurposeSetup2FA)
+		return user, true, err
+	}
+	claims, err := requireAuth(r)
+	if err != nil {
+		return nil, false, err
+	}
+	user, err := getUserByEmail(r.Context(), claimString(claims, "sub"))
+	if err != nil {
+		return nil, false, errors.New("Korisnik nije pronadjen")
+	}
+	return user, false, nil
+}
+
+func userForChallenge(ctx context.Context, token, purpose string) (*User, error) {
+	email, err := lookupAccountToken(ctx, token, purpose)
+	if err != nil {
+		return nil, errors.New("Neispravan ili istekao izazov za prijavu")
+	}
+	user, err := getUserByEmail(ctx, email)
+	if err != nil || user.Disabled {
+		return nil, errors.New("Neispravan ili istekao izazov za prijavu")
+	}
+	return user, nil
+}
+
+// verifySecondFactor prihvata TOTP kod (svaki korak samo jednom) ili
+// jednokratni kod za oporavak.
+func verifySecondFactor(ctx context.Context, user *User, code string) error {
+	code = strings.TrimSpace(code)
+	if step, ok := verifyTOTP(user.TOTPSecret, code, time.Now()); ok {
+		res, err := usersCollection.UpdateOne(ctx,
+			bson.M{"_id": user.ID, "totp_last_step": bson.M{"$lt": step}},
+			bson.M{"$set": bson.M{"totp_last_step": step}},
+		)
+		if err != nil {
+			return err
+		}
+		if res.ModifiedCount == 0 {
+			return errInvalidTwoFactorCode
+		}
+		return nil
+	}
+
+	hash := hashRecoveryCode(code)
+	res, err := usersCollection.UpdateOne(ctx,
+		bson.M{"_id": user.ID, "totp_recovery_codes": hash},
+		bson.M{"$pull": bson.M{"totp_recovery_codes": hash}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount == 0 {
+		return errInvalidTwoFactorCode
+	}
+	recordAuditEvent(ctx, AuditEvent{Type: "2fa_recovery_code_used", Email: user.Email})
+	return nil
+}
+
+func clearTwoFactor(ctx context.Context, user *User) error {
+	_, err := usersCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{
+		"$set": bson.M{"totp_enabled": false, "updated_at": time.Now()},
+		"$unset": bson.M{
+			"totp_secret":         "",
+			"totp_pending_secret": "",
+			"totp_last_step":      "",
+			"totp_recovery_codes": "",
+		},
+	})
+	return err
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes := make([]string, 0, recoveryCodeCount)
+	hashes := make([]string, 0, recoveryCodeCount)
+	for i := 0; i < recoveryCodeCount; i++ {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, nil, err
+		}
+		raw := strings.ToLower(totpEncoding.EncodeToString(buf))
+		code := raw[:4] + "-" + raw[4:]
+		codes = append(codes, code)
+		hashes = append(hashes, hashRecoveryCode(code))
+	}
+	return codes, hashes, nil
+}
+
+func hashRecoveryCode(code string) string {
+	normalized := strings.ToLower(strings.ReplaceAll(strings.TrimSpace(code), "-", ""))
+	return hashRefreshToken("recovery:" + normalized)
+}
@@ -0,0 +1,485 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CreateUserRequest struct {
+	Email    string   `json:"email"`
+	Password string   `json:"password"`
+	Role     string   `json:"role"`
+	VrticIDs []string `json:"vrtic_ids"`
+}
+
+type ChangeRoleRequest struct {
+	Role     string   `json:"role"`
+	VrticIDs []string `json:"vrtic_ids"`
+}
+
+type UserVrticiRequest struct {
+	VrticIDs []string `json:"vrtic_ids"`
+}
+
+type ChangePasswordRequest struct {
+	Email       string `json:"email"`
+	OldPassword string `json:"old_password"`
+	NewPassword string `json:"new_password"`
+}
+
+type PasswordResetResponse struct {
+	Email             string `json:"email"`
+	PrivremenaLozinka string `json:"privremena_lozinka"`
+	PromenaObavezna   bool   `json:"promena_obavezna"`
+}
+
+type UserListQuery struct {
+	Role     string
+	Status   string
+	Search   string
+	Page     int
+	PageSize int // 0: bez strana, vraca se ceo spisak
+}
+
+const (
+	defaultUsersPageSize = 100
+	maxUsersPageSize     = 500
+
+	userStatusActive   = "aktivan"
+	userStatusDisabled = "onemogucen"
+)
+
+var (
+	errUserDisabled          = errors.New("Nalog je onemogucen")
+	errPasswordResetRequired = errors.New("Potrebna je promena lozinke")
+)
+
+func init() {
+	http.HandleFunc("/auth/users/", handleUserAction)
+	http.HandleFunc("/auth/change-password", handleChangePassword)
+}
+
+func handleCreateUser(w http.ResponseWriter, r *http.Request) {
+	var req CreateUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+		return
+	}
+	role, err := normalizeRole(req.Role)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	vrticIDs, err := normalizeVrticIDs(role, req.VrticIDs)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err := insertUser(r.Context(), req.Email, req.Password, role, newUserOptions{ResetRequired: true, EmailVerified: true, VrticIDs: vrticIDs}); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	user, err := getUserByEmail(r.Context(), req.Email)
+	if err != nil {
+		http.Error(w, "Greska pri citanju korisnika", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(toUserListItem(*user))
+}
+
+func handleUserAction(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err := requireAdminClaim(claims); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	id, action, err := parseUserAction(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	user, err := getUserByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			http.Error(w, "Korisnik nije pronadjen", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Greska pri citanju korisnika", http.StatusInternalServerError)
+		return
+	}
+	if action != "reset-lozinke" && user.Email == strings.ToLower(strings.TrimSpace(claimString(claims, "sub"))) {
+		http.Error(w, "Ne mozete menjati sopstveni nalog", http.StatusBadRequest)
+		return
+	}
+
+	switch action {
+	case "rola":
+		var req ChangeRoleRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+			return
+		}
+		role, err := normalizeRole(req.Role)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		vrticIDs, err := normalizeVrticIDs(role, req.VrticIDs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := changeUserRole(r.Context(), user, role, vrticIDs); err != nil {
+			http.Error(w, "Greska pri promeni role", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "vrtici":
+		if user.Role != "direktor" {
+			http.Error(w, "Vrtici se dodeljuju samo direktoru", http.StatusBadRequest)
+			return
+		}
+		var req UserVrticiRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+			return
+		}
+		vrticIDs, err := normalizeVrticIDs(user.Role, req.VrticIDs)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if err := changeUserRole(r.Context(), user, user.Role, vrticIDs); err != nil {
+			http.Error(w, "Greska pri dodeli vrtica", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "onemoguci", "omoguci":
+		if err := setUserDisabled(r.Context(), user, action == "onemoguci"); err != nil {
+			http.Error(w, "Greska pri izmeni naloga", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case "reset-lozinke":
+		password, err := forcePasswordReset(r.Context(), user)
+		if err != nil {
+			http.Error(w, "Greska pri resetovanju lozinke", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(PasswordResetResponse{
+			Email:             user.Email,
+			PrivremenaLozinka: password,
+			PromenaObavezna:   true,
+		})
+	case "reset-2fa":
+		if err := clearTwoFactor(r.Context(), user); err != nil {
+			http.Error(w, "Greska pri resetovanju dvofaktorske prijave", http.StatusInternalServerError)
+			return
+		}
+		if err := revokeAllSessions(r.Context(), user.Email, "2fa_reset"); err != nil {
+			http.Error(w, "Greska pri opozivu sesija", http.StatusInternalServerError)
+			return
+		}
+		recordAuditEvent(r.Context(), AuditEvent{Type: "2fa_reset", Email: user.Email, Details: bson.M{"admin": claimString(claims, "sub")}})
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func handleChangePassword(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+		return
+	}
+
+	ip := clientIP(r)
+	wait, err := loginRetryAfter(r.Context(), req.Email, ip)
+	if err != nil {
+		http.Error(w, "Greska pri proveri prijave", http.StatusInternalServerError)
+		return
+	}
+	if wait > 0 {
+		writeThrottled(w, wait)
+		return
+	}
+
+	user, err := verifyCredentials(r.Context(), req.Email, req.OldPassword)
+	if err != nil {
+		if errors.Is(err, errUserDisabled) {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		recordLoginFailure(r.Context(), req.Email, ip)
+		http.Error(w, "Neispravni kredencijali", http.StatusUnauthorized)
+		return
+	}
+	recordLoginSuccess(r.Context(), user.Email)
+	if err := validatePassword(req.NewPassword); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if req.NewPassword == req.OldPassword {
+		http.Error(w, "Nova lozinka mora biti razlicita od stare", http.StatusBadRequest)
+		return
+	}
+	if err := setUserPassword(r.Context(), user, req.NewPassword, false); err != nil {
+		http.Error(w, "Greska pri promeni lozinke", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func parseUserAction(path string) (primitive.ObjectID, string, error) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/auth/users/"), "/"), "/")
+	if len(parts) != 2 {
+		return primitive.NilObjectID, "", errors.New("Neispravan URL korisnika")
+	}
+	id, err := primitive.ObjectIDFromHex(parts[0])
+	if err != nil {
+		return primitive.NilObjectID, "", errors.New("Neispravan ID korisnika")
+	}
+	action := strings.ToLower(strings.TrimSpace(parts[1]))
+	switch action {
+	case "rola", "vrtici", "onemoguci", "omoguci", "reset-lozinke", "reset-2fa":
+		return id, action, nil
+	default:
+		return primitive.NilObjectID, "", errors.New("Nepoznata akcija")
+	}
+}
+
+func parseUserListQuery(r *http.Request) (UserListQuery, error) {
+	q := r.URL.Query()
+	query := UserListQuery{
+		Role:   strings.ToLower(strings.TrimSpace(q.Get("role"))),
+		Status: strings.ToLower(strings.TrimSpace(q.Get("status"))),
+		Search: strings.ToLower(strings.TrimSpace(q.Get("q"))),
+		Page:   1,
+	}
+	// Bez page i page_size parametara vraca se ceo spisak, kao pre
+	// uvodjenja strana.
+	if strings.TrimSpace(q.Get("page")) != "" || strings.TrimSpace(q.Get("page_size")) != "" {
+		query.PageSize = defaultUsersPageSize
+	}
+	if raw := strings.TrimSpace(q.Get("page")); raw != "" {
+		page, err := strconv.Atoi(raw)
+		if err != nil || page < 1 {
+			return query, errors.New("Neispravan broj strane")
+		}
+		query.Page = page
+	}
+	if raw := strings.TrimSpace(q.Get("page_size")); raw != "" {
+		size, err := strconv.Atoi(raw)
+		if err != nil || size < 1 || size > maxUsersPageSize {
+			return query, errors.New("Velicina strane mora biti izmedju 1 i 500")
+		}
+		query.PageSize = size
+	}
+	if query.Status != "" && query.Status != userStatusActive && query.Status != userStatusDisabled {
+		return query, errors.New("Neispravan status (aktivan, onemogucen)")
+	}
+	return query, nil
+}
+
+func (q UserListQuery) filter() bson.M {
+	filter := bson.M{}
+	if q.Role != "" {
+		filter["role"] = q.Role
+	}
+	switch q.Status {
+	case userStatusActive:
+		filter["disabled"] = bson.M{"$ne": true}
+	case userStatusDisabled:
+		filter["disabled"] = true
+	}
+	if q.Search != "" {
+		filter["email"] = bson.M{"$regex": regexp.QuoteMeta(q.Search)}
+	}
+	return filter
+}
+
+func requireAdminClaim(claims jwt.MapClaims) error {
+	if strings.ToLower(strings.TrimSpace(claimString(claims, "role"))) != "admin" {
+		return errors.New("Samo admin moze da upravlja korisnicima")
+	}
+	return nil
+}
+
+func getUserByID(ctx context.Context, id primitive.ObjectID) (*User, error) {
+	var user User
+	if err := usersCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&user); err != nil {
+		return nil, err
+	}
+	return &user, nil
+}
+
+// normalizeVrticIDs proverava vrtice za direktora; ostale role ih nemaju.
+func normalizeVrticIDs(role string, raw []string) ([]string, error) {
+	if role != "direktor" {
+		return nil, nil
+	}
+	seen := map[string]bool{}
+	ids := make([]string, 0, len(raw))
+	for _, item := range raw {
+		id, err := primitive.ObjectIDFromHex(strings.TrimSpace(item))
+		if err != nil {
+			return nil, errors.New("Neispravan ID vrtica: " + item)
+		}
+		if !seen[id.Hex()] {
+			seen[id.Hex()] = true
+			ids = append(ids, id.Hex())
+		}
+	}
+	if len(ids) == 0 {
+		return nil, errors.New("Direktoru mora biti dodeljen bar jedan vrtic")
+	}
+	return ids, nil
+}
+
+// Promena role ili vrtica, onemogucavanje i reset lozinke gase sve sesije
+// korisnika, jer postojeci tokeni nose stara prava odnosno vise ne smeju
+// da vaze.
+func changeUserRole(ctx context.Context, user *User, role string, vrticIDs []string) error {
+	update := bson.M{"$set": bson.M{"role": role, "updated_at": time.Now()}}
+	if len(vrticIDs) > 0 {
+		update["$set"].(bson.M)["vrtic_ids"] = vrticIDs
+	} else {
+		update["$unset"] = bson.M{"vrtic_ids": ""}
+	}
+	_, err := usersCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, update)
+	if err != nil {
+		return err
+	}
+	return revokeAllSessions(ctx, user.Email, "role_change")
+}
+
+func setUserDisabled(ctx context.Context, user *User, disabled bool) error {
+	now := time.Now()
+	update := bson.M{"$set": bson.M{"disabled": disabled, "updated_at": now}}
+	if disabled {
+		update["$set"].(bson.M)["disabled_at"] = now
+	} else {
+		update["$unset"] = bson.M{"disabled_at": ""}
+	}
+	if _, err := usersCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, update); err != nil {
+		return err
+	}
+	if !disabled {
+		return nil
+	}
+	return revokeAllSessions(ctx, user.Email, "account_disabled")
+}
+
+func forcePasswordReset(ctx context.Context, user *User) (string, error) {
+	buf := make([]byte, 9)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	password := base64.RawURLEncoding.EncodeToString(buf)
+	if err := setUserPassword(ctx, user, password, true); err != nil {
+		return "", err
+	}
+	return password, nil
+}
+
+func setUserPassword(ctx context.Context, user *User, password string, resetRequired bool) error {
+	hash, err := hashPassword(password)
+	if err != nil {
+		return err
+	}
+	_, err = usersCollection.UpdateOne(ctx, bson.M{"_id": user.ID}, bson.M{"$set": bson.M{
+		"password_hash":           hash,
+		"password_reset_required": resetRequired,
+		"updated_at":              time.Now(),
+	}})
+	if err != nil {
+		return err
+	}
+	return revokeAllSessions(ctx, user.Email, "password_change")
+}
+
+func toUserListItem(user User) UserListItem {
+	status := userStatusActive
+	if user.Disabled {
+		status = userStatusDisabled
+	}
+	return UserListItem{
+		ID:                    user.ID,
+		Email:                 user.Email,
+		Role:                  user.Role,
+		VrticIDs:              user.VrticIDs,
+		Status:                status,
+		PasswordResetRequired: user.PasswordResetRequired,
+		CreatedAt:             user.CreatedAt,
+	}
+}
+
+func listUsersPage(ctx context.Context, query UserListQuery) ([]UserListItem, int64, error) {
+	filter := query.filter()
+	total, err := usersCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().SetSort(bson.D{{Key: "email", Value: 1}})
+	if query.PageSize > 0 {
+		opts.SetSkip(int64((query.Page - 1) * query.PageSize)).SetLimit(int64(query.PageSize))
+	}
+	cursor, err := usersCollection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(ctx)
+
+	items := make([]UserListItem, 0)
+	for cursor.Next(ctx) {
+		var user User
+		if err := cursor.Decode(&user); err != nil {
+			return nil, 0, err
+		}
+		items = append(items, toUserListItem(user))
+	}
+	return items, total, cursor.Err()
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"net/http/httptest"
+	"testing"
+)
+
+func TestParseUserListQuery(t *testing.T) {
+	tests := []struct {
+		name         string
+		url          string
+		wantPage     int
+		wantPageSize int
+		wantErr      bool
+	}{
+		{"bez strana vraca sve", "/auth/users", 1, 0, false},
+		{"samo filteri", "/auth/users?role=roditelj&status=aktivan", 1, 0, false},
+		{"strana sa podrazumevanom velicinom", "/auth/users?page=2", 2, defaultUsersPageSize, false},
+		{"samo velicina strane", "/auth/users?page_size=20", 1, 20, false},
+		{"strana i velicina", "/auth/users?page=3&page_size=50", 3, 50, false},
+		{"nula strana", "/auth/users?page=0", 0, 0, true},
+		{"prevelika strana", "/auth/users?page_size=501", 0, 0, true},
+		{"nepoznat status", "/auth/users?status=obrisan", 0, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, err := parseUserListQuery(httptest.NewRequest("GET", tt.url, nil))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if query.Page != tt.wantPage || query.PageSize != tt.wantPageSize {
+				t.Fatalf("page = %d, page_size = %d, want %d, %d", query.Page, query.PageSize, tt.wantPage, tt.wantPageSize)
+			}
+		})
+	}
+}
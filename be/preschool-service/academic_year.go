@@ -0,0 +1,595 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// RadnaGodina traje od 1. septembra do 31. avgusta i oznacava se kao
+// "2025/2026". Konkurs upisuje decu za jednu radnu godinu, a zahtev nosi
+// godinu svog konkursa. TrenutnoUpisano u vrticu broji decu aktivne godine
+// i decu vec odobrenu za sledecu; prelaz na sledecu godinu prevodi decu u
+// stariju grupu i ispisuje predskolce koji zavrsavaju, pa se njihova mesta
+// na konkursima za sledecu godinu unapred racunaju kao slobodna.
+type RadnaGodina struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Oznaka    string             `json:"oznaka" bson:"oznaka"`
+	Pocetak   time.Time          `json:"pocetak" bson:"pocetak"`
+	Kraj      time.Time          `json:"kraj" bson:"kraj"`
+	Aktivna   bool               `json:"aktivna" bson:"aktivna"`
+	PrelazAt  *time.Time         `json:"prelaz_at,omitempty" bson:"prelaz_at,omitempty"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+type RadnaGodinaRequest struct {
+	Oznaka string `json:"oznaka"`
+}
+
+type PrelazGodineResponse struct {
+	Iz        string `json:"iz"`
+	U         string `json:"u"`
+	Nastavlja int    `json:"nastavlja"`
+	Zavrsilo  int    `json:"zavrsilo"`
+}
+
+var radneGodineCollection *mongo.Collection
+
+func init() {
+	http.HandleFunc("/radne-godine", handleRadneGodine)
+	http.HandleFunc("/radne-godine/", handleRadnaGodinaAction)
+}
+
+func academicYearLabel(startYear int) string {
+	return fmt.Sprintf("%d/%d", startYear, startYear+1)
+}
+
+func academicYearStart(startYear int) time.Time {
+	return time.Date(startYear, time.September, 1, 0, 0, 0, 0, time.Local)
+}
+
+// parseAcademicYear vraca godinu pocetka iz oznake "2025/2026".
+func parseAcademicYear(oznaka string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(oznaka), "/")
+	if len(parts) != 2 {
+		return 0, errors.New("Radna godina mora biti u formatu GGGG/GGGG")
+	}
+	start, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, errors.New("Radna godina mora biti u formatu GGGG/GGGG")
+	}
+	end, err := strconv.Atoi(parts[1])
+	if err != nil || end != start+1 {
+		return 0, errors.New("Radna godina mora obuhvatiti dve uzastopne godine")
+	}
+	return start, nil
+}
+
+// academicYearFor vraca radnu godinu u kojoj je dan t.
+func academicYearFor(t time.Time) string {
+	if t.Month() >= time.September {
+		return academicYearLabel(t.Year())
+	}
+	return academicYearLabel(t.Year() - 1)
+}
+
+// konkursAcademicYear je podrazumevana godina konkursa: ona koja pocinje
+// 1. septembra godine u kojoj konkurs pocinje.
+func konkursAcademicYear(pocetak time.Time) string {
+	return academicYearLabel(pocetak.Year())
+}
+
+func getRadnaGodina(ctx context.Context, oznaka string) (RadnaGodina, error) {
+	var item RadnaGodina
+	err := radneGodineCollection.FindOne(ctx, bson.M{"oznaka": oznaka}).Decode(&item)
+	return item, err
+}
+
+func getRadneGodine(ctx context.Context) ([]RadnaGodina, error) {
+	cursor, err := radneGodineCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "pocetak", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	items := make([]RadnaGodina, 0)
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+// createRadnaGodina otvara radnu godinu. Prva otvorena godina postaje
+// aktivna; kasnije aktivnu godinu menja samo prelaz.
+func createRadnaGodina(ctx context.Context, oznaka string) (*RadnaGodina, error) {
+	start, err := parseAcademicYear(oznaka)
+	if err != nil {
+		return nil, err
+	}
+	active, err := radneGodineCollection.CountDocuments(ctx, bson.M{"aktivna": true})
+	if err != nil {
+		return nil, err
+	}
+	item := RadnaGodina{
+		Oznaka:    academicYearLabel(start),
+		Pocetak:   academicYearStart(start),
+		Kraj:      academicYearStart(start + 1).Add(-time.Nanosecond),
+		Aktivna:   active == 0,
+		CreatedAt: time.Now(),
+	}
+	res, err := radneGodineCollection.InsertOne(ctx, item)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errors.New("Radna godina " + item.Oznaka + " vec postoji")
+		}
+		return nil, err
+	}
+	if id, ok := res.InsertedID.(primitive.ObjectID); ok {
+		item.ID = id
+	}
+	return &item, nil
+}
+
+// requireOpenAcademicYear proverava da godina postoji i da za nju jos nije
+// uradjen prelaz, pa se na nju moze upisivati.
+func requireOpenAcademicYear(ctx context.Context, oznaka string) error {
+	item, err := getRadnaGodina(ctx, oznaka)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return errors.New("Radna godina " + oznaka + " nije otvorena")
+		}
+		return err
+	}
+	if item.PrelazAt != nil {
+		return errors.New("Radna godina " + oznaka + " je zavrsena")
+	}
+	return nil
+}
+
+// konkursYearFromRequest vraca radnu godinu konkursa: zadatu ili
+// podrazumevanu prema datumu pocetka. Godina mora biti otvorena.
+func konkursYearFromRequest(ctx context.Context, req KonkursRequest, pocetak time.Time) (string, error) {
+	oznaka := konkursAcademicYear(pocetak)
+	if strings.TrimSpace(req.RadnaGodina) != "" {
+		start, err := parseAcademicYear(req.RadnaGodina)
+		if err != nil {
+			return "", err
+		}
+		oznaka = academicYearLabel(start)
+	}
+	if err := requireOpenAcademicYear(ctx, oznaka); err != nil {
+		return "", err
+	}
+	return oznaka, nil
+}
+
+// rolloverAcademicYear prevodi upisanu decu iz godine u sledecu. Dete koje
+// je bilo predskolac ili vise nije u uzrastu ni jedne grupe zavrsava vrtic:
+// zahtev prelazi u ispisan i mesto se oslobadja. Ostala deca dobijaju grupu
+// prema uzrastu na pocetku nove godine. Svaki zahtev se menja uslovno po
+// godini, pa se prekinut prelaz moze bezbedno ponoviti.
+func rolloverAcademicYear(ctx context.Context, claims jwt.MapClaims, id primitive.ObjectID) (*PrelazGodineResponse, error) {
+	var year RadnaGodina
+	if err := radneGodineCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&year); err != nil {
+		return nil, err
+	}
+	if year.PrelazAt != nil {
+		return nil, errors.New("Prelaz za ovu godinu je vec uradjen")
+	}
+	if !year.Aktivna {
+		return nil, errors.New("Prelaz je moguc samo iz aktivne radne godine")
+	}
+	start, err := parseAcademicYear(year.Oznaka)
+	if err != nil {
+		return nil, err
+	}
+	if time.Now().Before(academicYearStart(start+1).AddDate(0, -1, 0)) {
+		return nil, errors.New("Prelaz je moguc najranije od 1. avgusta")
+	}
+	nextLabel := academicYearLabel(start + 1)
+	nextStart := academicYearStart(start + 1)
+	if _, err := getRadnaGodina(ctx, nextLabel); errors.Is(err, mongo.ErrNoDocuments) {
+		if _, err := createRadnaGodina(ctx, nextLabel); err != nil {
+			return nil, err
+		}
+	} else if err != nil {
+		return nil, err
+	}
+
+	cursor, err := zahteviCollection.Find(ctx, bson.M{"radna_godina": year.Oznaka, "status": statusApproved})
+	if err != nil {
+		return nil, err
+	}
+	var items []UpisZahtev
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+
+	result := PrelazGodineResponse{Iz: year.Oznaka, U: nextLabel}
+	freed := map[primitive.ObjectID]bool{}
+	for _, item := range items {
+		nextGroup, brojGodina, graduates, err := nextAgeGroup(ctx, item, nextStart)
+		if err != nil {
+			return &result, err
+		}
+		if graduates {
+			err := updateRequestStatus(ctx, item.ID, claims, statusApproved, statusUnenrolled, "Dete je zavrsilo predskolski program u radnoj godini "+year.Oznaka+".")
+			if errors.Is(err, errRequestChanged) {
+				continue
+			}
+			if err != nil {
+				return &result, err
+			}
+			if err := releaseVrticSeat(ctx, item.VrticID, item.Grupa); err != nil {
+				log.Printf("Seat release warning for vrtic %s: %v", item.VrticID.Hex(), err)
+			}
+			cleanupEnrollmentViews(ctx, item)
+			freed[item.VrticID] = true
+			result.Zavrsilo++
+			continue
+		}
+
+		res, err := zahteviCollection.UpdateOne(ctx,
+			bson.M{"_id": item.ID, "status": statusApproved, "radna_godina": year.Oznaka},
+			bson.M{
+				"$set":      bson.M{"radna_godina": nextLabel, "grupa": nextGroup, "broj_godina": brojGodina},
+				"$addToSet": bson.M{"upisane_godine": year.Oznaka},
+			},
+		)
+		if err != nil {
+			return &result, err
+		}
+		if res.ModifiedCount == 0 {
+			continue
+		}
+		if nextGroup != item.Grupa {
+			moveVrticGroupSeat(ctx, item.VrticID, item.Grupa, nextGroup)
+		}
+		result.Nastavlja++
+	}
+
+	now := time.Now()
+	if _, err := radneGodineCollection.UpdateOne(ctx,
+		bson.M{"_id": year.ID, "prelaz_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"prelaz_at": now, "aktivna": false}},
+	); err != nil {
+		return &result, err
+	}
+	if _, err := radneGodineCollection.UpdateOne(ctx, bson.M{"oznaka": nextLabel}, bson.M{"$set": bson.M{"aktivna": true}}); err != nil {
+		return &result, err
+	}
+	// Mesta dece koja su zavrsila vrtic idu listi cekanja nove godine.
+	for vrticID := range freed {
+		onSeatsFreed(ctx, vrticID, "prelaz_godine")
+	}
+	return &result, nil
+}
+
+// nextAgeGroup racuna grupu i uzrast deteta na pocetku nove godine.
+// Poslednji rezultat je true kada dete zavrsava vrtic. Za stare zahteve bez
+// registrovanog deteta uzrast se procenjuje iz broja godina upisanog na
+// zahtevu, uvecanog za jednu godinu.
+func nextAgeGroup(ctx context.Context, item UpisZahtev, nextStart time.Time) (string, int, bool, error) {
+	if item.Grupa == grupaPredskolci {
+		return "", 0, true, nil
+	}
+	if !item.DeteID.IsZero() {
+		dete, err := getDeteByID(ctx, item.DeteID)
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return "", 0, false, err
+		}
+		if err == nil {
+			grupa, ok := ageGroupFor(dete.DatumRodjenja, nextStart)
+			if !ok {
+				return "", 0, true, nil
+			}
+			return grupa.Sifra, ageAt(dete.DatumRodjenja, nextStart), false, nil
+		}
+	}
+	grupa, brojGodina, graduates := legacyNextAgeGroup(item)
+	return grupa, brojGodina, graduates, nil
+}
+
+// legacyNextAgeGroup odlucuje po broju navrsenih godina. Zahtev bez
+// uzrasta (broj_godina 0) zadrzava grupu, jer se ne moze proceniti.
+func legacyNextAgeGroup(item UpisZahtev) (string, int, bool) {
+	if item.BrojGodina <= 0 {
+		return item.Grupa, item.BrojGodina, false
+	}
+	brojGodina := item.BrojGodina + 1
+	months := brojGodina * 12
+	for _, g := range uzrasneGrupe {
+		if months >= g.OdMeseci && months < g.DoMeseci {
+			return g.Sifra, brojGodina, false
+		}
+	}
+	return "", brojGodina, true
+}
+
+// moveVrticGroupSeat prebacuje upisano dete iz jedne uzrasne grupe vrtica u
+// drugu. Ukupan broj upisanih se ne menja; kapacitet grupe se ne proverava
+// jer dete vec pohadja vrtic.
+func moveVrticGroupSeat(ctx context.Context, vrticID primitive.ObjectID, from, to string) {
+	if from != "" {
+		if _, err := vrticiCollection.UpdateOne(ctx,
+			bson.M{"_id": vrticID, "grupe": bson.M{"$elemMatch": bson.M{"grupa": from, "upisano": bson.M{"$gt": 0}}}},
+			bson.M{"$inc": bson.M{"grupe.$.upisano": -1}},
+		); err != nil {
+			log.Printf("Group move warning for vrtic %s: %v", vrticID.Hex(), err)
+		}
+	}
+	if to != "" {
+		if _, err := vrticiCollection.UpdateOne(ctx,
+			bson.M{"_id": vrticID, "grupe.grupa": to},
+			bson.M{"$inc": bson.M{"grupe.$.upisano": 1}},
+		); err != nil {
+			log.Printf("Group move warning for vrtic %s: %v", vrticID.Hex(), err)
+		}
+	}
+}
+
+// migrateAcademicYears jednokratno upisuje radnu godinu konkursima i
+// zahtevima nastalim pre uvodjenja radnih godina.
+func migrateAcademicYears(ctx context.Context, db *mongo.Database) error {
+	const name = "radna_godina_backfill"
+	migrations := db.Collection("migracije")
+	if n, err := migrations.CountDocuments(ctx, bson.M{"_id": name}); err != nil || n > 0 {
+		return err
+	}
+
+	cursor, err := konkursiCollection.Find(ctx, bson.M{"radna_godina": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	var konkursi []Konkurs
+	if err := cursor.All(ctx, &konkursi); err != nil {
+		return err
+	}
+	for _, k := range konkursi {
+		oznaka := konkursAcademicYear(k.DatumPocetka)
+		if _, err := konkursiCollection.UpdateOne(ctx, bson.M{"_id": k.ID}, bson.M{"$set": bson.M{"radna_godina": oznaka}}); err != nil {
+			return err
+		}
+		if _, err := zahteviCollection.UpdateMany(ctx,
+			bson.M{"konkurs_id": k.ID, "radna_godina": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"radna_godina": oznaka}},
+		); err != nil {
+			return err
+		}
+	}
+
+	cursor, err = zahteviCollection.Find(ctx, bson.M{"radna_godina": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	var zahtevi []UpisZahtev
+	if err := cursor.All(ctx, &zahtevi); err != nil {
+		return err
+	}
+	for _, item := range zahtevi {
+		if _, err := zahteviCollection.UpdateOne(ctx,
+			bson.M{"_id": item.ID},
+			bson.M{"$set": bson.M{"radna_godina": academicYearFor(item.CreatedAt)}},
+		); err != nil {
+			return err
+		}
+	}
+
+	_, err = migrations.InsertOne(ctx, bson.M{"_id": name, "izvrsena_at": time.Now()})
+	return err
+}
+
+// activeAcademicYear vraca oznaku aktivne radne godine; ok je false dok
+// nijedna godina nije aktivirana.
+func activeAcademicYear(ctx context.Context) (string, bool, error) {
+	var active RadnaGodina
+	if err := radneGodineCollection.FindOne(ctx, bson.M{"aktivna": true}).Decode(&active); err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return "", false, nil
+		}
+		return "", false, err
+	}
+	return active.Oznaka, true, nil
+}
+
+// graduatingSeats vraca broj mesta u vrticu koja ce se osloboditi do
+// pocetka radne godine radnaGodina: predskolci upisani u aktivnoj godini
+// zavrsavaju vrtic na prelazu. Brojac trenutno_upisano vec sadrzi i decu
+// odobrenu za sledecu godinu, pa konkurs za kasniju godinu sme da ga
+// prebaci za toliko mesta. Za aktivnu ili raniju godinu vraca 0.
+func graduatingSeats(ctx context.Context, vrticID primitive.ObjectID, radnaGodina string) (int, error) {
+	target, err := parseAcademicYear(radnaGodina)
+	if err != nil {
+		return 0, nil
+	}
+	active, ok, err := activeAcademicYear(ctx)
+	if err != nil || !ok {
+		return 0, err
+	}
+	start, err := parseAcademicYear(active)
+	if err != nil || target <= start {
+		return 0, nil
+	}
+	n, err := zahteviCollection.CountDocuments(ctx, bson.M{
+		"vrtic_id":     vrticID,
+		"radna_godina": active,
+		"status":       statusApproved,
+		"grupa":        grupaPredskolci,
+	})
+	return int(n), err
+}
+
+// freeSeatsInYear je broj slobodnih mesta u vrticu za upis u radnu godinu.
+func freeSeatsInYear(ctx context.Context, v Vrtic, radnaGodina string) (int, error) {
+	graduating, err := graduatingSeats(ctx, v.ID, radnaGodina)
+	if err != nil {
+		return 0, err
+	}
+	return slobodnaMesta(v) + graduating, nil
+}
+
+func enrolledPerVrticInYear(ctx context.Context, radnaGodina string) (map[primitive.ObjectID]int, error) {
+	start, err := parseAcademicYear(radnaGodina)
+	if err != nil {
+		return nil, err
+	}
+	oznaka := academicYearLabel(start)
+	cursor, err := zahteviCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{
+			"status": bson.M{"$in": bson.A{statusApproved, statusUnenrolled}},
+			"$or":    bson.A{bson.M{"radna_godina": oznaka}, bson.M{"upisane_godine": oznaka}},
+		}}},
+		{{Key: "$group", Value: bson.M{"_id": "$vrtic_id", "upisano": bson.M{"$sum": 1}}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		VrticID primitive.ObjectID `bson:"_id"`
+		Upisano int                `bson:"upisano"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	result := make(map[primitive.ObjectID]int, len(rows))
+	for _, row := range rows {
+		result[row.VrticID] = row.Upisano
+	}
+	return result, nil
+}
+
+// ensureAcademicYears otvara tekucu i sledecu radnu godinu ako nijedna ne
+// postoji, da bi se konkursi za narednu godinu mogli raspisati odmah.
+func ensureAcademicYears(ctx context.Context) {
+	_, err := radneGodineCollection.Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "oznaka", Value: 1}},
+		Options: options.Index().SetUnique(true),
+	})
+	if err != nil {
+		log.Printf("Academic years index warning: %v", err)
+	}
+	_, err = zahteviCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "radna_godina", Value: 1}, {Key: "status", Value: 1}}})
+	if err != nil {
+		log.Printf("Requests index warning: %v", err)
+	}
+
+	count, err := radneGodineCollection.CountDocuments(ctx, bson.M{})
+	if err != nil {
+		log.Printf("Academic years warning: %v", err)
+		return
+	}
+	if count > 0 {
+		return
+	}
+	current := academicYearFor(time.Now())
+	start, _ := parseAcademicYear(current)
+	for _, oznaka := range []string{current, academicYearLabel(start + 1)} {
+		if _, err := createRadnaGodina(ctx, oznaka); err != nil {
+			log.Printf("Academic years warning: %v", err)
+		}
+	}
+}
+
+func handleRadneGodine(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		items, err := getRadneGodine(r.Context())
+		if err != nil {
+			http.Error(w, "Greska pri citanju radnih godina", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(items)
+	case http.MethodPost:
+		claims, err := requireAuth(r)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusUnauthorized)
+			return
+		}
+		if err := authorize(claims, permAcademicYearManage); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		var req RadnaGodinaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+			return
+		}
+		item, err := createRadnaGodina(r.Context(), req.Oznaka)
+		if err != nil {
+			status := http.StatusBadRequest
+			if strings.Contains(err.Error(), "vec postoji") {
+				status = http.StatusConflict
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(item)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleRadnaGodinaAction obradjuje PUT /radne-godine/{id}/prelaz.
+func handleRadnaGodinaAction(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodPut {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err := authorize(claims, permAcademicYearManage); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/radne-godine/"), "/"), "/")
+	if len(parts) != 2 || parts[1] != "prelaz" {
+		http.Error(w, "Nepoznata akcija", http.StatusBadRequest)
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(parts[0])
+	if err != nil {
+		http.Error(w, "Neispravan ID radne godine", http.StatusBadRequest)
+		return
+	}
+
+	result, err := rolloverAcademicYear(r.Context(), claims, id)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			http.Error(w, "Radna godina nije pronadjena", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestLegacyNextAgeGroup(t *testing.T) {
+	tests := []struct {
+		name       string
+		item       UpisZahtev
+		grupa      string
+		brojGodina int
+		graduates  bool
+	}{
+		{"jaslice ostaju jaslice", UpisZahtev{Grupa: grupaJaslice, BrojGodina: 1}, grupaJaslice, 2, false},
+		{"jaslice u vrtic", UpisZahtev{Grupa: grupaJaslice, BrojGodina: 2}, grupaVrtic, 3, false},
+		{"bez grupe u predskolski", UpisZahtev{BrojGodina: 5}, grupaPredskolci, 6, false},
+		{"bez grupe zavrsava", UpisZahtev{BrojGodina: 6}, "", 7, true},
+		{"vrtic zavrsava sa 7", UpisZahtev{Grupa: grupaVrtic, BrojGodina: 7}, "", 8, true},
+		{"nepoznat uzrast zadrzava grupu", UpisZahtev{Grupa: grupaVrtic}, grupaVrtic, 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			grupa, brojGodina, graduates := legacyNextAgeGroup(tt.item)
+			if grupa != tt.grupa || brojGodina != tt.brojGodina || graduates != tt.graduates {
+				t.Fatalf("legacyNextAgeGroup = (%q, %d, %v), want (%q, %d, %v)", grupa, brojGodina, graduates, tt.grupa, tt.brojGodina, tt.graduates)
+			}
+		})
+	}
+}
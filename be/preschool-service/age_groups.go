@@ -0,0 +1,236 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// Uzrasne grupe u koje se deca rasporedjuju. Granice su u mesecima starosti
+// na dan pocetka konkursa; donja granica je ukljucena, gornja nije.
+const (
+	grupaJaslice    = "jaslice"
+	grupaVrtic      = "vrtic"
+	grupaPredskolci = "predskolski"
+)
+
+type UzrasnaGrupa struct {
+	Sifra    string `json:"sifra"`
+	Naziv    string `json:"naziv"`
+	OdMeseci int    `json:"od_meseci"`
+	DoMeseci int    `json:"do_meseci"`
+}
+
+var uzrasneGrupe = []UzrasnaGrupa{
+	{Sifra: grupaJaslice, Naziv: "Jaslice (0-3 godine)", OdMeseci: 0, DoMeseci: 36},
+	{Sifra: grupaVrtic, Naziv: "Vrtic (3-5.5 godina)", OdMeseci: 36, DoMeseci: 66},
+	{Sifra: grupaPredskolci, Naziv: "Predskolski (5.5-6.5 godina)", OdMeseci: 66, DoMeseci: 78},
+}
+
+// KapacitetGrupe je kapacitet vrtica za jednu uzrasnu grupu. Vrtic bez
+// navedenih grupa prima decu svih uzrasta u okviru ukupnog kapaciteta.
+type KapacitetGrupe struct {
+	Grupa     string `json:"grupa" bson:"grupa"`
+	Kapacitet int    `json:"kapacitet" bson:"kapacitet"`
+	Upisano   int    `json:"upisano" bson:"upisano"`
+}
+
+// MestaGrupe je broj mesta koji konkurs raspisuje za jednu uzrasnu grupu.
+type MestaGrupe struct {
+	Grupa     string `json:"grupa" bson:"grupa"`
+	MaxMesta  int    `json:"max_mesta" bson:"max_mesta"`
+	Popunjeno int    `json:"popunjeno" bson:"popunjeno"`
+}
+
+type GrupaView struct {
+	Grupa         string `json:"grupa"`
+	Naziv         string `json:"naziv"`
+	Kapacitet     int    `json:"kapacitet"`
+	Upisano       int    `json:"upisano"`
+	SlobodnaMesta int    `json:"slobodna_mesta"`
+}
+
+func findAgeGroup(sifra string) (UzrasnaGrupa, bool) {
+	for _, g := range uzrasneGrupe {
+		if g.Sifra == sifra {
+			return g, true
+		}
+	}
+	return UzrasnaGrupa{}, false
+}
+
+func ageGroupName(sifra string) string {
+	if g, ok := findAgeGroup(sifra); ok {
+		return g.Naziv
+	}
+	return sifra
+}
+
+// monthsAt vraca broj navrsenih meseci starosti na dan t.
+func monthsAt(dob, t time.Time) int {
+	months := (t.Year()-dob.Year())*12 + int(t.Month()) - int(dob.Month())
+	if t.Day() < dob.Day() {
+		months--
+	}
+	return months
+}
+
+func ageGroupFor(dob, t time.Time) (UzrasnaGrupa, bool) {
+	months := monthsAt(dob, t)
+	for _, g := range uzrasneGrupe {
+		if months >= g.OdMeseci && months < g.DoMeseci {
+			return g, true
+		}
+	}
+	return UzrasnaGrupa{}, false
+}
+
+func vrticGroup(v Vrtic, sifra string) (KapacitetGrupe, bool) {
+	for _, g := range v.Grupe {
+		if g.Grupa == sifra {
+			return g, true
+		}
+	}
+	return KapacitetGrupe{}, false
+}
+
+func konkursGroup(k Konkurs, sifra string) (MestaGrupe, bool) {
+	for _, g := range k.MestaPoGrupi {
+		if g.Grupa == sifra {
+			return g, true
+		}
+	}
+	return MestaGrupe{}, false
+}
+
+func validateVrticGroups(v Vrtic) error {
+	seen := map[string]bool{}
+	ukupno := 0
+	for _, g := range v.Grupe {
+		if _, ok := findAgeGroup(g.Grupa); !ok {
+			return fmt.Errorf("Nepoznata uzrasna grupa: %s", g.Grupa)
+		}
+		if seen[g.Grupa] {
+			return fmt.Errorf("Uzrasna grupa %s je navedena vise puta", g.Grupa)
+		}
+		seen[g.Grupa] = true
+		if g.Kapacitet <= 0 {
+			return fmt.Errorf("Kapacitet grupe %s mora biti > 0", g.Grupa)
+		}
+		ukupno += g.Kapacitet
+	}
+	if ukupno > v.MaxKapacitet {
+		return errors.New("Zbir kapaciteta grupa ne moze biti veci od max kapaciteta vrtica")
+	}
+	return nil
+}
+
+// normalizeKonkursGroups proverava raspodelu mesta po grupama. Ako
+// raspodela nije zadata konkurs nema ogranicenja po grupama; inace zbir
+// mora biti jednak ukupnom broju mesta.
+func normalizeKonkursGroups(vrtic Vrtic, grupe []MestaGrupe, maxMesta int) ([]MestaGrupe, error) {
+	if len(grupe) == 0 {
+		return nil, nil
+	}
+	result := make([]MestaGrupe, 0, len(grupe))
+	seen := map[string]bool{}
+	ukupno := 0
+	for _, g := range grupe {
+		sifra := strings.ToLower(strings.TrimSpace(g.Grupa))
+		if _, ok := findAgeGroup(sifra); !ok {
+			return nil, fmt.Errorf("Nepoznata uzrasna grupa: %s", g.Grupa)
+		}
+		if seen[sifra] {
+			return nil, fmt.Errorf("Uzrasna grupa %s je navedena vise puta", sifra)
+		}
+		seen[sifra] = true
+		if g.MaxMesta <= 0 {
+			return nil, fmt.Errorf("Broj mesta za grupu %s mora biti > 0", sifra)
+		}
+		if len(vrtic.Grupe) > 0 {
+			kapacitet, ok := vrticGroup(vrtic, sifra)
+			if !ok {
+				return nil, fmt.Errorf("Vrtic ne prima decu iz grupe %s", sifra)
+			}
+			if g.MaxMesta > kapacitet.Kapacitet-kapacitet.Upisano {
+				return nil, fmt.Errorf("Broj mesta za grupu %s je veci od slobodnih mesta u toj grupi", sifra)
+			}
+		}
+		ukupno += g.MaxMesta
+		result = append(result, MestaGrupe{Grupa: sifra, MaxMesta: g.MaxMesta})
+	}
+	if ukupno != maxMesta {
+		return nil, errors.New("Zbir mesta po grupama mora biti jednak max mestima konkursa")
+	}
+	return result, nil
+}
+
+// checkGroupEligibility proverava da vrtic i konkurs primaju decu iz grupe.
+func checkGroupEligibility(vrtic Vrtic, konkurs Konkurs, sifra string) error {
+	if len(vrtic.Grupe) > 0 {
+		if _, ok := vrticGroup(vrtic, sifra); !ok {
+			return fmt.Errorf("Vrtic ne prima decu uzrasne grupe: %s", ageGroupName(sifra))
+		}
+	}
+	if len(konkurs.MestaPoGrupi) > 0 {
+		if _, ok := konkursGroup(konkurs, sifra); !ok {
+			return fmt.Errorf("Konkurs nema mesta za uzrasnu grupu: %s", ageGroupName(sifra))
+		}
+	}
+	return nil
+}
+
+// groupFullReason vraca razlog za listu cekanja kada je grupa deteta
+// popunjena u vrticu ili na konkursu, ili prazan string.
+func groupFullReason(vrtic Vrtic, konkurs Konkurs, sifra string) string {
+	if g, ok := vrticGroup(vrtic, sifra); ok && g.Upisano >= g.Kapacitet {
+		return "Nema slobodnih mesta u uzrasnoj grupi. Zahtev je dodat na listu cekanja."
+	}
+	if g, ok := konkursGroup(konkurs, sifra); ok && g.Popunjeno >= g.MaxMesta {
+		return "Mesta za uzrasnu grupu na konkursu su popunjena. Zahtev je dodat na listu cekanja."
+	}
+	return ""
+}
+
+func vrticGroupViews(v Vrtic) []GrupaView {
+	if len(v.Grupe) == 0 {
+		return nil
+	}
+	views := make([]GrupaView, 0, len(v.Grupe))
+	for _, g := range v.Grupe {
+		slobodno := g.Kapacitet - g.Upisano
+		if slobodno < 0 {
+			slobodno = 0
+		}
+		views = append(views, GrupaView{
+			Grupa:         g.Grupa,
+			Naziv:         ageGroupName(g.Grupa),
+			Kapacitet:     g.Kapacitet,
+			Upisano:       g.Upisano,
+			SlobodnaMesta: slobodno,
+		})
+	}
+	return views
+}
+
+func konkursGroupViews(k Konkurs) []GrupaView {
+	if len(k.MestaPoGrupi) == 0 {
+		return nil
+	}
+	views := make([]GrupaView, 0, len(k.MestaPoGrupi))
+	for _, g := range k.MestaPoGrupi {
+		slobodno := g.MaxMesta - g.Popunjeno
+		if slobodno < 0 {
+			slobodno = 0
+		}
+		views = append(views, GrupaView{
+			Grupa:         g.Grupa,
+			Naziv:         ageGroupName(g.Grupa),
+			Kapacitet:     g.MaxMesta,
+			Upisano:       g.Popunjeno,
+			SlobodnaMesta: slobodno,
+		})
+	}
+	return views
+}
@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestMonthsAt(t *testing.T) {
+	dob := time.Date(2020, time.January, 31, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		at   time.Time
+		want int
+	}{
+		{dob, 0},
+		{time.Date(2020, time.February, 29, 0, 0, 0, 0, time.UTC), 0},
+		{time.Date(2020, time.March, 1, 0, 0, 0, 0, time.UTC), 1},
+		{time.Date(2021, time.January, 30, 0, 0, 0, 0, time.UTC), 11},
+		{time.Date(2021, time.January, 31, 0, 0, 0, 0, time.UTC), 12},
+		{time.Date(2023, time.September, 1, 0, 0, 0, 0, time.UTC), 43},
+	}
+	for _, tt := range tests {
+		if got := monthsAt(dob, tt.at); got != tt.want {
+			t.Errorf("monthsAt(%s) = %d, want %d", tt.at.Format("2006-01-02"), got, tt.want)
+		}
+	}
+}
+
+func TestAgeGroupFor(t *testing.T) {
+	pocetak := time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC)
+	rodjen := func(meseci, dana int) time.Time {
+		return pocetak.AddDate(0, -meseci, -dana)
+	}
+
+	tests := []struct {
+		name   string
+		dob    time.Time
+		want   string
+		wantOK bool
+	}{
+		{"novorodjence", pocetak, grupaJaslice, true},
+		{"35 meseci", rodjen(35, 10), grupaJaslice, true},
+		{"tacno 36 meseci", rodjen(36, 0), grupaVrtic, true},
+		{"dan manje od 36 meseci", rodjen(36, -1), grupaJaslice, true},
+		{"65 meseci", rodjen(65, 20), grupaVrtic, true},
+		{"tacno 66 meseci", rodjen(66, 0), grupaPredskolci, true},
+		{"77 meseci", rodjen(77, 25), grupaPredskolci, true},
+		{"tacno 78 meseci", rodjen(78, 0), "", false},
+		{"rodjen posle pocetka", pocetak.AddDate(0, 0, 1), "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, ok := ageGroupFor(tt.dob, pocetak)
+			if ok != tt.wantOK || got.Sifra != tt.want {
+				t.Fatalf("ageGroupFor(%s) = (%q, %v), want (%q, %v)", tt.dob.Format("2006-01-02"), got.Sifra, ok, tt.want, tt.wantOK)
+			}
+		})
+	}
+}
@@ -1,15 +1,22 @@
 package main
 
 import (
+	"context"
 	"errors"
 	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
 	"net/http"
 	"os"
 	"strings"
 )
 
+const (
+	accessTokenIssuer   = "auth-service"
+	accessTokenAudience = "frontend"
+	tokenTypeAccess     = "access"
+)
+
 func requireAuth(r *http.Request) (jwt.MapClaims, error) {
-	secret := getenvDefault("JWT_SECRET", "dev-secret")
 	authHeader := r.Header.Get("Authorization")
 	if authHeader == "" {
 		return nil, errors.New("Nedostaje Authorization header")
@@ -21,19 +28,40 @@ func requireAuth(r *http.Request) (jwt.MapClaims, error) {
 	}
 
 	claims := jwt.MapClaims{}
-	token, err := jwt.ParseWithClaims(tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, errors.New("Neispravan algoritam")
-		}
-		return []byte(secret), nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, claims, jwksKeyFunc)
 	if err != nil || !token.Valid {
 		return nil, errors.New("Neispravan ili istekao token")
 	}
+	// Prihvataju se samo access tokeni auth servisa: id_token (drugi aud i
+	// typ) i tokeni bez jti, koji se ne mogu opozvati, se odbijaju.
+	if !claims.VerifyIssuer(accessTokenIssuer, true) || !claims.VerifyAudience(accessTokenAudience, true) {
+		return nil, errors.New("Token nije izdat za ovaj servis")
+	}
+	if claimString(claims, "typ") != tokenTypeAccess || claimString(claims, "jti") == "" {
+		return nil, errors.New("Neispravan tip tokena")
+	}
+
+	revoked, err := isTokenRevoked(r.Context(), claimString(claims, "jti"))
+	if err != nil {
+		return nil, errors.New("Greska pri proveri tokena")
+	}
+	if revoked {
+		return nil, errors.New("Token je opozvan")
+	}
 
 	return claims, nil
 }
 
+// isTokenRevoked proverava listu opozvanih tokena koju vodi auth servis
+// u istoj bazi (odjava, rotacija refresh tokena, admin opoziv sesija).
+func isTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	if jti == "" || revokedTokensCollection == nil {
+		return false, nil
+	}
+	count, err := revokedTokensCollection.CountDocuments(ctx, bson.M{"jti": jti})
+	return count > 0, err
+}
+
 func claimString(claims jwt.MapClaims, key string) string {
 	value, ok := claims[key]
 	if !ok {
@@ -46,6 +74,11 @@ func claimString(claims jwt.MapClaims, key string) string {
 	return text
 }
 
+func claimBool(claims jwt.MapClaims, key string) bool {
+	value, ok := claims[key].(bool)
+	return ok && value
+}
+
 func getenvDefault(key, fallback string) string {
 	val := os.Getenv(key)
 	if val == "" {
@@ -0,0 +1,468 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Dete je registrovano dete roditelja. Zahtevi za upis, sastanci i
+// obavestenja ga referenciraju preko dete_id; ime_deteta na njima je samo
+// kopija za prikaz. Zahtevi nastali pre registra nemaju dete_id.
+type Dete struct {
+	ID                 primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	RoditeljEmail      string             `json:"roditelj_email" bson:"roditelj_email"`
+	Ime                string             `json:"ime" bson:"ime"`
+	Prezime            string             `json:"prezime" bson:"prezime"`
+	DatumRodjenja      time.Time          `json:"datum_rodjenja" bson:"datum_rodjenja"`
+	JMBG               string             `json:"jmbg" bson:"jmbg"`
+	Alergije           []string           `json:"alergije" bson:"alergije"`
+	MedicinskeNapomene string             `json:"medicinske_napomene,omitempty" bson:"medicinske_napomene,omitempty"`
+	CreatedAt          time.Time          `json:"created_at" bson:"created_at"`
+	UpdatedAt          time.Time          `json:"updated_at" bson:"updated_at"`
+}
+
+type DeteRequest struct {
+	Ime                string   `json:"ime"`
+	Prezime            string   `json:"prezime"`
+	DatumRodjenja      string   `json:"datum_rodjenja"`
+	JMBG               string   `json:"jmbg"`
+	Alergije           []string `json:"alergije"`
+	MedicinskeNapomene string   `json:"medicinske_napomene"`
+}
+
+var deteCollection *mongo.Collection
+
+var (
+	errDeteNotFound         = errors.New("Dete nije pronadjeno")
+	errDeteForbidden        = errors.New("Nemate dozvolu za ovo dete")
+	errDeteExists           = errors.New("Dete sa ovim JMBG-om je vec registrovano")
+	errDeteHasActiveRequest = errors.New("Dete ima aktivan zahtev za upis i ne moze biti obrisano")
+)
+
+func init() {
+	http.HandleFunc("/deca", handleDeca)
+	http.HandleFunc("/deca/", handleDete)
+}
+
+func (d Dete) PunoIme() string {
+	return strings.TrimSpace(d.Ime + " " + d.Prezime)
+}
+
+// ageAt vraca broj navrsenih godina na dan t.
+func ageAt(datumRodjenja, t time.Time) int {
+	years := t.Year() - datumRodjenja.Year()
+	if t.Month() < datumRodjenja.Month() || (t.Month() == datumRodjenja.Month() && t.Day() < datumRodjenja.Day()) {
+		years--
+	}
+	return years
+}
+
+// validateJMBG proverava format, kontrolnu cifru i slaganje prvih sedam
+// cifara (DDMMGGG) sa datumom rodjenja.
+func validateJMBG(jmbg string, datumRodjenja time.Time) error {
+	if len(jmbg) != 13 {
+		return errors.New("JMBG mora imati 13 cifara")
+	}
+	d := make([]int, 13)
+	for i, r := range jmbg {
+		if r < '0' || r > '9' {
+			return errors.New("JMBG mora imati 13 cifara")
+		}
+		d[i] = int(r - '0')
+	}
+	sum := 7*(d[0]+d[6]) + 6*(d[1]+d[7]) + 5*(d[2]+d[8]) + 4*(d[3]+d[9]) + 3*(d[4]+d[10]) + 2*(d[5]+d[11])
+	m := 11 - sum%11
+	if m > 9 {
+		m = 0
+	}
+	if m != d[12] {
+		return errors.New("JMBG nije ispravan (kontrolna cifra)")
+	}
+	if jmbg[:7] != datumRodjenja.Format("0201")+datumRodjenja.Format("2006")[1:] {
+		return errors.New("JMBG se ne slaze sa datumom rodjenja")
+	}
+	return nil
+}
+
+func normalizeAllergies(items []string) []string {
+	result := make([]string, 0, len(items))
+	seen := map[string]bool{}
+	for _, item := range items {
+		item = strings.TrimSpace(item)
+		key := strings.ToLower(item)
+		if item == "" || seen[key] {
+			continue
+		}
+		seen[key] = true
+		result = append(result, item)
+	}
+	return result
+}
+
+// enrollmentChild ucitava dete roditelja za zahtev, racuna njegov uzrast na
+// dan pocetka konkursa i uzrasnu grupu za koju vrtic i konkurs moraju imati
+// mesta.
+func enrollmentChild(ctx context.Context, claims jwt.MapClaims, deteIDRaw string, vrtic Vrtic, konkurs Konkurs) (Dete, int, string, error) {
+	deteID, err := primitive.ObjectIDFromHex(strings.TrimSpace(deteIDRaw))
+	if err != nil {
+		return Dete{}, 0, "", errors.New("Neispravan ID deteta")
+	}
+	dete, err := getOwnedDete(ctx, claims, deteID)
+	if err != nil {
+		return Dete{}, 0, "", err
+	}
+	grupa, ok := ageGroupFor(dete.DatumRodjenja, konkurs.DatumPocetka)
+	if !ok {
+		return Dete{}, 0, "", errors.New("Dete na dan pocetka konkursa nije u uzrastu ni jedne grupe (do 6.5 godina)")
+	}
+	if err := checkGroupEligibility(vrtic, konkurs, grupa.Sifra); err != nil {
+		return Dete{}, 0, "", err
+	}
+	return dete, ageAt(dete.DatumRodjenja, konkurs.DatumPocetka), grupa.Sifra, nil
+}
+
+func validateDeteInput(req DeteRequest) (time.Time, error) {
+	if strings.TrimSpace(req.Ime) == "" || strings.TrimSpace(req.Prezime) == "" {
+		return time.Time{}, errors.New("Ime i prezime deteta su obavezni")
+	}
+	datum, err := time.Parse("2006-01-02", strings.TrimSpace(req.DatumRodjenja))
+	if err != nil {
+		return time.Time{}, errors.New("Datum rodjenja mora biti u formatu YYYY-MM-DD")
+	}
+	if datum.After(time.Now()) {
+		return time.Time{}, errors.New("Datum rodjenja ne moze biti u buducnosti")
+	}
+	if err := validateJMBG(strings.TrimSpace(req.JMBG), datum); err != nil {
+		return time.Time{}, err
+	}
+	return datum, nil
+}
+
+func getDeteByID(ctx context.Context, id primitive.ObjectID) (Dete, error) {
+	var item Dete
+	err := deteCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&item)
+	return item, err
+}
+
+// getOwnedDete ucitava dete i proverava da pripada roditelju iz tokena.
+func getOwnedDete(ctx context.Context, claims jwt.MapClaims, id primitive.ObjectID) (Dete, error) {
+	item, err := getDeteByID(ctx, id)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return item, errDeteNotFound
+		}
+		return item, err
+	}
+	email := strings.ToLower(strings.TrimSpace(claimString(claims, "sub")))
+	if email == "" || email != item.RoditeljEmail {
+		return item, errDeteForbidden
+	}
+	return item, nil
+}
+
+func getDecaByParent(ctx context.Context, email string) ([]Dete, error) {
+	cursor, err := deteCollection.Find(ctx, bson.M{"roditelj_email": strings.ToLower(strings.TrimSpace(email))}, options.Find().SetSort(bson.D{{Key: "datum_rodjenja", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	items := make([]Dete, 0)
+	for cursor.Next(ctx) {
+		var item Dete
+		if err := cursor.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, cursor.Err()
+}
+
+func createDete(ctx context.Context, claims jwt.MapClaims, req DeteRequest) (*Dete, error) {
+	datum, err := validateDeteInput(req)
+	if err != nil {
+		return nil, err
+	}
+	email := strings.ToLower(strings.TrimSpace(claimString(claims, "sub")))
+	if email == "" {
+		return nil, errors.New("Neispravan token")
+	}
+	now := time.Now()
+	item := Dete{
+		RoditeljEmail:      email,
+		Ime:                strings.TrimSpace(req.Ime),
+		Prezime:            strings.TrimSpace(req.Prezime),
+		DatumRodjenja:      datum,
+		JMBG:               strings.TrimSpace(req.JMBG),
+		Alergije:           normalizeAllergies(req.Alergije),
+		MedicinskeNapomene: strings.TrimSpace(req.MedicinskeNapomene),
+		CreatedAt:          now,
+		UpdatedAt:          now,
+	}
+	res, err := deteCollection.InsertOne(ctx, item)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errDeteExists
+		}
+		return nil, err
+	}
+	if id, ok := res.InsertedID.(primitive.ObjectID); ok {
+		item.ID = id
+	}
+	return &item, nil
+}
+
+// errChildIdentityLocked: uzrasna grupa aktivnih zahteva je proverena za
+// zateceni datum rodjenja, pa se on (ni JMBG koji ga sadrzi) ne menja dok
+// zahtevi traju.
+var errChildIdentityLocked = errors.New("Datum rodjenja i JMBG se ne mogu menjati dok dete ima aktivan zahtev za upis")
+
+func updateDete(ctx context.Context, claims jwt.MapClaims, id primitive.ObjectID, req DeteRequest) (*Dete, error) {
+	item, err := getOwnedDete(ctx, claims, id)
+	if err != nil {
+		return nil, err
+	}
+	datum, err := validateDeteInput(req)
+	if err != nil {
+		return nil, err
+	}
+	if !datum.Equal(item.DatumRodjenja) || strings.TrimSpace(req.JMBG) != item.JMBG {
+		active, err := zahteviCollection.CountDocuments(ctx, bson.M{"dete_id": id, "status": bson.M{"$in": activeRequestStatuses}})
+		if err != nil {
+			return nil, err
+		}
+		if active > 0 {
+			return nil, errChildIdentityLocked
+		}
+	}
+	item.Ime = strings.TrimSpace(req.Ime)
+	item.Prezime = strings.TrimSpace(req.Prezime)
+	item.DatumRodjenja = datum
+	item.JMBG = strings.TrimSpace(req.JMBG)
+	item.Alergije = normalizeAllergies(req.Alergije)
+	item.MedicinskeNapomene = strings.TrimSpace(req.MedicinskeNapomene)
+	item.UpdatedAt = time.Now()
+
+	if _, err := deteCollection.ReplaceOne(ctx, bson.M{"_id": id}, item); err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errDeteExists
+		}
+		return nil, err
+	}
+
+	// Ime za prikaz je kopirano na zahteve, sastanke i obavestenja.
+	rename := bson.M{"$set": bson.M{"ime_deteta": item.PunoIme()}}
+	for _, coll := range []*mongo.Collection{zahteviCollection, sastanciCollection, obavestenjaCollection, roditeljObavestenjaCollection} {
+		if _, err := coll.UpdateMany(ctx, bson.M{"dete_id": id}, rename); err != nil {
+			log.Printf("Child rename warning for %s: %v", id.Hex(), err)
+		}
+	}
+	return &item, nil
+}
+
+func deleteDete(ctx context.Context, claims jwt.MapClaims, id primitive.ObjectID) error {
+	if _, err := getOwnedDete(ctx, claims, id); err != nil {
+		return err
+	}
+	active, err := zahteviCollection.CountDocuments(ctx, bson.M{"dete_id": id, "status": bson.M{"$in": activeRequestStatuses}})
+	if err != nil {
+		return err
+	}
+	if active > 0 {
+		return errDeteHasActiveRequest
+	}
+	_, err = deteCollection.DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
+
+// canReadDete: roditelj vidi svoju decu, administrator svu, a vaspitac decu
+// iz svojih vaspitnih grupa (zbog alergija i napomena).
+func canReadDete(ctx context.Context, claims jwt.MapClaims, item Dete) (bool, error) {
+	p := principalFromClaims(claims)
+	if p.Email != "" && p.Email == item.RoditeljEmail && p.Can(permChildManageOwn) {
+		return true, nil
+	}
+	if p.Can(permChildRegistryRead) {
+		return true, nil
+	}
+	if !p.Can(permChildrenRead) {
+		return false, nil
+	}
+	cursor, err := zahteviCollection.Find(ctx, bson.M{"dete_id": item.ID, "status": statusApproved})
+	if err != nil {
+		return false, err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var zahtev UpisZahtev
+		if err := cursor.Decode(&zahtev); err != nil {
+			return false, err
+		}
+		ok, err := educatorResponsibleFor(ctx, p.Email, zahtev)
+		if err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, cursor.Err()
+}
+
+func ensureDecaIndexes(ctx context.Context) {
+	_, err := deteCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "roditelj_email", Value: 1}}},
+		{Keys: bson.D{{Key: "jmbg", Value: 1}}, Options: options.Index().SetUnique(true)},
+	})
+	if err != nil {
+		log.Printf("Deca index warning: %v", err)
+	}
+	_, err = zahteviCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "dete_id", Value: 1}}},
+		{
+			Keys: bson.D{{Key: "aktivno_dete_id", Value: 1}},
+			Options: options.Index().SetUnique(true).
+				SetPartialFilterExpression(bson.M{"aktivno_dete_id": bson.M{"$exists": true}}),
+		},
+	})
+	if err != nil {
+		log.Printf("Requests index warning: %v", err)
+	}
+}
+
+func deteErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errDeteNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errDeteForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, errDeteExists), errors.Is(err, errDeteHasActiveRequest), errors.Is(err, errChildIdentityLocked):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func handleDeca(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err := authorize(claims, permChildManageOwn); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		items, err := getDecaByParent(r.Context(), claimString(claims, "sub"))
+		if err != nil {
+			http.Error(w, "Greska pri citanju dece", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(items)
+	case http.MethodPost:
+		var req DeteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+			return
+		}
+		item, err := createDete(r.Context(), claims, req)
+		if err != nil {
+			http.Error(w, err.Error(), deteErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(item)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleDete(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	id, err := parseSimpleObjectID(r.URL.Path, "/deca/")
+	if err != nil {
+		http.Error(w, "Neispravan ID deteta", http.StatusBadRequest)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		item, err := getDeteByID(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				http.Error(w, "Dete nije pronadjeno", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Greska pri citanju deteta", http.StatusInternalServerError)
+			return
+		}
+		ok, err := canReadDete(r.Context(), claims, item)
+		if err != nil {
+			http.Error(w, "Greska pri proveri dozvole", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Nemate dozvolu za ovo dete", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(item)
+	case http.MethodPut:
+		if err := authorize(claims, permChildManageOwn); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		var req DeteRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+			return
+		}
+		item, err := updateDete(r.Context(), claims, id, req)
+		if err != nil {
+			http.Error(w, err.Error(), deteErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(item)
+	case http.MethodDelete:
+		if err := authorize(claims, permChildManageOwn); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		if err := deleteDete(r.Context(), claims, id); err != nil {
+			http.Error(w, err.Error(), deteErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestValidateJMBG(t *testing.T) {
+	rodjen := time.Date(2021, time.March, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		name    string
+		jmbg    string
+		datum   time.Time
+		wantErr string
+	}{
+		{"ispravan", "1503021710011", rodjen, ""},
+		{"rodjen 1999", "0101999710124", time.Date(1999, time.January, 1, 0, 0, 0, 0, time.UTC), ""},
+		{"prekratak", "150302171001", rodjen, "13 cifara"},
+		{"slovo", "15030217100A1", rodjen, "13 cifara"},
+		{"pogresna kontrolna cifra", "1503021710012", rodjen, "kontrolna cifra"},
+		{"drugi datum rodjenja", "1503021710011", rodjen.AddDate(0, 0, 1), "datumom rodjenja"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := validateJMBG(tt.jmbg, tt.datum)
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("validateJMBG(%q) = %v, want nil", tt.jmbg, err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("validateJMBG(%q) = %v, want %q", tt.jmbg, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAgeAt(t *testing.T) {
+	rodjen := time.Date(2020, time.June, 15, 0, 0, 0, 0, time.UTC)
+
+	tests := []struct {
+		at   time.Time
+		want int
+	}{
+		{rodjen, 0},
+		{time.Date(2021, time.June, 14, 0, 0, 0, 0, time.UTC), 0},
+		{time.Date(2021, time.June, 15, 0, 0, 0, 0, time.UTC), 1},
+		{time.Date(2024, time.May, 31, 0, 0, 0, 0, time.UTC), 3},
+		{time.Date(2024, time.September, 1, 0, 0, 0, 0, time.UTC), 4},
+	}
+	for _, tt := range tests {
+		if got := ageAt(rodjen, tt.at); got != tt.want {
+			t.Errorf("ageAt(%s) = %d, want %d", tt.at.Format("2006-01-02"), got, tt.want)
+		}
+	}
+}
+
+func TestUpdateDeteLocksIdentityWhileRequestActive(t *testing.T) {
+	ctx := testMongo(t)
+	claims := jwt.MapClaims{"sub": "roditelj@test.rs"}
+	dete := Dete{
+		RoditeljEmail: "roditelj@test.rs",
+		Ime:           "Ana",
+		Prezime:       "Anic",
+		DatumRodjenja: time.Date(2021, time.March, 15, 0, 0, 0, 0, time.UTC),
+		JMBG:          "1503021710011",
+	}
+	res, err := deteCollection.InsertOne(ctx, dete)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dete.ID = insertedID(res.InsertedID)
+	zahtev, err := zahteviCollection.InsertOne(ctx, UpisZahtev{DeteID: dete.ID, KorisnikEmail: dete.RoditeljEmail, Status: statusSubmitted})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rename := DeteRequest{Ime: "Ana Marija", Prezime: "Anic", DatumRodjenja: "2021-03-15", JMBG: "1503021710011"}
+	if _, err := updateDete(ctx, claims, dete.ID, rename); err != nil {
+		t.Fatalf("promena imena uz aktivan zahtev: %v", err)
+	}
+	redate := DeteRequest{Ime: "Ana Marija", Prezime: "Anic", DatumRodjenja: "1999-01-01", JMBG: "0101999710124"}
+	if _, err := updateDete(ctx, claims, dete.ID, redate); !errors.Is(err, errChildIdentityLocked) {
+		t.Fatalf("promena datuma uz aktivan zahtev = %v, want errChildIdentityLocked", err)
+	}
+
+	if _, err := zahteviCollection.UpdateByID(ctx, zahtev.InsertedID, bson.M{"$set": bson.M{"status": statusWithdrawn}}); err != nil {
+		t.Fatal(err)
+	}
+	updated, err := updateDete(ctx, claims, dete.ID, redate)
+	if err != nil {
+		t.Fatalf("promena datuma bez aktivnog zahteva: %v", err)
+	}
+	if updated.JMBG != "0101999710124" {
+		t.Fatalf("JMBG = %q, want 0101999710124", updated.JMBG)
+	}
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/gridfs"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// DocumentStorage cuva sadrzaj prilozenih dokumenata. Metapodaci (tip,
+// velicina, status provere) stoje na zahtevu, a ovde samo bajtovi pod
+// kljucem koji vraca Save. Izbor se pravi preko DOCUMENT_STORAGE
+// (gridfs|disk).
+type DocumentStorage interface {
+	Save(ctx context.Context, name string, r io.Reader) (string, error)
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+var documentStorage DocumentStorage
+
+var errDocumentNotFound = errors.New("Dokument nije pronadjen")
+
+func initDocumentStorage(db *mongo.Database) {
+	switch strings.ToLower(strings.TrimSpace(getenvDefault("DOCUMENT_STORAGE", "gridfs"))) {
+	case "disk":
+		dir := getenvDefault("DOCUMENT_STORAGE_DIR", "/data/dokumenti")
+		if err := os.MkdirAll(dir, 0o750); err != nil {
+			log.Fatalf("Document storage error: %v", err)
+		}
+		documentStorage = diskStorage{dir: dir}
+	default:
+		bucket, err := gridfs.NewBucket(db, options.GridFSBucket().SetName("dokumenti"))
+		if err != nil {
+			log.Fatalf("Document storage error: %v", err)
+		}
+		documentStorage = gridFSStorage{bucket: bucket}
+	}
+}
+
+type gridFSStorage struct {
+	bucket *gridfs.Bucket
+}
+
+func (s gridFSStorage) Save(ctx context.Context, name string, r io.Reader) (string, error) {
+	id, err := s.bucket.UploadFromStream(name, r)
+	if err != nil {
+		return "", err
+	}
+	return id.Hex(), nil
+}
+
+func (s gridFSStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	id, err := primitive.ObjectIDFromHex(key)
+	if err != nil {
+		return nil, errDocumentNotFound
+	}
+	stream, err := s.bucket.OpenDownloadStream(id)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil, errDocumentNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return stream, nil
+}
+
+func (s gridFSStorage) Delete(ctx context.Context, key string) error {
+	id, err := primitive.ObjectIDFromHex(key)
+	if err != nil {
+		return errDocumentNotFound
+	}
+	err = s.bucket.Delete(id)
+	if errors.Is(err, gridfs.ErrFileNotFound) {
+		return nil
+	}
+	return err
+}
+
+// diskStorage cuva fajlove u jednom direktorijumu; kljuc je nasumican ID,
+// pa ime koje salje korisnik nikada ne ulazi u putanju.
+type diskStorage struct {
+	dir string
+}
+
+func (s diskStorage) path(key string) (string, error) {
+	if _, err := primitive.ObjectIDFromHex(key); err != nil {
+		return "", errDocumentNotFound
+	}
+	return filepath.Join(s.dir, key), nil
+}
+
+func (s diskStorage) Save(ctx context.Context, name string, r io.Reader) (string, error) {
+	key := primitive.NewObjectID().Hex()
+	path, _ := s.path(key)
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0o640)
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		os.Remove(path)
+		return "", err
+	}
+	if err := f.Close(); err != nil {
+		os.Remove(path)
+		return "", err
+	}
+	return key, nil
+}
+
+func (s diskStorage) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errDocumentNotFound
+	}
+	return f, err
+}
+
+func (s diskStorage) Delete(ctx context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
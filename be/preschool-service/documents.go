@@ -0,0 +1,349 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Roditelj prilaze dokumente kao fajlove (PDF ili JPEG), po jedan za svaki
+// tip. Polja PotvrdaVakcinacije i IzvodIzMaticneKnjige na zahtevu su sada
+// izvedena: true kada je dokument prilozen i nije odbijen pri proveri.
+const (
+	docStatusPending  = "na_proveri"
+	docStatusAccepted = "prihvacen"
+	docStatusRejected = "odbijen"
+
+	defaultDocumentMaxBytes = 5 << 20
+)
+
+// requiredDocuments mapira tip dokumenta na izvedeno polje zahteva.
+var requiredDocuments = map[string]string{
+	"potvrda_vakcinacije":     "potvrda_vakcinacije",
+	"izvod_iz_maticne_knjige": "izvod_iz_maticne_knjige",
+}
+
+var allowedDocumentTypes = map[string]string{
+	"application/pdf": ".pdf",
+	"image/jpeg":      ".jpg",
+}
+
+type PrilozenDokument struct {
+	Tip          string     `json:"tip" bson:"tip"`
+	NazivFajla   string     `json:"naziv_fajla" bson:"naziv_fajla"`
+	ContentType  string     `json:"content_type" bson:"content_type"`
+	Velicina     int64      `json:"velicina" bson:"velicina"`
+	StorageKey   string     `json:"-" bson:"storage_key"`
+	PostavljenAt time.Time  `json:"postavljen_at" bson:"postavljen_at"`
+	Status       string     `json:"status" bson:"status"`
+	Razlog       string     `json:"razlog,omitempty" bson:"razlog,omitempty"`
+	ProverioBy   string     `json:"proverio,omitempty" bson:"proverio,omitempty"`
+	ProverenAt   *time.Time `json:"proveren_at,omitempty" bson:"proveren_at,omitempty"`
+}
+
+type DokumentProveraRequest struct {
+	Status string `json:"status"`
+	Reason string `json:"reason"`
+}
+
+func documentMaxBytes() int64 {
+	n, err := strconv.ParseInt(getenvDefault("DOCUMENT_MAX_BYTES", ""), 10, 64)
+	if err != nil || n <= 0 {
+		return defaultDocumentMaxBytes
+	}
+	return n
+}
+
+func findDocument(item UpisZahtev, tip string) (PrilozenDokument, bool) {
+	for _, doc := range item.Dokumenti {
+		if doc.Tip == tip {
+			return doc, true
+		}
+	}
+	return PrilozenDokument{}, false
+}
+
+// documentsComplete je true kada su svi obavezni dokumenti prilozeni i
+// nijedan nije odbijen.
+func documentsComplete(item UpisZahtev) bool {
+	for tip := range requiredDocuments {
+		doc, ok := findDocument(item, tip)
+		if !ok || doc.Status == docStatusRejected {
+			return false
+		}
+	}
+	return true
+}
+
+func parseRequestDocumentPath(path string) (primitive.ObjectID, string, bool, error) {
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/zahtevi-upisa/"), "/"), "/")
+	if (len(parts) != 3 && len(parts) != 4) || parts[1] != "dokumenti" || (len(parts) == 4 && parts[3] != "provera") {
+		return primitive.NilObjectID, "", false, errors.New("Neispravan URL dokumenta")
+	}
+	id, err := primitive.ObjectIDFromHex(parts[0])
+	if err != nil {
+		return primitive.NilObjectID, "", false, errors.New("Neispravan ID zahteva")
+	}
+	tip := strings.ToLower(strings.TrimSpace(parts[2]))
+	if _, ok := requiredDocuments[tip]; !ok {
+		return primitive.NilObjectID, "", false, errors.New("Nepoznat tip dokumenta")
+	}
+	return id, tip, len(parts) == 4, nil
+}
+
+func uploadRequestDocument(ctx context.Context, claims jwt.MapClaims, id primitive.ObjectID, tip string, fileName string, data []byte) (*PrilozenDokument, error) {
+	item, err := getRequestByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if err := requireRequestOwner(claims, item); err != nil {
+		return nil, err
+	}
+	if !containsStatus(withdrawableStatuses, canonicalRequestStatus(item.Status)) {
+		return nil, errors.New("Dokumenti se ne mogu menjati za zavrsen zahtev")
+	}
+	if existing, ok := findDocument(item, tip); ok && existing.Status == docStatusAccepted {
+		return nil, errors.New("Dokument je vec prihvacen")
+	}
+
+	contentType := http.DetectContentType(data)
+	ext, ok := allowedDocumentTypes[contentType]
+	if !ok {
+		return nil, errors.New("Dozvoljeni su samo PDF i JPEG fajlovi")
+	}
+
+	key, err := documentStorage.Save(ctx, fmt.Sprintf("%s-%s%s", id.Hex(), tip, ext), bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+	doc := PrilozenDokument{
+		Tip:          tip,
+		NazivFajla:   sanitizeFileName(fileName, tip+ext),
+		ContentType:  contentType,
+		Velicina:     int64(len(data)),
+		StorageKey:   key,
+		PostavljenAt: time.Now(),
+		Status:       docStatusPending,
+	}
+
+	// Stari dokument istog tipa se menja novim u jednoj izmeni.
+	update := mongo.Pipeline{{{Key: "$set", Value: bson.M{
+		"dokumenti": bson.M{"$concatArrays": bson.A{
+			bson.M{"$filter": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$dokumenti", bson.A{}}},
+				"cond":  bson.M{"$ne": bson.A{"$$this.tip", tip}},
+			}},
+			// $literal, da se ime fajla koje pocinje sa $ ne tumaci kao izraz.
+			bson.M{"$literal": bson.A{doc}},
+		}},
+		requiredDocuments[tip]: true,
+	}}}}
+	res, err := zahteviCollection.UpdateOne(ctx, bson.M{"_id": id, "status": bson.M{"$in": withdrawableStatuses}}, update)
+	if err != nil || res.MatchedCount == 0 {
+		if delErr := documentStorage.Delete(ctx, key); delErr != nil {
+			log.Printf("Document cleanup warning for %s: %v", key, delErr)
+		}
+		if err == nil {
+			err = errRequestChanged
+		}
+		return nil, err
+	}
+
+	if existing, ok := findDocument(item, tip); ok {
+		if err := documentStorage.Delete(ctx, existing.StorageKey); err != nil {
+			log.Printf("Document cleanup warning for %s: %v", existing.StorageKey, err)
+		}
+	}
+	return &doc, nil
+}
+
+func verifyRequestDocument(ctx context.Context, claims jwt.MapClaims, item UpisZahtev, tip string, req DokumentProveraRequest) error {
+	status := strings.ToLower(strings.TrimSpace(req.Status))
+	reason := strings.TrimSpace(req.Reason)
+	if status != docStatusAccepted && status != docStatusRejected {
+		return errors.New("Status provere mora biti prihvacen ili odbijen")
+	}
+	if status == docStatusRejected && reason == "" {
+		return errors.New("Unesite razlog odbijanja dokumenta")
+	}
+	if _, ok := findDocument(item, tip); !ok {
+		return mongo.ErrNoDocuments
+	}
+
+	now := time.Now()
+	set := bson.M{
+		"dokumenti.$.status":      status,
+		"dokumenti.$.proverio":    strings.ToLower(strings.TrimSpace(claimString(claims, "sub"))),
+		"dokumenti.$.proveren_at": now,
+		requiredDocuments[tip]:    status == docStatusAccepted,
+	}
+	update := bson.M{"$set": set}
+	if reason != "" {
+		set["dokumenti.$.razlog"] = reason
+	} else {
+		update["$unset"] = bson.M{"dokumenti.$.razlog": ""}
+	}
+	res, err := zahteviCollection.UpdateOne(ctx, bson.M{"_id": item.ID, "dokumenti.tip": tip}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+func sanitizeFileName(name, fallback string) string {
+	name = strings.TrimSpace(name)
+	if i := strings.LastIndexAny(name, `/\`); i >= 0 {
+		name = name[i+1:]
+	}
+	name = strings.Map(func(r rune) rune {
+		if r < 32 || r == '"' || r > 126 {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" {
+		return fallback
+	}
+	return name
+}
+
+func handleRequestDocument(w http.ResponseWriter, r *http.Request, claims jwt.MapClaims) {
+	id, tip, provera, err := parseRequestDocumentPath(r.URL.Path)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodPost && !provera:
+		if err := authorize(claims, permEnrollmentUpdateOwn); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		maxBytes := documentMaxBytes()
+		r.Body = http.MaxBytesReader(w, r.Body, maxBytes+1<<20)
+		if err := r.ParseMultipartForm(maxBytes); err != nil {
+			http.Error(w, "Fajl je prevelik ili zahtev nije ispravan", http.StatusRequestEntityTooLarge)
+			return
+		}
+		file, header, err := r.FormFile("fajl")
+		if err != nil {
+			http.Error(w, "Fajl je obavezan", http.StatusBadRequest)
+			return
+		}
+		defer file.Close()
+		data, err := io.ReadAll(io.LimitReader(file, maxBytes+1))
+		if err != nil {
+			http.Error(w, "Greska pri citanju fajla", http.StatusBadRequest)
+			return
+		}
+		if int64(len(data)) > maxBytes {
+			http.Error(w, fmt.Sprintf("Fajl ne sme biti veci od %d KB", maxBytes>>10), http.StatusRequestEntityTooLarge)
+			return
+		}
+		if len(data) == 0 {
+			http.Error(w, "Fajl je prazan", http.StatusBadRequest)
+			return
+		}
+
+		doc, err := uploadRequestDocument(r.Context(), claims, id, tip, header.Filename, data)
+		if err != nil {
+			status := http.StatusBadRequest
+			switch {
+			case errors.Is(err, mongo.ErrNoDocuments):
+				status = http.StatusNotFound
+			case errors.Is(err, errRequestChanged):
+				status = http.StatusConflict
+			case strings.Contains(err.Error(), "Nemate dozvolu"):
+				status = http.StatusForbidden
+			}
+			http.Error(w, err.Error(), status)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(doc)
+
+	case r.Method == http.MethodGet && !provera:
+		item, err := getRequestByID(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				http.Error(w, "Zahtev nije pronadjen", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Greska pri citanju zahteva", http.StatusInternalServerError)
+			return
+		}
+		if !canAccessRequestDocument(item, claims) {
+			http.Error(w, "Nemate dozvolu za ovaj dokument", http.StatusForbidden)
+			return
+		}
+		doc, ok := findDocument(item, tip)
+		if !ok {
+			http.Error(w, "Dokument nije prilozen", http.StatusNotFound)
+			return
+		}
+		content, err := documentStorage.Open(r.Context(), doc.StorageKey)
+		if err != nil {
+			if errors.Is(err, errDocumentNotFound) {
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Greska pri citanju dokumenta", http.StatusInternalServerError)
+			return
+		}
+		defer content.Close()
+		w.Header().Set("Content-Type", doc.ContentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", doc.NazivFajla))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		io.Copy(w, content)
+
+	case r.Method == http.MethodPut && provera:
+		item, err := getRequestByID(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				http.Error(w, "Zahtev nije pronadjen", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Greska pri citanju zahteva", http.StatusInternalServerError)
+			return
+		}
+		if err := authorizeVrtic(claims, permEnrollmentProcess, item.VrticID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		var payload DokumentProveraRequest
+		if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
+			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+			return
+		}
+		if err := verifyRequestDocument(r.Context(), claims, item, tip, payload); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				http.Error(w, "Dokument nije prilozen", http.StatusNotFound)
+				return
+			}
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
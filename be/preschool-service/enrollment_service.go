@@ -8,6 +8,7 @@ import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"log"
 	"net/http"
 	"sort"
 	"strings"
@@ -67,12 +68,24 @@ func getKriticni(ctx context.Context) ([]VrticView, error) {
 	return toViews(kriticni), nil
 }
 
-func izvestajPoOpstini(ctx context.Context) ([]OpstinaIzvestaj, error) {
+// izvestajPoOpstini sabira kapacitete po opstini. Bez radne godine broj
+// upisanih je trenutno stanje vrtica; sa godinom se broje deca koja su u toj
+// godini bila upisana (odobreni zahtevi te godine, ukljucujuci kasnije
+// ispisane i prevedene u sledecu godinu).
+func izvestajPoOpstini(ctx context.Context, radnaGodina string) ([]OpstinaIzvestaj, error) {
 	all, err := getAllVrtici(ctx)
 	if err != nil {
 		return nil, err
 	}
 
+	var upisanoPoVrticu map[primitive.ObjectID]int
+	if radnaGodina != "" {
+		upisanoPoVrticu, err = enrolledPerVrticInYear(ctx, radnaGodina)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	byOpstina := map[string]*OpstinaIzvestaj{}
 	for _, v := range all {
 		key := v.Opstina
@@ -81,12 +94,16 @@ func izvestajPoOpstini(ctx context.Context) ([]OpstinaIzvestaj, error) {
 		}
 		entry, ok := byOpstina[key]
 		if !ok {
-			entry = &OpstinaIzvestaj{Opstina: key}
+			entry = &OpstinaIzvestaj{Opstina: key, RadnaGodina: radnaGodina}
 			byOpstina[key] = entry
 		}
 		entry.BrojVrtica++
 		entry.UkupanKapacitet += v.MaxKapacitet
-		entry.UkupnoUpisano += v.TrenutnoUpisano
+		if upisanoPoVrticu != nil {
+			entry.UkupnoUpisano += upisanoPoVrticu[v.ID]
+		} else {
+			entry.UkupnoUpisano += v.TrenutnoUpisano
+		}
 	}
 
 	var report []OpstinaIzvestaj
@@ -104,7 +121,102 @@ func izvestajPoOpstini(ctx context.Context) ([]OpstinaIzvestaj, error) {
 	return report, nil
 }
 
-func createEnrollmentRequest(ctx context.Context, claims jwt.MapClaims, req UpisRequest) (*UpisZahtev, error) {
+var errActiveEnrollmentExists = errors.New("Vec postoji aktivan zahtev ili prijava za ovo dete")
+
+// ensureNoActiveEnrollment odbija novi zahtev ako dete vec ima aktivan
+// zahtev u bilo kom vrticu. Izbori prijave su obicni zahtevi, pa ovo
+// pokriva i aktivne prijave; filter dodatno iskljucuje zahteve koji se
+// ne racunaju (npr. zahtev koji se menja). Provera daje razumljivu gresku
+// unapred, a istovremena podnosenja odbija jedinstveni indeks na
+// aktivno_dete_id (activeEnrollmentError).
+func ensureNoActiveEnrollment(ctx context.Context, deteID primitive.ObjectID, filter bson.M) error {
+	filter["dete_id"] = deteID
+	filter["status"] = bson.M{"$in": activeRequestStatuses}
+	exists, err := zahteviCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if exists > 0 {
+		return errActiveEnrollmentExists
+	}
+	return nil
+}
+
+// activeEnrollmentError prevodi povredu jedinstvenog indeksa na
+// aktivno_dete_id u gresku o vec aktivnom zahtevu.
+func activeEnrollmentError(err error) error {
+	if mongo.IsDuplicateKeyError(err) {
+		return errActiveEnrollmentExists
+	}
+	return err
+}
+
+// releaseActiveEnrollment skida oznaku aktivnog zahteva sa zavrsenog
+// zahteva i, ako je to bio nosilac prijave, prenosi je na izbor iste
+// prijave koji je jos aktivan.
+func releaseActiveEnrollment(ctx context.Context, id primitive.ObjectID) {
+	var item UpisZahtev
+	err := zahteviCollection.FindOneAndUpdate(ctx,
+		bson.M{"_id": id, "aktivno_dete_id": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"aktivno_dete_id": ""}},
+	).Decode(&item)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return
+	}
+	if err != nil {
+		log.Printf("Active enrollment release warning for zahtev %s: %v", id.Hex(), err)
+		return
+	}
+	if item.PrijavaID.IsZero() {
+		return
+	}
+	next := zahteviCollection.FindOneAndUpdate(ctx,
+		bson.M{"prijava_id": item.PrijavaID, "_id": bson.M{"$ne": id}, "status": bson.M{"$in": activeRequestStatuses}},
+		bson.M{"$set": bson.M{"aktivno_dete_id": item.AktivnoDeteID}},
+		options.FindOneAndUpdate().SetSort(bson.D{{Key: "preferencija", Value: 1}}),
+	)
+	if err := next.Err(); err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		log.Printf("Active enrollment transfer warning for prijava %s: %v", item.PrijavaID.Hex(), err)
+	}
+}
+
+// migrateActiveEnrollmentHolders jednokratno oznacava po jedan aktivan
+// zahtev svakog deteta (najstariji) pre uvodjenja jedinstvenog indeksa.
+func migrateActiveEnrollmentHolders(ctx context.Context, db *mongo.Database) error {
+	const name = "zahtevi_aktivno_dete"
+	migrations := db.Collection("migracije")
+	if n, err := migrations.CountDocuments(ctx, bson.M{"_id": name}); err != nil || n > 0 {
+		return err
+	}
+
+	cursor, err := zahteviCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"dete_id": bson.M{"$exists": true}, "status": bson.M{"$in": activeRequestStatuses}}}},
+		{{Key: "$sort", Value: bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}}},
+		{{Key: "$group", Value: bson.M{"_id": "$dete_id", "zahtev_id": bson.M{"$first": "$_id"}}}},
+	})
+	if err != nil {
+		return err
+	}
+	var holders []struct {
+		DeteID   primitive.ObjectID `bson:"_id"`
+		ZahtevID primitive.ObjectID `bson:"zahtev_id"`
+	}
+	if err := cursor.All(ctx, &holders); err != nil {
+		return err
+	}
+	for _, h := range holders {
+		if _, err := zahteviCollection.UpdateOne(ctx, bson.M{"_id": h.ZahtevID}, bson.M{"$set": bson.M{"aktivno_dete_id": h.DeteID}}); err != nil {
+			return err
+		}
+	}
+
+	_, err = migrations.InsertOne(ctx, bson.M{"_id": name, "izvrsena_at": time.Now()})
+	return err
+}
+
+// buildEnrollmentRequest proverava unos i pravi zahtev za upis bez upisa u
+// bazu; koristi ga i podnosenje prijave sa vise vrtica.
+func buildEnrollmentRequest(ctx context.Context, claims jwt.MapClaims, req UpisRequest) (*UpisZahtev, error) {
 	if err := validateEnrollmentInput(req); err != nil {
 		return nil, err
 	}
@@ -117,7 +229,7 @@ func createEnrollmentRequest(ctx context.Context, claims jwt.MapClaims, req Upis
 	vrtic, err := getVrticByID(ctx, vrticID)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, errors.New("Vrtic nije pronadjen")
+			return nil, errVrticNotFound
 		}
 		return nil, err
 	}
@@ -134,29 +246,35 @@ func createEnrollmentRequest(ctx context.Context, claims jwt.MapClaims, req Upis
 	if korisnikEmail == "" {
 		return nil, errors.New("Neispravan token")
 	}
+	if !claimBool(claims, "email_verified") {
+		return nil, errors.New("Potvrdite email adresu pre podnosenja zahteva za upis")
+	}
 
-	blockingStatuses := append([]string{}, activeRequestStatuses...)
-	blockingStatuses = append(blockingStatuses, "na_cekanju", "u_proveri")
-	exists, err := zahteviCollection.CountDocuments(ctx, bson.M{
-		"vrtic_id":       vrticID,
-		"korisnik_email": korisnikEmail,
-		"ime_deteta":     strings.TrimSpace(req.ImeDeteta),
-		"status":         bson.M{"$in": blockingStatuses},
-	})
+	dete, brojGodina, grupa, err := enrollmentChild(ctx, claims, req.DeteID, vrtic, konkurs)
 	if err != nil {
 		return nil, err
 	}
-	if exists > 0 {
-		return nil, errors.New("Vec postoji aktivan zahtev za ovo dete u izabranom vrticu")
+
+	if err := ensureNoActiveEnrollment(ctx, dete.ID, bson.M{}); err != nil {
+		return nil, err
 	}
 
+	free, err := freeSeatsInYear(ctx, vrtic, konkurs.RadnaGodina)
+	if err != nil {
+		return nil, err
+	}
 	status := statusSubmitted
 	reason := ""
-	if slobodnaMesta(vrtic) <= 0 {
+	if free <= 0 {
 		status = statusWaitingList
 		reason = "Trenutno nema slobodnih mesta. Zahtev je dodat na listu cekanja."
 	}
 
+	kriterijumi, bodovi, err := scoreRequest(konkurs, req.Kriterijumi)
+	if err != nil {
+		return nil, err
+	}
+
 	approvedForKonkurs, err := countApprovedRequestsForKonkurs(ctx, konkurs.ID)
 	if err != nil {
 		return nil, err
@@ -165,31 +283,47 @@ func createEnrollmentRequest(ctx context.Context, claims jwt.MapClaims, req Upis
 		status = statusWaitingList
 		reason = "Konkurs je trenutno popunjen. Zahtev je dodat na listu cekanja."
 	}
+	if full := groupFullReason(vrtic, konkurs, grupa); full != "" {
+		status = statusWaitingList
+		reason = full
+	}
 
 	item := UpisZahtev{
-		VrticID:    vrticID,
-		KonkursID:  konkurs.ID,
-		VrticNaziv: vrtic.Naziv,
-
-		ImeRoditelja:         strings.TrimSpace(req.ImeRoditelja),
-		ImeDeteta:            strings.TrimSpace(req.ImeDeteta),
-		BrojGodina:           req.BrojGodina,
-		KorisnikEmail:        korisnikEmail,
-		PotvrdaVakcinacije:   req.PotvrdaVakcinacije,
-		IzvodIzMaticneKnjige: req.IzvodIzMaticneKnjige,
-		Status:               status,
-		CreatedAt:            time.Now(),
-		Reason:               reason,
+		VrticID:     vrticID,
+		KonkursID:   konkurs.ID,
+		RadnaGodina: konkurs.RadnaGodina,
+		VrticNaziv:  vrtic.Naziv,
+
+		ImeRoditelja:  strings.TrimSpace(req.ImeRoditelja),
+		DeteID:        dete.ID,
+		AktivnoDeteID: dete.ID,
+		Grupa:         grupa,
+		ImeDeteta:     dete.PunoIme(),
+		BrojGodina:    brojGodina,
+		KorisnikEmail: korisnikEmail,
+		Kriterijumi:   kriterijumi,
+		Bodovi:        bodovi,
+		Status:        status,
+		CreatedAt:     time.Now(),
+		Reason:        reason,
+		Istorija:      []StatusPromena{newStatusChange(claims, "", status, reason)},
 	}
+	return &item, nil
+}
 
-	res, err := zahteviCollection.InsertOne(ctx, item)
+func createEnrollmentRequest(ctx context.Context, claims jwt.MapClaims, req UpisRequest) (*UpisZahtev, error) {
+	item, err := buildEnrollmentRequest(ctx, claims, req)
 	if err != nil {
 		return nil, err
 	}
+	res, err := zahteviCollection.InsertOne(ctx, item)
+	if err != nil {
+		return nil, activeEnrollmentError(err)
+	}
 	if id, ok := res.InsertedID.(primitive.ObjectID); ok {
 		item.ID = id
 	}
-	return &item, nil
+	return item, nil
 }
 
 func processEnrollmentRequest(ctx context.Context, claims jwt.MapClaims, id primitive.ObjectID, action string, reason string) error {
@@ -201,65 +335,51 @@ func processEnrollmentRequest(ctx context.Context, claims jwt.MapClaims, id prim
 	current := canonicalRequestStatus(item.Status)
 	reason = strings.TrimSpace(reason)
 
+	if action == "odbij-ispis" {
+		return cancelUnenrollment(ctx, item)
+	}
+	target, ok := requestActionTargets[action]
+	if !ok {
+		return errors.New("Nepoznata akcija")
+	}
+	if err := checkRequestTransition(current, target); err != nil {
+		return err
+	}
+
 	switch action {
-	case "obrada":
-		if current != statusSubmitted && current != statusNeedDocs && current != statusWaitingList {
-			return errors.New("Samo podnet, vracen ili cekajuci zahtev moze da predje u obradu")
-		}
-		return updateRequestStatus(ctx, id, claims, statusInReview, "")
 	case "dopuna":
-		if current == statusApproved || current == statusRejected {
-			return errors.New("Zahtev je vec zavrsen")
-		}
 		if reason == "" {
 			return errors.New("Unesite sta nedostaje u dokumentaciji")
 		}
-		return updateRequestStatus(ctx, id, claims, statusNeedDocs, reason)
 	case "odbij":
-		if current == statusApproved || current == statusRejected {
-			return errors.New("Zahtev je vec zavrsen")
-		}
 		if reason == "" {
 			return errors.New("Unesite razlog odbijanja")
 		}
-		return updateRequestStatus(ctx, id, claims, statusRejected, reason)
-	case "odobri":
-		if current == statusApproved || current == statusRejected {
-			return errors.New("Zahtev je vec zavrsen")
-		}
-
-		vrtic, err := getVrticByID(ctx, item.VrticID)
-		if err != nil {
+		if err := updateRequestStatus(ctx, id, claims, current, statusRejected, reason); err != nil {
 			return err
 		}
-		if slobodnaMesta(vrtic) <= 0 {
-			return updateRequestStatus(ctx, id, claims, statusWaitingList, "Trenutno nema slobodnih mesta. Zahtev ostaje na listi cekanja.")
-		}
-		if !item.KonkursID.IsZero() {
-			konkurs, err := getKonkursByID(ctx, item.KonkursID)
-			if err != nil {
-				return err
-			}
-			approvedForKonkurs, err := countApprovedRequestsForKonkurs(ctx, konkurs.ID)
-			if err != nil {
-				return err
-			}
-			if approvedForKonkurs >= konkurs.MaxMesta {
-				return updateRequestStatus(ctx, id, claims, statusWaitingList, "Konkurs je trenutno popunjen. Zahtev ostaje na listi cekanja.")
-			}
-		}
-
-		vrtic.TrenutnoUpisano++
-		if err := updateVrtic(ctx, vrtic.ID, vrtic); err != nil {
-			return err
+		// Odbijanjem vec odobrenog zahteva oslobadja se mesto za listu cekanja,
+		// a dete se uklanja iz vaspitne grupe i buducih sastanaka.
+		if current == statusApproved {
+			releaseSeats(ctx, item, !item.KonkursID.IsZero())
+			cleanupEnrollmentViews(ctx, item)
+			onSeatsFreed(ctx, item.VrticID, "odbijen_odobren_zahtev")
 		}
-		return updateRequestStatus(ctx, id, claims, statusApproved, "")
-	default:
-		return errors.New("Nepoznata akcija")
+		return nil
+	case "odobri":
+		return approveEnrollment(ctx, claims, item, current)
+	case "potvrdi-ispis":
+		return confirmUnenrollment(ctx, claims, item)
 	}
+	return updateRequestStatus(ctx, id, claims, current, target, reason)
 }
-func getAllRequests(ctx context.Context) ([]UpisZahtev, error) {
-	cursor, err := zahteviCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+
+func getAllRequests(ctx context.Context, radnaGodina string, scope VrticScope) ([]UpisZahtev, error) {
+	filter := bson.M{}
+	if radnaGodina != "" {
+		filter["radna_godina"] = radnaGodina
+	}
+	cursor, err := zahteviCollection.Find(ctx, scope.apply(filter), options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
 	if err != nil {
 		return nil, err
 	}
@@ -305,25 +425,50 @@ func getRequestByID(ctx context.Context, id primitive.ObjectID) (UpisZahtev, err
 	return item, err
 }
 
-func updateRequestStatus(ctx context.Context, id primitive.ObjectID, claims jwt.MapClaims, status string, reason string) error {
-	now := time.Now()
-	payload := bson.M{
-		"status":       canonicalRequestStatus(status),
-		"processed_at": now,
-		"processed_by": strings.ToLower(strings.TrimSpace(claimString(claims, "sub"))),
+// updateRequestStatus uslovno menja status (samo ako je zahtev i dalje u
+// statusu from), proverava tabelu prelaza i dopisuje promenu u istoriju.
+func updateRequestStatus(ctx context.Context, id primitive.ObjectID, claims jwt.MapClaims, from string, status string, reason string) error {
+	if err := checkRequestTransition(from, status); err != nil {
+		return err
 	}
-	reason = strings.TrimSpace(reason)
-	update := bson.M{"$set": payload}
-	if reason != "" {
-		payload["reason"] = reason
+	change := newStatusChange(claims, from, status, reason)
+	payload := bson.M{"status": change.Na}
+	unset := bson.M{}
+	update := bson.M{"$set": payload, "$push": bson.M{"istorija": change}}
+	// Zahtev vracen u podnet (dopunjena dokumentacija) ponovo ceka obradu,
+	// pa nema obradjivaca ni razloga; razlog ostaje samo u istoriji.
+	if change.Na == statusSubmitted {
+		unset["processed_at"] = ""
+		unset["processed_by"] = ""
+		unset["reason"] = ""
 	} else {
-		update["$unset"] = bson.M{"reason": ""}
+		payload["processed_at"] = change.Vreme
+		payload["processed_by"] = change.Korisnik
+		if change.Razlog != "" {
+			payload["reason"] = change.Razlog
+		} else {
+			unset["reason"] = ""
+		}
 	}
-	_, err := zahteviCollection.UpdateOne(ctx, bson.M{"_id": id}, update)
-	return err
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	res, err := zahteviCollection.UpdateOne(ctx, bson.M{"_id": id, "status": canonicalRequestStatus(from)}, update)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errRequestChanged
+	}
+	if !containsStatus(activeRequestStatuses, change.Na) {
+		releaseActiveEnrollment(ctx, id)
+	}
+	return nil
 }
 
-func updateRequestDocuments(ctx context.Context, claims jwt.MapClaims, id primitive.ObjectID, payload DokumentaUpdateRequest) error {
+// updateRequestDocuments vraca zahtev iz dopune u podnet kada su svi
+// obavezni dokumenti prilozeni (vidi documents.go).
+func updateRequestDocuments(ctx context.Context, claims jwt.MapClaims, id primitive.ObjectID) error {
 	item, err := getRequestByID(ctx, id)
 	if err != nil {
 		return err
@@ -335,22 +480,10 @@ func updateRequestDocuments(ctx context.Context, claims jwt.MapClaims, id primit
 	if canonicalRequestStatus(item.Status) != statusNeedDocs {
 		return errors.New("Dokumentacija se moze dopuniti samo kada je zahtev vracen na dopunu")
 	}
-	if !payload.PotvrdaVakcinacije || !payload.IzvodIzMaticneKnjige {
-		return errors.New("Obe stavke dokumentacije moraju biti prilozene")
+	if !documentsComplete(item) {
+		return errors.New("Obe stavke dokumentacije moraju biti prilozene, a odbijeni dokumenti zamenjeni")
 	}
-	_, err = zahteviCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
-		"$set": bson.M{
-			"potvrda_vakcinacije":     true,
-			"izvod_iz_maticne_knjige": true,
-			"status":                  statusSubmitted,
-		},
-		"$unset": bson.M{
-			"processed_at": "",
-			"processed_by": "",
-			"reason":       "",
-		},
-	})
-	return err
+	return updateRequestStatus(ctx, id, claims, statusNeedDocs, statusSubmitted, "Dokumentacija dopunjena")
 }
 
 func updateEnrollmentRequest(ctx context.Context, claims jwt.MapClaims, id primitive.ObjectID, req UpisRequest) (*UpisZahtev, error) {
@@ -370,16 +503,23 @@ func updateEnrollmentRequest(ctx context.Context, claims jwt.MapClaims, id primi
 	if canonicalRequestStatus(item.Status) != statusNeedDocs {
 		return nil, errors.New("Zahtev moze da se izmeni samo kada je vracen na dopunu")
 	}
+	if !documentsComplete(item) {
+		return nil, errors.New("Obe stavke dokumentacije moraju biti prilozene, a odbijeni dokumenti zamenjeni")
+	}
 
 	vrticID, err := primitive.ObjectIDFromHex(strings.TrimSpace(req.VrticID))
 	if err != nil {
 		return nil, errors.New("Neispravan ID vrtica")
 	}
+	// Izbori prijave sa vise vrtica imaju fiksan vrtic i redosled.
+	if !item.PrijavaID.IsZero() && vrticID != item.VrticID {
+		return nil, errors.New("Vrtic se ne moze promeniti za zahtev iz prijave sa vise vrtica")
+	}
 
 	vrtic, err := getVrticByID(ctx, vrticID)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, errors.New("Vrtic nije pronadjen")
+			return nil, errVrticNotFound
 		}
 		return nil, err
 	}
@@ -392,29 +532,36 @@ func updateEnrollmentRequest(ctx context.Context, claims jwt.MapClaims, id primi
 		return nil, err
 	}
 
-	blockingStatuses := append([]string{}, activeRequestStatuses...)
-	blockingStatuses = append(blockingStatuses, statusSubmitted, statusWaitingList, "u_proveri")
-	exists, err := zahteviCollection.CountDocuments(ctx, bson.M{
-		"_id":            bson.M{"$ne": id},
-		"vrtic_id":       vrticID,
-		"korisnik_email": email,
-		"ime_deteta":     strings.TrimSpace(req.ImeDeteta),
-		"status":         bson.M{"$in": blockingStatuses},
-	})
+	dete, brojGodina, grupa, err := enrollmentChild(ctx, claims, req.DeteID, vrtic, konkurs)
 	if err != nil {
 		return nil, err
 	}
-	if exists > 0 {
-		return nil, errors.New("Vec postoji aktivan zahtev za ovo dete u izabranom vrticu")
+
+	// Ostali izbori iste prijave su isto dete i ne racunaju se kao duplikat.
+	exclude := bson.M{"_id": bson.M{"$ne": id}}
+	if !item.PrijavaID.IsZero() {
+		exclude["prijava_id"] = bson.M{"$ne": item.PrijavaID}
+	}
+	if err := ensureNoActiveEnrollment(ctx, dete.ID, exclude); err != nil {
+		return nil, err
 	}
 
+	free, err := freeSeatsInYear(ctx, vrtic, konkurs.RadnaGodina)
+	if err != nil {
+		return nil, err
+	}
 	status := statusSubmitted
 	reason := ""
-	if slobodnaMesta(vrtic) <= 0 {
+	if free <= 0 {
 		status = statusWaitingList
 		reason = "Trenutno nema slobodnih mesta. Zahtev je dodat na listu cekanja."
 	}
 
+	kriterijumi, bodovi, err := scoreRequest(konkurs, req.Kriterijumi)
+	if err != nil {
+		return nil, err
+	}
+
 	approvedForKonkurs, err := countApprovedRequestsForKonkurs(ctx, konkurs.ID)
 	if err != nil {
 		return nil, err
@@ -423,33 +570,49 @@ func updateEnrollmentRequest(ctx context.Context, claims jwt.MapClaims, id primi
 		status = statusWaitingList
 		reason = "Konkurs je trenutno popunjen. Zahtev je dodat na listu cekanja."
 	}
+	if full := groupFullReason(vrtic, konkurs, grupa); full != "" {
+		status = statusWaitingList
+		reason = full
+	}
 
 	update := bson.M{
 		"$set": bson.M{
-			"vrtic_id":                vrticID,
-			"konkurs_id":              konkurs.ID,
-			"vrtic_naziv":             vrtic.Naziv,
-			"ime_roditelja":           strings.TrimSpace(req.ImeRoditelja),
-			"ime_deteta":              strings.TrimSpace(req.ImeDeteta),
-			"broj_godina":             req.BrojGodina,
-			"potvrda_vakcinacije":     req.PotvrdaVakcinacije,
-			"izvod_iz_maticne_knjige": req.IzvodIzMaticneKnjige,
-			"status":                  status,
-			"reason":                  reason,
+			"vrtic_id":      vrticID,
+			"konkurs_id":    konkurs.ID,
+			"radna_godina":  konkurs.RadnaGodina,
+			"vrtic_naziv":   vrtic.Naziv,
+			"ime_roditelja": strings.TrimSpace(req.ImeRoditelja),
+			"dete_id":       dete.ID,
+			"grupa":         grupa,
+			"ime_deteta":    dete.PunoIme(),
+			"broj_godina":   brojGodina,
+			"kriterijumi":   kriterijumi,
+			"bodovi":        bodovi,
+			"status":        status,
+			"reason":        reason,
 		},
 		"$unset": bson.M{
 			"processed_at": "",
 			"processed_by": "",
 		},
+		"$push": bson.M{"istorija": newStatusChange(claims, statusNeedDocs, status, reason)},
 	}
 
 	if reason == "" {
 		update["$unset"].(bson.M)["reason"] = ""
 		delete(update["$set"].(bson.M), "reason")
 	}
+	// Oznaka aktivnog zahteva prati dete ako je zahtev nosilac.
+	if !item.AktivnoDeteID.IsZero() {
+		update["$set"].(bson.M)["aktivno_dete_id"] = dete.ID
+	}
 
-	if _, err := zahteviCollection.UpdateOne(ctx, bson.M{"_id": id}, update); err != nil {
-		return nil, err
+	res, err := zahteviCollection.UpdateOne(ctx, bson.M{"_id": id, "status": statusNeedDocs}, update)
+	if err != nil {
+		return nil, activeEnrollmentError(err)
+	}
+	if res.MatchedCount == 0 {
+		return nil, errRequestChanged
 	}
 
 	updated, err := getRequestByID(ctx, id)
@@ -470,7 +633,7 @@ func createAssignment(ctx context.Context, req VaspitacRasporedRequest) (*Vaspit
 	vrtic, err := getVrticByID(ctx, vrticID)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, errors.New("Vrtic nije pronadjen")
+			return nil, errVrticNotFound
 		}
 		return nil, err
 	}
@@ -498,8 +661,8 @@ func createAssignment(ctx context.Context, req VaspitacRasporedRequest) (*Vaspit
 	return &item, nil
 }
 
-func listAssignments(ctx context.Context) ([]VaspitacRaspored, error) {
-	cursor, err := rasporediCollection.Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+func listAssignments(ctx context.Context, scope VrticScope) ([]VaspitacRaspored, error) {
+	cursor, err := rasporediCollection.Find(ctx, scope.apply(bson.M{}), options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
 	if err != nil {
 		return nil, err
 	}
@@ -515,15 +678,25 @@ func listAssignments(ctx context.Context) ([]VaspitacRaspored, error) {
 	return items, cursor.Err()
 }
 
+func getAssignmentByID(ctx context.Context, id primitive.ObjectID) (VaspitacRaspored, error) {
+	var item VaspitacRaspored
+	err := rasporediCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&item)
+	return item, err
+}
+
+// deleteAssignment uklanja vaspitaca iz vrtica, iz svih grupa i smena tog
+// vrtica.
 func deleteAssignment(ctx context.Context, id primitive.ObjectID) error {
-	res, err := rasporediCollection.DeleteOne(ctx, bson.M{"_id": id})
-	if err != nil {
+	var item VaspitacRaspored
+	if err := rasporediCollection.FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&item); err != nil {
 		return err
 	}
-	if res.DeletedCount == 0 {
-		return mongo.ErrNoDocuments
-	}
-	return nil
+	removeEducatorShifts(ctx, item.VrticID, item.VaspitacEmail)
+	_, err := vaspitneGrupeCollection.UpdateMany(ctx,
+		bson.M{"vrtic_id": item.VrticID, "vaspitaci": item.VaspitacEmail},
+		bson.M{"$pull": bson.M{"vaspitaci": item.VaspitacEmail}},
+	)
+	return err
 }
 
 func getAssignmentsByVrtic(ctx context.Context, vrticID primitive.ObjectID) ([]VaspitacRaspored, error) {
@@ -570,17 +743,13 @@ func getRoditeljVaspitaci(ctx context.Context, email string) ([]RoditeljVaspitac
 		if canonicalRequestStatus(item.Status) != statusApproved {
 			continue
 		}
-		assignments, err := getAssignmentsByVrtic(ctx, item.VrticID)
+		emails, err := requestEducators(ctx, item)
 		if err != nil {
 			return nil, err
 		}
-		if len(assignments) == 0 {
+		if len(emails) == 0 {
 			continue
 		}
-		emails := make([]string, 0, len(assignments))
-		for _, assignment := range assignments {
-			emails = append(emails, assignment.VaspitacEmail)
-		}
 		result = append(result, RoditeljVaspitaciView{
 			ZahtevID:   item.ID,
 			VrticID:    item.VrticID,
@@ -637,12 +806,12 @@ func createMeeting(ctx context.Context, claims jwt.MapClaims, req SastanakReques
 		return nil, errors.New("Sastanak se moze zakazati samo za odobren upis")
 	}
 	educatorEmail := strings.ToLower(strings.TrimSpace(req.VaspitacEmail))
-	allowed, err := educatorAssignedToVrtic(ctx, educatorEmail, item.VrticID)
+	allowed, err := educatorResponsibleFor(ctx, educatorEmail, item)
 	if err != nil {
 		return nil, err
 	}
 	if !allowed {
-		return nil, errors.New("Izabrani vaspitac nije rasporedjen u vrtic deteta")
+		return nil, errors.New("Izabrani vaspitac nije vaspitac grupe deteta")
 	}
 	termin, err := parseMeetingTime(req.Termin)
 	if err != nil {
@@ -653,6 +822,7 @@ func createMeeting(ctx context.Context, claims jwt.MapClaims, req SastanakReques
 	}
 	meeting := Sastanak{
 		ZahtevID:      item.ID,
+		DeteID:        item.DeteID,
 		VrticID:       item.VrticID,
 		VrticNaziv:    item.VrticNaziv,
 		ImeDeteta:     item.ImeDeteta,
@@ -744,8 +914,17 @@ func getMeetingsByParent(ctx context.Context, email string) ([]Sastanak, error)
 	return items, cursor.Err()
 }
 
+// getMeetingsByEducator vraca sastanke vaspitaca samo za decu iz njegovih
+// grupa; sastanci deteta premestenog u drugu grupu se ne prikazuju.
 func getMeetingsByEducator(ctx context.Context, email string) ([]Sastanak, error) {
-	cursor, err := sastanciCollection.Find(ctx, bson.M{"vaspitac_email": strings.ToLower(strings.TrimSpace(email))}, options.Find().SetSort(bson.D{{Key: "termin", Value: 1}}))
+	ids, err := educatorVisibleRequestIDs(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := sastanciCollection.Find(ctx, bson.M{
+		"vaspitac_email": strings.ToLower(strings.TrimSpace(email)),
+		"zahtev_id":      bson.M{"$in": ids},
+	}, options.Find().SetSort(bson.D{{Key: "termin", Value: 1}}))
 	if err != nil {
 		return nil, err
 	}
@@ -763,35 +942,14 @@ func getMeetingsByEducator(ctx context.Context, email string) ([]Sastanak, error
 }
 
 func getEducatorChildren(ctx context.Context, email string) ([]UpisZahtev, error) {
-	assignments, err := getAssignmentsByEducator(ctx, email)
+	filter, ok, err := educatorChildrenFilter(ctx, email)
 	if err != nil {
 		return nil, err
 	}
-	if len(assignments) == 0 {
+	if !ok {
 		return []UpisZahtev{}, nil
 	}
-	ids := make([]primitive.ObjectID, 0, len(assignments))
-	for _, item := range assignments {
-		ids = append(ids, item.VrticID)
-	}
-	cursor, err := zahteviCollection.Find(ctx, bson.M{
-		"vrtic_id": bson.M{"$in": ids},
-		"status":   statusApproved,
-	}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
-	items := make([]UpisZahtev, 0)
-	for cursor.Next(ctx) {
-		var item UpisZahtev
-		if err := cursor.Decode(&item); err != nil {
-			return nil, err
-		}
-		item.Status = canonicalRequestStatus(item.Status)
-		items = append(items, item)
-	}
-	return items, cursor.Err()
+	return findApprovedRequests(ctx, filter)
 }
 
 func createSymptomsNotification(ctx context.Context, claims jwt.MapClaims, req SimptomObavestenjeRequest) (*SimptomObavestenje, error) {
@@ -813,7 +971,7 @@ func createSymptomsNotification(ctx context.Context, claims jwt.MapClaims, req S
 		return nil, errors.New("Obavestenje se moze poslati samo za odobren upis")
 	}
 	educatorEmail := strings.ToLower(strings.TrimSpace(claimString(claims, "sub")))
-	allowed, err := educatorAssignedToVrtic(ctx, educatorEmail, item.VrticID)
+	allowed, err := educatorResponsibleFor(ctx, educatorEmail, item)
 	if err != nil {
 		return nil, err
 	}
@@ -822,6 +980,7 @@ func createSymptomsNotification(ctx context.Context, claims jwt.MapClaims, req S
 	}
 	notice := SimptomObavestenje{
 		ZahtevID:      item.ID,
+		DeteID:        item.DeteID,
 		VrticID:       item.VrticID,
 		VrticNaziv:    item.VrticNaziv,
 		ImeDeteta:     item.ImeDeteta,
@@ -840,19 +999,22 @@ func createSymptomsNotification(ctx context.Context, claims jwt.MapClaims, req S
 	return &notice, nil
 }
 
+// getNotificationsByParent spaja prijave simptoma i obavestenja o listi
+// cekanja, od najnovijeg.
 func getNotificationsByParent(ctx context.Context, email string) ([]SimptomObavestenje, error) {
-	cursor, err := obavestenjaCollection.Find(ctx, bson.M{"roditelj_email": strings.ToLower(strings.TrimSpace(email))}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
-	if err != nil {
-		return nil, err
-	}
-	defer cursor.Close(ctx)
+	filter := bson.M{"roditelj_email": strings.ToLower(strings.TrimSpace(email))}
 	items := make([]SimptomObavestenje, 0)
-	for cursor.Next(ctx) {
-		var item SimptomObavestenje
-		if err := cursor.Decode(&item); err != nil {
+	for _, coll := range []*mongo.Collection{obavestenjaCollection, roditeljObavestenjaCollection} {
+		cursor, err := coll.Find(ctx, filter)
+		if err != nil {
 			return nil, err
 		}
-		items = append(items, item)
+		var batch []SimptomObavestenje
+		if err := cursor.All(ctx, &batch); err != nil {
+			return nil, err
+		}
+		items = append(items, batch...)
 	}
-	return items, cursor.Err()
+	sort.SliceStable(items, func(i, j int) bool { return items[i].CreatedAt.After(items[j].CreatedAt) })
+	return items, nil
 }
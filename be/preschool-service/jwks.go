@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"golang.org/x/sync/singleflight"
+)
+
+// Javni kljucevi auth servisa se preuzimaju sa /.well-known/jwks.json i
+// kesiraju. Nepoznat kid (rotacija kljuca) izaziva ponovno preuzimanje,
+// ali najvise jednom u jwksMinRefetch da token sa laznim kid-om ne bi
+// preopteretio auth servis. Isto vazi i za neuspela preuzimanja, pa ni
+// nedostupan auth servis ne dobija vise od jednog zahteva u jwksMinRefetch.
+type jwk struct {
+	KTY string `json:"kty"`
+	Alg string `json:"alg"`
+	KID string `json:"kid"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+const (
+	jwksCacheTTL    = 10 * time.Minute
+	jwksMinRefetch  = 30 * time.Second
+	jwksHTTPTimeout = 5 * time.Second
+)
+
+var jwksCache = struct {
+	sync.Mutex
+	keys        map[string]*rsa.PublicKey
+	fetchedAt   time.Time
+	attemptedAt time.Time
+	lastErr     error
+}{}
+
+var jwksClient = &http.Client{Timeout: jwksHTTPTimeout}
+
+var jwksFetches singleflight.Group
+
+func jwksKeyFunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodRSA); !ok {
+		return nil, errors.New("Neispravan algoritam")
+	}
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		return nil, errors.New("Token nema kid")
+	}
+	return lookupJWK(kid)
+}
+
+// lookupJWK preuzima JWKS van brave, tako da spor auth servis ne blokira
+// proveru tokena sa vec poznatim kljucem; istovremena preuzimanja se
+// spajaju u jedno.
+func lookupJWK(kid string) (*rsa.PublicKey, error) {
+	jwksCache.Lock()
+	key, ok := jwksCache.keys[kid]
+	age := time.Since(jwksCache.fetchedAt)
+	sinceAttempt := time.Since(jwksCache.attemptedAt)
+	jwksCache.Unlock()
+	if ok && age < jwksCacheTTL {
+		return key, nil
+	}
+
+	if sinceAttempt >= jwksMinRefetch {
+		jwksFetches.Do("jwks", func() (interface{}, error) {
+			jwksCache.Lock()
+			jwksCache.attemptedAt = time.Now()
+			jwksCache.Unlock()
+
+			ctx, cancel := context.WithTimeout(context.Background(), jwksHTTPTimeout)
+			defer cancel()
+			keys, err := fetchJWKS(ctx)
+
+			jwksCache.Lock()
+			defer jwksCache.Unlock()
+			jwksCache.lastErr = err
+			if err != nil {
+				return nil, err
+			}
+			jwksCache.keys = keys
+			jwksCache.fetchedAt = time.Now()
+			return nil, nil
+		})
+	}
+
+	jwksCache.Lock()
+	defer jwksCache.Unlock()
+	if jwksCache.keys == nil && jwksCache.lastErr != nil {
+		return nil, jwksCache.lastErr
+	}
+	if key, ok := jwksCache.keys[kid]; ok {
+		return key, nil
+	}
+	return nil, errors.New("Nepoznat kljuc")
+}
+
+func fetchJWKS(ctx context.Context) (map[string]*rsa.PublicKey, error) {
+	url := getenvDefault("AUTH_JWKS_URL", "http://auth-app:8083/.well-known/jwks.json")
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := jwksClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("JWKS status %d", resp.StatusCode)
+	}
+
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]*rsa.PublicKey{}
+	for _, item := range set.Keys {
+		if item.KTY != "RSA" || item.KID == "" {
+			continue
+		}
+		key, err := item.publicKey()
+		if err != nil {
+			continue
+		}
+		keys[item.KID] = key
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (*rsa.PublicKey, error) {
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	exponent := new(big.Int).SetBytes(e)
+	if !exponent.IsInt64() || exponent.Int64() <= 1 {
+		return nil, errors.New("neispravan eksponent")
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(exponent.Int64())}, nil
+}
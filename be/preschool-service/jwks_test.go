@@ -0,0 +1,40 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestLookupJWKThrottlesFailedFetches(t *testing.T) {
+	var hits int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(&hits, 1)
+		http.Error(w, "nedostupan", http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+	t.Setenv("AUTH_JWKS_URL", srv.URL)
+
+	jwksCache.Lock()
+	saved := jwksCache.keys
+	jwksCache.keys = nil
+	jwksCache.fetchedAt, jwksCache.attemptedAt, jwksCache.lastErr = time.Time{}, time.Time{}, nil
+	jwksCache.Unlock()
+	t.Cleanup(func() {
+		jwksCache.Lock()
+		jwksCache.keys = saved
+		jwksCache.fetchedAt, jwksCache.attemptedAt, jwksCache.lastErr = time.Time{}, time.Time{}, nil
+		jwksCache.Unlock()
+	})
+
+	for i := 0; i < 5; i++ {
+		if _, err := lookupJWK("nepoznat"); err == nil {
+			t.Fatalf("lookupJWK #%d: ocekivana greska", i)
+		}
+	}
+	if got := atomic.LoadInt32(&hits); got != 1 {
+		t.Fatalf("auth servis pozvan %d puta, want 1", got)
+	}
+}
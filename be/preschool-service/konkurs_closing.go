@@ -0,0 +1,271 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Kada konkursu istekne DatumZavrsetka, pozadinski posao ga zatvara,
+// zamrzava listu prijavljenih po rang listi, odobrava zahteve dok ima mesta,
+// ostale stavlja na listu cekanja i za svakog kandidata cuva PDF resenje.
+// Svaki korak je uslovan, pa posao moze bezbedno da se ponovi posle
+// restarta servisa; konkurs je gotov tek kada dobije zakljucen_at.
+
+const (
+	konkursClosingBatchSize = 20
+	// Posle ovog vremena smatra se da je instanca koja je zakljucivala
+	// konkurs pala, pa ga druga instanca moze preuzeti.
+	konkursClosingLease = 10 * time.Minute
+)
+
+var resenjaCollection *mongo.Collection
+
+// Resenje je PDF odluka izdata kandidatu pri zakljucivanju konkursa.
+type Resenje struct {
+	ID        primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	ZahtevID  primitive.ObjectID `json:"zahtev_id" bson:"zahtev_id"`
+	KonkursID primitive.ObjectID `json:"konkurs_id" bson:"konkurs_id"`
+	Status    string             `json:"status" bson:"status"`
+	FileName  string             `json:"file_name" bson:"file_name"`
+	PDF       []byte             `json:"-" bson:"pdf"`
+	CreatedAt time.Time          `json:"created_at" bson:"created_at"`
+}
+
+func konkursClosingInterval() time.Duration {
+	d, err := time.ParseDuration(getenvDefault("KONKURS_CLOSING_INTERVAL", "1m"))
+	if err != nil || d <= 0 {
+		return time.Minute
+	}
+	return d
+}
+
+func startKonkursClosingJob() {
+	run := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Minute)
+		defer cancel()
+		if err := closeExpiredKonkursi(ctx); err != nil {
+			log.Printf("Konkurs closing warning: %v", err)
+		}
+	}
+
+	go func() {
+		run()
+		ticker := time.NewTicker(konkursClosingInterval())
+		defer ticker.Stop()
+		for range ticker.C {
+			run()
+		}
+	}()
+}
+
+func closeExpiredKonkursi(ctx context.Context) error {
+	for i := 0; i < konkursClosingBatchSize; i++ {
+		konkurs, err := claimExpiredKonkurs(ctx)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if err := finalizeKonkurs(ctx, konkurs); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// migrateExpiredKonkursi jednokratno oznacava kao zakljucene konkurse kojima
+// je rok istekao pre uvodjenja posla za zakljucivanje. Oni su vec zatvoreni
+// (rucno ili pri raspisivanju novog konkursa), pa za njih ne treba naknadno
+// odobravati zahteve, zauzimati mesta niti izdavati resenja.
+func migrateExpiredKonkursi(ctx context.Context, db *mongo.Database) error {
+	const name = "konkursi_istekli_pre_zakljucivanja"
+	migrations := db.Collection("migracije")
+	if n, err := migrations.CountDocuments(ctx, bson.M{"_id": name}); err != nil || n > 0 {
+		return err
+	}
+
+	now := time.Now()
+	res, err := konkursiCollection.UpdateMany(ctx,
+		bson.M{
+			"datum_zavrsetka":  bson.M{"$lt": now},
+			"zakljucen_at":     bson.M{"$exists": false},
+			"zakljucivanje_od": bson.M{"$exists": false},
+		},
+		bson.M{"$set": bson.M{"aktivan": false, "zakljucen_at": now}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.ModifiedCount > 0 {
+		log.Printf("Migration %s: %d konkurs(a) oznaceno kao zakljuceno", name, res.ModifiedCount)
+	}
+
+	_, err = migrations.InsertOne(ctx, bson.M{"_id": name, "izvrsena_at": now})
+	return err
+}
+
+// claimExpiredKonkurs preuzima jedan istekli a nezakljucen konkurs, tako da
+// ga istovremeno obradjuje samo jedna instanca servisa.
+func claimExpiredKonkurs(ctx context.Context) (Konkurs, error) {
+	now := time.Now()
+	var item Konkurs
+	err := konkursiCollection.FindOneAndUpdate(ctx,
+		bson.M{
+			"datum_zavrsetka": bson.M{"$lt": now},
+			"zakljucen_at":    bson.M{"$exists": false},
+			"$or": bson.A{
+				bson.M{"zakljucivanje_od": bson.M{"$exists": false}},
+				bson.M{"zakljucivanje_od": bson.M{"$lt": now.Add(-konkursClosingLease)}},
+			},
+		},
+		bson.M{"$set": bson.M{"aktivan": false, "zakljucivanje_od": now}},
+		options.FindOneAndUpdate().
+			SetSort(bson.D{{Key: "datum_zavrsetka", Value: 1}}).
+			SetReturnDocument(options.After),
+	).Decode(&item)
+	return item, err
+}
+
+func finalizeKonkurs(ctx context.Context, konkurs Konkurs) error {
+	now := time.Now()
+	if _, err := konkursiCollection.UpdateOne(ctx,
+		bson.M{"_id": konkurs.ID, "closed_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"closed_at": now}},
+	); err != nil {
+		return err
+	}
+
+	frozen, err := freezeKonkursApplicants(ctx, konkurs)
+	if err != nil {
+		return err
+	}
+
+	for _, id := range frozen {
+		item, err := getRequestByID(ctx, id)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if err := decideFrozenRequest(ctx, item); err != nil && !errors.Is(err, errRequestChanged) {
+			return err
+		}
+		item, err = getRequestByID(ctx, id)
+		if err != nil {
+			return err
+		}
+		if err := storeDecision(ctx, konkurs.ID, item); err != nil {
+			return err
+		}
+	}
+
+	_, err = konkursiCollection.UpdateOne(ctx,
+		bson.M{"_id": konkurs.ID, "zakljucen_at": bson.M{"$exists": false}},
+		bson.M{
+			"$set":   bson.M{"zakljucen_at": time.Now()},
+			"$unset": bson.M{"zakljucivanje_od": ""},
+			"$push":  bson.M{"istorija": newKonkursChange(systemClaims, "zakljucen", "", fmt.Sprintf("%d kandidata", len(frozen)))},
+		},
+	)
+	if err == nil {
+		log.Printf("Konkurs %s zakljucen (%d kandidata)", konkurs.ID.Hex(), len(frozen))
+	}
+	return err
+}
+
+// freezeKonkursApplicants upisuje redosled kandidata samo prvi put, pa
+// ponovljeno zakljucivanje radi nad istom listom.
+func freezeKonkursApplicants(ctx context.Context, konkurs Konkurs) ([]primitive.ObjectID, error) {
+	if konkurs.ZamrznutiZahtevi != nil {
+		return konkurs.ZamrznutiZahtevi, nil
+	}
+	items, err := getRankedRequests(ctx, konkurs.ID, nil)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	if _, err := konkursiCollection.UpdateOne(ctx,
+		bson.M{"_id": konkurs.ID, "zamrznuti_zahtevi": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"zamrznuti_zahtevi": ids}},
+	); err != nil {
+		return nil, err
+	}
+	stored, err := getKonkursByID(ctx, konkurs.ID)
+	if err != nil {
+		return nil, err
+	}
+	return stored.ZamrznutiZahtevi, nil
+}
+
+// decideFrozenRequest odobrava zahtev sa rang liste ako ima mesta, a u
+// suprotnom ga ostavlja na listi cekanja. Odobreni, odbijeni, povuceni i
+// ispisani zahtevi se ne menjaju.
+func decideFrozenRequest(ctx context.Context, item UpisZahtev) error {
+	current := canonicalRequestStatus(item.Status)
+	switch {
+	case current == statusNeedDocs:
+		return updateRequestStatus(ctx, item.ID, systemClaims, current, statusWaitingList, "Dokumentacija nije dopunjena do zatvaranja konkursa. Zahtev je dodat na listu cekanja.")
+	case containsStatus(rankableStatuses, current):
+		return approveEnrollment(ctx, systemClaims, item, current)
+	default:
+		return nil
+	}
+}
+
+func storeDecision(ctx context.Context, konkursID primitive.ObjectID, item UpisZahtev) error {
+	pdf, fileName, err := buildRequestDecisionPDF(item)
+	if err != nil {
+		log.Printf("Konkurs decision warning for %s: %v", item.ID.Hex(), err)
+		return nil
+	}
+	_, err = resenjaCollection.UpdateOne(ctx,
+		bson.M{"zahtev_id": item.ID, "konkurs_id": konkursID},
+		bson.M{"$setOnInsert": Resenje{
+			ZahtevID:  item.ID,
+			KonkursID: konkursID,
+			Status:    canonicalRequestStatus(item.Status),
+			FileName:  fileName,
+			PDF:       pdf,
+			CreatedAt: time.Now(),
+		}},
+		options.Update().SetUpsert(true),
+	)
+	return err
+}
+
+// getCurrentDecision vraca sacuvano resenje ako i dalje odgovara statusu
+// zahteva (npr. zahtev sa liste cekanja kasnije moze biti odobren).
+func getCurrentDecision(ctx context.Context, item UpisZahtev) (*Resenje, error) {
+	var resenje Resenje
+	err := resenjaCollection.FindOne(ctx,
+		bson.M{"zahtev_id": item.ID, "status": canonicalRequestStatus(item.Status)},
+		options.FindOne().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	).Decode(&resenje)
+	if err != nil {
+		return nil, err
+	}
+	return &resenje, nil
+}
+
+func ensureDecisionsIndexes(ctx context.Context) {
+	_, err := resenjaCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "zahtev_id", Value: 1}, {Key: "konkurs_id", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "konkurs_id", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Decisions index warning: %v", err)
+	}
+}
@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestFinalizeKonkursSkipsClosedRequests(t *testing.T) {
+	ctx := testMongo(t)
+
+	vrticRes, err := vrticiCollection.InsertOne(ctx, Vrtic{Naziv: "Sumica", MaxKapacitet: 10})
+	if err != nil {
+		t.Fatalf("insert vrtic: %v", err)
+	}
+	vrticID := insertedID(vrticRes.InsertedID)
+	konkursRes, err := konkursiCollection.InsertOne(ctx, Konkurs{
+		VrticID:        vrticID,
+		DatumPocetka:   time.Now().AddDate(0, -1, 0),
+		DatumZavrsetka: time.Now().Add(-time.Hour),
+		MaxMesta:       5,
+		Aktivan:        true,
+	})
+	if err != nil {
+		t.Fatalf("insert konkurs: %v", err)
+	}
+	konkursID := insertedID(konkursRes.InsertedID)
+
+	tests := []struct {
+		status string
+		want   string
+	}{
+		{statusSubmitted, statusApproved},
+		{statusWithdrawn, statusWithdrawn},
+		{statusUnenrolled, statusUnenrolled},
+		{statusRejected, statusRejected},
+		{statusNeedDocs, statusWaitingList},
+	}
+	ids := make(map[string]UpisZahtev)
+	for i, tt := range tests {
+		item := UpisZahtev{
+			VrticID:       vrticID,
+			KonkursID:     konkursID,
+			VrticNaziv:    "Sumica",
+			ImeDeteta:     fmt.Sprintf("Dete %d", i),
+			KorisnikEmail: fmt.Sprintf("roditelj%d@example.com", i),
+			Status:        tt.status,
+			CreatedAt:     time.Now().Add(time.Duration(i) * time.Second),
+		}
+		res, err := zahteviCollection.InsertOne(ctx, item)
+		if err != nil {
+			t.Fatalf("insert zahtev: %v", err)
+		}
+		item.ID = insertedID(res.InsertedID)
+		ids[tt.status] = item
+	}
+
+	if err := closeExpiredKonkursi(ctx); err != nil {
+		t.Fatalf("closeExpiredKonkursi: %v", err)
+	}
+
+	check := func(run string) {
+		t.Helper()
+		konkurs, err := getKonkursByID(ctx, konkursID)
+		if err != nil {
+			t.Fatalf("%s: getKonkursByID: %v", run, err)
+		}
+		if konkurs.ZakljucenAt == nil || konkurs.Aktivan {
+			t.Fatalf("%s: konkurs nije zakljucen: aktivan=%v zakljucen_at=%v", run, konkurs.Aktivan, konkurs.ZakljucenAt)
+		}
+		if konkurs.Popunjeno != 1 {
+			t.Fatalf("%s: popunjeno = %d, ocekivano 1", run, konkurs.Popunjeno)
+		}
+		for _, tt := range tests {
+			item, err := getRequestByID(ctx, ids[tt.status].ID)
+			if err != nil {
+				t.Fatalf("%s: getRequestByID: %v", run, err)
+			}
+			if got := canonicalRequestStatus(item.Status); got != tt.want {
+				t.Errorf("%s: zahtev u statusu %s: posle zakljucivanja %s, ocekivano %s", run, tt.status, got, tt.want)
+			}
+		}
+		decisions, err := resenjaCollection.CountDocuments(ctx, bson.M{"konkurs_id": konkursID})
+		if err != nil {
+			t.Fatalf("%s: count resenja: %v", run, err)
+		}
+		if decisions != int64(len(tests)) {
+			t.Fatalf("%s: izdato %d resenja, ocekivano %d", run, decisions, len(tests))
+		}
+	}
+	check("prvo zakljucivanje")
+
+	// Ponovno pokretanje ne sme nista da promeni.
+	if err := closeExpiredKonkursi(ctx); err != nil {
+		t.Fatalf("ponovno zakljucivanje: %v", err)
+	}
+	check("ponovno zakljucivanje")
+}
+
+func TestMigrateExpiredKonkursiLeavesHistoryUntouched(t *testing.T) {
+	ctx := testMongo(t)
+
+	vrticRes, err := vrticiCollection.InsertOne(ctx, Vrtic{Naziv: "Sumica", MaxKapacitet: 10})
+	if err != nil {
+		t.Fatalf("insert vrtic: %v", err)
+	}
+	vrticID := insertedID(vrticRes.InsertedID)
+	konkursRes, err := konkursiCollection.InsertOne(ctx, Konkurs{
+		VrticID:        vrticID,
+		DatumPocetka:   time.Now().AddDate(-1, 0, 0),
+		DatumZavrsetka: time.Now().AddDate(-1, 1, 0),
+		MaxMesta:       5,
+	})
+	if err != nil {
+		t.Fatalf("insert konkurs: %v", err)
+	}
+	konkursID := insertedID(konkursRes.InsertedID)
+	statuses := []string{statusSubmitted, statusInReview, statusWaitingList}
+	for i, status := range statuses {
+		if _, err := zahteviCollection.InsertOne(ctx, UpisZahtev{
+			VrticID:       vrticID,
+			KonkursID:     konkursID,
+			KorisnikEmail: fmt.Sprintf("roditelj%d@example.com", i),
+			Status:        status,
+			CreatedAt:     time.Now().AddDate(-1, 0, i),
+		}); err != nil {
+			t.Fatalf("insert zahtev: %v", err)
+		}
+	}
+
+	if err := migrateExpiredKonkursi(ctx, konkursiCollection.Database()); err != nil {
+		t.Fatalf("migrateExpiredKonkursi: %v", err)
+	}
+	if err := closeExpiredKonkursi(ctx); err != nil {
+		t.Fatalf("closeExpiredKonkursi: %v", err)
+	}
+
+	konkurs, err := getKonkursByID(ctx, konkursID)
+	if err != nil {
+		t.Fatalf("getKonkursByID: %v", err)
+	}
+	if konkurs.ZakljucenAt == nil || konkurs.ClosedAt != nil || konkurs.Popunjeno != 0 {
+		t.Fatalf("istekli konkurs je obradjen: zakljucen_at=%v closed_at=%v popunjeno=%d", konkurs.ZakljucenAt, konkurs.ClosedAt, konkurs.Popunjeno)
+	}
+	for _, status := range statuses {
+		n, err := zahteviCollection.CountDocuments(ctx, bson.M{"konkurs_id": konkursID, "status": status})
+		if err != nil {
+			t.Fatalf("count zahtevi: %v", err)
+		}
+		if n != 1 {
+			t.Errorf("zahteva u statusu %s: %d, ocekivano 1", status, n)
+		}
+	}
+	decisions, err := resenjaCollection.CountDocuments(ctx, bson.M{"konkurs_id": konkursID})
+	if err != nil {
+		t.Fatalf("count resenja: %v", err)
+	}
+	if decisions != 0 {
+		t.Fatalf("izdato %d resenja za istorijski konkurs", decisions)
+	}
+	vrtic, err := getVrticByID(ctx, vrticID)
+	if err != nil {
+		t.Fatalf("getVrticByID: %v", err)
+	}
+	if vrtic.TrenutnoUpisano != 0 {
+		t.Fatalf("trenutno_upisano = %d, ocekivano 0", vrtic.TrenutnoUpisano)
+	}
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Izmene konkursa posle kreiranja: izmena pre pocetka, produzenje roka dok
+// traje i ponovno otvaranje greskom zatvorenog konkursa. Svaka promena se
+// upisuje u istoriju konkursa. Aktivni konkursi istog vrtica se ne smeju
+// preklapati, pa getActiveKonkursByVrticID uvek nalazi najvise jedan.
+
+// KonkursPromena je jedna stavka istorije konkursa.
+type KonkursPromena struct {
+	Akcija   string    `json:"akcija" bson:"akcija"`
+	Korisnik string    `json:"korisnik" bson:"korisnik"`
+	Razlog   string    `json:"razlog,omitempty" bson:"razlog,omitempty"`
+	Detalji  string    `json:"detalji,omitempty" bson:"detalji,omitempty"`
+	Vreme    time.Time `json:"vreme" bson:"vreme"`
+}
+
+// KonkursRokRequest je telo za produzenje i ponovno otvaranje konkursa.
+type KonkursRokRequest struct {
+	DatumZavrsetka string `json:"datum_zavrsetka"`
+	Razlog         string `json:"razlog"`
+}
+
+var (
+	errKonkursOverlap = errors.New("Vrtic vec ima aktivan konkurs u tom periodu")
+	errKonkursChanged = errors.New("Konkurs je u medjuvremenu izmenjen, osvezite prikaz i pokusajte ponovo")
+)
+
+func newKonkursChange(claims jwt.MapClaims, akcija, razlog, detalji string) KonkursPromena {
+	return KonkursPromena{
+		Akcija:   akcija,
+		Korisnik: strings.ToLower(strings.TrimSpace(claimString(claims, "sub"))),
+		Razlog:   strings.TrimSpace(razlog),
+		Detalji:  detalji,
+		Vreme:    time.Now(),
+	}
+}
+
+func overlappingKonkursFilter(vrticID primitive.ObjectID, start, end time.Time, exclude primitive.ObjectID) bson.M {
+	filter := bson.M{
+		"vrtic_id":        vrticID,
+		"aktivan":         true,
+		"datum_pocetka":   bson.M{"$lte": end},
+		"datum_zavrsetka": bson.M{"$gte": start},
+	}
+	if !exclude.IsZero() {
+		filter["_id"] = bson.M{"$ne": exclude}
+	}
+	return filter
+}
+
+func checkKonkursOverlap(ctx context.Context, vrticID primitive.ObjectID, start, end time.Time, exclude primitive.ObjectID) error {
+	n, err := konkursiCollection.CountDocuments(ctx, overlappingKonkursFilter(vrticID, start, end, exclude))
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return errKonkursOverlap
+	}
+	return nil
+}
+
+// resolveKonkursInsertRace brise upravo upisan konkurs ako se preklapa sa
+// ranije upisanim (manji ObjectID). Od dva istovremena kreiranja tako uvek
+// ostaje tacno jedno.
+func resolveKonkursInsertRace(ctx context.Context, item Konkurs) error {
+	filter := overlappingKonkursFilter(item.VrticID, item.DatumPocetka, item.DatumZavrsetka, primitive.NilObjectID)
+	filter["_id"] = bson.M{"$lt": item.ID}
+	n, err := konkursiCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return nil
+	}
+	if _, err := konkursiCollection.DeleteOne(ctx, bson.M{"_id": item.ID}); err != nil {
+		return err
+	}
+	return errKonkursOverlap
+}
+
+func konkursViewFor(ctx context.Context, item Konkurs) (*KonkursView, error) {
+	vrtic, err := getVrticByID(ctx, item.VrticID)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, err
+	}
+	approved, err := countApprovedRequestsForKonkurs(ctx, item.ID)
+	if err != nil {
+		return nil, err
+	}
+	slobodno := item.MaxMesta - approved
+	if slobodno < 0 {
+		slobodno = 0
+	}
+	return &KonkursView{
+		ID:             item.ID,
+		VrticID:        item.VrticID,
+		VrticNaziv:     vrtic.Naziv,
+		RadnaGodina:    item.RadnaGodina,
+		DatumPocetka:   item.DatumPocetka,
+		DatumZavrsetka: item.DatumZavrsetka,
+		MaxMesta:       item.MaxMesta,
+		Aktivan:        item.Aktivan,
+		Status:         konkursStatusLabel(item, time.Now()),
+		Popunjeno:      approved,
+		SlobodnaMesta:  slobodno,
+		MestaPoGrupi:   konkursGroupViews(item),
+		Kriterijumi:    konkursCriteria(item),
+		ZakljucenAt:    item.ZakljucenAt,
+	}, nil
+}
+
+// updateKonkurs menja datume, broj mesta i kriterijume konkursa koji jos
+// nije poceo. Pre pocetka nema zahteva, pa nema ni zauzetih mesta.
+func updateKonkurs(ctx context.Context, claims jwt.MapClaims, id primitive.ObjectID, req KonkursRequest) (*KonkursView, error) {
+	item, err := getKonkursByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	req.VrticID = item.VrticID.Hex()
+	if err := validateKonkursInput(req); err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if !item.Aktivan || !now.Before(item.DatumPocetka) {
+		return nil, errors.New("Konkurs moze da se izmeni samo pre pocetka")
+	}
+
+	vrtic, err := getVrticByID(ctx, item.VrticID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errVrticNotFound
+		}
+		return nil, err
+	}
+	pocetak, err := parseDateValue(req.DatumPocetka, false)
+	if err != nil {
+		return nil, err
+	}
+	zavrsetak, err := parseDateValue(req.DatumZavrsetka, true)
+	if err != nil {
+		return nil, err
+	}
+	if !zavrsetak.After(pocetak) {
+		return nil, errors.New("Datum zavrsetka mora biti posle datuma pocetka")
+	}
+	radnaGodina, err := konkursYearFromRequest(ctx, req, pocetak)
+	if err != nil {
+		return nil, err
+	}
+	free, err := freeSeatsInYear(ctx, vrtic, radnaGodina)
+	if err != nil {
+		return nil, err
+	}
+	if req.MaxMesta > free {
+		return nil, errors.New("Max mesta na konkursu ne moze biti vece od slobodnih mesta u vrticu za radnu godinu " + radnaGodina)
+	}
+	kriterijumi, err := normalizeKonkursCriteria(req.Kriterijumi)
+	if err != nil {
+		return nil, err
+	}
+	mestaPoGrupi, err := normalizeKonkursGroups(vrtic, req.MestaPoGrupi, req.MaxMesta)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkKonkursOverlap(ctx, item.VrticID, pocetak, zavrsetak, item.ID); err != nil {
+		return nil, err
+	}
+
+	detalji := fmt.Sprintf("%s, %s - %s, %d mesta", radnaGodina, pocetak.Format("2006-01-02"), zavrsetak.Format("2006-01-02"), req.MaxMesta)
+	res, err := konkursiCollection.UpdateOne(ctx,
+		bson.M{"_id": id, "aktivan": true, "datum_pocetka": item.DatumPocetka},
+		bson.M{
+			"$set": bson.M{
+				"radna_godina":    radnaGodina,
+				"datum_pocetka":   pocetak,
+				"datum_zavrsetka": zavrsetak,
+				"max_mesta":       req.MaxMesta,
+				"mesta_po_grupi":  mestaPoGrupi,
+				"kriterijumi":     kriterijumi,
+			},
+			"$push": bson.M{"istorija": newKonkursChange(claims, "izmenjen", "", detalji)},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, errKonkursChanged
+	}
+	item.RadnaGodina = radnaGodina
+	item.DatumPocetka = pocetak
+	item.DatumZavrsetka = zavrsetak
+	item.MaxMesta = req.MaxMesta
+	item.MestaPoGrupi = mestaPoGrupi
+	item.Kriterijumi = kriterijumi
+	return konkursViewFor(ctx, item)
+}
+
+// extendKonkurs pomera rok konkursa koji je u toku. Uslov na stari rok i
+// na odsustvo zakljucivanja sprecava trku sa poslom za zatvaranje.
+func extendKonkurs(ctx context.Context, claims jwt.MapClaims, id primitive.ObjectID, req KonkursRokRequest) (*KonkursView, error) {
+	item, err := getKonkursByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if konkursStatusLabel(item, now) != "aktivan" {
+		return nil, errors.New("Rok moze da se produzi samo konkursu koji je u toku")
+	}
+	zavrsetak, err := parseDateValue(req.DatumZavrsetka, true)
+	if err != nil {
+		return nil, err
+	}
+	if !zavrsetak.After(item.DatumZavrsetka) {
+		return nil, errors.New("Novi rok mora biti posle postojeceg")
+	}
+	if err := checkKonkursOverlap(ctx, item.VrticID, item.DatumPocetka, zavrsetak, item.ID); err != nil {
+		return nil, err
+	}
+
+	detalji := fmt.Sprintf("rok %s -> %s", item.DatumZavrsetka.Format("2006-01-02"), zavrsetak.Format("2006-01-02"))
+	res, err := konkursiCollection.UpdateOne(ctx,
+		bson.M{
+			"_id":              id,
+			"aktivan":          true,
+			"datum_zavrsetka":  item.DatumZavrsetka,
+			"zakljucivanje_od": bson.M{"$exists": false},
+		},
+		bson.M{
+			"$set":  bson.M{"datum_zavrsetka": zavrsetak},
+			"$push": bson.M{"istorija": newKonkursChange(claims, "produzen", req.Razlog, detalji)},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, errKonkursChanged
+	}
+	item.DatumZavrsetka = zavrsetak
+	return konkursViewFor(ctx, item)
+}
+
+// reopenKonkurs ponovo otvara zatvoren konkurs koji jos nije zakljucen
+// (nema izdatih resenja). Razlog je obavezan; ako je rok prosao, mora se
+// zadati novi.
+func reopenKonkurs(ctx context.Context, claims jwt.MapClaims, id primitive.ObjectID, req KonkursRokRequest) (*KonkursView, error) {
+	if strings.TrimSpace(req.Razlog) == "" {
+		return nil, errors.New("Unesite razlog ponovnog otvaranja")
+	}
+	item, err := getKonkursByID(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if item.Aktivan {
+		return nil, errors.New("Konkurs nije zatvoren")
+	}
+	if item.ZakljucenAt != nil || item.ZakljucivanjeOd != nil {
+		return nil, errors.New("Konkurs je vec zakljucen i resenja su izdata")
+	}
+
+	zavrsetak := item.DatumZavrsetka
+	if strings.TrimSpace(req.DatumZavrsetka) != "" {
+		zavrsetak, err = parseDateValue(req.DatumZavrsetka, true)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if !zavrsetak.After(time.Now()) || !zavrsetak.After(item.DatumPocetka) {
+		return nil, errors.New("Rok konkursa je prosao, zadajte novi datum zavrsetka")
+	}
+	if err := checkKonkursOverlap(ctx, item.VrticID, item.DatumPocetka, zavrsetak, item.ID); err != nil {
+		return nil, err
+	}
+
+	detalji := ""
+	if !zavrsetak.Equal(item.DatumZavrsetka) {
+		detalji = fmt.Sprintf("rok %s -> %s", item.DatumZavrsetka.Format("2006-01-02"), zavrsetak.Format("2006-01-02"))
+	}
+	res, err := konkursiCollection.UpdateOne(ctx,
+		bson.M{
+			"_id":              id,
+			"aktivan":          false,
+			"zakljucen_at":     bson.M{"$exists": false},
+			"zakljucivanje_od": bson.M{"$exists": false},
+		},
+		bson.M{
+			"$set":   bson.M{"aktivan": true, "datum_zavrsetka": zavrsetak},
+			"$unset": bson.M{"closed_at": ""},
+			"$push":  bson.M{"istorija": newKonkursChange(claims, "ponovo_otvoren", req.Razlog, detalji)},
+		},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, errKonkursChanged
+	}
+	item.Aktivan = true
+	item.ClosedAt = nil
+	item.DatumZavrsetka = zavrsetak
+	// Ponovno otvaranje moze dati nova mesta listi cekanja.
+	onSeatsFreed(ctx, item.VrticID, "ponovo_otvoren_konkurs")
+	return konkursViewFor(ctx, item)
+}
+
+func konkursErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments):
+		return http.StatusNotFound
+	case errors.Is(err, errKonkursOverlap), errors.Is(err, errKonkursChanged):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
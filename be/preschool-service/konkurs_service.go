@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"github.com/golang-jwt/jwt/v4"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -34,7 +35,7 @@ func countApprovedRequestsForKonkurs(ctx context.Context, konkursID primitive.Ob
 	return int(count), err
 }
 
-func createKonkurs(ctx context.Context, req KonkursRequest) (*KonkursView, error) {
+func createKonkurs(ctx context.Context, claims jwt.MapClaims, req KonkursRequest) (*KonkursView, error) {
 	if err := validateKonkursInput(req); err != nil {
 		return nil, err
 	}
@@ -46,7 +47,7 @@ func createKonkurs(ctx context.Context, req KonkursRequest) (*KonkursView, error
 	vrtic, err := getVrticByID(ctx, vrticID)
 	if err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return nil, errors.New("Vrtic nije pronadjen")
+			return nil, errVrticNotFound
 		}
 		return nil, err
 	}
@@ -62,23 +63,43 @@ func createKonkurs(ctx context.Context, req KonkursRequest) (*KonkursView, error
 	if !zavrsetak.After(pocetak) {
 		return nil, errors.New("Datum zavrsetka mora biti posle datuma pocetka")
 	}
-	if req.MaxMesta > slobodnaMesta(vrtic) {
-		return nil, errors.New("Max mesta na konkursu ne moze biti vece od trenutno slobodnih mesta u vrticu")
+	radnaGodina, err := konkursYearFromRequest(ctx, req, pocetak)
+	if err != nil {
+		return nil, err
 	}
-
-	now := time.Now()
-	_, err = konkursiCollection.UpdateMany(ctx, bson.M{"vrtic_id": vrticID, "aktivan": true}, bson.M{"$set": bson.M{"aktivan": false, "closed_at": now}})
+	free, err := freeSeatsInYear(ctx, vrtic, radnaGodina)
+	if err != nil {
+		return nil, err
+	}
+	if req.MaxMesta > free {
+		return nil, errors.New("Max mesta na konkursu ne moze biti vece od slobodnih mesta u vrticu za radnu godinu " + radnaGodina)
+	}
+	kriterijumi, err := normalizeKonkursCriteria(req.Kriterijumi)
+	if err != nil {
+		return nil, err
+	}
+	mestaPoGrupi, err := normalizeKonkursGroups(vrtic, req.MestaPoGrupi, req.MaxMesta)
 	if err != nil {
 		return nil, err
 	}
 
+	if err := checkKonkursOverlap(ctx, vrticID, pocetak, zavrsetak, primitive.NilObjectID); err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+
 	item := Konkurs{
 		VrticID:        vrticID,
+		RadnaGodina:    radnaGodina,
 		DatumPocetka:   pocetak,
 		DatumZavrsetka: zavrsetak,
 		MaxMesta:       req.MaxMesta,
+		MestaPoGrupi:   mestaPoGrupi,
+		Kriterijumi:    kriterijumi,
 		Aktivan:        true,
 		CreatedAt:      now,
+		Istorija:       []KonkursPromena{newKonkursChange(claims, "kreiran", "", "")},
 	}
 	res, err := konkursiCollection.InsertOne(ctx, item)
 	if err != nil {
@@ -87,11 +108,18 @@ func createKonkurs(ctx context.Context, req KonkursRequest) (*KonkursView, error
 	if id, ok := res.InsertedID.(primitive.ObjectID); ok {
 		item.ID = id
 	}
+	// Dva istovremena kreiranja mogu oba proci proveru; ostaje ranije upisan.
+	if err := resolveKonkursInsertRace(ctx, item); err != nil {
+		return nil, err
+	}
+
+	onSeatsFreed(ctx, vrticID, "novi_konkurs")
 
 	view := KonkursView{
 		ID:             item.ID,
 		VrticID:        item.VrticID,
 		VrticNaziv:     vrtic.Naziv,
+		RadnaGodina:    item.RadnaGodina,
 		DatumPocetka:   item.DatumPocetka,
 		DatumZavrsetka: item.DatumZavrsetka,
 		MaxMesta:       item.MaxMesta,
@@ -99,13 +127,18 @@ func createKonkurs(ctx context.Context, req KonkursRequest) (*KonkursView, error
 		Status:         konkursStatusLabel(item, now),
 		Popunjeno:      0,
 		SlobodnaMesta:  item.MaxMesta,
+		MestaPoGrupi:   konkursGroupViews(item),
+		Kriterijumi:    konkursCriteria(item),
 	}
 	return &view, nil
 }
 
-func closeKonkurs(ctx context.Context, id primitive.ObjectID) error {
+func closeKonkurs(ctx context.Context, claims jwt.MapClaims, id primitive.ObjectID, reason string) error {
 	now := time.Now()
-	res, err := konkursiCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{"aktivan": false, "closed_at": now}})
+	res, err := konkursiCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{
+		"$set":  bson.M{"aktivan": false, "closed_at": now},
+		"$push": bson.M{"istorija": newKonkursChange(claims, "zatvoren", reason, "")},
+	})
 	if err != nil {
 		return err
 	}
@@ -115,8 +148,11 @@ func closeKonkurs(ctx context.Context, id primitive.ObjectID) error {
 	return nil
 }
 
-func getAllKonkursViews(ctx context.Context, statusFilter string, vrticIDRaw string) ([]KonkursView, error) {
+func getAllKonkursViews(ctx context.Context, statusFilter string, vrticIDRaw string, radnaGodina string, scope VrticScope) ([]KonkursView, error) {
 	filter := bson.M{}
+	if radnaGodina != "" {
+		filter["radna_godina"] = radnaGodina
+	}
 	if strings.TrimSpace(vrticIDRaw) != "" {
 		vrticID, err := primitive.ObjectIDFromHex(strings.TrimSpace(vrticIDRaw))
 		if err != nil {
@@ -125,7 +161,7 @@ func getAllKonkursViews(ctx context.Context, statusFilter string, vrticIDRaw str
 		filter["vrtic_id"] = vrticID
 	}
 
-	cursor, err := konkursiCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	cursor, err := konkursiCollection.Find(ctx, scope.apply(filter), options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
 	if err != nil {
 		return nil, err
 	}
@@ -164,6 +200,7 @@ func getAllKonkursViews(ctx context.Context, statusFilter string, vrticIDRaw str
 			ID:             item.ID,
 			VrticID:        item.VrticID,
 			VrticNaziv:     vrtic.Naziv,
+			RadnaGodina:    item.RadnaGodina,
 			DatumPocetka:   item.DatumPocetka,
 			DatumZavrsetka: item.DatumZavrsetka,
 			MaxMesta:       item.MaxMesta,
@@ -171,6 +208,9 @@ func getAllKonkursViews(ctx context.Context, statusFilter string, vrticIDRaw str
 			Status:         status,
 			Popunjeno:      approved,
 			SlobodnaMesta:  slobodno,
+			MestaPoGrupi:   konkursGroupViews(item),
+			Kriterijumi:    konkursCriteria(item),
+			ZakljucenAt:    item.ZakljucenAt,
 		})
 	}
 	return result, cursor.Err()
@@ -1,7 +1,6 @@
 package main
 
 import (
-	"github.com/golang-jwt/jwt/v4"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"strings"
@@ -9,30 +8,35 @@ import (
 )
 
 type Vrtic struct {
-	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	Naziv           string             `json:"naziv" bson:"naziv"`
-	Tip             string             `json:"tip" bson:"tip"`
-	Grad            string             `json:"grad" bson:"grad"`
-	Opstina         string             `json:"opstina" bson:"opstina"`
-	MaxKapacitet    int                `json:"max_kapacitet" bson:"max_kapacitet"`
-	TrenutnoUpisano int                `json:"trenutno_upisano" bson:"trenutno_upisano"`
+	ID                primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	Naziv             string             `json:"naziv" bson:"naziv"`
+	Tip               string             `json:"tip" bson:"tip"`
+	Grad              string             `json:"grad" bson:"grad"`
+	Opstina           string             `json:"opstina" bson:"opstina"`
+	MaxKapacitet      int                `json:"max_kapacitet" bson:"max_kapacitet"`
+	TrenutnoUpisano   int                `json:"trenutno_upisano" bson:"trenutno_upisano"`
+	UpisanoVanSistema int                `json:"upisano_van_sistema" bson:"upisano_van_sistema"`
+	Grupe             []KapacitetGrupe   `json:"grupe,omitempty" bson:"grupe,omitempty"`
 }
 
 type VrticView struct {
-	ID              primitive.ObjectID `json:"id"`
-	Naziv           string             `json:"naziv"`
-	Tip             string             `json:"tip"`
-	Grad            string             `json:"grad"`
-	Opstina         string             `json:"opstina"`
-	MaxKapacitet    int                `json:"max_kapacitet"`
-	TrenutnoUpisano int                `json:"trenutno_upisano"`
-	Popunjenost     float64            `json:"popunjenost"`
-	SlobodnaMesta   int                `json:"slobodna_mesta"`
-	Kriticno        bool               `json:"kriticno"`
+	ID                primitive.ObjectID `json:"id"`
+	Naziv             string             `json:"naziv"`
+	Tip               string             `json:"tip"`
+	Grad              string             `json:"grad"`
+	Opstina           string             `json:"opstina"`
+	MaxKapacitet      int                `json:"max_kapacitet"`
+	TrenutnoUpisano   int                `json:"trenutno_upisano"`
+	UpisanoVanSistema int                `json:"upisano_van_sistema"`
+	Popunjenost       float64            `json:"popunjenost"`
+	SlobodnaMesta     int                `json:"slobodna_mesta"`
+	Kriticno          bool               `json:"kriticno"`
+	Grupe             []GrupaView        `json:"grupe,omitempty"`
 }
 
 type OpstinaIzvestaj struct {
 	Opstina         string  `json:"opstina"`
+	RadnaGodina     string  `json:"radna_godina,omitempty"`
 	BrojVrtica      int     `json:"broj_vrtica"`
 	UkupanKapacitet int     `json:"ukupan_kapacitet"`
 	UkupnoUpisano   int     `json:"ukupno_upisano"`
@@ -40,71 +44,98 @@ type OpstinaIzvestaj struct {
 }
 
 type UpisZahtev struct {
-	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	VrticID    primitive.ObjectID `json:"vrtic_id" bson:"vrtic_id"`
-	KonkursID  primitive.ObjectID `json:"konkurs_id,omitempty" bson:"konkurs_id,omitempty"`
-	VrticNaziv string             `json:"vrtic_naziv" bson:"vrtic_naziv"`
-
-	ImeRoditelja         string     `json:"ime_roditelja" bson:"ime_roditelja"`
-	ImeDeteta            string     `json:"ime_deteta" bson:"ime_deteta"`
-	BrojGodina           int        `json:"broj_godina" bson:"broj_godina"`
-	KorisnikEmail        string     `json:"korisnik_email" bson:"korisnik_email"`
-	PotvrdaVakcinacije   bool       `json:"potvrda_vakcinacije" bson:"potvrda_vakcinacije"`
-	IzvodIzMaticneKnjige bool       `json:"izvod_iz_maticne_knjige" bson:"izvod_iz_maticne_knjige"`
-	Status               string     `json:"status" bson:"status"`
-	CreatedAt            time.Time  `json:"created_at" bson:"created_at"`
-	ProcessedAt          *time.Time `json:"processed_at,omitempty" bson:"processed_at,omitempty"`
-	ProcessedBy          string     `json:"processed_by,omitempty" bson:"processed_by,omitempty"`
-	Reason               string     `json:"reason,omitempty" bson:"reason,omitempty"`
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	VrticID       primitive.ObjectID `json:"vrtic_id" bson:"vrtic_id"`
+	KonkursID     primitive.ObjectID `json:"konkurs_id,omitempty" bson:"konkurs_id,omitempty"`
+	RadnaGodina   string             `json:"radna_godina,omitempty" bson:"radna_godina,omitempty"`
+	UpisaneGodine []string           `json:"upisane_godine,omitempty" bson:"upisane_godine,omitempty"`
+	VrticNaziv    string             `json:"vrtic_naziv" bson:"vrtic_naziv"`
+	DeteID        primitive.ObjectID `json:"dete_id,omitempty" bson:"dete_id,omitempty"`
+	// Postavljen na tacno jednom aktivnom zahtevu deteta (direktan zahtev
+	// ili nosilac prijave); jedinstveni indeks sprecava dva istovremena
+	// podnosenja za isto dete (vidi ensureNoActiveEnrollment).
+	AktivnoDeteID primitive.ObjectID `json:"-" bson:"aktivno_dete_id,omitempty"`
+	Grupa         string             `json:"grupa,omitempty" bson:"grupa,omitempty"`
+	// Vaspitna grupa u koju je odobren zahtev rasporedjen (vaspitne_grupe.go).
+	VaspitnaGrupaID primitive.ObjectID `json:"vaspitna_grupa_id,omitempty" bson:"vaspitna_grupa_id,omitempty"`
+	PrijavaID       primitive.ObjectID `json:"prijava_id,omitempty" bson:"prijava_id,omitempty"`
+	Preferencija    int                `json:"preferencija,omitempty" bson:"preferencija,omitempty"`
+
+	ImeRoditelja         string                  `json:"ime_roditelja" bson:"ime_roditelja"`
+	ImeDeteta            string                  `json:"ime_deteta" bson:"ime_deteta"`
+	BrojGodina           int                     `json:"broj_godina" bson:"broj_godina"`
+	KorisnikEmail        string                  `json:"korisnik_email" bson:"korisnik_email"`
+	PotvrdaVakcinacije   bool                    `json:"potvrda_vakcinacije" bson:"potvrda_vakcinacije"`
+	IzvodIzMaticneKnjige bool                    `json:"izvod_iz_maticne_knjige" bson:"izvod_iz_maticne_knjige"`
+	Kriterijumi          []DeklarisaniKriterijum `json:"kriterijumi,omitempty" bson:"kriterijumi,omitempty"`
+	Bodovi               int                     `json:"bodovi" bson:"bodovi"`
+	Status               string                  `json:"status" bson:"status"`
+	CreatedAt            time.Time               `json:"created_at" bson:"created_at"`
+	ProcessedAt          *time.Time              `json:"processed_at,omitempty" bson:"processed_at,omitempty"`
+	ProcessedBy          string                  `json:"processed_by,omitempty" bson:"processed_by,omitempty"`
+	Reason               string                  `json:"reason,omitempty" bson:"reason,omitempty"`
+	IspisZatrazenAt      *time.Time              `json:"ispis_zatrazen_at,omitempty" bson:"ispis_zatrazen_at,omitempty"`
+	IspisRazlog          string                  `json:"ispis_razlog,omitempty" bson:"ispis_razlog,omitempty"`
+	Istorija             []StatusPromena         `json:"istorija,omitempty" bson:"istorija,omitempty"`
+	Dokumenti            []PrilozenDokument      `json:"dokumenti,omitempty" bson:"dokumenti,omitempty"`
 }
 
 type UpisRequest struct {
-	VrticID              string `json:"vrtic_id"`
-	ImeRoditelja         string `json:"ime_roditelja"`
-	ImeDeteta            string `json:"ime_deteta"`
-	BrojGodina           int    `json:"broj_godina"`
-	PotvrdaVakcinacije   bool   `json:"potvrda_vakcinacije"`
-	IzvodIzMaticneKnjige bool   `json:"izvod_iz_maticne_knjige"`
+	VrticID      string                  `json:"vrtic_id"`
+	ImeRoditelja string                  `json:"ime_roditelja"`
+	DeteID       string                  `json:"dete_id"`
+	Kriterijumi  []DeklarisaniKriterijum `json:"kriterijumi"`
 }
 
 type RequestActionPayload struct {
 	Reason string `json:"reason"`
 }
 
-type DokumentaUpdateRequest struct {
-	PotvrdaVakcinacije   bool `json:"potvrda_vakcinacije"`
-	IzvodIzMaticneKnjige bool `json:"izvod_iz_maticne_knjige"`
-}
-
 type Konkurs struct {
-	ID             primitive.ObjectID `json:"id" bson:"_id,omitempty"`
-	VrticID        primitive.ObjectID `json:"vrtic_id" bson:"vrtic_id"`
-	DatumPocetka   time.Time          `json:"datum_pocetka" bson:"datum_pocetka"`
-	DatumZavrsetka time.Time          `json:"datum_zavrsetka" bson:"datum_zavrsetka"`
-	MaxMesta       int                `json:"max_mesta" bson:"max_mesta"`
-	Aktivan        bool               `json:"aktivan" bson:"aktivan"`
-	CreatedAt      time.Time          `json:"created_at" bson:"created_at"`
-	ClosedAt       *time.Time         `json:"closed_at,omitempty" bson:"closed_at,omitempty"`
+	ID             primitive.ObjectID    `json:"id" bson:"_id,omitempty"`
+	VrticID        primitive.ObjectID    `json:"vrtic_id" bson:"vrtic_id"`
+	RadnaGodina    string                `json:"radna_godina" bson:"radna_godina,omitempty"`
+	DatumPocetka   time.Time             `json:"datum_pocetka" bson:"datum_pocetka"`
+	DatumZavrsetka time.Time             `json:"datum_zavrsetka" bson:"datum_zavrsetka"`
+	MaxMesta       int                   `json:"max_mesta" bson:"max_mesta"`
+	Popunjeno      int                   `json:"popunjeno" bson:"popunjeno"`
+	MestaPoGrupi   []MestaGrupe          `json:"mesta_po_grupi,omitempty" bson:"mesta_po_grupi,omitempty"`
+	Kriterijumi    []KriterijumBodovanja `json:"kriterijumi,omitempty" bson:"kriterijumi,omitempty"`
+	Aktivan        bool                  `json:"aktivan" bson:"aktivan"`
+	CreatedAt      time.Time             `json:"created_at" bson:"created_at"`
+	ClosedAt       *time.Time            `json:"closed_at,omitempty" bson:"closed_at,omitempty"`
+	// Popunjava posao za zakljucivanje konkursa (konkurs_closing.go).
+	ZakljucenAt      *time.Time           `json:"zakljucen_at,omitempty" bson:"zakljucen_at,omitempty"`
+	ZakljucivanjeOd  *time.Time           `json:"-" bson:"zakljucivanje_od,omitempty"`
+	ZamrznutiZahtevi []primitive.ObjectID `json:"-" bson:"zamrznuti_zahtevi,omitempty"`
+	Istorija         []KonkursPromena     `json:"istorija,omitempty" bson:"istorija,omitempty"`
 }
 
 type KonkursRequest struct {
-	VrticID        string `json:"vrtic_id"`
-	DatumPocetka   string `json:"datum_pocetka"`
-	DatumZavrsetka string `json:"datum_zavrsetka"`
-	MaxMesta       int    `json:"max_mesta"`
+	VrticID        string                `json:"vrtic_id"`
+	RadnaGodina    string                `json:"radna_godina"`
+	DatumPocetka   string                `json:"datum_pocetka"`
+	DatumZavrsetka string                `json:"datum_zavrsetka"`
+	MaxMesta       int                   `json:"max_mesta"`
+	MestaPoGrupi   []MestaGrupe          `json:"mesta_po_grupi"`
+	Kriterijumi    []KriterijumBodovanja `json:"kriterijumi"`
 }
 
 type KonkursView struct {
-	ID             primitive.ObjectID `json:"id"`
-	VrticID        primitive.ObjectID `json:"vrtic_id"`
-	VrticNaziv     string             `json:"vrtic_naziv"`
-	DatumPocetka   time.Time          `json:"datum_pocetka"`
-	DatumZavrsetka time.Time          `json:"datum_zavrsetka"`
-	MaxMesta       int                `json:"max_mesta"`
-	Aktivan        bool               `json:"aktivan"`
-	Status         string             `json:"status"`
-	Popunjeno      int                `json:"popunjeno"`
-	SlobodnaMesta  int                `json:"slobodna_mesta"`
+	ID             primitive.ObjectID    `json:"id"`
+	VrticID        primitive.ObjectID    `json:"vrtic_id"`
+	VrticNaziv     string                `json:"vrtic_naziv"`
+	RadnaGodina    string                `json:"radna_godina,omitempty"`
+	DatumPocetka   time.Time             `json:"datum_pocetka"`
+	DatumZavrsetka time.Time             `json:"datum_zavrsetka"`
+	MaxMesta       int                   `json:"max_mesta"`
+	Aktivan        bool                  `json:"aktivan"`
+	Status         string                `json:"status"`
+	Popunjeno      int                   `json:"popunjeno"`
+	SlobodnaMesta  int                   `json:"slobodna_mesta"`
+	MestaPoGrupi   []GrupaView           `json:"mesta_po_grupi,omitempty"`
+	Kriterijumi    []KriterijumBodovanja `json:"kriterijumi"`
+	ZakljucenAt    *time.Time            `json:"zakljucen_at,omitempty"`
 }
 
 type VaspitacRaspored struct {
@@ -131,6 +162,7 @@ type RoditeljVaspitaciView struct {
 type Sastanak struct {
 	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	ZahtevID      primitive.ObjectID `json:"zahtev_id" bson:"zahtev_id"`
+	DeteID        primitive.ObjectID `json:"dete_id,omitempty" bson:"dete_id,omitempty"`
 	VrticID       primitive.ObjectID `json:"vrtic_id" bson:"vrtic_id"`
 	VrticNaziv    string             `json:"vrtic_naziv" bson:"vrtic_naziv"`
 	ImeDeteta     string             `json:"ime_deteta" bson:"ime_deteta"`
@@ -159,11 +191,13 @@ type SastanakActionPayload struct {
 type SimptomObavestenje struct {
 	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
 	ZahtevID      primitive.ObjectID `json:"zahtev_id" bson:"zahtev_id"`
+	DeteID        primitive.ObjectID `json:"dete_id,omitempty" bson:"dete_id,omitempty"`
 	VrticID       primitive.ObjectID `json:"vrtic_id" bson:"vrtic_id"`
 	VrticNaziv    string             `json:"vrtic_naziv" bson:"vrtic_naziv"`
 	ImeDeteta     string             `json:"ime_deteta" bson:"ime_deteta"`
 	RoditeljEmail string             `json:"roditelj_email" bson:"roditelj_email"`
 	VaspitacEmail string             `json:"vaspitac_email" bson:"vaspitac_email"`
+	Tip           string             `json:"tip,omitempty" bson:"tip,omitempty"`
 	Poruka        string             `json:"poruka" bson:"poruka"`
 	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
 }
@@ -180,6 +214,8 @@ const (
 	statusApproved    = "odobren"
 	statusRejected    = "odbijen"
 	statusWaitingList = "na_listi_cekanja"
+	statusWithdrawn   = "povucen"
+	statusUnenrolled  = "ispisan"
 
 	meetingStatusPending  = "na_cekanju"
 	meetingStatusAccepted = "prihvacen"
@@ -194,12 +230,13 @@ var konkursiCollection *mongo.Collection
 var rasporediCollection *mongo.Collection
 var sastanciCollection *mongo.Collection
 var obavestenjaCollection *mongo.Collection
+var revokedTokensCollection *mongo.Collection
 
 func canonicalRequestStatus(status string) string {
 	switch strings.ToLower(strings.TrimSpace(status)) {
-	case "", statusSubmitted, "na_cekanju":
+	case statusSubmitted:
 		return statusSubmitted
-	case statusInReview, "u_proveri":
+	case statusInReview:
 		return statusInReview
 	case statusNeedDocs:
 		return statusNeedDocs
@@ -209,6 +246,10 @@ func canonicalRequestStatus(status string) string {
 		return statusRejected
 	case statusWaitingList:
 		return statusWaitingList
+	case statusWithdrawn:
+		return statusWithdrawn
+	case statusUnenrolled:
+		return statusUnenrolled
 	default:
 		return strings.ToLower(strings.TrimSpace(status))
 	}
@@ -226,15 +267,3 @@ func canonicalMeetingStatus(status string) string {
 		return strings.ToLower(strings.TrimSpace(status))
 	}
 }
-
-func isAdminClaim(claims jwt.MapClaims) bool {
-	return strings.ToLower(strings.TrimSpace(claimString(claims, "role"))) == "admin"
-}
-
-func canAccessRequestDocument(item UpisZahtev, claims jwt.MapClaims) bool {
-	if isAdminClaim(claims) {
-		return true
-	}
-	email := strings.ToLower(strings.TrimSpace(claimString(claims, "sub")))
-	return email != "" && email == strings.ToLower(strings.TrimSpace(item.KorisnikEmail))
-}
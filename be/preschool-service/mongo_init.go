@@ -34,13 +34,51 @@ func initMongo() {
 	rasporediCollection = db.Collection("rasporedi_vaspitaca")
 	sastanciCollection = db.Collection("sastanci")
 	obavestenjaCollection = db.Collection("obavestenja")
+	roditeljObavestenjaCollection = db.Collection("obavestenja_roditeljima")
+	revokedTokensCollection = db.Collection("revoked_tokens")
+	resenjaCollection = db.Collection("resenja")
+	deteCollection = db.Collection("deca")
+	prijaveCollection = db.Collection("prijave")
+	radneGodineCollection = db.Collection("radne_godine")
+	vaspitneGrupeCollection = db.Collection("vaspitne_grupe")
+	smeneCollection = db.Collection("smene")
+	odsustvaCollection = db.Collection("odsustva")
+	zameneCollection = db.Collection("zamene")
+	initDocumentStorage(db)
+
+	if err := migrateLegacyRequestStatuses(ctx, db); err != nil {
+		log.Fatalf("Mongo migration error: %v", err)
+	}
+	if err := migrateAcademicYears(ctx, db); err != nil {
+		log.Fatalf("Mongo migration error: %v", err)
+	}
+	if err := migrateOccupancyBaseline(ctx, db); err != nil {
+		log.Fatalf("Mongo migration error: %v", err)
+	}
+	if err := migrateExpiredKonkursi(ctx, db); err != nil {
+		log.Fatalf("Mongo migration error: %v", err)
+	}
+	if err := migrateParentNotifications(ctx, db); err != nil {
+		log.Fatalf("Mongo migration error: %v", err)
+	}
+	if err := migrateActiveEnrollmentHolders(ctx, db); err != nil {
+		log.Fatalf("Mongo migration error: %v", err)
+	}
 
 	ensureSeedData(ctx)
 	ensureRequestsIndexes(ctx)
 	ensureKonkursIndexes(ctx)
+	ensureKonkursSeatCounters(ctx)
 	ensureAssignmentsIndexes(ctx)
 	ensureMeetingsIndexes(ctx)
 	ensureNotificationsIndexes(ctx)
+	ensureDecisionsIndexes(ctx)
+	ensureDecaIndexes(ctx)
+	ensurePrijaveIndexes(ctx)
+	ensureAcademicYears(ctx)
+	ensureVaspitneGrupeIndexes(ctx)
+	ensureShiftsIndexes(ctx)
+	logOccupancyMismatches(ctx)
 }
 
 func ensureSeedData(ctx context.Context) {
@@ -54,8 +92,8 @@ func ensureSeedData(ctx context.Context) {
 	}
 
 	seed := []interface{}{
-		Vrtic{Naziv: "Plavi Cuperak", Tip: "drzavni", Grad: "Beograd", Opstina: "Zvezdara", MaxKapacitet: 120, TrenutnoUpisano: 95},
-		Vrtic{Naziv: "Sumica", Tip: "privatni", Grad: "Beograd", Opstina: "Vozdovac", MaxKapacitet: 60, TrenutnoUpisano: 58},
+		Vrtic{Naziv: "Plavi Cuperak", Tip: "drzavni", Grad: "Beograd", Opstina: "Zvezdara", MaxKapacitet: 120, TrenutnoUpisano: 95, UpisanoVanSistema: 95},
+		Vrtic{Naziv: "Sumica", Tip: "privatni", Grad: "Beograd", Opstina: "Vozdovac", MaxKapacitet: 60, TrenutnoUpisano: 58, UpisanoVanSistema: 58},
 	}
 
 	if _, err := vrticiCollection.InsertMany(ctx, seed); err != nil {
@@ -118,4 +156,8 @@ func ensureNotificationsIndexes(ctx context.Context) {
 	if err != nil {
 		log.Printf("Notifications index warning: %v", err)
 	}
+	_, err = roditeljObavestenjaCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "roditelj_email", Value: 1}}})
+	if err != nil {
+		log.Printf("Notifications index warning: %v", err)
+	}
 }
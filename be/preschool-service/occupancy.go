@@ -0,0 +1,230 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Popunjenost vrtica je izvedena vrednost: upisani van sistema plus
+// odobreni zahtevi (po grupi: odobreni zahtevi te grupe). trenutno_upisano
+// i grupe.upisano su materijalizovani brojaci koje odrzava samo uslovno
+// zauzimanje i oslobadjanje mesta (seat_allocation.go). Provera ispod
+// poredi brojace sa zahtevima i po potrebi ih ispravlja.
+
+var errVrticChanged = errors.New("Vrtic je u medjuvremenu izmenjen, osvezite prikaz i pokusajte ponovo")
+
+type GrupaOdstupanje struct {
+	Grupa      string `json:"grupa"`
+	Zabelezeno int    `json:"zabelezeno"`
+	Ocekivano  int    `json:"ocekivano"`
+}
+
+type PopunjenostOdstupanje struct {
+	VrticID     primitive.ObjectID `json:"vrtic_id"`
+	Naziv       string             `json:"naziv"`
+	Zabelezeno  int                `json:"zabelezeno"`
+	Ocekivano   int                `json:"ocekivano"`
+	Grupe       []GrupaOdstupanje  `json:"grupe,omitempty"`
+	Ispravljeno bool               `json:"ispravljeno"`
+}
+
+type approvedCounts struct {
+	total   int
+	byGroup map[string]int
+}
+
+// approvedPerVrtic broji odobrene zahteve po vrticu i uzrasnoj grupi.
+func approvedPerVrtic(ctx context.Context) (map[primitive.ObjectID]*approvedCounts, error) {
+	cursor, err := zahteviCollection.Aggregate(ctx, mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"status": statusApproved}}},
+		{{Key: "$group", Value: bson.M{
+			"_id":  bson.M{"vrtic_id": "$vrtic_id", "grupa": "$grupa"},
+			"broj": bson.M{"$sum": 1},
+		}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var rows []struct {
+		ID struct {
+			VrticID primitive.ObjectID `bson:"vrtic_id"`
+			Grupa   string             `bson:"grupa"`
+		} `bson:"_id"`
+		Broj int `bson:"broj"`
+	}
+	if err := cursor.All(ctx, &rows); err != nil {
+		return nil, err
+	}
+	result := map[primitive.ObjectID]*approvedCounts{}
+	for _, row := range rows {
+		counts, ok := result[row.ID.VrticID]
+		if !ok {
+			counts = &approvedCounts{byGroup: map[string]int{}}
+			result[row.ID.VrticID] = counts
+		}
+		counts.total += row.Broj
+		counts.byGroup[row.ID.Grupa] += row.Broj
+	}
+	return result, nil
+}
+
+// reconcileOccupancy vraca vrtice ciji se brojaci razlikuju od zahteva. Uz
+// fix brojace postavlja na ocekivane vrednosti, uslovno na zatecene; ako se
+// brojac u medjuvremenu promenio, vrtic ostaje neispravljen za sledece
+// pokretanje.
+func reconcileOccupancy(ctx context.Context, fix bool) ([]PopunjenostOdstupanje, error) {
+	vrtici, err := getAllVrtici(ctx)
+	if err != nil {
+		return nil, err
+	}
+	approved, err := approvedPerVrtic(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]PopunjenostOdstupanje, 0)
+	for _, v := range vrtici {
+		counts := approved[v.ID]
+		if counts == nil {
+			counts = &approvedCounts{byGroup: map[string]int{}}
+		}
+		item := PopunjenostOdstupanje{
+			VrticID:    v.ID,
+			Naziv:      v.Naziv,
+			Zabelezeno: v.TrenutnoUpisano,
+			Ocekivano:  v.UpisanoVanSistema + counts.total,
+		}
+		mismatch := item.Zabelezeno != item.Ocekivano
+		grupe := make([]KapacitetGrupe, 0, len(v.Grupe))
+		for _, g := range v.Grupe {
+			expected := counts.byGroup[g.Grupa]
+			if g.Upisano != expected {
+				mismatch = true
+				item.Grupe = append(item.Grupe, GrupaOdstupanje{Grupa: g.Grupa, Zabelezeno: g.Upisano, Ocekivano: expected})
+			}
+			g.Upisano = expected
+			grupe = append(grupe, g)
+		}
+		if !mismatch {
+			continue
+		}
+
+		if fix {
+			set := bson.M{"trenutno_upisano": item.Ocekivano}
+			if len(v.Grupe) > 0 {
+				set["grupe"] = grupe
+			}
+			res, err := vrticiCollection.UpdateOne(ctx,
+				bson.M{"_id": v.ID, "trenutno_upisano": v.TrenutnoUpisano, "grupe": v.Grupe},
+				bson.M{"$set": set},
+			)
+			if err != nil {
+				return result, err
+			}
+			item.Ispravljeno = res.ModifiedCount == 1
+			if item.Ispravljeno && item.Ocekivano < item.Zabelezeno {
+				onSeatsFreed(ctx, v.ID, "usaglasavanje_popunjenosti")
+			}
+		}
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// logOccupancyMismatches pri pokretanju samo prijavljuje odstupanja.
+func logOccupancyMismatches(ctx context.Context) {
+	items, err := reconcileOccupancy(ctx, false)
+	if err != nil {
+		log.Printf("Occupancy check warning: %v", err)
+		return
+	}
+	for _, item := range items {
+		log.Printf("Occupancy mismatch for vrtic %s (%s): zabelezeno %d, ocekivano %d", item.VrticID.Hex(), item.Naziv, item.Zabelezeno, item.Ocekivano)
+	}
+}
+
+// migrateOccupancyBaseline jednokratno upisuje broj dece upisane van
+// sistema za vrtice nastale pre izvedene popunjenosti: sve sto brojac ima
+// preko odobrenih zahteva smatra se upisanim van sistema.
+func migrateOccupancyBaseline(ctx context.Context, db *mongo.Database) error {
+	const name = "vrtici_upisano_van_sistema"
+	migrations := db.Collection("migracije")
+	if n, err := migrations.CountDocuments(ctx, bson.M{"_id": name}); err != nil || n > 0 {
+		return err
+	}
+
+	approved, err := approvedPerVrtic(ctx)
+	if err != nil {
+		return err
+	}
+	cursor, err := vrticiCollection.Find(ctx, bson.M{"upisano_van_sistema": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	var vrtici []Vrtic
+	if err := cursor.All(ctx, &vrtici); err != nil {
+		return err
+	}
+	for _, v := range vrtici {
+		baseline := v.TrenutnoUpisano
+		if counts := approved[v.ID]; counts != nil {
+			baseline -= counts.total
+		}
+		if baseline < 0 {
+			baseline = 0
+		}
+		if _, err := vrticiCollection.UpdateOne(ctx,
+			bson.M{"_id": v.ID, "upisano_van_sistema": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"upisano_van_sistema": baseline}},
+		); err != nil {
+			return err
+		}
+	}
+
+	_, err = migrations.InsertOne(ctx, bson.M{"_id": name, "izvrsena_at": time.Now()})
+	return err
+}
+
+// handleOccupancyCheck: GET /popunjenost/provera prijavljuje odstupanja,
+// POST ih i ispravlja.
+func handleOccupancyCheck(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err := authorize(claims, permOccupancyReconcile); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	items, err := reconcileOccupancy(r.Context(), r.Method == http.MethodPost)
+	if err != nil {
+		http.Error(w, "Greska pri proveri popunjenosti", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+func init() {
+	http.HandleFunc("/popunjenost/provera", handleOccupancyCheck)
+}
@@ -9,7 +9,7 @@ type OpenDataVaspitacView struct {
 }
 
 func getOpenDataEducators(ctx context.Context) ([]OpenDataVaspitacView, error) {
-	items, err := listAssignments(ctx)
+	items, err := listAssignments(ctx, allVrtici)
 	if err != nil {
 		return nil, err
 	}
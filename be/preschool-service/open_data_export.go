@@ -9,7 +9,7 @@ type OpenDataZahtevView struct {
 }
 
 func getOpenDataRequests(ctx context.Context) ([]OpenDataZahtevView, error) {
-	items, err := getAllRequests(ctx)
+	items, err := getAllRequests(ctx, "", allVrtici)
 	if err != nil {
 		return nil, err
 	}
@@ -2,7 +2,6 @@ package main
 
 import (
 	"errors"
-	"github.com/golang-jwt/jwt/v4"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"strings"
 	"time"
@@ -35,7 +34,8 @@ func parseRequestAction(path string) (primitive.ObjectID, string, error) {
 		action = "obrada"
 	}
 	switch action {
-	case "obrada", "dopuna", "odobri", "odbij", "dokument", "dokumenta", "izmeni":
+	case "obrada", "dopuna", "odobri", "odbij", "dokument", "dokumenta", "izmeni",
+		"povuci", "ispis", "potvrdi-ispis", "odbij-ispis", "istorija":
 		return id, action, nil
 	default:
 		return primitive.NilObjectID, "", errors.New("Nepoznata akcija")
@@ -56,13 +56,17 @@ func parseSimpleObjectID(path, prefix string) (primitive.ObjectID, error) {
 
 func parseKonkursAction(path string) (primitive.ObjectID, string, error) {
 	parts := strings.Split(strings.Trim(strings.TrimPrefix(path, "/konkursi/"), "/"), "/")
-	if len(parts) != 2 {
+	if len(parts) < 1 || len(parts) > 2 {
 		return primitive.NilObjectID, "", errors.New("Neispravan URL konkursa")
 	}
 	id, err := primitive.ObjectIDFromHex(parts[0])
 	if err != nil {
 		return primitive.NilObjectID, "", errors.New("Neispravan ID konkursa")
 	}
+	// Bez akcije (/konkursi/{id}) je izmena samog konkursa.
+	if len(parts) == 1 {
+		return id, "", nil
+	}
 	return id, parts[1], nil
 }
 
@@ -94,11 +98,16 @@ func validateVrticInput(v Vrtic) error {
 	if v.MaxKapacitet <= 0 {
 		return errors.New("Max kapacitet mora biti > 0")
 	}
-	if v.TrenutnoUpisano < 0 {
-		return errors.New("Trenutno upisano mora biti >= 0")
+	// Broj upisanih se ne zadaje; zadaje se samo broj dece upisane van
+	// sistema (pre uvodjenja elektronskog upisa).
+	if v.UpisanoVanSistema < 0 {
+		return errors.New("Upisano van sistema mora biti >= 0")
 	}
-	if v.TrenutnoUpisano > v.MaxKapacitet {
-		return errors.New("Trenutno upisano ne moze biti vece od kapaciteta")
+	if v.UpisanoVanSistema > v.MaxKapacitet {
+		return errors.New("Upisano van sistema ne moze biti vece od kapaciteta")
+	}
+	if err := validateVrticGroups(v); err != nil {
+		return err
 	}
 	return nil
 }
@@ -110,17 +119,8 @@ func validateEnrollmentInput(req UpisRequest) error {
 	if strings.TrimSpace(req.ImeRoditelja) == "" {
 		return errors.New("Ime roditelja je obavezno")
 	}
-	if strings.TrimSpace(req.ImeDeteta) == "" {
-		return errors.New("Ime deteta je obavezno")
-	}
-	if req.BrojGodina <= 0 || req.BrojGodina > 7 {
-		return errors.New("Broj godina mora biti izmedju 1 i 7")
-	}
-	if !req.PotvrdaVakcinacije {
-		return errors.New("Potvrda o vakcinaciji je obavezna pri upisu")
-	}
-	if !req.IzvodIzMaticneKnjige {
-		return errors.New("Izvod iz maticne knjige rodjenih je obavezan pri upisu")
+	if strings.TrimSpace(req.DeteID) == "" {
+		return errors.New("Dete je obavezno")
 	}
 	return nil
 }
@@ -201,25 +201,3 @@ func konkursStatusLabel(item Konkurs, now time.Time) string {
 	}
 	return "aktivan"
 }
-
-func requireAdminRole(claims jwt.MapClaims) error {
-	if strings.ToLower(strings.TrimSpace(claimString(claims, "role"))) == "admin" {
-		return nil
-	}
-	return errors.New("Nemate dozvolu za admin operacije")
-}
-
-func requireUserRole(claims jwt.MapClaims) error {
-	role := strings.ToLower(strings.TrimSpace(claimString(claims, "role")))
-	if role == "roditelj" || role == "korisnik" {
-		return nil
-	}
-	return errors.New("Samo roditelj moze slati zahtev za upis")
-}
-
-func requireEducatorRole(claims jwt.MapClaims) error {
-	if strings.ToLower(strings.TrimSpace(claimString(claims, "role"))) == "vaspitac" {
-		return nil
-	}
-	return errors.New("Samo vaspitac moze koristiti ovu funkciju")
-}
@@ -8,12 +8,15 @@ import (
 	"time"
 )
 
-func buildOpstinaPDFReport(report []OpstinaIzvestaj) ([]byte, error) {
+func buildOpstinaPDFReport(report []OpstinaIzvestaj, radnaGodina string) ([]byte, error) {
 	lines := []string{
 		"Izvestaj o kapacitetima po opstini",
 		fmt.Sprintf("Datum: %s", time.Now().Format("2006-01-02 15:04")),
-		"",
 	}
+	if radnaGodina != "" {
+		lines = append(lines, "Radna godina: "+radnaGodina)
+	}
+	lines = append(lines, "")
 
 	if len(report) == 0 {
 		lines = append(lines, "Nema podataka za izvestaj.")
@@ -35,8 +38,10 @@ func buildOpstinaPDFReport(report []OpstinaIzvestaj) ([]byte, error) {
 
 func buildRequestDecisionPDF(item UpisZahtev) ([]byte, string, error) {
 	status := canonicalRequestStatus(item.Status)
-	if status != statusApproved && status != statusRejected {
-		return nil, "", errors.New("PDF je dostupan samo za odobren ili odbijen zahtev")
+	switch status {
+	case statusApproved, statusRejected, statusWaitingList, statusWithdrawn, statusUnenrolled:
+	default:
+		return nil, "", errors.New("PDF je dostupan samo za zavrsen zahtev ili zahtev na listi cekanja")
 	}
 
 	title := "Potvrda o upisu"
@@ -45,6 +50,18 @@ func buildRequestDecisionPDF(item UpisZahtev) ([]byte, string, error) {
 		title = "Odbijenica"
 		fileName = fmt.Sprintf("odbijenica-%s.pdf", item.ID.Hex())
 	}
+	if status == statusWaitingList {
+		title = "Obavestenje o listi cekanja"
+		fileName = fmt.Sprintf("lista-cekanja-%s.pdf", item.ID.Hex())
+	}
+	if status == statusWithdrawn {
+		title = "Potvrda o povlacenju zahteva"
+		fileName = fmt.Sprintf("povlacenje-%s.pdf", item.ID.Hex())
+	}
+	if status == statusUnenrolled {
+		title = "Potvrda o ispisu"
+		fileName = fmt.Sprintf("potvrda-ispis-%s.pdf", item.ID.Hex())
+	}
 
 	lines := []string{
 		title,
@@ -64,6 +81,9 @@ func buildRequestDecisionPDF(item UpisZahtev) ([]byte, string, error) {
 	if item.ProcessedAt != nil {
 		lines = append(lines, fmt.Sprintf("Datum obrade: %s", item.ProcessedAt.Format("02.01.2006 15:04")))
 	}
+	if item.IspisZatrazenAt != nil {
+		lines = append(lines, fmt.Sprintf("Ispis zatrazen: %s", item.IspisZatrazenAt.Format("02.01.2006 15:04")))
+	}
 	if strings.TrimSpace(item.Reason) != "" {
 		lines = append(lines, fmt.Sprintf("Napomena: %s", item.Reason))
 	}
@@ -123,16 +143,18 @@ func toViews(vrtici []Vrtic) []VrticView {
 	views := make([]VrticView, 0, len(vrtici))
 	for _, v := range vrtici {
 		views = append(views, VrticView{
-			ID:              v.ID,
-			Naziv:           v.Naziv,
-			Tip:             v.Tip,
-			Grad:            v.Grad,
-			Opstina:         v.Opstina,
-			MaxKapacitet:    v.MaxKapacitet,
-			TrenutnoUpisano: v.TrenutnoUpisano,
-			Popunjenost:     popunjenost(v),
-			SlobodnaMesta:   slobodnaMesta(v),
-			Kriticno:        popunjenost(v) >= 0.9,
+			ID:                v.ID,
+			Naziv:             v.Naziv,
+			Tip:               v.Tip,
+			Grad:              v.Grad,
+			Opstina:           v.Opstina,
+			MaxKapacitet:      v.MaxKapacitet,
+			TrenutnoUpisano:   v.TrenutnoUpisano,
+			UpisanoVanSistema: v.UpisanoVanSistema,
+			Popunjenost:       popunjenost(v),
+			SlobodnaMesta:     slobodnaMesta(v),
+			Kriticno:          popunjenost(v) >= 0.9,
+			Grupe:             vrticGroupViews(v),
 		})
 	}
 	return views
@@ -0,0 +1,338 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Dozvole koje proveravaju handleri. Role se na dozvole mapiraju u
+// konfiguraciji (RBAC_POLICY_FILE), a ne poredjenjem naziva role u kodu.
+const (
+	permVrticCreate = "vrtic:create"
+	permVrticUpdate = "vrtic:update"
+	permVrticDelete = "vrtic:delete"
+
+	permKonkursCreate = "konkurs:create"
+	permKonkursClose  = "konkurs:close"
+
+	permEnrollmentCreate      = "enrollment:create"
+	permEnrollmentRead        = "enrollment:read"
+	permEnrollmentReadOwn     = "enrollment:read_own"
+	permEnrollmentUpdateOwn   = "enrollment:update_own"
+	permEnrollmentProcess     = "enrollment:process"
+	permEnrollmentApprove     = "enrollment:approve"
+	permEnrollmentReject      = "enrollment:reject"
+	permEnrollmentDocument    = "enrollment:document"
+	permEnrollmentWithdrawOwn = "enrollment:withdraw_own"
+	permEnrollmentUnenroll    = "enrollment:unenroll"
+	permEnrollmentAllocate    = "enrollment:allocate"
+
+	permAcademicYearManage = "radna_godina:manage"
+
+	permOccupancyReconcile = "popunjenost:reconcile"
+
+	permAssignmentRead   = "raspored:read"
+	permAssignmentManage = "raspored:manage"
+
+	permGroupRead   = "vaspitna_grupa:read"
+	permGroupManage = "vaspitna_grupa:manage"
+
+	permShiftRead    = "smena:read"
+	permShiftManage  = "smena:manage"
+	permShiftReadOwn = "smena:read_own"
+
+	permMeetingCreate  = "sastanak:create"
+	permMeetingReadOwn = "sastanak:read_own"
+	permMeetingDecide  = "sastanak:decide"
+
+	permEducatorsReadOwn    = "vaspitaci:read_own"
+	permChildrenRead        = "deca:read"
+	permNotificationCreate  = "obavestenje:create"
+	permNotificationReadOwn = "obavestenje:read_own"
+
+	permRatingCreate = "ocena:create"
+
+	permChildManageOwn    = "dete:manage_own"
+	permChildRegistryRead = "dete:read"
+)
+
+// scopeVrtic znaci da dozvole role vaze samo za vrtice iz vrtic_ids
+// claim-a u tokenu.
+const scopeVrtic = "vrtic"
+
+type RolePolicy struct {
+	Permissions []string `json:"permissions"`
+	Scope       string   `json:"scope,omitempty"`
+}
+
+type Policy struct {
+	Roles map[string]RolePolicy `json:"roles"`
+}
+
+// VrticScope opisuje nad kojim vrticima pozivalac ima dozvolu; liste se
+// automatski filtriraju na taj skup.
+type VrticScope struct {
+	All      bool
+	VrticIDs []primitive.ObjectID
+}
+
+// Principal je pozivalac izveden iz JWT claim-ova.
+type Principal struct {
+	Email    string
+	Role     string
+	VrticIDs []primitive.ObjectID
+}
+
+var defaultPolicy = Policy{Roles: map[string]RolePolicy{
+	// Admin upravlja vrticima, konkursima, zahtevima i rasporedima. Dozvole
+	// nad sopstvenim zahtevima, sastancima i obavestenjima pripadaju
+	// roditelju, a rad sa decom u grupi (sastanci, obavestenja) vaspitacu.
+	"admin": {Permissions: []string{
+		permVrticCreate, permVrticUpdate, permVrticDelete,
+		permKonkursCreate, permKonkursClose,
+		permEnrollmentRead, permEnrollmentProcess, permEnrollmentApprove, permEnrollmentReject, permEnrollmentDocument,
+		permEnrollmentUnenroll, permEnrollmentAllocate,
+		permAcademicYearManage, permOccupancyReconcile,
+		permAssignmentRead, permAssignmentManage,
+		permGroupRead, permGroupManage,
+		permShiftRead, permShiftManage,
+		permChildRegistryRead,
+	}},
+	"roditelj": {Permissions: []string{
+		permEnrollmentCreate, permEnrollmentReadOwn, permEnrollmentUpdateOwn, permEnrollmentWithdrawOwn,
+		permMeetingCreate, permMeetingReadOwn, permEducatorsReadOwn,
+		permNotificationReadOwn, permRatingCreate, permChildManageOwn,
+	}},
+	"vaspitac": {Permissions: []string{
+		permChildrenRead, permMeetingReadOwn, permMeetingDecide, permNotificationCreate,
+		permShiftReadOwn,
+	}},
+	"direktor": {Scope: scopeVrtic, Permissions: []string{
+		permKonkursCreate, permKonkursClose,
+		permEnrollmentRead, permEnrollmentProcess, permEnrollmentApprove, permEnrollmentReject, permEnrollmentDocument,
+		permEnrollmentUnenroll,
+		permAssignmentRead, permAssignmentManage,
+		permGroupRead, permGroupManage,
+		permShiftRead, permShiftManage,
+	}},
+}}
+
+var allVrtici = VrticScope{All: true}
+
+var (
+	policyOnce   sync.Once
+	activePolicy Policy
+)
+
+// initPolicy ucitava politiku iz RBAC_POLICY_FILE ili koristi ugradjenu.
+// Neispravan fajl zaustavlja servis, da se ne bi tiho radilo sa
+// drugacijim pravima od ocekivanih.
+func initPolicy() {
+	policyOnce.Do(func() {
+		activePolicy = defaultPolicy
+		path := strings.TrimSpace(os.Getenv("RBAC_POLICY_FILE"))
+		if path == "" {
+			return
+		}
+		raw, err := os.ReadFile(path)
+		if err != nil {
+			log.Fatalf("RBAC policy read error: %v", err)
+		}
+		var loaded Policy
+		if err := json.Unmarshal(raw, &loaded); err != nil {
+			log.Fatalf("RBAC policy parse error: %v", err)
+		}
+		if len(loaded.Roles) == 0 {
+			log.Fatalf("RBAC policy %s ne definise nijednu rolu", path)
+		}
+		activePolicy = Policy{Roles: map[string]RolePolicy{}}
+		for role, item := range loaded.Roles {
+			activePolicy.Roles[normalizeRole(role)] = item
+		}
+	})
+}
+
+func currentPolicy() Policy {
+	initPolicy()
+	return activePolicy
+}
+
+func normalizeRole(role string) string {
+	role = strings.ToLower(strings.TrimSpace(role))
+	// "korisnik" je stari naziv za roditelja.
+	if role == "korisnik" {
+		return "roditelj"
+	}
+	return role
+}
+
+func principalFromClaims(claims jwt.MapClaims) Principal {
+	p := Principal{
+		Email: strings.ToLower(strings.TrimSpace(claimString(claims, "sub"))),
+		Role:  normalizeRole(claimString(claims, "role")),
+	}
+	if raw, ok := claims["vrtic_ids"].([]interface{}); ok {
+		for _, value := range raw {
+			text, _ := value.(string)
+			if id, err := primitive.ObjectIDFromHex(text); err == nil {
+				p.VrticIDs = append(p.VrticIDs, id)
+			}
+		}
+	}
+	return p
+}
+
+// grants vraca da li rola ima dozvolu i da li je ona ogranicena na vrtice.
+func (p Principal) grants(perm string) (bool, bool) {
+	item, ok := currentPolicy().Roles[p.Role]
+	if !ok {
+		return false, false
+	}
+	for _, granted := range item.Permissions {
+		if permissionMatches(granted, perm) {
+			return true, item.Scope == scopeVrtic
+		}
+	}
+	return false, false
+}
+
+// permissionMatches podrzava "*" i dzoker po resursu, npr. "enrollment:*".
+func permissionMatches(granted, perm string) bool {
+	granted = strings.ToLower(strings.TrimSpace(granted))
+	if granted == "*" || granted == perm {
+		return true
+	}
+	if strings.HasSuffix(granted, ":*") {
+		return strings.HasPrefix(perm, strings.TrimSuffix(granted, "*"))
+	}
+	return false
+}
+
+// Can vazi samo za globalne dozvole; role ogranicene na vrtice moraju
+// proci kroz CanInVrtic.
+func (p Principal) Can(perm string) bool {
+	ok, scoped := p.grants(perm)
+	return ok && !scoped
+}
+
+func (p Principal) CanInVrtic(perm string, vrticID primitive.ObjectID) bool {
+	ok, scoped := p.grants(perm)
+	if !ok {
+		return false
+	}
+	if !scoped {
+		return true
+	}
+	return VrticScope{VrticIDs: p.VrticIDs}.Contains(vrticID)
+}
+
+// ListScope je skup vrtica koje pozivalac vidi u javnim listama: role
+// ogranicene na vrtice vide samo svoje, ostali sve.
+func (p Principal) ListScope() VrticScope {
+	item, ok := currentPolicy().Roles[p.Role]
+	if ok && item.Scope == scopeVrtic {
+		return VrticScope{VrticIDs: p.VrticIDs}
+	}
+	return allVrtici
+}
+
+func (s VrticScope) Contains(vrticID primitive.ObjectID) bool {
+	if s.All {
+		return true
+	}
+	for _, id := range s.VrticIDs {
+		if id == vrticID {
+			return true
+		}
+	}
+	return false
+}
+
+// apply dodaje ogranicenje na vrtic_id u postojeci Mongo filter.
+func (s VrticScope) apply(filter bson.M) bson.M {
+	if s.All {
+		return filter
+	}
+	ids := s.VrticIDs
+	if ids == nil {
+		ids = []primitive.ObjectID{}
+	}
+	inScope := bson.M{"vrtic_id": bson.M{"$in": ids}}
+	if existing, ok := filter["vrtic_id"]; ok {
+		delete(filter, "vrtic_id")
+		filter["$and"] = []bson.M{{"vrtic_id": existing}, inScope}
+		return filter
+	}
+	filter["vrtic_id"] = inScope["vrtic_id"]
+	return filter
+}
+
+func errForbidden(perm string) error {
+	return errors.New("Nemate dozvolu za ovu operaciju (" + perm + ")")
+}
+
+func authorize(claims jwt.MapClaims, perm string) error {
+	if principalFromClaims(claims).Can(perm) {
+		return nil
+	}
+	return errForbidden(perm)
+}
+
+// authorizeScope proverava dozvolu za listu i vraca vrtice na koje se
+// lista mora ograniciti.
+func authorizeScope(claims jwt.MapClaims, perm string) (VrticScope, error) {
+	p := principalFromClaims(claims)
+	ok, scoped := p.grants(perm)
+	if !ok {
+		return VrticScope{}, errForbidden(perm)
+	}
+	if scoped {
+		return VrticScope{VrticIDs: p.VrticIDs}, nil
+	}
+	return allVrtici, nil
+}
+
+func authorizeVrtic(claims jwt.MapClaims, perm string, vrticID primitive.ObjectID) error {
+	if principalFromClaims(claims).CanInVrtic(perm, vrticID) {
+		return nil
+	}
+	return errForbidden(perm)
+}
+
+// enrollmentActionPermission mapira akciju nad zahtevom na dozvolu.
+func enrollmentActionPermission(action string) string {
+	switch action {
+	case "odobri":
+		return permEnrollmentApprove
+	case "odbij":
+		return permEnrollmentReject
+	case "potvrdi-ispis", "odbij-ispis":
+		return permEnrollmentUnenroll
+	default:
+		return permEnrollmentProcess
+	}
+}
+
+func canReadRequest(item UpisZahtev, claims jwt.MapClaims) bool {
+	p := principalFromClaims(claims)
+	if p.CanInVrtic(permEnrollmentRead, item.VrticID) {
+		return true
+	}
+	return p.Can(permEnrollmentReadOwn) && p.Email != "" && p.Email == strings.ToLower(strings.TrimSpace(item.KorisnikEmail))
+}
+
+func canAccessRequestDocument(item UpisZahtev, claims jwt.MapClaims) bool {
+	p := principalFromClaims(claims)
+	if p.CanInVrtic(permEnrollmentDocument, item.VrticID) {
+		return true
+	}
+	return p.Can(permEnrollmentReadOwn) && p.Email != "" && p.Email == strings.ToLower(strings.TrimSpace(item.KorisnikEmail))
+}
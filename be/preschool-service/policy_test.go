@@ -0,0 +1,28 @@
+package main
+
+import "testing"
+
+func TestDefaultAdminPolicy(t *testing.T) {
+	admin := defaultPolicy.Roles["admin"]
+	granted := map[string]bool{}
+	for _, perm := range admin.Permissions {
+		granted[perm] = true
+	}
+
+	// Dozvole roditelja i vaspitaca koje admin ne sme imati.
+	for _, perm := range []string{
+		permEnrollmentCreate, permEnrollmentReadOwn, permEnrollmentUpdateOwn, permEnrollmentWithdrawOwn,
+		permMeetingCreate, permMeetingReadOwn, permMeetingDecide,
+		permEducatorsReadOwn, permChildrenRead, permNotificationCreate, permNotificationReadOwn,
+		permRatingCreate, permChildManageOwn, permShiftReadOwn,
+	} {
+		if granted[perm] {
+			t.Errorf("admin ima dozvolu %s", perm)
+		}
+	}
+	for _, perm := range []string{permVrticUpdate, permEnrollmentApprove, permEnrollmentAllocate, permChildRegistryRead, permShiftManage} {
+		if !granted[perm] {
+			t.Errorf("admin nema dozvolu %s", perm)
+		}
+	}
+}
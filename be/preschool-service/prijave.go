@@ -0,0 +1,587 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// PrijavaUpisa je jedna prijava deteta sa rangiranom listom vrtica. Za
+// svaki izbor se pravi obican zahtev za upis (prijava_id, preferencija), pa
+// dokumentacija, bodovanje i obrada rade kao i ranije. Raspodela dodeljuje
+// dete najvisem izboru koji ima mesta; kada je dete upisano preko bilo kog
+// izbora, ostali izbori se automatski povlace.
+type PrijavaUpisa struct {
+	ID            primitive.ObjectID   `json:"id" bson:"_id,omitempty"`
+	KorisnikEmail string               `json:"korisnik_email" bson:"korisnik_email"`
+	DeteID        primitive.ObjectID   `json:"dete_id" bson:"dete_id"`
+	ImeDeteta     string               `json:"ime_deteta" bson:"ime_deteta"`
+	Preferencije  []PreferencijaVrtica `json:"preferencije" bson:"preferencije"`
+	CreatedAt     time.Time            `json:"created_at" bson:"created_at"`
+}
+
+type PreferencijaVrtica struct {
+	Rang       int                `json:"rang" bson:"rang"`
+	VrticID    primitive.ObjectID `json:"vrtic_id" bson:"vrtic_id"`
+	VrticNaziv string             `json:"vrtic_naziv" bson:"vrtic_naziv"`
+	ZahtevID   primitive.ObjectID `json:"zahtev_id" bson:"zahtev_id"`
+}
+
+type PrijavaRequest struct {
+	ImeRoditelja string                  `json:"ime_roditelja"`
+	DeteID       string                  `json:"dete_id"`
+	Vrtici       []string                `json:"vrtici"`
+	Kriterijumi  []DeklarisaniKriterijum `json:"kriterijumi"`
+}
+
+type PreferencijaView struct {
+	PreferencijaVrtica
+	Status string `json:"status"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type PrijavaView struct {
+	ID            primitive.ObjectID `json:"id"`
+	DeteID        primitive.ObjectID `json:"dete_id"`
+	ImeDeteta     string             `json:"ime_deteta"`
+	Preferencije  []PreferencijaView `json:"preferencije"`
+	DodeljenVrtic string             `json:"dodeljen_vrtic,omitempty"`
+	CreatedAt     time.Time          `json:"created_at"`
+}
+
+type RaspodelaResponse struct {
+	Kandidata      int `json:"kandidata"`
+	Odobreno       int `json:"odobreno"`
+	Neraspodeljeno int `json:"neraspodeljeno"`
+}
+
+const defaultMaxPreferencija = 3
+
+var errPrijavaForbidden = errors.New("Nemate dozvolu za ovu prijavu")
+
+var prijaveCollection *mongo.Collection
+
+func init() {
+	http.HandleFunc("/prijave", handlePrijave)
+	http.HandleFunc("/prijave/", handlePrijava)
+}
+
+func maxPreferencija() int {
+	n, err := strconv.Atoi(getenvDefault("PRIJAVA_MAX_VRTICA", ""))
+	if err != nil || n <= 0 {
+		return defaultMaxPreferencija
+	}
+	return n
+}
+
+func validatePrijavaInput(req PrijavaRequest) ([]string, error) {
+	if strings.TrimSpace(req.DeteID) == "" {
+		return nil, errors.New("Dete je obavezno")
+	}
+	if strings.TrimSpace(req.ImeRoditelja) == "" {
+		return nil, errors.New("Ime roditelja je obavezno")
+	}
+	if len(req.Vrtici) == 0 {
+		return nil, errors.New("Izaberite bar jedan vrtic")
+	}
+	if len(req.Vrtici) > maxPreferencija() {
+		return nil, fmt.Errorf("Mozete izabrati najvise %d vrtica", maxPreferencija())
+	}
+	vrtici := make([]string, 0, len(req.Vrtici))
+	seen := map[string]bool{}
+	for _, raw := range req.Vrtici {
+		id := strings.TrimSpace(raw)
+		if seen[id] {
+			return nil, errors.New("Isti vrtic je izabran vise puta")
+		}
+		seen[id] = true
+		vrtici = append(vrtici, id)
+	}
+	return vrtici, nil
+}
+
+// createPrijava proverava sve izbore pre upisa bilo cega, pa upisuje
+// zahteve i na kraju prijavu. Ako upis prijave ne uspe, zahtevi se brisu.
+func createPrijava(ctx context.Context, claims jwt.MapClaims, req PrijavaRequest) (*PrijavaView, error) {
+	vrtici, err := validatePrijavaInput(req)
+	if err != nil {
+		return nil, err
+	}
+
+	prijava := PrijavaUpisa{ID: primitive.NewObjectID(), CreatedAt: time.Now()}
+	items := make([]interface{}, 0, len(vrtici))
+	zahtevi := make([]UpisZahtev, 0, len(vrtici))
+	for i, vrticID := range vrtici {
+		item, err := buildEnrollmentRequest(ctx, claims, UpisRequest{
+			VrticID:      vrticID,
+			ImeRoditelja: req.ImeRoditelja,
+			DeteID:       req.DeteID,
+			Kriterijumi:  req.Kriterijumi,
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%d. izbor: %w", i+1, err)
+		}
+		item.ID = primitive.NewObjectID()
+		item.PrijavaID = prijava.ID
+		item.Preferencija = i + 1
+		// Oznaku aktivnog zahteva nosi samo prvi izbor.
+		if i > 0 {
+			item.AktivnoDeteID = primitive.NilObjectID
+		}
+		items = append(items, *item)
+		zahtevi = append(zahtevi, *item)
+
+		prijava.KorisnikEmail = item.KorisnikEmail
+		prijava.DeteID = item.DeteID
+		prijava.ImeDeteta = item.ImeDeteta
+		prijava.Preferencije = append(prijava.Preferencije, PreferencijaVrtica{
+			Rang:       i + 1,
+			VrticID:    item.VrticID,
+			VrticNaziv: item.VrticNaziv,
+			ZahtevID:   item.ID,
+		})
+	}
+
+	if _, err := zahteviCollection.InsertMany(ctx, items); err != nil {
+		return nil, activeEnrollmentError(err)
+	}
+	if _, err := prijaveCollection.InsertOne(ctx, prijava); err != nil {
+		if _, delErr := zahteviCollection.DeleteMany(ctx, bson.M{"prijava_id": prijava.ID}); delErr != nil {
+			log.Printf("Prijava rollback warning for %s: %v", prijava.ID.Hex(), delErr)
+		}
+		return nil, err
+	}
+	view := buildPrijavaView(prijava, zahtevi)
+	return &view, nil
+}
+
+func buildPrijavaView(prijava PrijavaUpisa, zahtevi []UpisZahtev) PrijavaView {
+	byID := map[primitive.ObjectID]UpisZahtev{}
+	for _, item := range zahtevi {
+		byID[item.ID] = item
+	}
+	view := PrijavaView{
+		ID:           prijava.ID,
+		DeteID:       prijava.DeteID,
+		ImeDeteta:    prijava.ImeDeteta,
+		Preferencije: make([]PreferencijaView, 0, len(prijava.Preferencije)),
+		CreatedAt:    prijava.CreatedAt,
+	}
+	for _, pref := range prijava.Preferencije {
+		item := byID[pref.ZahtevID]
+		status := canonicalRequestStatus(item.Status)
+		view.Preferencije = append(view.Preferencije, PreferencijaView{PreferencijaVrtica: pref, Status: status, Reason: item.Reason})
+		if status == statusApproved {
+			view.DodeljenVrtic = pref.VrticNaziv
+		}
+	}
+	return view
+}
+
+func prijavaViews(ctx context.Context, prijave []PrijavaUpisa) ([]PrijavaView, error) {
+	ids := make([]primitive.ObjectID, 0, len(prijave))
+	for _, p := range prijave {
+		ids = append(ids, p.ID)
+	}
+	cursor, err := zahteviCollection.Find(ctx, bson.M{"prijava_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	var zahtevi []UpisZahtev
+	if err := cursor.All(ctx, &zahtevi); err != nil {
+		return nil, err
+	}
+	views := make([]PrijavaView, 0, len(prijave))
+	for _, p := range prijave {
+		views = append(views, buildPrijavaView(p, zahtevi))
+	}
+	return views, nil
+}
+
+func getPrijaveByParent(ctx context.Context, email string) ([]PrijavaView, error) {
+	cursor, err := prijaveCollection.Find(ctx,
+		bson.M{"korisnik_email": strings.ToLower(strings.TrimSpace(email))},
+		options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}),
+	)
+	if err != nil {
+		return nil, err
+	}
+	var prijave []PrijavaUpisa
+	if err := cursor.All(ctx, &prijave); err != nil {
+		return nil, err
+	}
+	return prijavaViews(ctx, prijave)
+}
+
+func getPrijava(ctx context.Context, claims jwt.MapClaims, id primitive.ObjectID) (*PrijavaView, error) {
+	var prijava PrijavaUpisa
+	if err := prijaveCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&prijava); err != nil {
+		return nil, err
+	}
+	email := strings.ToLower(strings.TrimSpace(claimString(claims, "sub")))
+	if email != prijava.KorisnikEmail && authorize(claims, permEnrollmentAllocate) != nil {
+		return nil, errPrijavaForbidden
+	}
+	views, err := prijavaViews(ctx, []PrijavaUpisa{prijava})
+	if err != nil {
+		return nil, err
+	}
+	return &views[0], nil
+}
+
+// withdrawOtherPreferences povlaci ostale izbore iste prijave kada je dete
+// upisano preko jednog od njih.
+func withdrawOtherPreferences(ctx context.Context, item UpisZahtev) {
+	if item.PrijavaID.IsZero() {
+		return
+	}
+	cursor, err := zahteviCollection.Find(ctx, bson.M{
+		"prijava_id": item.PrijavaID,
+		"_id":        bson.M{"$ne": item.ID},
+		"status":     bson.M{"$in": withdrawableStatuses},
+	})
+	if err != nil {
+		log.Printf("Preference withdrawal warning for prijava %s: %v", item.PrijavaID.Hex(), err)
+		return
+	}
+	var others []UpisZahtev
+	if err := cursor.All(ctx, &others); err != nil {
+		log.Printf("Preference withdrawal warning for prijava %s: %v", item.PrijavaID.Hex(), err)
+		return
+	}
+	reason := fmt.Sprintf("Dete je upisano u vrtic %s (%d. izbor). Ostali izbori su povuceni.", item.VrticNaziv, item.Preferencija)
+	for _, other := range others {
+		current := canonicalRequestStatus(other.Status)
+		if err := updateRequestStatus(ctx, other.ID, systemClaims, current, statusWithdrawn, reason); err != nil {
+			if !errors.Is(err, errRequestChanged) {
+				log.Printf("Preference withdrawal warning for zahtev %s: %v", other.ID.Hex(), err)
+			}
+			continue
+		}
+		cleanupEnrollmentViews(ctx, other)
+		if current == statusInReview {
+			onSeatsFreed(ctx, other.VrticID, "povucen_izbor_prijave")
+		}
+	}
+}
+
+// seatCapacity je broj slobodnih mesta na konkursu za raspodelu: ukupno i,
+// kada vrtic ili konkurs imaju uzrasne grupe, po grupi.
+type seatCapacity struct {
+	total  int
+	groups map[string]int
+}
+
+func (c seatCapacity) fits(used int, usedByGroup map[string]int, grupa string) bool {
+	if used >= c.total {
+		return false
+	}
+	if c.groups == nil || grupa == "" {
+		return true
+	}
+	return usedByGroup[grupa] < c.groups[grupa]
+}
+
+func konkursCapacity(k Konkurs, v Vrtic, graduating int) seatCapacity {
+	c := seatCapacity{total: k.MaxMesta - k.Popunjeno}
+	if free := slobodnaMesta(v) + graduating; free < c.total {
+		c.total = free
+	}
+	if len(k.MestaPoGrupi) > 0 {
+		c.groups = map[string]int{}
+		for _, g := range k.MestaPoGrupi {
+			c.groups[g.Grupa] = g.MaxMesta - g.Popunjeno
+		}
+	}
+	if len(v.Grupe) > 0 {
+		vrticGroups := map[string]int{}
+		for _, g := range v.Grupe {
+			vrticGroups[g.Grupa] = g.Kapacitet - g.Upisano
+		}
+		if c.groups == nil {
+			c.groups = vrticGroups
+		} else {
+			for grupa, free := range c.groups {
+				if vrticFree := vrticGroups[grupa]; vrticFree < free {
+					c.groups[grupa] = vrticFree
+				}
+			}
+		}
+	}
+	return c
+}
+
+// rankedBefore je redosled rang liste (rankingSort) za zahteve u memoriji.
+func rankedBefore(a, b UpisZahtev) bool {
+	if a.Bodovi != b.Bodovi {
+		return a.Bodovi > b.Bodovi
+	}
+	if !a.CreatedAt.Equal(b.CreatedAt) {
+		return a.CreatedAt.Before(b.CreatedAt)
+	}
+	return a.ID.Hex() < b.ID.Hex()
+}
+
+// matchApplicants je jezgro raspodele bez pristupa bazi: vraca kandidate
+// koje svaki konkurs zadrzava posle odlozenog prihvatanja i broj dece.
+func matchApplicants(candidates []UpisZahtev, capacity map[primitive.ObjectID]seatCapacity) (map[primitive.ObjectID][]UpisZahtev, int) {
+	// Izbori svakog deteta po redu preferencije.
+	choices := map[primitive.ObjectID][]UpisZahtev{}
+	applicants := make([]primitive.ObjectID, 0)
+	for _, item := range candidates {
+		key := item.PrijavaID
+		if key.IsZero() {
+			key = item.ID
+		}
+		if _, ok := choices[key]; !ok {
+			applicants = append(applicants, key)
+		}
+		choices[key] = append(choices[key], item)
+	}
+	for _, key := range applicants {
+		list := choices[key]
+		sort.SliceStable(list, func(i, j int) bool { return list[i].Preferencija < list[j].Preferencija })
+	}
+
+	next := map[primitive.ObjectID]int{}
+	held := map[primitive.ObjectID][]UpisZahtev{}
+	free := append([]primitive.ObjectID(nil), applicants...)
+	for len(free) > 0 {
+		key := free[0]
+		free = free[1:]
+		if next[key] >= len(choices[key]) {
+			continue
+		}
+		proposal := choices[key][next[key]]
+		next[key]++
+
+		pool := append(held[proposal.KonkursID], proposal)
+		sort.SliceStable(pool, func(i, j int) bool { return rankedBefore(pool[i], pool[j]) })
+		c := capacity[proposal.KonkursID]
+		kept := make([]UpisZahtev, 0, len(pool))
+		usedByGroup := map[string]int{}
+		for _, item := range pool {
+			if c.fits(len(kept), usedByGroup, item.Grupa) {
+				kept = append(kept, item)
+				usedByGroup[item.Grupa]++
+				continue
+			}
+			rejected := item.PrijavaID
+			if rejected.IsZero() {
+				rejected = item.ID
+			}
+			free = append(free, rejected)
+		}
+		held[proposal.KonkursID] = kept
+	}
+	return held, len(applicants)
+}
+
+// runAllocation raspodeljuje decu po aktivnim konkursima odlozenim
+// prihvatanjem: svako dete se prijavljuje na svoj najvisi jos neodbijen
+// izbor, a svaki konkurs privremeno zadrzava najbolje rangirane kandidate
+// do popune mesta i odbija ostale. Kada niko vise nema kome da se prijavi,
+// zadrzani kandidati se odobravaju. Zahtevi bez prijave ucestvuju kao
+// prijave sa jednim izborom.
+func runAllocation(ctx context.Context, claims jwt.MapClaims) (*RaspodelaResponse, error) {
+	cursor, err := konkursiCollection.Find(ctx, bson.M{"aktivan": true, "zakljucen_at": bson.M{"$exists": false}})
+	if err != nil {
+		return nil, err
+	}
+	var konkursi []Konkurs
+	if err := cursor.All(ctx, &konkursi); err != nil {
+		return nil, err
+	}
+	capacity := map[primitive.ObjectID]seatCapacity{}
+	konkursIDs := make([]primitive.ObjectID, 0, len(konkursi))
+	for _, k := range konkursi {
+		vrtic, err := getVrticByID(ctx, k.VrticID)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				continue
+			}
+			return nil, err
+		}
+		graduating, err := graduatingSeats(ctx, vrtic.ID, k.RadnaGodina)
+		if err != nil {
+			return nil, err
+		}
+		capacity[k.ID] = konkursCapacity(k, vrtic, graduating)
+		konkursIDs = append(konkursIDs, k.ID)
+	}
+
+	cursor, err = zahteviCollection.Find(ctx, bson.M{
+		"konkurs_id": bson.M{"$in": konkursIDs},
+		"status":     bson.M{"$in": rankableStatuses},
+	})
+	if err != nil {
+		return nil, err
+	}
+	var candidates []UpisZahtev
+	if err := cursor.All(ctx, &candidates); err != nil {
+		return nil, err
+	}
+
+	held, applicants := matchApplicants(candidates, capacity)
+	result := RaspodelaResponse{Kandidata: applicants}
+	for _, konkursID := range konkursIDs {
+		for _, item := range held[konkursID] {
+			if err := approveEnrollment(ctx, claims, item, canonicalRequestStatus(item.Status)); err != nil {
+				if errors.Is(err, errRequestChanged) {
+					continue
+				}
+				return &result, err
+			}
+			updated, err := getRequestByID(ctx, item.ID)
+			if err != nil {
+				return &result, err
+			}
+			if updated.Status == statusApproved {
+				result.Odobreno++
+			}
+		}
+	}
+	result.Neraspodeljeno = result.Kandidata - result.Odobreno
+	return &result, nil
+}
+
+func ensurePrijaveIndexes(ctx context.Context) {
+	_, err := prijaveCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "korisnik_email", Value: 1}}})
+	if err != nil {
+		log.Printf("Prijave index warning: %v", err)
+	}
+	_, err = zahteviCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "prijava_id", Value: 1}}})
+	if err != nil {
+		log.Printf("Requests index warning: %v", err)
+	}
+}
+
+func prijavaErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments), errors.Is(err, errDeteNotFound), errors.Is(err, errVrticNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errDeteForbidden), errors.Is(err, errPrijavaForbidden):
+		return http.StatusForbidden
+	case errors.Is(err, errActiveEnrollmentExists):
+		return http.StatusConflict
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func handlePrijave(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		if err := authorize(claims, permEnrollmentReadOwn); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		items, err := getPrijaveByParent(r.Context(), claimString(claims, "sub"))
+		if err != nil {
+			http.Error(w, "Greska pri citanju prijava", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(items)
+	case http.MethodPost:
+		if err := authorize(claims, permEnrollmentCreate); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		var req PrijavaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+			return
+		}
+		item, err := createPrijava(r.Context(), claims, req)
+		if err != nil {
+			http.Error(w, err.Error(), prijavaErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(item)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handlePrijava(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	// POST /prijave/raspodela pokrece raspodelu po svim aktivnim konkursima.
+	if strings.TrimSuffix(r.URL.Path, "/") == "/prijave/raspodela" {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if err := authorize(claims, permEnrollmentAllocate); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		result, err := runAllocation(r.Context(), claims)
+		if err != nil {
+			http.Error(w, "Greska pri raspodeli: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(result)
+		return
+	}
+
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := parseSimpleObjectID(r.URL.Path, "/prijave/")
+	if err != nil {
+		http.Error(w, "Neispravan ID prijave", http.StatusBadRequest)
+		return
+	}
+	item, err := getPrijava(r.Context(), claims, id)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			http.Error(w, "Prijava nije pronadjena", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), prijavaErrorStatus(err))
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(item)
+}
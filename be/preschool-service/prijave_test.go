@@ -0,0 +1,249 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+func TestMatchApplicants(t *testing.T) {
+	konkursA := primitive.NewObjectID()
+	konkursB := primitive.NewObjectID()
+	konkursC := primitive.NewObjectID()
+	base := time.Date(2024, time.May, 1, 8, 0, 0, 0, time.UTC)
+
+	// izbor je jedan zahtev deteta; rang 0 znaci zahtev bez prijave.
+	type izbor struct {
+		dete    string
+		konkurs primitive.ObjectID
+		rang    int
+		bodovi  int
+		grupa   string
+	}
+	build := func(izbori []izbor) ([]UpisZahtev, map[primitive.ObjectID]string) {
+		prijave := map[string]primitive.ObjectID{}
+		names := map[primitive.ObjectID]string{}
+		items := make([]UpisZahtev, 0, len(izbori))
+		for i, iz := range izbori {
+			item := UpisZahtev{
+				ID:           primitive.NewObjectID(),
+				KonkursID:    iz.konkurs,
+				ImeDeteta:    iz.dete,
+				Preferencija: iz.rang,
+				Bodovi:       iz.bodovi,
+				Grupa:        iz.grupa,
+				CreatedAt:    base.Add(time.Duration(i) * time.Minute),
+			}
+			if iz.rang > 0 {
+				if _, ok := prijave[iz.dete]; !ok {
+					prijave[iz.dete] = primitive.NewObjectID()
+				}
+				item.PrijavaID = prijave[iz.dete]
+			}
+			names[item.ID] = iz.dete
+			items = append(items, item)
+		}
+		return items, names
+	}
+
+	tests := []struct {
+		name       string
+		izbori     []izbor
+		capacity   map[primitive.ObjectID]seatCapacity
+		want       map[primitive.ObjectID][]string
+		applicants int
+	}{
+		{
+			name: "odbijeno dete prelazi na sledeci izbor",
+			izbori: []izbor{
+				{"Ana", konkursA, 1, 10, ""},
+				{"Ana", konkursB, 2, 10, ""},
+				{"Bora", konkursA, 1, 30, ""},
+				{"Bora", konkursB, 2, 30, ""},
+			},
+			capacity:   map[primitive.ObjectID]seatCapacity{konkursA: {total: 1}, konkursB: {total: 1}},
+			want:       map[primitive.ObjectID][]string{konkursA: {"Bora"}, konkursB: {"Ana"}},
+			applicants: 2,
+		},
+		{
+			name: "zadrzano dete se istiskuje i dobija drugi izbor",
+			izbori: []izbor{
+				{"Ana", konkursA, 1, 10, ""},
+				{"Ana", konkursB, 2, 10, ""},
+				{"Bora", konkursB, 1, 5, ""},
+				{"Vesna", konkursA, 1, 20, ""},
+			},
+			capacity:   map[primitive.ObjectID]seatCapacity{konkursA: {total: 1}, konkursB: {total: 1}},
+			want:       map[primitive.ObjectID][]string{konkursA: {"Vesna"}, konkursB: {"Ana"}},
+			applicants: 3,
+		},
+		{
+			name: "zahtev bez prijave ostaje neraspodeljen",
+			izbori: []izbor{
+				{"Ana", konkursA, 0, 10, ""},
+				{"Bora", konkursA, 0, 20, ""},
+				{"Vesna", konkursC, 0, 0, ""},
+			},
+			capacity:   map[primitive.ObjectID]seatCapacity{konkursA: {total: 1}, konkursC: {total: 0}},
+			want:       map[primitive.ObjectID][]string{konkursA: {"Bora"}},
+			applicants: 3,
+		},
+		{
+			name: "ograniceno po uzrasnim grupama",
+			izbori: []izbor{
+				{"Ana", konkursA, 1, 40, grupaJaslice},
+				{"Ana", konkursB, 2, 40, grupaJaslice},
+				{"Bora", konkursA, 1, 30, grupaJaslice},
+				{"Bora", konkursB, 2, 30, grupaJaslice},
+				{"Vesna", konkursA, 1, 5, grupaVrtic},
+				{"Goran", konkursA, 1, 20, grupaJaslice},
+			},
+			capacity: map[primitive.ObjectID]seatCapacity{
+				konkursA: {total: 3, groups: map[string]int{grupaJaslice: 1, grupaVrtic: 2}},
+				konkursB: {total: 5, groups: map[string]int{grupaJaslice: 1, grupaVrtic: 5}},
+			},
+			want:       map[primitive.ObjectID][]string{konkursA: {"Ana", "Vesna"}, konkursB: {"Bora"}},
+			applicants: 4,
+		},
+		{
+			name: "jednaki bodovi, ranije podnet zahtev ima prednost",
+			izbori: []izbor{
+				{"Ana", konkursA, 1, 10, ""},
+				{"Bora", konkursA, 1, 10, ""},
+			},
+			capacity:   map[primitive.ObjectID]seatCapacity{konkursA: {total: 1}},
+			want:       map[primitive.ObjectID][]string{konkursA: {"Ana"}},
+			applicants: 2,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items, names := build(tt.izbori)
+			assigned := func(held map[primitive.ObjectID][]UpisZahtev) map[primitive.ObjectID][]string {
+				result := map[primitive.ObjectID][]string{}
+				for konkursID, list := range held {
+					for _, item := range list {
+						result[konkursID] = append(result[konkursID], names[item.ID])
+					}
+					sort.Strings(result[konkursID])
+				}
+				return result
+			}
+
+			held, applicants := matchApplicants(items, tt.capacity)
+			if applicants != tt.applicants {
+				t.Fatalf("kandidata = %d, want %d", applicants, tt.applicants)
+			}
+			got := assigned(held)
+			for _, konkursID := range []primitive.ObjectID{konkursA, konkursB, konkursC} {
+				if g, w := got[konkursID], tt.want[konkursID]; !equalStrings(g, w) {
+					t.Fatalf("konkurs %s: dodeljeno %v, want %v", konkursID.Hex(), g, w)
+				}
+				for _, item := range held[konkursID] {
+					if item.KonkursID != konkursID {
+						t.Fatalf("zahtev %s zadrzan na pogresnom konkursu", names[item.ID])
+					}
+				}
+				if n := len(held[konkursID]); n > tt.capacity[konkursID].total {
+					t.Fatalf("konkurs %s: %d dodela preko %d mesta", konkursID.Hex(), n, tt.capacity[konkursID].total)
+				}
+			}
+
+			// Ishod ne sme zavisiti od redosleda kojim su zahtevi procitani.
+			reversed := make([]UpisZahtev, len(items))
+			for i, item := range items {
+				reversed[len(items)-1-i] = item
+			}
+			again, _ := matchApplicants(reversed, tt.capacity)
+			gotAgain := assigned(again)
+			for _, konkursID := range []primitive.ObjectID{konkursA, konkursB, konkursC} {
+				if !equalStrings(gotAgain[konkursID], got[konkursID]) {
+					t.Fatalf("obrnut redosled: konkurs %s dobija %v, a ne %v", konkursID.Hex(), gotAgain[konkursID], got[konkursID])
+				}
+			}
+		})
+	}
+}
+
+func equalStrings(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestPrijavaErrorStatus(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"prijava ne postoji", mongo.ErrNoDocuments, http.StatusNotFound},
+		{"dete ne postoji", fmt.Errorf("1. izbor: %w", errDeteNotFound), http.StatusNotFound},
+		{"vrtic ne postoji", fmt.Errorf("2. izbor: %w", errVrticNotFound), http.StatusNotFound},
+		{"tudje dete", fmt.Errorf("1. izbor: %w", errDeteForbidden), http.StatusForbidden},
+		{"tudja prijava", errPrijavaForbidden, http.StatusForbidden},
+		{"aktivan zahtev", fmt.Errorf("1. izbor: %w", errActiveEnrollmentExists), http.StatusConflict},
+		{"poruka sa istim recima", errors.New("Prethodni aktivan zahtev nije pronadjen"), http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := prijavaErrorStatus(tt.err); got != tt.want {
+				t.Fatalf("prijavaErrorStatus(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestActiveEnrollmentIndex(t *testing.T) {
+	ctx := testMongo(t)
+	ensureDecaIndexes(ctx)
+	deteID := primitive.NewObjectID()
+
+	// Dva podnosenja koja su oba prosla proveru unapred.
+	direct := UpisZahtev{DeteID: deteID, AktivnoDeteID: deteID, Status: statusSubmitted}
+	res, err := zahteviCollection.InsertOne(ctx, direct)
+	if err != nil {
+		t.Fatal(err)
+	}
+	direct.ID = insertedID(res.InsertedID)
+	_, err = zahteviCollection.InsertOne(ctx, UpisZahtev{DeteID: deteID, AktivnoDeteID: deteID, Status: statusSubmitted})
+	if err := activeEnrollmentError(err); !errors.Is(err, errActiveEnrollmentExists) {
+		t.Fatalf("drugo podnosenje: err = %v, want errActiveEnrollmentExists", err)
+	}
+
+	// Povlacenje oslobadja dete za novu prijavu.
+	if err := updateRequestStatus(ctx, direct.ID, systemClaims, statusSubmitted, statusWithdrawn, ""); err != nil {
+		t.Fatal(err)
+	}
+	prijavaID := primitive.NewObjectID()
+	first := UpisZahtev{ID: primitive.NewObjectID(), DeteID: deteID, AktivnoDeteID: deteID, PrijavaID: prijavaID, Preferencija: 1, Status: statusSubmitted}
+	second := UpisZahtev{ID: primitive.NewObjectID(), DeteID: deteID, PrijavaID: prijavaID, Preferencija: 2, Status: statusSubmitted}
+	if _, err := zahteviCollection.InsertMany(ctx, []interface{}{first, second}); err != nil {
+		t.Fatalf("prijava posle povlacenja: %v", err)
+	}
+
+	// Kada prvi izbor bude odbijen, oznaku preuzima drugi izbor.
+	if err := updateRequestStatus(ctx, first.ID, systemClaims, statusSubmitted, statusRejected, "Nema mesta"); err != nil {
+		t.Fatal(err)
+	}
+	var got UpisZahtev
+	if err := zahteviCollection.FindOne(ctx, bson.M{"aktivno_dete_id": deteID}).Decode(&got); err != nil {
+		t.Fatalf("nosilac posle odbijanja: %v", err)
+	}
+	if got.ID != second.ID {
+		t.Fatalf("nosilac = %s, want drugi izbor %s", got.ID.Hex(), second.ID.Hex())
+	}
+}
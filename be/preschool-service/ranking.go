@@ -0,0 +1,251 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// KriterijumBodovanja je jedan kriterijum konkursa (npr. zaposleni
+// roditelji). Ako je PotrebanDokument, bodovi se racunaju samo kada je
+// roditelj prilozio dokaz.
+type KriterijumBodovanja struct {
+	Sifra            string `json:"sifra" bson:"sifra"`
+	Naziv            string `json:"naziv" bson:"naziv"`
+	Bodovi           int    `json:"bodovi" bson:"bodovi"`
+	PotrebanDokument bool   `json:"potreban_dokument" bson:"potreban_dokument"`
+}
+
+// DeklarisaniKriterijum je kriterijum koji je roditelj naveo u zahtevu,
+// sa oznakom da li je prilozio dokument i dodeljenim bodovima.
+type DeklarisaniKriterijum struct {
+	Sifra    string `json:"sifra" bson:"sifra"`
+	Dokument bool   `json:"dokument" bson:"dokument"`
+	Bodovi   int    `json:"bodovi" bson:"bodovi"`
+}
+
+type RangListaStavka struct {
+	Rang        int                     `json:"rang"`
+	ZahtevID    primitive.ObjectID      `json:"zahtev_id"`
+	ImeDeteta   string                  `json:"ime_deteta"`
+	BrojGodina  int                     `json:"broj_godina"`
+	Grupa       string                  `json:"grupa,omitempty"`
+	Bodovi      int                     `json:"bodovi"`
+	Kriterijumi []DeklarisaniKriterijum `json:"kriterijumi"`
+	Status      string                  `json:"status"`
+	CreatedAt   time.Time               `json:"created_at"`
+}
+
+type RangListaResponse struct {
+	KonkursID primitive.ObjectID `json:"konkurs_id"`
+	MaxMesta  int                `json:"max_mesta"`
+	Popunjeno int                `json:"popunjeno"`
+	Stavke    []RangListaStavka  `json:"stavke"`
+}
+
+type RangListaOdobravanjeResponse struct {
+	Odobreno     int `json:"odobreno"`
+	ListaCekanja int `json:"lista_cekanja"`
+}
+
+// Podrazumevani kriterijumi za konkurse raspisane bez sopstvenih.
+var defaultKriterijumi = []KriterijumBodovanja{
+	{Sifra: "zaposleni_roditelji", Naziv: "Oba roditelja zaposlena", Bodovi: 30, PotrebanDokument: true},
+	{Sifra: "samohrani_roditelj", Naziv: "Samohrani roditelj", Bodovi: 30, PotrebanDokument: true},
+	{Sifra: "brat_sestra_upisan", Naziv: "Brat ili sestra vec upisani u vrtic", Bodovi: 15, PotrebanDokument: false},
+	{Sifra: "dete_sa_smetnjama", Naziv: "Dete sa smetnjama u razvoju", Bodovi: 40, PotrebanDokument: true},
+	{Sifra: "socijalna_pomoc", Naziv: "Korisnik novcane socijalne pomoci", Bodovi: 25, PotrebanDokument: true},
+}
+
+// rankableStatuses su statusi zahteva koji ulaze u rang listu za odobravanje.
+var rankableStatuses = []string{statusSubmitted, statusInReview, statusWaitingList}
+
+func konkursCriteria(k Konkurs) []KriterijumBodovanja {
+	if len(k.Kriterijumi) == 0 {
+		return defaultKriterijumi
+	}
+	return k.Kriterijumi
+}
+
+func normalizeKonkursCriteria(items []KriterijumBodovanja) ([]KriterijumBodovanja, error) {
+	if len(items) == 0 {
+		return nil, nil
+	}
+	seen := map[string]bool{}
+	result := make([]KriterijumBodovanja, 0, len(items))
+	for _, item := range items {
+		item.Sifra = strings.ToLower(strings.TrimSpace(item.Sifra))
+		item.Naziv = strings.TrimSpace(item.Naziv)
+		if item.Sifra == "" || item.Naziv == "" {
+			return nil, errors.New("Svaki kriterijum mora imati sifru i naziv")
+		}
+		if item.Bodovi <= 0 {
+			return nil, errors.New("Bodovi kriterijuma moraju biti veci od nule")
+		}
+		if seen[item.Sifra] {
+			return nil, errors.New("Kriterijum " + item.Sifra + " je naveden vise puta")
+		}
+		seen[item.Sifra] = true
+		result = append(result, item)
+	}
+	return result, nil
+}
+
+// scoreRequest proverava kriterijume koje je roditelj naveo i racuna
+// ukupan broj bodova po kriterijumima konkursa.
+func scoreRequest(k Konkurs, declared []DeklarisaniKriterijum) ([]DeklarisaniKriterijum, int, error) {
+	byCode := map[string]KriterijumBodovanja{}
+	for _, item := range konkursCriteria(k) {
+		byCode[item.Sifra] = item
+	}
+
+	seen := map[string]bool{}
+	result := make([]DeklarisaniKriterijum, 0, len(declared))
+	total := 0
+	for _, item := range declared {
+		code := strings.ToLower(strings.TrimSpace(item.Sifra))
+		criterion, ok := byCode[code]
+		if !ok {
+			return nil, 0, errors.New("Nepoznat kriterijum: " + item.Sifra)
+		}
+		if seen[code] {
+			continue
+		}
+		seen[code] = true
+		awarded := 0
+		if item.Dokument || !criterion.PotrebanDokument {
+			awarded = criterion.Bodovi
+		}
+		total += awarded
+		result = append(result, DeklarisaniKriterijum{Sifra: code, Dokument: item.Dokument, Bodovi: awarded})
+	}
+	return result, total, nil
+}
+
+// rankingSort je redosled rang liste: vise bodova, pa raniji zahtev.
+func rankingSort() bson.D {
+	return bson.D{{Key: "bodovi", Value: -1}, {Key: "created_at", Value: 1}, {Key: "_id", Value: 1}}
+}
+
+func getRankedRequests(ctx context.Context, konkursID primitive.ObjectID, statuses []string) ([]UpisZahtev, error) {
+	filter := bson.M{"konkurs_id": konkursID}
+	if len(statuses) > 0 {
+		filter["status"] = bson.M{"$in": statuses}
+	}
+	cursor, err := zahteviCollection.Find(ctx, filter, options.Find().SetSort(rankingSort()))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	items := make([]UpisZahtev, 0)
+	for cursor.Next(ctx) {
+		var item UpisZahtev
+		if err := cursor.Decode(&item); err != nil {
+			return nil, err
+		}
+		item.Status = canonicalRequestStatus(item.Status)
+		items = append(items, item)
+	}
+	return items, cursor.Err()
+}
+
+// getFrozenRequests vraca zahteve zakljucenog konkursa redom kojim su
+// zamrznuti, cak i ako su kasnije prebaceni na novi konkurs.
+func getFrozenRequests(ctx context.Context, ids []primitive.ObjectID) ([]UpisZahtev, error) {
+	cursor, err := zahteviCollection.Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	byID := map[primitive.ObjectID]UpisZahtev{}
+	for cursor.Next(ctx) {
+		var item UpisZahtev
+		if err := cursor.Decode(&item); err != nil {
+			return nil, err
+		}
+		item.Status = canonicalRequestStatus(item.Status)
+		byID[item.ID] = item
+	}
+	if err := cursor.Err(); err != nil {
+		return nil, err
+	}
+
+	items := make([]UpisZahtev, 0, len(ids))
+	for _, id := range ids {
+		if item, ok := byID[id]; ok {
+			items = append(items, item)
+		}
+	}
+	return items, nil
+}
+
+func getRankingList(ctx context.Context, konkurs Konkurs) (*RangListaResponse, error) {
+	var items []UpisZahtev
+	var err error
+	if konkurs.ZamrznutiZahtevi != nil {
+		items, err = getFrozenRequests(ctx, konkurs.ZamrznutiZahtevi)
+	} else {
+		items, err = getRankedRequests(ctx, konkurs.ID, nil)
+	}
+	if err != nil {
+		return nil, err
+	}
+	resp := RangListaResponse{KonkursID: konkurs.ID, MaxMesta: konkurs.MaxMesta, Popunjeno: konkurs.Popunjeno, Stavke: make([]RangListaStavka, 0, len(items))}
+	for _, item := range items {
+		if item.Status == statusRejected || item.Status == statusWithdrawn {
+			continue
+		}
+		kriterijumi := item.Kriterijumi
+		if kriterijumi == nil {
+			kriterijumi = []DeklarisaniKriterijum{}
+		}
+		resp.Stavke = append(resp.Stavke, RangListaStavka{
+			Rang:        len(resp.Stavke) + 1,
+			ZahtevID:    item.ID,
+			ImeDeteta:   item.ImeDeteta,
+			BrojGodina:  item.BrojGodina,
+			Grupa:       item.Grupa,
+			Bodovi:      item.Bodovi,
+			Kriterijumi: kriterijumi,
+			Status:      item.Status,
+			CreatedAt:   item.CreatedAt,
+		})
+	}
+	return &resp, nil
+}
+
+// approveByRanking odobrava zahteve redom sa rang liste dok ima mesta.
+// Zahtevi za koje mesta nije bilo ostaju na listi cekanja.
+func approveByRanking(ctx context.Context, claims jwt.MapClaims, konkursID primitive.ObjectID) (*RangListaOdobravanjeResponse, error) {
+	items, err := getRankedRequests(ctx, konkursID, rankableStatuses)
+	if err != nil {
+		return nil, err
+	}
+	result := RangListaOdobravanjeResponse{}
+	for _, item := range items {
+		if err := approveEnrollment(ctx, claims, item, item.Status); err != nil {
+			if errors.Is(err, errRequestChanged) {
+				continue
+			}
+			return &result, err
+		}
+		updated, err := getRequestByID(ctx, item.ID)
+		if err != nil {
+			return &result, err
+		}
+		if updated.Status == statusApproved {
+			result.Odobreno++
+		} else {
+			result.ListaCekanja++
+		}
+	}
+	return &result, nil
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestScoreRequest(t *testing.T) {
+	custom := Konkurs{Kriterijumi: []KriterijumBodovanja{
+		{Sifra: "zaposleni_roditelji", Naziv: "Oba roditelja zaposlena", Bodovi: 20, PotrebanDokument: true},
+		{Sifra: "blizina", Naziv: "Prebivaliste u opstini", Bodovi: 10},
+	}}
+
+	tests := []struct {
+		name     string
+		konkurs  Konkurs
+		declared []DeklarisaniKriterijum
+		want     []DeklarisaniKriterijum
+		bodovi   int
+		wantErr  bool
+	}{
+		{
+			name:    "bez kriterijuma",
+			konkurs: custom,
+			want:    []DeklarisaniKriterijum{},
+		},
+		{
+			name:     "dokument prilozen",
+			konkurs:  custom,
+			declared: []DeklarisaniKriterijum{{Sifra: "zaposleni_roditelji", Dokument: true}},
+			want:     []DeklarisaniKriterijum{{Sifra: "zaposleni_roditelji", Dokument: true, Bodovi: 20}},
+			bodovi:   20,
+		},
+		{
+			name:     "bez potrebnog dokumenta nema bodova",
+			konkurs:  custom,
+			declared: []DeklarisaniKriterijum{{Sifra: "zaposleni_roditelji"}},
+			want:     []DeklarisaniKriterijum{{Sifra: "zaposleni_roditelji"}},
+		},
+		{
+			name:     "kriterijum bez dokumenta",
+			konkurs:  custom,
+			declared: []DeklarisaniKriterijum{{Sifra: "blizina"}},
+			want:     []DeklarisaniKriterijum{{Sifra: "blizina", Bodovi: 10}},
+			bodovi:   10,
+		},
+		{
+			name:    "sifra se normalizuje, duplikat se ne boduje dvaput",
+			konkurs: custom,
+			declared: []DeklarisaniKriterijum{
+				{Sifra: " Blizina "},
+				{Sifra: "blizina"},
+				{Sifra: "ZAPOSLENI_RODITELJI", Dokument: true},
+			},
+			want: []DeklarisaniKriterijum{
+				{Sifra: "blizina", Bodovi: 10},
+				{Sifra: "zaposleni_roditelji", Dokument: true, Bodovi: 20},
+			},
+			bodovi: 30,
+		},
+		{
+			name:     "podrazumevani kriterijumi",
+			konkurs:  Konkurs{},
+			declared: []DeklarisaniKriterijum{{Sifra: "brat_sestra_upisan"}, {Sifra: "dete_sa_smetnjama", Dokument: true}},
+			want:     []DeklarisaniKriterijum{{Sifra: "brat_sestra_upisan", Bodovi: 15}, {Sifra: "dete_sa_smetnjama", Dokument: true, Bodovi: 40}},
+			bodovi:   55,
+		},
+		{
+			name:     "nepoznat kriterijum",
+			konkurs:  custom,
+			declared: []DeklarisaniKriterijum{{Sifra: "brat_sestra_upisan"}},
+			wantErr:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, bodovi, err := scoreRequest(tt.konkurs, tt.declared)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if bodovi != tt.bodovi || !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("scoreRequest = (%+v, %d), want (%+v, %d)", got, bodovi, tt.want, tt.bodovi)
+			}
+		})
+	}
+}
@@ -67,7 +67,7 @@ func handleOcene(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		if err := requireUserRole(claims); err != nil {
+		if err := authorize(claims, permRatingCreate); err != nil {
 			http.Error(w, err.Error(), http.StatusForbidden)
 			return
 		}
@@ -137,7 +137,7 @@ func upsertRating(ctx context.Context, claims jwt.MapClaims, req RatingRequest)
 	}
 	if _, err := getVrticByID(ctx, vrticID); err != nil {
 		if errors.Is(err, mongo.ErrNoDocuments) {
-			return errors.New("Vrtic nije pronadjen")
+			return errVrticNotFound
 		}
 		return err
 	}
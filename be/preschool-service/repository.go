@@ -2,6 +2,8 @@ package main
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
@@ -25,41 +27,110 @@ func getAllVrtici(ctx context.Context) ([]Vrtic, error) {
 	return result, cursor.Err()
 }
 
+var errVrticNotFound = errors.New("Vrtic nije pronadjen")
+
 func getVrticByID(ctx context.Context, id primitive.ObjectID) (Vrtic, error) {
 	var v Vrtic
 	err := vrticiCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&v)
 	return v, err
 }
 
+// insertVrtic upisuje nov vrtic. Brojaci upisanih krecu od dece upisane van
+// sistema; uzrasne grupe krecu od nule.
 func insertVrtic(ctx context.Context, v Vrtic) error {
+	v.TrenutnoUpisano = v.UpisanoVanSistema
+	for i := range v.Grupe {
+		v.Grupe[i].Upisano = 0
+	}
 	_, err := vrticiCollection.InsertOne(ctx, v)
 	return err
 }
 
+// vrticValidationError je greska u zadatim podacima izmene vrtica, za
+// razliku od greske baze.
+type vrticValidationError string
+
+func (e vrticValidationError) Error() string { return string(e) }
+
+// updateVrtic menja podatke vrtica. Brojaci upisanih se ne zadaju: ukupan
+// se pomera samo za promenu broja upisanih van sistema, a grupe zadrzavaju
+// zatecene brojeve. Izmena je uslovna na zatecene brojace, da se ne izgubi
+// istovremeno zauzeto mesto.
 func updateVrtic(ctx context.Context, id primitive.ObjectID, v Vrtic) error {
-	res, err := vrticiCollection.UpdateOne(ctx, bson.M{"_id": id}, bson.M{"$set": bson.M{
-		"naziv":            v.Naziv,
-		"tip":              v.Tip,
-		"grad":             v.Grad,
-		"opstina":          v.Opstina,
-		"max_kapacitet":    v.MaxKapacitet,
-		"trenutno_upisano": v.TrenutnoUpisano,
-	}})
+	existing, err := getVrticByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	grupe, err := mergeVrticGroups(existing.Grupe, v.Grupe)
+	if err != nil {
+		return err
+	}
+	upisano := existing.TrenutnoUpisano + v.UpisanoVanSistema - existing.UpisanoVanSistema
+	if upisano < 0 {
+		upisano = 0
+	}
+	if upisano > v.MaxKapacitet {
+		return vrticValidationError(fmt.Sprintf("Kapacitet ne moze biti manji od broja upisane dece (%d)", upisano))
+	}
+
+	res, err := vrticiCollection.UpdateOne(ctx,
+		bson.M{"_id": id, "trenutno_upisano": existing.TrenutnoUpisano, "grupe": existing.Grupe},
+		bson.M{"$set": bson.M{
+			"naziv":               v.Naziv,
+			"tip":                 v.Tip,
+			"grad":                v.Grad,
+			"opstina":             v.Opstina,
+			"max_kapacitet":       v.MaxKapacitet,
+			"upisano_van_sistema": v.UpisanoVanSistema,
+			"trenutno_upisano":    upisano,
+			"grupe":               grupe,
+		}},
+	)
 	if err != nil {
 		return err
 	}
 	if res.MatchedCount == 0 {
-		return mongo.ErrNoDocuments
+		return errVrticChanged
 	}
 	return nil
 }
 
+// mergeVrticGroups preuzima broj upisanih iz postojecih grupa. Grupa sa
+// upisanom decom ne moze se ukloniti niti smanjiti ispod broja upisanih.
+func mergeVrticGroups(existing, requested []KapacitetGrupe) ([]KapacitetGrupe, error) {
+	upisano := map[string]int{}
+	for _, g := range existing {
+		upisano[g.Grupa] = g.Upisano
+	}
+	result := make([]KapacitetGrupe, 0, len(requested))
+	for _, g := range requested {
+		g.Upisano = upisano[g.Grupa]
+		if g.Kapacitet < g.Upisano {
+			return nil, vrticValidationError(fmt.Sprintf("Kapacitet grupe %s ne moze biti manji od broja upisane dece (%d)", g.Grupa, g.Upisano))
+		}
+		delete(upisano, g.Grupa)
+		result = append(result, g)
+	}
+	for grupa, n := range upisano {
+		if n > 0 {
+			return nil, vrticValidationError(fmt.Sprintf("Grupa %s ima upisanu decu i ne moze se ukloniti", grupa))
+		}
+	}
+	if len(result) == 0 {
+		return nil, nil
+	}
+	return result, nil
+}
+
 func deleteVrtic(ctx context.Context, id primitive.ObjectID) error {
-	_, _ = zahteviCollection.DeleteMany(ctx, bson.M{"vrtic_id": id, "status": bson.M{"$in": []string{statusSubmitted, statusInReview, statusNeedDocs, statusWaitingList, statusRejected, "na_cekanju", "u_proveri"}}})
+	_, _ = zahteviCollection.DeleteMany(ctx, bson.M{"vrtic_id": id, "status": bson.M{"$in": []string{statusSubmitted, statusInReview, statusNeedDocs, statusWaitingList, statusRejected, statusWithdrawn}}})
 	_, _ = konkursiCollection.DeleteMany(ctx, bson.M{"vrtic_id": id})
 	_, _ = rasporediCollection.DeleteMany(ctx, bson.M{"vrtic_id": id})
+	_, _ = vaspitneGrupeCollection.DeleteMany(ctx, bson.M{"vrtic_id": id})
+	deleteVrticShifts(ctx, id)
 	_, _ = sastanciCollection.DeleteMany(ctx, bson.M{"vrtic_id": id})
 	_, _ = obavestenjaCollection.DeleteMany(ctx, bson.M{"vrtic_id": id})
+	_, _ = roditeljObavestenjaCollection.DeleteMany(ctx, bson.M{"vrtic_id": id})
 	res, err := vrticiCollection.DeleteOne(ctx, bson.M{"_id": id})
 	if err != nil {
 		return err
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestMergeVrticGroups(t *testing.T) {
+	existing := []KapacitetGrupe{
+		{Grupa: grupaJaslice, Kapacitet: 10, Upisano: 4},
+		{Grupa: grupaVrtic, Kapacitet: 20, Upisano: 0},
+	}
+
+	tests := []struct {
+		name      string
+		requested []KapacitetGrupe
+		want      []KapacitetGrupe
+		invalid   bool
+	}{
+		{
+			name:      "brojevi upisanih se zadrzavaju",
+			requested: []KapacitetGrupe{{Grupa: grupaJaslice, Kapacitet: 6, Upisano: 99}},
+			want:      []KapacitetGrupe{{Grupa: grupaJaslice, Kapacitet: 6, Upisano: 4}},
+		},
+		{
+			name:      "kapacitet ispod upisanih",
+			requested: []KapacitetGrupe{{Grupa: grupaJaslice, Kapacitet: 3}},
+			invalid:   true,
+		},
+		{
+			name:      "uklanjanje grupe sa decom",
+			requested: []KapacitetGrupe{{Grupa: grupaVrtic, Kapacitet: 20}},
+			invalid:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := mergeVrticGroups(existing, tt.requested)
+			var invalid vrticValidationError
+			if tt.invalid != errors.As(err, &invalid) {
+				t.Fatalf("err = %v, want validation error %v", err, tt.invalid)
+			}
+			if !tt.invalid && !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("mergeVrticGroups = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
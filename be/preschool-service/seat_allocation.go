@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Mesta se zauzimaju uslovnim atomicnim izmenama ($inc samo dok je brojac
+// ispod kapaciteta), pa dva istovremena odobravanja ne mogu oba dobiti
+// poslednje mesto. Transakcije se ne koriste jer Mongo iz docker-compose
+// radi bez replica seta.
+
+var errRequestChanged = errors.New("Zahtev je u medjuvremenu izmenjen, osvezite prikaz i pokusajte ponovo")
+
+// seatCounter opisuje polja brojaca mesta u dokumentu vrtica ili konkursa:
+// ukupan brojac i niz brojaca po uzrasnim grupama.
+type seatCounter struct {
+	used, limit           string
+	groups                string
+	groupUsed, groupLimit string
+}
+
+var (
+	vrticSeats   = seatCounter{used: "trenutno_upisano", limit: "max_kapacitet", groups: "grupe", groupUsed: "upisano", groupLimit: "kapacitet"}
+	konkursSeats = seatCounter{used: "popunjeno", limit: "max_mesta", groups: "mesta_po_grupi", groupUsed: "popunjeno", groupLimit: "max_mesta"}
+)
+
+// reserve zauzima mesto u ukupnom brojacu i, kada je grupa zadata, u
+// brojacu te grupe u istoj izmeni. extra povecava ukupan limit (mesta koja
+// ce se osloboditi do pocetka radne godine upisa).
+func (c seatCounter) reserve(ctx context.Context, coll *mongo.Collection, id primitive.ObjectID, grupa string, extra int) (bool, error) {
+	conds := bson.A{bson.M{"$lt": bson.A{"$" + c.used, bson.M{"$add": bson.A{"$" + c.limit, extra}}}}}
+	inc := bson.M{c.used: 1}
+	filter := bson.M{"_id": id}
+	if grupa != "" {
+		filter[c.groups+".grupa"] = grupa
+		conds = append(conds, bson.M{"$anyElementTrue": bson.A{bson.M{"$map": bson.M{
+			"input": bson.M{"$ifNull": bson.A{"$" + c.groups, bson.A{}}},
+			"in": bson.M{"$and": bson.A{
+				bson.M{"$eq": bson.A{"$$this.grupa", grupa}},
+				bson.M{"$lt": bson.A{"$$this." + c.groupUsed, "$$this." + c.groupLimit}},
+			}},
+		}}}})
+		inc[c.groups+".$."+c.groupUsed] = 1
+	}
+	filter["$expr"] = bson.M{"$and": conds}
+	res, err := coll.UpdateOne(ctx, filter, bson.M{"$inc": inc})
+	if err != nil {
+		return false, err
+	}
+	return res.ModifiedCount == 1, nil
+}
+
+func (c seatCounter) release(ctx context.Context, coll *mongo.Collection, id primitive.ObjectID, grupa string) error {
+	if grupa != "" {
+		res, err := coll.UpdateOne(ctx,
+			bson.M{"_id": id, c.used: bson.M{"$gt": 0}, c.groups: bson.M{"$elemMatch": bson.M{"grupa": grupa, c.groupUsed: bson.M{"$gt": 0}}}},
+			bson.M{"$inc": bson.M{c.used: -1, c.groups + ".$." + c.groupUsed: -1}},
+		)
+		if err != nil || res.ModifiedCount == 1 {
+			return err
+		}
+	}
+	_, err := coll.UpdateOne(ctx,
+		bson.M{"_id": id, c.used: bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{c.used: -1}},
+	)
+	return err
+}
+
+// vrticSeatGroup vraca grupu po kojoj se broje mesta u vrticu, ili prazan
+// string ako vrtic nema kapacitete po grupama.
+func vrticSeatGroup(ctx context.Context, vrticID primitive.ObjectID, grupa string) (string, error) {
+	if grupa == "" {
+		return "", nil
+	}
+	vrtic, err := getVrticByID(ctx, vrticID)
+	if err != nil {
+		return "", err
+	}
+	if len(vrtic.Grupe) == 0 {
+		return "", nil
+	}
+	return grupa, nil
+}
+
+func konkursSeatGroup(ctx context.Context, konkursID primitive.ObjectID, grupa string) (string, error) {
+	if grupa == "" {
+		return "", nil
+	}
+	konkurs, err := getKonkursByID(ctx, konkursID)
+	if err != nil {
+		return "", err
+	}
+	if len(konkurs.MestaPoGrupi) == 0 {
+		return "", nil
+	}
+	return grupa, nil
+}
+
+// reserveVrticSeat zauzima mesto za upis u radnu godinu radnaGodina. Za
+// kasniju godinu se mesta predskolaca koji zavrsavaju racunaju kao
+// slobodna; kapaciteti grupa se i dalje porede sa trenutnim upisom.
+func reserveVrticSeat(ctx context.Context, vrticID primitive.ObjectID, grupa, radnaGodina string) (bool, error) {
+	grupa, err := vrticSeatGroup(ctx, vrticID, grupa)
+	if err != nil {
+		return false, err
+	}
+	extra, err := graduatingSeats(ctx, vrticID, radnaGodina)
+	if err != nil {
+		return false, err
+	}
+	return vrticSeats.reserve(ctx, vrticiCollection, vrticID, grupa, extra)
+}
+
+func releaseVrticSeat(ctx context.Context, vrticID primitive.ObjectID, grupa string) error {
+	grupa, err := vrticSeatGroup(ctx, vrticID, grupa)
+	if err != nil {
+		return err
+	}
+	return vrticSeats.release(ctx, vrticiCollection, vrticID, grupa)
+}
+
+func reserveKonkursSeat(ctx context.Context, konkursID primitive.ObjectID, grupa string) (bool, error) {
+	grupa, err := konkursSeatGroup(ctx, konkursID, grupa)
+	if err != nil {
+		return false, err
+	}
+	return konkursSeats.reserve(ctx, konkursiCollection, konkursID, grupa, 0)
+}
+
+func releaseKonkursSeat(ctx context.Context, konkursID primitive.ObjectID, grupa string) error {
+	grupa, err := konkursSeatGroup(ctx, konkursID, grupa)
+	if err != nil {
+		return err
+	}
+	return konkursSeats.release(ctx, konkursiCollection, konkursID, grupa)
+}
+
+// releaseSeats vraca mesta zauzeta za zahtev koji na kraju nije odobren.
+func releaseSeats(ctx context.Context, item UpisZahtev, konkursReserved bool) {
+	if err := releaseVrticSeat(ctx, item.VrticID, item.Grupa); err != nil {
+		log.Printf("Seat release warning for vrtic %s: %v", item.VrticID.Hex(), err)
+	}
+	if konkursReserved {
+		if err := releaseKonkursSeat(ctx, item.KonkursID, item.Grupa); err != nil {
+			log.Printf("Seat release warning for konkurs %s: %v", item.KonkursID.Hex(), err)
+		}
+	}
+}
+
+// approveEnrollment prvo zauzima mesto u vrticu pa na konkursu, a zatim
+// uslovno prebacuje zahtev u odobren. Ako bilo koji korak ne uspe, vec
+// zauzeta mesta se vracaju.
+func approveEnrollment(ctx context.Context, claims jwt.MapClaims, item UpisZahtev, current string) error {
+	ok, err := reserveVrticSeat(ctx, item.VrticID, item.Grupa, item.RadnaGodina)
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return updateRequestStatus(ctx, item.ID, claims, current, statusWaitingList, "Trenutno nema slobodnih mesta. Zahtev ostaje na listi cekanja.")
+	}
+
+	konkursReserved := false
+	if !item.KonkursID.IsZero() {
+		ok, err := reserveKonkursSeat(ctx, item.KonkursID, item.Grupa)
+		if err != nil {
+			releaseSeats(ctx, item, false)
+			return err
+		}
+		if !ok {
+			releaseSeats(ctx, item, false)
+			return updateRequestStatus(ctx, item.ID, claims, current, statusWaitingList, "Konkurs je trenutno popunjen. Zahtev ostaje na listi cekanja.")
+		}
+		konkursReserved = true
+	}
+
+	if err := updateRequestStatus(ctx, item.ID, claims, current, statusApproved, ""); err != nil {
+		releaseSeats(ctx, item, konkursReserved)
+		return err
+	}
+	withdrawOtherPreferences(ctx, item)
+	return nil
+}
+
+// ensureKonkursSeatCounters popunjava brojac zauzetih mesta za konkurse
+// nastale pre uvodjenja atomicnog zauzimanja.
+func ensureKonkursSeatCounters(ctx context.Context) {
+	cursor, err := konkursiCollection.Find(ctx, bson.M{"popunjeno": bson.M{"$exists": false}})
+	if err != nil {
+		log.Printf("Konkurs seat counters warning: %v", err)
+		return
+	}
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var item Konkurs
+		if err := cursor.Decode(&item); err != nil {
+			log.Printf("Konkurs seat counters warning: %v", err)
+			return
+		}
+		approved, err := countApprovedRequestsForKonkurs(ctx, item.ID)
+		if err != nil {
+			log.Printf("Konkurs seat counters warning: %v", err)
+			return
+		}
+		_, err = konkursiCollection.UpdateOne(ctx,
+			bson.M{"_id": item.ID, "popunjeno": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"popunjeno": approved}},
+		)
+		if err != nil {
+			log.Printf("Konkurs seat counters warning: %v", err)
+		}
+	}
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// testMongo povezuje kolekcije servisa na privremenu bazu na
+// TEST_MONGO_URI. Bez dostupnog Mongo servera test se preskace.
+func testMongo(t *testing.T) context.Context {
+	t.Helper()
+	uri := os.Getenv("TEST_MONGO_URI")
+	if uri == "" {
+		t.Skip("TEST_MONGO_URI nije postavljen")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	t.Cleanup(cancel)
+	client, err := mongo.Connect(ctx, options.Client().ApplyURI(uri).SetServerSelectionTimeout(2*time.Second))
+	if err != nil {
+		t.Skipf("Mongo nije dostupan: %v", err)
+	}
+	if err := client.Ping(ctx, nil); err != nil {
+		t.Skipf("Mongo nije dostupan: %v", err)
+	}
+
+	db := client.Database(fmt.Sprintf("preschool_test_%d", time.Now().UnixNano()))
+	t.Cleanup(func() {
+		db.Drop(context.Background())
+		client.Disconnect(context.Background())
+	})
+	vrticiCollection = db.Collection("vrtici")
+	zahteviCollection = db.Collection("zahtevi_upisa")
+	konkursiCollection = db.Collection("konkursi")
+	rasporediCollection = db.Collection("rasporedi_vaspitaca")
+	sastanciCollection = db.Collection("sastanci")
+	obavestenjaCollection = db.Collection("obavestenja")
+	roditeljObavestenjaCollection = db.Collection("obavestenja_roditeljima")
+	revokedTokensCollection = db.Collection("revoked_tokens")
+	resenjaCollection = db.Collection("resenja")
+	deteCollection = db.Collection("deca")
+	prijaveCollection = db.Collection("prijave")
+	radneGodineCollection = db.Collection("radne_godine")
+	vaspitneGrupeCollection = db.Collection("vaspitne_grupe")
+	smeneCollection = db.Collection("smene")
+	odsustvaCollection = db.Collection("odsustva")
+	zameneCollection = db.Collection("zamene")
+	return ctx
+}
+
+func TestApproveEnrollmentLastSeatConcurrently(t *testing.T) {
+	ctx := testMongo(t)
+	const workers = 12
+
+	tests := []struct {
+		name    string
+		vrtic   Vrtic
+		konkurs Konkurs
+		grupa   string
+	}{
+		{
+			name:    "poslednje mesto u vrticu",
+			vrtic:   Vrtic{Naziv: "Sumica", MaxKapacitet: 10, TrenutnoUpisano: 9},
+			konkurs: Konkurs{MaxMesta: 20, Popunjeno: 3, Aktivan: true},
+		},
+		{
+			name:    "poslednje mesto na konkursu",
+			vrtic:   Vrtic{Naziv: "Sumica", MaxKapacitet: 100, TrenutnoUpisano: 10},
+			konkurs: Konkurs{MaxMesta: 5, Popunjeno: 4, Aktivan: true},
+		},
+		{
+			name: "poslednje mesto u uzrasnoj grupi",
+			vrtic: Vrtic{Naziv: "Sumica", MaxKapacitet: 100, TrenutnoUpisano: 14, Grupe: []KapacitetGrupe{
+				{Grupa: grupaJaslice, Kapacitet: 5, Upisano: 4},
+				{Grupa: grupaVrtic, Kapacitet: 50, Upisano: 10},
+			}},
+			konkurs: Konkurs{MaxMesta: 20, Popunjeno: 0, Aktivan: true, MestaPoGrupi: []MestaGrupe{
+				{Grupa: grupaJaslice, MaxMesta: 10},
+				{Grupa: grupaVrtic, MaxMesta: 10},
+			}},
+			grupa: grupaJaslice,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			vrticRes, err := vrticiCollection.InsertOne(ctx, tt.vrtic)
+			if err != nil {
+				t.Fatalf("insert vrtic: %v", err)
+			}
+			tt.vrtic.ID = insertedID(vrticRes.InsertedID)
+			tt.konkurs.VrticID = tt.vrtic.ID
+			konkursRes, err := konkursiCollection.InsertOne(ctx, tt.konkurs)
+			if err != nil {
+				t.Fatalf("insert konkurs: %v", err)
+			}
+			tt.konkurs.ID = insertedID(konkursRes.InsertedID)
+
+			items := make([]UpisZahtev, workers)
+			for i := range items {
+				items[i] = UpisZahtev{
+					VrticID:       tt.vrtic.ID,
+					KonkursID:     tt.konkurs.ID,
+					VrticNaziv:    tt.vrtic.Naziv,
+					Grupa:         tt.grupa,
+					ImeDeteta:     fmt.Sprintf("Dete %d", i),
+					KorisnikEmail: fmt.Sprintf("roditelj%d@example.com", i),
+					Status:        statusInReview,
+					CreatedAt:     time.Now(),
+				}
+				res, err := zahteviCollection.InsertOne(ctx, items[i])
+				if err != nil {
+					t.Fatalf("insert zahtev: %v", err)
+				}
+				items[i].ID = insertedID(res.InsertedID)
+			}
+
+			var wg sync.WaitGroup
+			start := make(chan struct{})
+			errs := make(chan error, workers)
+			for _, item := range items {
+				wg.Add(1)
+				go func(item UpisZahtev) {
+					defer wg.Done()
+					<-start
+					errs <- approveEnrollment(ctx, systemClaims, item, statusInReview)
+				}(item)
+			}
+			close(start)
+			wg.Wait()
+			close(errs)
+			for err := range errs {
+				if err != nil {
+					t.Errorf("approveEnrollment: %v", err)
+				}
+			}
+
+			approved, err := zahteviCollection.CountDocuments(ctx, bson.M{"konkurs_id": tt.konkurs.ID, "status": statusApproved})
+			if err != nil {
+				t.Fatalf("count: %v", err)
+			}
+			if approved != 1 {
+				t.Fatalf("odobreno %d zahteva, ocekivano tacno 1", approved)
+			}
+			waiting, _ := zahteviCollection.CountDocuments(ctx, bson.M{"konkurs_id": tt.konkurs.ID, "status": statusWaitingList})
+			if waiting != workers-1 {
+				t.Fatalf("na listi cekanja %d zahteva, ocekivano %d", waiting, workers-1)
+			}
+
+			vrtic, err := getVrticByID(ctx, tt.vrtic.ID)
+			if err != nil {
+				t.Fatalf("getVrticByID: %v", err)
+			}
+			if vrtic.TrenutnoUpisano > vrtic.MaxKapacitet || vrtic.TrenutnoUpisano != tt.vrtic.TrenutnoUpisano+1 {
+				t.Fatalf("trenutno_upisano = %d (kapacitet %d), ocekivano %d", vrtic.TrenutnoUpisano, vrtic.MaxKapacitet, tt.vrtic.TrenutnoUpisano+1)
+			}
+			for _, g := range vrtic.Grupe {
+				if g.Upisano > g.Kapacitet {
+					t.Fatalf("grupa %s: upisano %d preko kapaciteta %d", g.Grupa, g.Upisano, g.Kapacitet)
+				}
+			}
+
+			konkurs, err := getKonkursByID(ctx, tt.konkurs.ID)
+			if err != nil {
+				t.Fatalf("getKonkursByID: %v", err)
+			}
+			if konkurs.Popunjeno > konkurs.MaxMesta || konkurs.Popunjeno != tt.konkurs.Popunjeno+1 {
+				t.Fatalf("popunjeno = %d (max %d), ocekivano %d", konkurs.Popunjeno, konkurs.MaxMesta, tt.konkurs.Popunjeno+1)
+			}
+			for _, g := range konkurs.MestaPoGrupi {
+				if g.Popunjeno > g.MaxMesta {
+					t.Fatalf("grupa %s: popunjeno %d preko %d mesta", g.Grupa, g.Popunjeno, g.MaxMesta)
+				}
+			}
+		})
+	}
+}
+
+func insertedID(inserted interface{}) primitive.ObjectID {
+	id, _ := inserted.(primitive.ObjectID)
+	return id
+}
+
+func TestReserveVrticSeatNextYear(t *testing.T) {
+	ctx := testMongo(t)
+
+	if _, err := radneGodineCollection.InsertMany(ctx, []interface{}{
+		RadnaGodina{Oznaka: "2024/2025", Aktivna: true},
+		RadnaGodina{Oznaka: "2025/2026"},
+	}); err != nil {
+		t.Fatalf("insert radne godine: %v", err)
+	}
+	vrticRes, err := vrticiCollection.InsertOne(ctx, Vrtic{Naziv: "Sumica", MaxKapacitet: 2, TrenutnoUpisano: 2})
+	if err != nil {
+		t.Fatalf("insert vrtic: %v", err)
+	}
+	vrticID := insertedID(vrticRes.InsertedID)
+	for _, grupa := range []string{grupaPredskolci, grupaVrtic} {
+		if _, err := zahteviCollection.InsertOne(ctx, UpisZahtev{
+			VrticID:     vrticID,
+			RadnaGodina: "2024/2025",
+			Grupa:       grupa,
+			Status:      statusApproved,
+		}); err != nil {
+			t.Fatalf("insert zahtev: %v", err)
+		}
+	}
+
+	tests := []struct {
+		radnaGodina string
+		want        bool
+	}{
+		{"2024/2025", false},
+		{"2025/2026", true},
+		{"2025/2026", false},
+	}
+	for _, tt := range tests {
+		ok, err := reserveVrticSeat(ctx, vrticID, "", tt.radnaGodina)
+		if err != nil {
+			t.Fatalf("reserveVrticSeat(%s): %v", tt.radnaGodina, err)
+		}
+		if ok != tt.want {
+			t.Fatalf("reserveVrticSeat(%s) = %v, want %v", tt.radnaGodina, ok, tt.want)
+		}
+	}
+}
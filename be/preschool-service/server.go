@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"io"
 	"net/http"
@@ -43,25 +44,25 @@ func allDataHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	opstina, err := izvestajPoOpstini(r.Context())
+	opstina, err := izvestajPoOpstini(r.Context(), "")
 	if err != nil {
 		http.Error(w, "Greska opstina report", http.StatusInternalServerError)
 		return
 	}
 
-	konkursi, err := getAllKonkursViews(r.Context(), "", "")
+	konkursi, err := getAllKonkursViews(r.Context(), "", "", "", allVrtici)
 	if err != nil {
 		http.Error(w, "Greska konkursi", http.StatusInternalServerError)
 		return
 	}
 
-	rasporedi, err := listAssignments(r.Context())
+	rasporedi, err := listAssignments(r.Context(), allVrtici)
 	if err != nil {
 		http.Error(w, "Greska rasporedi", http.StatusInternalServerError)
 		return
 	}
 
-	zahtevi, err := getAllRequests(r.Context())
+	zahtevi, err := getAllRequests(r.Context(), "", allVrtici)
 	if err != nil {
 		http.Error(w, "Greska zahtevi", http.StatusInternalServerError)
 		return
@@ -81,7 +82,9 @@ func allDataHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(resp)
 }
 func main() {
+	initPolicy()
 	initMongo()
+	startKonkursClosingJob()
 
 	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		enableCORS(w)
@@ -124,14 +127,21 @@ func main() {
 			return
 		}
 
-		report, err := izvestajPoOpstini(r.Context())
+		radnaGodina := strings.TrimSpace(r.URL.Query().Get("radna_godina"))
+		if radnaGodina != "" {
+			if _, err := parseAcademicYear(radnaGodina); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+		}
+		report, err := izvestajPoOpstini(r.Context(), radnaGodina)
 		if err != nil {
 			http.Error(w, "Greska pri citanju iz baze", http.StatusInternalServerError)
 			return
 		}
 
 		if r.URL.Query().Get("format") == "pdf" || strings.Contains(r.Header.Get("Accept"), "application/pdf") {
-			pdfBytes, err := buildOpstinaPDFReport(report)
+			pdfBytes, err := buildOpstinaPDFReport(report, radnaGodina)
 			if err != nil {
 				http.Error(w, "Greska pri generisanju PDF izvestaja", http.StatusInternalServerError)
 				return
@@ -168,7 +178,7 @@ func main() {
 				http.Error(w, err.Error(), http.StatusUnauthorized)
 				return
 			}
-			if err := requireAdminRole(claims); err != nil {
+			if err := authorize(claims, permVrticCreate); err != nil {
 				http.Error(w, err.Error(), http.StatusForbidden)
 				return
 			}
@@ -202,7 +212,17 @@ func main() {
 
 		switch r.Method {
 		case http.MethodGet:
-			items, err := getAllKonkursViews(r.Context(), strings.TrimSpace(r.URL.Query().Get("status")), strings.TrimSpace(r.URL.Query().Get("vrtic_id")))
+			// Lista je javna; prijavljeni direktor vidi samo konkurse svojih vrtica.
+			scope := allVrtici
+			if r.Header.Get("Authorization") != "" {
+				claims, err := requireAuth(r)
+				if err != nil {
+					http.Error(w, err.Error(), http.StatusUnauthorized)
+					return
+				}
+				scope = principalFromClaims(claims).ListScope()
+			}
+			items, err := getAllKonkursViews(r.Context(), strings.TrimSpace(r.URL.Query().Get("status")), strings.TrimSpace(r.URL.Query().Get("vrtic_id")), strings.TrimSpace(r.URL.Query().Get("radna_godina")), scope)
 			if err != nil {
 				http.Error(w, "Greska pri citanju konkursa", http.StatusInternalServerError)
 				return
@@ -215,20 +235,24 @@ func main() {
 				http.Error(w, err.Error(), http.StatusUnauthorized)
 				return
 			}
-			if err := requireAdminRole(claims); err != nil {
-				http.Error(w, err.Error(), http.StatusForbidden)
-				return
-			}
-
 			var req KonkursRequest
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 				http.Error(w, "Neispravan JSON", http.StatusBadRequest)
 				return
 			}
+			vrticID, err := primitive.ObjectIDFromHex(strings.TrimSpace(req.VrticID))
+			if err != nil {
+				http.Error(w, "Neispravan ID vrtica", http.StatusBadRequest)
+				return
+			}
+			if err := authorizeVrtic(claims, permKonkursCreate, vrticID); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
 
-			item, err := createKonkurs(r.Context(), req)
+			item, err := createKonkurs(r.Context(), claims, req)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				http.Error(w, err.Error(), konkursErrorStatus(err))
 				return
 			}
 
@@ -246,7 +270,7 @@ func main() {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
-		if r.Method != http.MethodPut {
+		if r.Method != http.MethodGet && r.Method != http.MethodPut {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
@@ -256,29 +280,116 @@ func main() {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		if err := requireAdminRole(claims); err != nil {
-			http.Error(w, err.Error(), http.StatusForbidden)
-			return
-		}
-
 		id, action, err := parseKonkursAction(r.URL.Path)
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
-		if action != "zatvori" {
+
+		var perm string
+		switch {
+		case r.Method == http.MethodGet && action == "rang-lista":
+			perm = permEnrollmentRead
+		case r.Method == http.MethodGet && action == "istorija":
+			perm = permKonkursCreate
+		case r.Method == http.MethodPut && (action == "" || action == "produzi"):
+			perm = permKonkursCreate
+		case r.Method == http.MethodPut && (action == "zatvori" || action == "ponovo-otvori"):
+			perm = permKonkursClose
+		case r.Method == http.MethodPut && action == "rang-lista":
+			perm = permEnrollmentApprove
+		default:
 			http.Error(w, "Nepoznata akcija", http.StatusBadRequest)
 			return
 		}
-		if err := closeKonkurs(r.Context(), id); err != nil {
+
+		konkurs, err := getKonkursByID(r.Context(), id)
+		if err != nil {
 			if errors.Is(err, mongo.ErrNoDocuments) {
 				http.Error(w, "Konkurs nije pronadjen", http.StatusNotFound)
 				return
 			}
-			http.Error(w, err.Error(), http.StatusBadRequest)
+			http.Error(w, "Greska pri citanju konkursa", http.StatusInternalServerError)
 			return
 		}
-		w.WriteHeader(http.StatusNoContent)
+		if err := authorizeVrtic(claims, perm, konkurs.VrticID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+
+		switch {
+		case r.Method == http.MethodGet && action == "istorija":
+			istorija := konkurs.Istorija
+			if istorija == nil {
+				istorija = []KonkursPromena{}
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(istorija)
+		case r.Method == http.MethodGet:
+			resp, err := getRankingList(r.Context(), konkurs)
+			if err != nil {
+				http.Error(w, "Greska pri citanju rang liste", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+		case action == "rang-lista":
+			// PUT na rang listu odobrava zahteve redom dok ima mesta.
+			resp, err := approveByRanking(r.Context(), claims, konkurs.ID)
+			if err != nil {
+				http.Error(w, "Greska pri odobravanju po rang listi", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(resp)
+		case action == "":
+			var req KonkursRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+				return
+			}
+			item, err := updateKonkurs(r.Context(), claims, id, req)
+			if err != nil {
+				http.Error(w, err.Error(), konkursErrorStatus(err))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(item)
+		case action == "produzi" || action == "ponovo-otvori":
+			var req KonkursRokRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+				return
+			}
+			var item *KonkursView
+			if action == "produzi" {
+				item, err = extendKonkurs(r.Context(), claims, id, req)
+			} else {
+				item, err = reopenKonkurs(r.Context(), claims, id, req)
+			}
+			if err != nil {
+				http.Error(w, err.Error(), konkursErrorStatus(err))
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(item)
+		default:
+			// Razlog zatvaranja je opcion.
+			var req KonkursRokRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
+				http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+				return
+			}
+			if err := closeKonkurs(r.Context(), claims, id, req.Razlog); err != nil {
+				if errors.Is(err, mongo.ErrNoDocuments) {
+					http.Error(w, "Konkurs nije pronadjen", http.StatusNotFound)
+					return
+				}
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		}
 	})
 
 	http.HandleFunc("/rasporedi-vaspitaca", func(w http.ResponseWriter, r *http.Request) {
@@ -296,11 +407,12 @@ func main() {
 
 		switch r.Method {
 		case http.MethodGet:
-			if err := requireAdminRole(claims); err != nil {
+			scope, err := authorizeScope(claims, permAssignmentRead)
+			if err != nil {
 				http.Error(w, err.Error(), http.StatusForbidden)
 				return
 			}
-			items, err := listAssignments(r.Context())
+			items, err := listAssignments(r.Context(), scope)
 			if err != nil {
 				http.Error(w, "Greska pri citanju rasporeda", http.StatusInternalServerError)
 				return
@@ -308,15 +420,20 @@ func main() {
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(items)
 		case http.MethodPost:
-			if err := requireAdminRole(claims); err != nil {
-				http.Error(w, err.Error(), http.StatusForbidden)
-				return
-			}
 			var req VaspitacRasporedRequest
 			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 				http.Error(w, "Neispravan JSON", http.StatusBadRequest)
 				return
 			}
+			vrticID, err := primitive.ObjectIDFromHex(strings.TrimSpace(req.VrticID))
+			if err != nil {
+				http.Error(w, "Neispravan ID vrtica", http.StatusBadRequest)
+				return
+			}
+			if err := authorizeVrtic(claims, permAssignmentManage, vrticID); err != nil {
+				http.Error(w, err.Error(), http.StatusForbidden)
+				return
+			}
 			item, err := createAssignment(r.Context(), req)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
@@ -345,15 +462,24 @@ func main() {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		if err := requireAdminRole(claims); err != nil {
-			http.Error(w, err.Error(), http.StatusForbidden)
-			return
-		}
 		id, err := parseSimpleObjectID(r.URL.Path, "/rasporedi-vaspitaca/")
 		if err != nil {
 			http.Error(w, err.Error(), http.StatusBadRequest)
 			return
 		}
+		assignment, err := getAssignmentByID(r.Context(), id)
+		if err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				http.Error(w, "Raspored nije pronadjen", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Greska pri citanju rasporeda", http.StatusInternalServerError)
+			return
+		}
+		if err := authorizeVrtic(claims, permAssignmentManage, assignment.VrticID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
 		if err := deleteAssignment(r.Context(), id); err != nil {
 			if errors.Is(err, mongo.ErrNoDocuments) {
 				http.Error(w, "Raspored nije pronadjen", http.StatusNotFound)
@@ -380,7 +506,7 @@ func main() {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		if err := requireUserRole(claims); err != nil {
+		if err := authorize(claims, permEducatorsReadOwn); err != nil {
 			http.Error(w, err.Error(), http.StatusForbidden)
 			return
 		}
@@ -409,7 +535,7 @@ func main() {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		if err := requireUserRole(claims); err != nil {
+		if err := authorize(claims, permMeetingReadOwn); err != nil {
 			http.Error(w, err.Error(), http.StatusForbidden)
 			return
 		}
@@ -438,7 +564,7 @@ func main() {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		if err := requireUserRole(claims); err != nil {
+		if err := authorize(claims, permMeetingCreate); err != nil {
 			http.Error(w, err.Error(), http.StatusForbidden)
 			return
 		}
@@ -472,7 +598,7 @@ func main() {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		if err := requireEducatorRole(claims); err != nil {
+		if err := authorize(claims, permChildrenRead); err != nil {
 			http.Error(w, err.Error(), http.StatusForbidden)
 			return
 		}
@@ -501,7 +627,7 @@ func main() {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		if err := requireEducatorRole(claims); err != nil {
+		if err := authorize(claims, permMeetingReadOwn); err != nil {
 			http.Error(w, err.Error(), http.StatusForbidden)
 			return
 		}
@@ -530,7 +656,7 @@ func main() {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		if err := requireEducatorRole(claims); err != nil {
+		if err := authorize(claims, permMeetingDecide); err != nil {
 			http.Error(w, err.Error(), http.StatusForbidden)
 			return
 		}
@@ -567,7 +693,7 @@ func main() {
 			w.WriteHeader(http.StatusNoContent)
 			return
 		}
-		if r.Method != http.MethodPost {
+		if r.Method != http.MethodPost && r.Method != http.MethodGet {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 			return
 		}
@@ -576,10 +702,21 @@ func main() {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		if err := requireEducatorRole(claims); err != nil {
+		if err := authorize(claims, permNotificationCreate); err != nil {
 			http.Error(w, err.Error(), http.StatusForbidden)
 			return
 		}
+		if r.Method == http.MethodGet {
+			email := strings.ToLower(strings.TrimSpace(claimString(claims, "sub")))
+			items, err := getNotificationsByEducator(r.Context(), email)
+			if err != nil {
+				http.Error(w, "Greska pri citanju obavestenja", http.StatusInternalServerError)
+				return
+			}
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(items)
+			return
+		}
 		var req SimptomObavestenjeRequest
 		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
@@ -610,7 +747,7 @@ func main() {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		if err := requireUserRole(claims); err != nil {
+		if err := authorize(claims, permNotificationReadOwn); err != nil {
 			http.Error(w, err.Error(), http.StatusForbidden)
 			return
 		}
@@ -640,7 +777,7 @@ func main() {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
-		if err := requireUserRole(claims); err != nil {
+		if err := authorize(claims, permEnrollmentReadOwn); err != nil {
 			http.Error(w, err.Error(), http.StatusForbidden)
 			return
 		}
@@ -670,7 +807,7 @@ func main() {
 				http.Error(w, err.Error(), http.StatusUnauthorized)
 				return
 			}
-			if err := requireUserRole(claims); err != nil {
+			if err := authorize(claims, permEnrollmentCreate); err != nil {
 				http.Error(w, err.Error(), http.StatusForbidden)
 				return
 			}
@@ -683,7 +820,11 @@ func main() {
 
 			newReq, err := createEnrollmentRequest(r.Context(), claims, req)
 			if err != nil {
-				http.Error(w, err.Error(), http.StatusBadRequest)
+				status := http.StatusBadRequest
+				if errors.Is(err, errActiveEnrollmentExists) {
+					status = http.StatusConflict
+				}
+				http.Error(w, err.Error(), status)
 				return
 			}
 
@@ -696,12 +837,13 @@ func main() {
 				http.Error(w, err.Error(), http.StatusUnauthorized)
 				return
 			}
-			if err := requireAdminRole(claims); err != nil {
+			scope, err := authorizeScope(claims, permEnrollmentRead)
+			if err != nil {
 				http.Error(w, err.Error(), http.StatusForbidden)
 				return
 			}
 
-			items, err := getAllRequests(r.Context())
+			items, err := getAllRequests(r.Context(), strings.TrimSpace(r.URL.Query().Get("radna_godina")), scope)
 			if err != nil {
 				http.Error(w, "Greska pri citanju zahteva", http.StatusInternalServerError)
 				return
@@ -726,6 +868,10 @@ func main() {
 			http.Error(w, err.Error(), http.StatusUnauthorized)
 			return
 		}
+		if strings.Contains(r.URL.Path, "/dokumenti/") {
+			handleRequestDocument(w, r, claims)
+			return
+		}
 
 		switch r.Method {
 		case http.MethodGet:
@@ -734,7 +880,7 @@ func main() {
 				http.Error(w, err.Error(), http.StatusBadRequest)
 				return
 			}
-			if action != "dokument" {
+			if action != "dokument" && action != "istorija" {
 				http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 				return
 			}
@@ -748,11 +894,32 @@ func main() {
 				http.Error(w, "Greska pri citanju zahteva", http.StatusInternalServerError)
 				return
 			}
+			if action == "istorija" {
+				if !canReadRequest(item, claims) {
+					http.Error(w, "Nemate dozvolu za ovaj zahtev", http.StatusForbidden)
+					return
+				}
+				istorija := item.Istorija
+				if istorija == nil {
+					istorija = []StatusPromena{}
+				}
+				w.Header().Set("Content-Type", "application/json")
+				json.NewEncoder(w).Encode(istorija)
+				return
+			}
 			if !canAccessRequestDocument(item, claims) {
 				http.Error(w, "Nemate dozvolu za ovaj dokument", http.StatusForbidden)
 				return
 			}
 
+			// Resenje izdato pri zakljucivanju konkursa ima prednost.
+			if resenje, err := getCurrentDecision(r.Context(), item); err == nil {
+				w.Header().Set("Content-Type", "application/pdf")
+				w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=\"%s\"", resenje.FileName))
+				w.Write(resenje.PDF)
+				return
+			}
+
 			pdf, fileName, err := buildRequestDecisionPDF(item)
 			if err != nil {
 				http.Error(w, err.Error(), http.StatusBadRequest)
@@ -776,7 +943,7 @@ func main() {
 			}
 
 			if action == "izmeni" {
-				if err := requireUserRole(claims); err != nil {
+				if err := authorize(claims, permEnrollmentUpdateOwn); err != nil {
 					http.Error(w, err.Error(), http.StatusForbidden)
 					return
 				}
@@ -791,6 +958,8 @@ func main() {
 					switch {
 					case errors.Is(err, mongo.ErrNoDocuments):
 						status = http.StatusNotFound
+					case errors.Is(err, errRequestChanged), errors.Is(err, errActiveEnrollmentExists):
+						status = http.StatusConflict
 					case strings.Contains(err.Error(), "Nemate dozvolu"):
 						status = http.StatusForbidden
 					}
@@ -803,20 +972,52 @@ func main() {
 			}
 
 			if action == "dokumenta" {
-				if err := requireUserRole(claims); err != nil {
+				if err := authorize(claims, permEnrollmentUpdateOwn); err != nil {
 					http.Error(w, err.Error(), http.StatusForbidden)
 					return
 				}
-				var payload DokumentaUpdateRequest
-				if err := json.NewDecoder(r.Body).Decode(&payload); err != nil {
-					http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+				if err := updateRequestDocuments(r.Context(), claims, id); err != nil {
+					status := http.StatusBadRequest
+					switch {
+					case errors.Is(err, mongo.ErrNoDocuments):
+						status = http.StatusNotFound
+					case errors.Is(err, errRequestChanged):
+						status = http.StatusConflict
+					case strings.Contains(err.Error(), "Nemate dozvolu"):
+						status = http.StatusForbidden
+					}
+					http.Error(w, err.Error(), status)
 					return
 				}
-				if err := updateRequestDocuments(r.Context(), claims, id, payload); err != nil {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+
+			if action == "povuci" || action == "ispis" {
+				if err := authorize(claims, permEnrollmentWithdrawOwn); err != nil {
+					http.Error(w, err.Error(), http.StatusForbidden)
+					return
+				}
+				var payload RequestActionPayload
+				if r.Body != nil {
+					defer r.Body.Close()
+					if err := json.NewDecoder(r.Body).Decode(&payload); err != nil && !errors.Is(err, io.EOF) {
+						http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+						return
+					}
+				}
+				if action == "povuci" {
+					err = withdrawEnrollmentRequest(r.Context(), claims, id, payload.Reason)
+				} else {
+					err = requestUnenrollment(r.Context(), claims, id, payload.Reason)
+				}
+				if err != nil {
 					status := http.StatusBadRequest
 					switch {
 					case errors.Is(err, mongo.ErrNoDocuments):
 						status = http.StatusNotFound
+					case errors.Is(err, errRequestChanged):
+						status = http.StatusConflict
 					case strings.Contains(err.Error(), "Nemate dozvolu"):
 						status = http.StatusForbidden
 					}
@@ -827,7 +1028,16 @@ func main() {
 				return
 			}
 
-			if err := requireAdminRole(claims); err != nil {
+			item, err := getRequestByID(r.Context(), id)
+			if err != nil {
+				if errors.Is(err, mongo.ErrNoDocuments) {
+					http.Error(w, "Zahtev nije pronadjen", http.StatusNotFound)
+					return
+				}
+				http.Error(w, "Greska pri citanju zahteva", http.StatusInternalServerError)
+				return
+			}
+			if err := authorizeVrtic(claims, enrollmentActionPermission(action), item.VrticID); err != nil {
 				http.Error(w, err.Error(), http.StatusForbidden)
 				return
 			}
@@ -846,6 +1056,8 @@ func main() {
 				switch {
 				case errors.Is(err, mongo.ErrNoDocuments):
 					status = http.StatusNotFound
+				case errors.Is(err, errRequestChanged):
+					status = http.StatusConflict
 				case strings.Contains(err.Error(), "Nemate dozvolu"):
 					status = http.StatusForbidden
 				}
@@ -891,7 +1103,7 @@ func main() {
 				http.Error(w, err.Error(), http.StatusUnauthorized)
 				return
 			}
-			if err := requireAdminRole(claims); err != nil {
+			if err := authorizeVrtic(claims, permVrticUpdate, id); err != nil {
 				http.Error(w, err.Error(), http.StatusForbidden)
 				return
 			}
@@ -911,9 +1123,19 @@ func main() {
 					http.Error(w, "Vrtic nije pronadjen", http.StatusNotFound)
 					return
 				}
+				if errors.Is(err, errVrticChanged) {
+					http.Error(w, err.Error(), http.StatusConflict)
+					return
+				}
+				var invalid vrticValidationError
+				if errors.As(err, &invalid) {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
 				http.Error(w, "Greska pri azuriranju", http.StatusInternalServerError)
 				return
 			}
+			onSeatsFreed(r.Context(), id, "izmena_kapaciteta")
 
 			w.WriteHeader(http.StatusNoContent)
 		case http.MethodDelete:
@@ -922,7 +1144,7 @@ func main() {
 				http.Error(w, err.Error(), http.StatusUnauthorized)
 				return
 			}
-			if err := requireAdminRole(claims); err != nil {
+			if err := authorizeVrtic(claims, permVrticDelete, id); err != nil {
 				http.Error(w, err.Error(), http.StatusForbidden)
 				return
 			}
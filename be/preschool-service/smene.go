@@ -0,0 +1,1377 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Smena je nedeljni raspored rada vaspitaca u vrticu (i grupi, ako ih vrtic
+// ima) sa periodom vazenja. Dezurstvo u datom trenutku se izvodi iz smena,
+// odsustava i zamena; nista se ne materijalizuje po danima. Vaspitac ne
+// sme imati dve smene istog tipa u istom danu, ni u razlicitim vrticima.
+
+const (
+	smenaJutarnja   = "jutarnja"
+	smenaPopodnevna = "popodnevna"
+
+	defaultMaxDecePoVaspitacu        = 12
+	defaultMaxDecePoVaspitacuJaslice = 8
+)
+
+// TipSmene odredjuje radno vreme smene u minutima od ponoci po lokalnom
+// vremenu; pocetak je ukljucen, kraj nije.
+type TipSmene struct {
+	Sifra string `json:"sifra"`
+	Naziv string `json:"naziv"`
+	Od    int    `json:"od_minuta"`
+	Do    int    `json:"do_minuta"`
+}
+
+var tipoviSmena = []TipSmene{
+	{Sifra: smenaJutarnja, Naziv: "Jutarnja (06:00-12:00)", Od: 6 * 60, Do: 12 * 60},
+	{Sifra: smenaPopodnevna, Naziv: "Popodnevna (12:00-18:00)", Od: 12 * 60, Do: 18 * 60},
+}
+
+type Smena struct {
+	ID              primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	VaspitacEmail   string             `json:"vaspitac_email" bson:"vaspitac_email"`
+	VrticID         primitive.ObjectID `json:"vrtic_id" bson:"vrtic_id"`
+	VrticNaziv      string             `json:"vrtic_naziv" bson:"vrtic_naziv"`
+	VaspitnaGrupaID primitive.ObjectID `json:"vaspitna_grupa_id,omitempty" bson:"vaspitna_grupa_id,omitempty"`
+	Tip             string             `json:"tip" bson:"tip"`
+	// Dani u nedelji: 1 = ponedeljak ... 7 = nedelja.
+	Dani      []int      `json:"dani" bson:"dani"`
+	VaziOd    time.Time  `json:"vazi_od" bson:"vazi_od"`
+	VaziDo    *time.Time `json:"vazi_do,omitempty" bson:"vazi_do,omitempty"`
+	CreatedAt time.Time  `json:"created_at" bson:"created_at"`
+}
+
+type SmenaRequest struct {
+	VaspitacEmail   string `json:"vaspitac_email"`
+	VrticID         string `json:"vrtic_id"`
+	VaspitnaGrupaID string `json:"vaspitna_grupa_id"`
+	Tip             string `json:"tip"`
+	Dani            []int  `json:"dani"`
+	VaziOd          string `json:"vazi_od"`
+	VaziDo          string `json:"vazi_do"`
+}
+
+// Odsustvo je period (ukljucujuci oba datuma) u kome vaspitac ne radi ni
+// u jednom vrticu.
+type Odsustvo struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	VaspitacEmail string             `json:"vaspitac_email" bson:"vaspitac_email"`
+	Od            time.Time          `json:"od" bson:"od"`
+	Do            time.Time          `json:"do" bson:"do"`
+	Razlog        string             `json:"razlog,omitempty" bson:"razlog,omitempty"`
+	CreatedBy     string             `json:"created_by" bson:"created_by"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+}
+
+type OdsustvoRequest struct {
+	VaspitacEmail string `json:"vaspitac_email"`
+	Od            string `json:"od"`
+	Do            string `json:"do"`
+	Razlog        string `json:"razlog"`
+}
+
+// Zamena prenosi jednu smenu jednog dana na drugog vaspitaca.
+type Zamena struct {
+	ID            primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	SmenaID       primitive.ObjectID `json:"smena_id" bson:"smena_id"`
+	VrticID       primitive.ObjectID `json:"vrtic_id" bson:"vrtic_id"`
+	Datum         time.Time          `json:"datum" bson:"datum"`
+	Tip           string             `json:"tip" bson:"tip"`
+	VaspitacEmail string             `json:"vaspitac_email" bson:"vaspitac_email"`
+	ZamenaEmail   string             `json:"zamena_email" bson:"zamena_email"`
+	Razlog        string             `json:"razlog,omitempty" bson:"razlog,omitempty"`
+	CreatedAt     time.Time          `json:"created_at" bson:"created_at"`
+}
+
+type ZamenaRequest struct {
+	Datum         string `json:"datum"`
+	VaspitacEmail string `json:"vaspitac_email"`
+	Razlog        string `json:"razlog"`
+}
+
+type DezurstvoView struct {
+	VaspitacEmail   string             `json:"vaspitac_email"`
+	VrticID         primitive.ObjectID `json:"vrtic_id"`
+	VrticNaziv      string             `json:"vrtic_naziv"`
+	VaspitnaGrupaID primitive.ObjectID `json:"vaspitna_grupa_id,omitempty"`
+	Tip             string             `json:"tip"`
+	SmenaID         primitive.ObjectID `json:"smena_id"`
+	ZamenaZa        string             `json:"zamena_za,omitempty"`
+}
+
+type DezurniResponse struct {
+	Vreme       time.Time       `json:"vreme"`
+	Tip         string          `json:"tip,omitempty"`
+	Dezurni     []DezurstvoView `json:"dezurni"`
+	Nepokrivene []Smena         `json:"nepokrivene_smene"`
+}
+
+type KadarProvera struct {
+	VaspitnaGrupaID primitive.ObjectID `json:"vaspitna_grupa_id,omitempty"`
+	Grupa           string             `json:"grupa,omitempty"`
+	Tip             string             `json:"tip"`
+	Dece            int                `json:"dece"`
+	Vaspitaca       int                `json:"vaspitaca"`
+	Potrebno        int                `json:"potrebno"`
+	Ispunjeno       bool               `json:"ispunjeno"`
+}
+
+type MojRasporedView struct {
+	Smene    []Smena    `json:"smene"`
+	Zamene   []Zamena   `json:"zamene"`
+	Odsustva []Odsustvo `json:"odsustva"`
+}
+
+var (
+	smeneCollection    *mongo.Collection
+	odsustvaCollection *mongo.Collection
+	zameneCollection   *mongo.Collection
+)
+
+var errSmenaOverlap = errors.New("Vaspitac vec ima smenu u isto vreme")
+
+func init() {
+	http.HandleFunc("/smene", handleSmene)
+	http.HandleFunc("/smene/", handleSmena)
+	http.HandleFunc("/smene/dezurni", handleDezurni)
+	http.HandleFunc("/smene/provera-kadra", handleKadarProvera)
+	http.HandleFunc("/smene/moje", handleMojeSmene)
+	http.HandleFunc("/odsustva", handleOdsustva)
+	http.HandleFunc("/odsustva/", handleOdsustvo)
+}
+
+func findShiftType(sifra string) (TipSmene, bool) {
+	for _, t := range tipoviSmena {
+		if t.Sifra == sifra {
+			return t, true
+		}
+	}
+	return TipSmene{}, false
+}
+
+// shiftTypeAt vraca tip smene u koju pada lokalno vreme t.
+func shiftTypeAt(t time.Time) (TipSmene, bool) {
+	minutes := t.Hour()*60 + t.Minute()
+	for _, tip := range tipoviSmena {
+		if minutes >= tip.Od && minutes < tip.Do {
+			return tip, true
+		}
+	}
+	return TipSmene{}, false
+}
+
+// calendarDay svodi trenutak na datum u obliku koji vraca parseDateValue.
+func calendarDay(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.UTC)
+}
+
+func isoWeekday(t time.Time) int {
+	if t.Weekday() == time.Sunday {
+		return 7
+	}
+	return int(t.Weekday())
+}
+
+func maxDecePoVaspitacu(grupa *VaspitnaGrupa) int {
+	key, fallback := "MAX_DECE_PO_VASPITACU", defaultMaxDecePoVaspitacu
+	if grupa != nil && grupa.DoMeseci <= 36 {
+		key, fallback = "MAX_DECE_PO_VASPITACU_JASLICE", defaultMaxDecePoVaspitacuJaslice
+	}
+	n, err := strconv.Atoi(getenvDefault(key, ""))
+	if err != nil || n <= 0 {
+		return fallback
+	}
+	return n
+}
+
+func normalizeShiftDays(dani []int) ([]int, error) {
+	seen := map[int]bool{}
+	result := make([]int, 0, len(dani))
+	for _, d := range dani {
+		if d < 1 || d > 7 {
+			return nil, errors.New("Dani smene moraju biti od 1 (ponedeljak) do 7 (nedelja)")
+		}
+		if !seen[d] {
+			seen[d] = true
+			result = append(result, d)
+		}
+	}
+	if len(result) == 0 {
+		return nil, errors.New("Navedite bar jedan dan smene")
+	}
+	sort.Ints(result)
+	return result, nil
+}
+
+// buildShift proverava zahtev i vraca smenu spremnu za upis: vaspitac mora
+// biti rasporedjen u vrtic, a u vrticu sa grupama i u izabranu grupu.
+func buildShift(ctx context.Context, req SmenaRequest) (Smena, error) {
+	email := strings.ToLower(strings.TrimSpace(req.VaspitacEmail))
+	if email == "" {
+		return Smena{}, errors.New("Email vaspitaca je obavezan")
+	}
+	if _, ok := findShiftType(strings.TrimSpace(req.Tip)); !ok {
+		return Smena{}, errors.New("Nepoznat tip smene")
+	}
+	dani, err := normalizeShiftDays(req.Dani)
+	if err != nil {
+		return Smena{}, err
+	}
+	vaziOd, err := parseDateValue(req.VaziOd, false)
+	if err != nil {
+		return Smena{}, err
+	}
+	var vaziDo *time.Time
+	if strings.TrimSpace(req.VaziDo) != "" {
+		t, err := parseDateValue(req.VaziDo, true)
+		if err != nil {
+			return Smena{}, err
+		}
+		if t.Before(vaziOd) {
+			return Smena{}, errors.New("Kraj vazenja smene mora biti posle pocetka")
+		}
+		vaziDo = &t
+	}
+
+	vrticID, err := primitive.ObjectIDFromHex(strings.TrimSpace(req.VrticID))
+	if err != nil {
+		return Smena{}, errors.New("Neispravan ID vrtica")
+	}
+	vrtic, err := getVrticByID(ctx, vrticID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return Smena{}, errVrticNotFound
+		}
+		return Smena{}, err
+	}
+	assigned, err := educatorAssignedToVrtic(ctx, email, vrticID)
+	if err != nil {
+		return Smena{}, err
+	}
+	if !assigned {
+		return Smena{}, errors.New("Vaspitac nije rasporedjen u izabrani vrtic")
+	}
+
+	item := Smena{
+		VaspitacEmail: email,
+		VrticID:       vrticID,
+		VrticNaziv:    vrtic.Naziv,
+		Tip:           strings.TrimSpace(req.Tip),
+		Dani:          dani,
+		VaziOd:        vaziOd,
+		VaziDo:        vaziDo,
+	}
+	hasGroups, err := vrticHasGroups(ctx, vrticID)
+	if err != nil {
+		return Smena{}, err
+	}
+	if !hasGroups {
+		if strings.TrimSpace(req.VaspitnaGrupaID) != "" {
+			return Smena{}, errors.New("Vrtic nema vaspitne grupe")
+		}
+		return item, nil
+	}
+	grupaID, err := primitive.ObjectIDFromHex(strings.TrimSpace(req.VaspitnaGrupaID))
+	if err != nil {
+		return Smena{}, errors.New("Izaberite vaspitnu grupu smene")
+	}
+	grupa, err := getVaspitnaGrupa(ctx, grupaID)
+	if err != nil || grupa.VrticID != vrticID {
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return Smena{}, err
+		}
+		return Smena{}, errors.New("Grupa nije pronadjena u izabranom vrticu")
+	}
+	member := false
+	for _, e := range grupa.Vaspitaci {
+		member = member || e == email
+	}
+	if !member {
+		return Smena{}, errors.New("Vaspitac nije vaspitac izabrane grupe")
+	}
+	item.VaspitnaGrupaID = grupaID
+	return item, nil
+}
+
+// overlappingShiftFilter pronalazi smene istog vaspitaca istog tipa koje
+// dele bar jedan dan u nedelji i preklapaju se po periodu vazenja, u bilo
+// kom vrticu.
+func overlappingShiftFilter(item Smena, exclude primitive.ObjectID) bson.M {
+	filter := bson.M{
+		"vaspitac_email": item.VaspitacEmail,
+		"tip":            item.Tip,
+		"dani":           bson.M{"$in": item.Dani},
+		"$or": bson.A{
+			bson.M{"vazi_do": nil},
+			bson.M{"vazi_do": bson.M{"$gte": item.VaziOd}},
+		},
+	}
+	if item.VaziDo != nil {
+		filter["vazi_od"] = bson.M{"$lte": *item.VaziDo}
+	}
+	if !exclude.IsZero() {
+		filter["_id"] = bson.M{"$ne": exclude}
+	}
+	return filter
+}
+
+func checkShiftOverlap(ctx context.Context, item Smena, exclude primitive.ObjectID) error {
+	var conflict Smena
+	err := smeneCollection.FindOne(ctx, overlappingShiftFilter(item, exclude)).Decode(&conflict)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	return fmt.Errorf("%w (%s smena u vrticu %s)", errSmenaOverlap, conflict.Tip, conflict.VrticNaziv)
+}
+
+func createShift(ctx context.Context, req SmenaRequest) (*Smena, error) {
+	item, err := buildShift(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkShiftOverlap(ctx, item, primitive.NilObjectID); err != nil {
+		return nil, err
+	}
+	item.CreatedAt = time.Now()
+	res, err := smeneCollection.InsertOne(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := res.InsertedID.(primitive.ObjectID); ok {
+		item.ID = id
+	}
+
+	// Kao kod konkursa: od dve istovremeno upisane smene ostaje ranija.
+	filter := overlappingShiftFilter(item, primitive.NilObjectID)
+	filter["_id"] = bson.M{"$lt": item.ID}
+	n, err := smeneCollection.CountDocuments(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		if _, err := smeneCollection.DeleteOne(ctx, bson.M{"_id": item.ID}); err != nil {
+			return nil, err
+		}
+		return nil, errSmenaOverlap
+	}
+	return &item, nil
+}
+
+func updateShift(ctx context.Context, existing Smena, req SmenaRequest) (*Smena, error) {
+	item, err := buildShift(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+	if err := checkShiftOverlap(ctx, item, existing.ID); err != nil {
+		return nil, err
+	}
+	set := bson.M{
+		"vaspitac_email": item.VaspitacEmail,
+		"vrtic_id":       item.VrticID,
+		"vrtic_naziv":    item.VrticNaziv,
+		"tip":            item.Tip,
+		"dani":           item.Dani,
+		"vazi_od":        item.VaziOd,
+	}
+	unset := bson.M{}
+	if item.VaziDo != nil {
+		set["vazi_do"] = *item.VaziDo
+	} else {
+		unset["vazi_do"] = ""
+	}
+	if !item.VaspitnaGrupaID.IsZero() {
+		set["vaspitna_grupa_id"] = item.VaspitnaGrupaID
+	} else {
+		unset["vaspitna_grupa_id"] = ""
+	}
+	update := bson.M{"$set": set}
+	if len(unset) > 0 {
+		update["$unset"] = unset
+	}
+	res, err := smeneCollection.UpdateOne(ctx, bson.M{"_id": existing.ID}, update)
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+	item.ID = existing.ID
+	item.CreatedAt = existing.CreatedAt
+
+	// Kao kod upisa: ako je istovremeno upisana ili izmenjena preklapajuca
+	// smena, izmena se vraca. Od dve izmene koje se preklapaju obe se
+	// vracaju, pa vaspitac nikada ne ostaje sa dve smene u isto vreme.
+	if err := checkShiftOverlap(ctx, item, item.ID); err != nil {
+		if !errors.Is(err, errSmenaOverlap) {
+			return nil, err
+		}
+		if _, restoreErr := smeneCollection.ReplaceOne(ctx, bson.M{"_id": existing.ID}, existing); restoreErr != nil {
+			return nil, restoreErr
+		}
+		return nil, err
+	}
+	syncShiftSubstitutions(ctx, existing, item)
+	return &item, nil
+}
+
+// syncShiftSubstitutions uskladjuje zamene sa izmenjenom smenom: zamene za
+// dane kada smena vise ne radi (drugi tip, vrtic, dani ili period vazenja)
+// i zamene u kojima bi novi vaspitac menjao sam sebe se brisu, a ostale
+// dobijaju novog vaspitaca smene.
+func syncShiftSubstitutions(ctx context.Context, existing, item Smena) {
+	cursor, err := zameneCollection.Find(ctx, bson.M{"smena_id": item.ID})
+	if err != nil {
+		log.Printf("Substitutions cleanup warning for %s: %v", item.ID.Hex(), err)
+		return
+	}
+	var zamene []Zamena
+	if err := cursor.All(ctx, &zamene); err != nil {
+		log.Printf("Substitutions cleanup warning for %s: %v", item.ID.Hex(), err)
+		return
+	}
+	stale := make([]primitive.ObjectID, 0)
+	for _, z := range zamene {
+		if z.Tip != item.Tip || z.VrticID != item.VrticID || z.ZamenaEmail == item.VaspitacEmail || !shiftRunsOn(item, z.Datum) {
+			stale = append(stale, z.ID)
+		}
+	}
+	if len(stale) > 0 {
+		if _, err := zameneCollection.DeleteMany(ctx, bson.M{"_id": bson.M{"$in": stale}}); err != nil {
+			log.Printf("Substitutions cleanup warning for %s: %v", item.ID.Hex(), err)
+		}
+	}
+	if item.VaspitacEmail != existing.VaspitacEmail {
+		if _, err := zameneCollection.UpdateMany(ctx,
+			bson.M{"smena_id": item.ID},
+			bson.M{"$set": bson.M{"vaspitac_email": item.VaspitacEmail}},
+		); err != nil {
+			log.Printf("Substitutions update warning for %s: %v", item.ID.Hex(), err)
+		}
+	}
+}
+
+func deleteShift(ctx context.Context, id primitive.ObjectID) error {
+	res, err := smeneCollection.DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	_, err = zameneCollection.DeleteMany(ctx, bson.M{"smena_id": id})
+	return err
+}
+
+func getShiftByID(ctx context.Context, id primitive.ObjectID) (Smena, error) {
+	var item Smena
+	err := smeneCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&item)
+	return item, err
+}
+
+func findShifts(ctx context.Context, filter bson.M) ([]Smena, error) {
+	cursor, err := smeneCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "vrtic_naziv", Value: 1}, {Key: "vaspitac_email", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	items := make([]Smena, 0)
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func listShifts(ctx context.Context, vrticIDRaw, email string, scope VrticScope) ([]Smena, error) {
+	filter := bson.M{}
+	if strings.TrimSpace(vrticIDRaw) != "" {
+		vrticID, err := primitive.ObjectIDFromHex(strings.TrimSpace(vrticIDRaw))
+		if err != nil {
+			return nil, errors.New("Neispravan ID vrtica")
+		}
+		filter["vrtic_id"] = vrticID
+	}
+	if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+		filter["vaspitac_email"] = email
+	}
+	return findShifts(ctx, scope.apply(filter))
+}
+
+// removeEducatorShifts brise smene i zamene vaspitaca u vrticu iz kog je
+// uklonjen.
+func removeEducatorShifts(ctx context.Context, vrticID primitive.ObjectID, email string) {
+	shifts, err := findShifts(ctx, bson.M{"vrtic_id": vrticID, "vaspitac_email": email})
+	if err != nil {
+		log.Printf("Shifts cleanup warning for %s: %v", email, err)
+		return
+	}
+	for _, item := range shifts {
+		if err := deleteShift(ctx, item.ID); err != nil {
+			log.Printf("Shifts cleanup warning for %s: %v", item.ID.Hex(), err)
+		}
+	}
+	if _, err := zameneCollection.DeleteMany(ctx, bson.M{"vrtic_id": vrticID, "zamena_email": email}); err != nil {
+		log.Printf("Substitutions cleanup warning for %s: %v", email, err)
+	}
+}
+
+func deleteVrticShifts(ctx context.Context, vrticID primitive.ObjectID) {
+	_, _ = smeneCollection.DeleteMany(ctx, bson.M{"vrtic_id": vrticID})
+	_, _ = zameneCollection.DeleteMany(ctx, bson.M{"vrtic_id": vrticID})
+}
+
+// activeShiftsFilter pronalazi smene tipa tip koje vaze na dan day.
+func activeShiftsFilter(day time.Time, tip string) bson.M {
+	return bson.M{
+		"tip":     tip,
+		"dani":    isoWeekday(day),
+		"vazi_od": bson.M{"$lte": day},
+		"$or": bson.A{
+			bson.M{"vazi_do": nil},
+			bson.M{"vazi_do": bson.M{"$gte": day}},
+		},
+	}
+}
+
+func shiftRunsOn(item Smena, day time.Time) bool {
+	if day.Before(item.VaziOd) || (item.VaziDo != nil && day.After(*item.VaziDo)) {
+		return false
+	}
+	for _, d := range item.Dani {
+		if d == isoWeekday(day) {
+			return true
+		}
+	}
+	return false
+}
+
+func absentEducators(ctx context.Context, day time.Time) (map[string]bool, error) {
+	cursor, err := odsustvaCollection.Find(ctx, bson.M{"od": bson.M{"$lte": day}, "do": bson.M{"$gte": day}})
+	if err != nil {
+		return nil, err
+	}
+	var items []Odsustvo
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	result := map[string]bool{}
+	for _, item := range items {
+		result[item.VaspitacEmail] = true
+	}
+	return result, nil
+}
+
+// dutyForDay vraca ko radi smenu tipa tip na dan day: vaspitac smene, ili
+// njegova zamena tog dana. Smene ciji je vaspitac odsutan bez zamene (ili
+// je odsutna i zamena) vracaju se kao nepokrivene.
+func dutyForDay(ctx context.Context, day time.Time, tip string, filter bson.M) ([]DezurstvoView, []Smena, error) {
+	for k, v := range activeShiftsFilter(day, tip) {
+		filter[k] = v
+	}
+	shifts, err := findShifts(ctx, filter)
+	if err != nil {
+		return nil, nil, err
+	}
+	absent, err := absentEducators(ctx, day)
+	if err != nil {
+		return nil, nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(shifts))
+	for _, s := range shifts {
+		ids = append(ids, s.ID)
+	}
+	cursor, err := zameneCollection.Find(ctx, bson.M{"smena_id": bson.M{"$in": ids}, "datum": day})
+	if err != nil {
+		return nil, nil, err
+	}
+	var zamene []Zamena
+	if err := cursor.All(ctx, &zamene); err != nil {
+		return nil, nil, err
+	}
+	bySmena := map[primitive.ObjectID]Zamena{}
+	for _, z := range zamene {
+		bySmena[z.SmenaID] = z
+	}
+
+	duty := make([]DezurstvoView, 0, len(shifts))
+	uncovered := make([]Smena, 0)
+	for _, s := range shifts {
+		view := DezurstvoView{
+			VaspitacEmail:   s.VaspitacEmail,
+			VrticID:         s.VrticID,
+			VrticNaziv:      s.VrticNaziv,
+			VaspitnaGrupaID: s.VaspitnaGrupaID,
+			Tip:             s.Tip,
+			SmenaID:         s.ID,
+		}
+		if z, ok := bySmena[s.ID]; ok {
+			view.VaspitacEmail = z.ZamenaEmail
+			view.ZamenaZa = s.VaspitacEmail
+		}
+		if absent[view.VaspitacEmail] {
+			uncovered = append(uncovered, s)
+			continue
+		}
+		duty = append(duty, view)
+	}
+	return duty, uncovered, nil
+}
+
+// educatorBusy proverava da li vaspitac vec radi smenu tipa tip na dan day,
+// bilo svoju (koju niko ne menja) bilo kao zamena.
+func educatorBusy(ctx context.Context, email string, day time.Time, tip string) (bool, error) {
+	duty, _, err := dutyForDay(ctx, day, tip, bson.M{"vaspitac_email": email})
+	if err != nil {
+		return false, err
+	}
+	for _, d := range duty {
+		if d.VaspitacEmail == email {
+			return true, nil
+		}
+	}
+	n, err := zameneCollection.CountDocuments(ctx, bson.M{"zamena_email": email, "datum": day, "tip": tip})
+	return n > 0, err
+}
+
+func createSubstitution(ctx context.Context, smena Smena, req ZamenaRequest) (*Zamena, error) {
+	day, err := parseDateValue(req.Datum, false)
+	if err != nil {
+		return nil, err
+	}
+	day = calendarDay(day)
+	if !shiftRunsOn(smena, day) {
+		return nil, errors.New("Smena ne vazi tog dana")
+	}
+	email := strings.ToLower(strings.TrimSpace(req.VaspitacEmail))
+	if email == "" {
+		return nil, errors.New("Email vaspitaca zamene je obavezan")
+	}
+	if email == smena.VaspitacEmail {
+		return nil, errors.New("Vaspitac ne moze menjati samog sebe")
+	}
+	assigned, err := educatorAssignedToVrtic(ctx, email, smena.VrticID)
+	if err != nil {
+		return nil, err
+	}
+	if !assigned {
+		return nil, errors.New("Vaspitac zamene nije rasporedjen u vrtic smene")
+	}
+	absent, err := absentEducators(ctx, day)
+	if err != nil {
+		return nil, err
+	}
+	if absent[email] {
+		return nil, errors.New("Vaspitac zamene je tog dana odsutan")
+	}
+	busy, err := educatorBusy(ctx, email, day, smena.Tip)
+	if err != nil {
+		return nil, err
+	}
+	if busy {
+		return nil, errSmenaOverlap
+	}
+
+	item := Zamena{
+		SmenaID:       smena.ID,
+		VrticID:       smena.VrticID,
+		Datum:         day,
+		Tip:           smena.Tip,
+		VaspitacEmail: smena.VaspitacEmail,
+		ZamenaEmail:   email,
+		Razlog:        strings.TrimSpace(req.Razlog),
+		CreatedAt:     time.Now(),
+	}
+	res, err := zameneCollection.InsertOne(ctx, item)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errors.New("Za ovu smenu tog dana vec postoji zamena")
+		}
+		return nil, err
+	}
+	if id, ok := res.InsertedID.(primitive.ObjectID); ok {
+		item.ID = id
+	}
+	// Ista osoba istovremeno postavljena kao zamena u dve smene: ostaje ranija.
+	n, err := zameneCollection.CountDocuments(ctx, bson.M{"zamena_email": email, "datum": day, "tip": item.Tip, "_id": bson.M{"$lt": item.ID}})
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		if _, err := zameneCollection.DeleteOne(ctx, bson.M{"_id": item.ID}); err != nil {
+			return nil, err
+		}
+		return nil, errSmenaOverlap
+	}
+	return &item, nil
+}
+
+func deleteSubstitution(ctx context.Context, smenaID, id primitive.ObjectID) error {
+	res, err := zameneCollection.DeleteOne(ctx, bson.M{"_id": id, "smena_id": smenaID})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		return mongo.ErrNoDocuments
+	}
+	return nil
+}
+
+// canManageEducator: odsustvo vaspitaca moze upisati ko ima dozvolu za
+// smene u bar jednom vrticu u koji je vaspitac rasporedjen.
+func canManageEducator(ctx context.Context, claims jwt.MapClaims, email string) (bool, error) {
+	p := principalFromClaims(claims)
+	if p.Can(permShiftManage) {
+		return true, nil
+	}
+	assignments, err := getAssignmentsByEducator(ctx, email)
+	if err != nil {
+		return false, err
+	}
+	for _, a := range assignments {
+		if p.CanInVrtic(permShiftManage, a.VrticID) {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+func createAbsence(ctx context.Context, claims jwt.MapClaims, req OdsustvoRequest) (*Odsustvo, error) {
+	email := strings.ToLower(strings.TrimSpace(req.VaspitacEmail))
+	if email == "" {
+		return nil, errors.New("Email vaspitaca je obavezan")
+	}
+	od, err := parseDateValue(req.Od, false)
+	if err != nil {
+		return nil, err
+	}
+	do, err := parseDateValue(req.Do, true)
+	if err != nil {
+		return nil, err
+	}
+	if do.Before(od) {
+		return nil, errors.New("Kraj odsustva mora biti posle pocetka")
+	}
+	allowed, err := canManageEducator(ctx, claims, email)
+	if err != nil {
+		return nil, err
+	}
+	if !allowed {
+		return nil, errForbidden(permShiftManage)
+	}
+	// Vaspitac ne moze biti odsutan dok je upisan kao necija zamena.
+	n, err := zameneCollection.CountDocuments(ctx, bson.M{"zamena_email": email, "datum": bson.M{"$gte": od, "$lte": do}})
+	if err != nil {
+		return nil, err
+	}
+	if n > 0 {
+		return nil, errors.New("Vaspitac je u tom periodu zamena u nekoj smeni; prvo uklonite zamene")
+	}
+
+	item := Odsustvo{
+		VaspitacEmail: email,
+		Od:            od,
+		Do:            do,
+		Razlog:        strings.TrimSpace(req.Razlog),
+		CreatedBy:     strings.ToLower(strings.TrimSpace(claimString(claims, "sub"))),
+		CreatedAt:     time.Now(),
+	}
+	res, err := odsustvaCollection.InsertOne(ctx, item)
+	if err != nil {
+		return nil, err
+	}
+	if id, ok := res.InsertedID.(primitive.ObjectID); ok {
+		item.ID = id
+	}
+	return &item, nil
+}
+
+// listAbsences: role ogranicene na vrtice vide odsustva vaspitaca
+// rasporedjenih u njihove vrtice.
+func listAbsences(ctx context.Context, email string, scope VrticScope) ([]Odsustvo, error) {
+	filter := bson.M{}
+	if email = strings.ToLower(strings.TrimSpace(email)); email != "" {
+		filter["vaspitac_email"] = email
+	}
+	if !scope.All {
+		assignments, err := listAssignments(ctx, scope)
+		if err != nil {
+			return nil, err
+		}
+		emails := make([]string, 0, len(assignments))
+		for _, a := range assignments {
+			emails = append(emails, a.VaspitacEmail)
+		}
+		filter["$and"] = bson.A{bson.M{"vaspitac_email": bson.M{"$in": emails}}}
+	}
+	cursor, err := odsustvaCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "od", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	items := make([]Odsustvo, 0)
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func getAbsenceByID(ctx context.Context, id primitive.ObjectID) (Odsustvo, error) {
+	var item Odsustvo
+	err := odsustvaCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&item)
+	return item, err
+}
+
+func parseDutyTime(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Now(), nil
+	}
+	if t, err := time.Parse(time.RFC3339, raw); err == nil {
+		return t, nil
+	}
+	if t, err := time.ParseInLocation("2006-01-02T15:04", raw, time.Local); err == nil {
+		return t, nil
+	}
+	return time.Time{}, errors.New("Neispravan format vremena")
+}
+
+func onDutyAt(ctx context.Context, t time.Time, filter bson.M) (*DezurniResponse, error) {
+	local := t.In(time.Local)
+	result := &DezurniResponse{Vreme: local, Dezurni: []DezurstvoView{}, Nepokrivene: []Smena{}}
+	tip, ok := shiftTypeAt(local)
+	if !ok {
+		return result, nil
+	}
+	duty, uncovered, err := dutyForDay(ctx, calendarDay(local), tip.Sifra, filter)
+	if err != nil {
+		return nil, err
+	}
+	result.Tip = tip.Sifra
+	result.Dezurni = duty
+	result.Nepokrivene = uncovered
+	return result, nil
+}
+
+// checkStaffing poredi broj vaspitaca u smeni sa brojem dece, po grupi ako
+// ih vrtic ima, a inace za ceo vrtic (deca odobrena za aktivnu radnu
+// godinu, bez vec odobrenih za sledecu). Provera je samo izvestaj: izmene
+// smena, zamena i odsustava se ne odbijaju kada ostave smenu bez dovoljno
+// vaspitaca, jer odsustvo (npr. bolovanje) mora biti upisano i tada.
+func checkStaffing(ctx context.Context, vrticID primitive.ObjectID, day time.Time) ([]KadarProvera, error) {
+	grupe, err := listVaspitneGrupe(ctx, vrticID.Hex(), allVrtici)
+	if err != nil {
+		return nil, err
+	}
+	var vrticDece int
+	if len(grupe) == 0 {
+		filter := bson.M{"vrtic_id": vrticID, "status": statusApproved}
+		active, ok, err := activeAcademicYear(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			filter["radna_godina"] = active
+		}
+		n, err := zahteviCollection.CountDocuments(ctx, filter)
+		if err != nil {
+			return nil, err
+		}
+		vrticDece = int(n)
+	}
+
+	result := make([]KadarProvera, 0)
+	for _, tip := range tipoviSmena {
+		duty, _, err := dutyForDay(ctx, day, tip.Sifra, bson.M{"vrtic_id": vrticID})
+		if err != nil {
+			return nil, err
+		}
+		if len(grupe) == 0 {
+			result = append(result, staffingRow(KadarProvera{Tip: tip.Sifra, Dece: vrticDece, Vaspitaca: len(duty)}, nil))
+			continue
+		}
+		for i := range grupe {
+			count := 0
+			for _, d := range duty {
+				if d.VaspitnaGrupaID == grupe[i].ID {
+					count++
+				}
+			}
+			row := KadarProvera{VaspitnaGrupaID: grupe[i].ID, Grupa: grupe[i].Naziv, Tip: tip.Sifra, Dece: grupe[i].Upisano, Vaspitaca: count}
+			result = append(result, staffingRow(row, &grupe[i]))
+		}
+	}
+	return result, nil
+}
+
+func staffingRow(row KadarProvera, grupa *VaspitnaGrupa) KadarProvera {
+	limit := maxDecePoVaspitacu(grupa)
+	row.Potrebno = (row.Dece + limit - 1) / limit
+	row.Ispunjeno = row.Vaspitaca >= row.Potrebno
+	return row
+}
+
+func getMySchedule(ctx context.Context, email string) (*MojRasporedView, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	today := calendarDay(time.Now().In(time.Local))
+	smene, err := findShifts(ctx, bson.M{
+		"vaspitac_email": email,
+		"$or":            bson.A{bson.M{"vazi_do": nil}, bson.M{"vazi_do": bson.M{"$gte": today}}},
+	})
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := zameneCollection.Find(ctx, bson.M{
+		"$or":   bson.A{bson.M{"zamena_email": email}, bson.M{"vaspitac_email": email}},
+		"datum": bson.M{"$gte": today},
+	}, options.Find().SetSort(bson.D{{Key: "datum", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	zamene := make([]Zamena, 0)
+	if err := cursor.All(ctx, &zamene); err != nil {
+		return nil, err
+	}
+	cursor, err = odsustvaCollection.Find(ctx, bson.M{"vaspitac_email": email, "do": bson.M{"$gte": today}}, options.Find().SetSort(bson.D{{Key: "od", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	odsustva := make([]Odsustvo, 0)
+	if err := cursor.All(ctx, &odsustva); err != nil {
+		return nil, err
+	}
+	return &MojRasporedView{Smene: smene, Zamene: zamene, Odsustva: odsustva}, nil
+}
+
+func ensureShiftsIndexes(ctx context.Context) {
+	_, err := smeneCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "vaspitac_email", Value: 1}, {Key: "tip", Value: 1}}},
+		{Keys: bson.D{{Key: "vrtic_id", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Shifts index warning: %v", err)
+	}
+	_, err = zameneCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "smena_id", Value: 1}, {Key: "datum", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "zamena_email", Value: 1}, {Key: "datum", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Substitutions index warning: %v", err)
+	}
+	_, err = odsustvaCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "vaspitac_email", Value: 1}, {Key: "od", Value: 1}}})
+	if err != nil {
+		log.Printf("Absences index warning: %v", err)
+	}
+}
+
+func shiftErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments), strings.Contains(err.Error(), "nije pronadjen"):
+		return http.StatusNotFound
+	case errors.Is(err, errSmenaOverlap), strings.Contains(err.Error(), "vec postoji"):
+		return http.StatusConflict
+	case strings.Contains(err.Error(), "Nemate dozvolu"):
+		return http.StatusForbidden
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func handleSmene(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		scope, err := authorizeScope(claims, permShiftRead)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		items, err := listShifts(r.Context(), r.URL.Query().Get("vrtic_id"), r.URL.Query().Get("vaspitac_email"), scope)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(items)
+	case http.MethodPost:
+		var req SmenaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+			return
+		}
+		vrticID, err := primitive.ObjectIDFromHex(strings.TrimSpace(req.VrticID))
+		if err != nil {
+			http.Error(w, "Neispravan ID vrtica", http.StatusBadRequest)
+			return
+		}
+		if err := authorizeVrtic(claims, permShiftManage, vrticID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		item, err := createShift(r.Context(), req)
+		if err != nil {
+			http.Error(w, err.Error(), shiftErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(item)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleSmena obradjuje /smene/{id}, /smene/{id}/zamene i
+// /smene/{id}/zamene/{zamena_id}.
+func handleSmena(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/smene/"), "/"), "/")
+	if len(parts) > 3 || (len(parts) > 1 && parts[1] != "zamene") {
+		http.Error(w, "Neispravan URL smene", http.StatusBadRequest)
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(parts[0])
+	if err != nil {
+		http.Error(w, "Neispravan ID smene", http.StatusBadRequest)
+		return
+	}
+	smena, err := getShiftByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			http.Error(w, "Smena nije pronadjena", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Greska pri citanju smene", http.StatusInternalServerError)
+		return
+	}
+
+	if len(parts) == 1 && r.Method == http.MethodGet {
+		if err := authorizeVrtic(claims, permShiftRead, smena.VrticID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(smena)
+		return
+	}
+	if err := authorizeVrtic(claims, permShiftManage, smena.VrticID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		var req SmenaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+			return
+		}
+		vrticID, err := primitive.ObjectIDFromHex(strings.TrimSpace(req.VrticID))
+		if err != nil {
+			http.Error(w, "Neispravan ID vrtica", http.StatusBadRequest)
+			return
+		}
+		if err := authorizeVrtic(claims, permShiftManage, vrticID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		item, err := updateShift(r.Context(), smena, req)
+		if err != nil {
+			http.Error(w, err.Error(), shiftErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(item)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if err := deleteShift(r.Context(), smena.ID); err != nil {
+			http.Error(w, err.Error(), shiftErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && r.Method == http.MethodPost:
+		var req ZamenaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+			return
+		}
+		item, err := createSubstitution(r.Context(), smena, req)
+		if err != nil {
+			http.Error(w, err.Error(), shiftErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(item)
+	case len(parts) == 3 && r.Method == http.MethodDelete:
+		zamenaID, err := primitive.ObjectIDFromHex(parts[2])
+		if err != nil {
+			http.Error(w, "Neispravan ID zamene", http.StatusBadRequest)
+			return
+		}
+		if err := deleteSubstitution(r.Context(), smena.ID, zamenaID); err != nil {
+			if errors.Is(err, mongo.ErrNoDocuments) {
+				http.Error(w, "Zamena nije pronadjena", http.StatusNotFound)
+				return
+			}
+			http.Error(w, "Greska pri brisanju zamene", http.StatusInternalServerError)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleDezurni: GET /smene/dezurni?vreme=...&vrtic_id=... vraca ko je na
+// duznosti u datom trenutku (podrazumevano sada).
+func handleDezurni(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	scope, err := authorizeScope(claims, permShiftRead)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	t, err := parseDutyTime(r.URL.Query().Get("vreme"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	filter := bson.M{}
+	if raw := strings.TrimSpace(r.URL.Query().Get("vrtic_id")); raw != "" {
+		vrticID, err := primitive.ObjectIDFromHex(raw)
+		if err != nil {
+			http.Error(w, "Neispravan ID vrtica", http.StatusBadRequest)
+			return
+		}
+		filter["vrtic_id"] = vrticID
+	}
+
+	result, err := onDutyAt(r.Context(), t, scope.apply(filter))
+	if err != nil {
+		http.Error(w, "Greska pri citanju smena", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+// handleKadarProvera: GET /smene/provera-kadra?vrtic_id=...&datum=...
+func handleKadarProvera(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	vrticID, err := primitive.ObjectIDFromHex(strings.TrimSpace(r.URL.Query().Get("vrtic_id")))
+	if err != nil {
+		http.Error(w, "Neispravan ID vrtica", http.StatusBadRequest)
+		return
+	}
+	if err := authorizeVrtic(claims, permShiftRead, vrticID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	day := calendarDay(time.Now().In(time.Local))
+	if raw := strings.TrimSpace(r.URL.Query().Get("datum")); raw != "" {
+		t, err := parseDateValue(raw, false)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		day = calendarDay(t)
+	}
+
+	items, err := checkStaffing(r.Context(), vrticID, day)
+	if err != nil {
+		http.Error(w, "Greska pri proveri kadra", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(items)
+}
+
+func handleMojeSmene(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodGet {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	if err := authorize(claims, permShiftReadOwn); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+	result, err := getMySchedule(r.Context(), claimString(claims, "sub"))
+	if err != nil {
+		http.Error(w, "Greska pri citanju smena", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(result)
+}
+
+func handleOdsustva(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		scope, err := authorizeScope(claims, permShiftRead)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		items, err := listAbsences(r.Context(), r.URL.Query().Get("vaspitac_email"), scope)
+		if err != nil {
+			http.Error(w, "Greska pri citanju odsustava", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(items)
+	case http.MethodPost:
+		var req OdsustvoRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+			return
+		}
+		item, err := createAbsence(r.Context(), claims, req)
+		if err != nil {
+			http.Error(w, err.Error(), shiftErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(item)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func handleOdsustvo(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+	id, err := parseSimpleObjectID(r.URL.Path, "/odsustva/")
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	item, err := getAbsenceByID(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			http.Error(w, "Odsustvo nije pronadjeno", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Greska pri citanju odsustva", http.StatusInternalServerError)
+		return
+	}
+	allowed, err := canManageEducator(r.Context(), claims, item.VaspitacEmail)
+	if err != nil {
+		http.Error(w, "Greska pri proveri dozvole", http.StatusInternalServerError)
+		return
+	}
+	if !allowed {
+		http.Error(w, errForbidden(permShiftManage).Error(), http.StatusForbidden)
+		return
+	}
+	if _, err := odsustvaCollection.DeleteOne(r.Context(), bson.M{"_id": id}); err != nil {
+		http.Error(w, "Greska pri brisanju odsustva", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
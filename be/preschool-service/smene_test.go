@@ -0,0 +1,94 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestSyncShiftSubstitutions(t *testing.T) {
+	ctx := testMongo(t)
+
+	ponedeljak := time.Date(2025, time.March, 3, 0, 0, 0, 0, time.Local)
+	existing := Smena{
+		VaspitacEmail: "ana@example.com",
+		Tip:           tipoviSmena[0].Sifra,
+		Dani:          []int{1, 2, 3},
+		VaziOd:        ponedeljak,
+	}
+	res, err := smeneCollection.InsertOne(ctx, existing)
+	if err != nil {
+		t.Fatalf("insert smena: %v", err)
+	}
+	existing.ID = insertedID(res.InsertedID)
+
+	kraj := ponedeljak.AddDate(0, 0, 14)
+	item := existing
+	item.VaspitacEmail = "bora@example.com"
+	item.Dani = []int{1, 2}
+	item.VaziDo = &kraj
+
+	tests := []struct {
+		name   string
+		datum  time.Time
+		zamena string
+		keep   bool
+	}{
+		{"dan i dalje u smeni", ponedeljak.AddDate(0, 0, 1), "vesna@example.com", true},
+		{"dan uklonjen iz smene", ponedeljak.AddDate(0, 0, 2), "vesna@example.com", false},
+		{"posle kraja vazenja", ponedeljak.AddDate(0, 0, 21), "vesna@example.com", false},
+		{"novi vaspitac bi menjao sebe", ponedeljak.AddDate(0, 0, 7), "bora@example.com", false},
+	}
+	ids := make(map[string]Zamena)
+	for _, tt := range tests {
+		z := Zamena{SmenaID: existing.ID, Datum: tt.datum, Tip: existing.Tip, VaspitacEmail: existing.VaspitacEmail, ZamenaEmail: tt.zamena}
+		res, err := zameneCollection.InsertOne(ctx, z)
+		if err != nil {
+			t.Fatalf("insert zamena: %v", err)
+		}
+		z.ID = insertedID(res.InsertedID)
+		ids[tt.name] = z
+	}
+
+	syncShiftSubstitutions(ctx, existing, item)
+
+	for _, tt := range tests {
+		var got Zamena
+		err := zameneCollection.FindOne(ctx, bson.M{"_id": ids[tt.name].ID}).Decode(&got)
+		if tt.keep != (err == nil) {
+			t.Errorf("%s: zadrzana = %v, ocekivano %v", tt.name, err == nil, tt.keep)
+			continue
+		}
+		if tt.keep && got.VaspitacEmail != item.VaspitacEmail {
+			t.Errorf("%s: vaspitac_email = %q, ocekivano %q", tt.name, got.VaspitacEmail, item.VaspitacEmail)
+		}
+	}
+}
+
+func TestCheckStaffingCountsActiveYearOnly(t *testing.T) {
+	ctx := testMongo(t)
+	if _, err := radneGodineCollection.InsertOne(ctx, RadnaGodina{Oznaka: "2024/2025", Aktivna: true}); err != nil {
+		t.Fatal(err)
+	}
+	vrticID := primitive.NewObjectID()
+	for _, godina := range []string{"2024/2025", "2024/2025", "2025/2026"} {
+		if _, err := zahteviCollection.InsertOne(ctx, UpisZahtev{VrticID: vrticID, RadnaGodina: godina, Status: statusApproved}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	rows, err := checkStaffing(ctx, vrticID, time.Date(2025, time.March, 3, 0, 0, 0, 0, time.Local))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(rows) == 0 {
+		t.Fatal("checkStaffing nije vratio nijednu smenu")
+	}
+	for _, row := range rows {
+		if row.Dece != 2 {
+			t.Fatalf("%s smena: dece = %d, want 2 (bez dece za sledecu godinu)", row.Tip, row.Dece)
+		}
+	}
+}
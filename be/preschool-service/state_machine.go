@@ -0,0 +1,128 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Dozvoljeni prelazi statusa zahteva za upis. Svaka promena statusa ide
+// kroz updateRequestStatus, koji proverava ovu tabelu i dodaje stavku u
+// istoriju zahteva.
+var requestTransitions = map[string][]string{
+	statusSubmitted:   {statusInReview, statusNeedDocs, statusApproved, statusRejected, statusWaitingList, statusWithdrawn},
+	statusInReview:    {statusNeedDocs, statusApproved, statusRejected, statusWaitingList, statusWithdrawn},
+	statusNeedDocs:    {statusSubmitted, statusInReview, statusNeedDocs, statusApproved, statusRejected, statusWaitingList, statusWithdrawn},
+	statusWaitingList: {statusInReview, statusNeedDocs, statusApproved, statusRejected, statusWaitingList, statusWithdrawn},
+	statusApproved:    {statusRejected, statusUnenrolled},
+}
+
+// requestActionTargets povezuje akcije obrade sa ciljnim statusom.
+var requestActionTargets = map[string]string{
+	"obrada":        statusInReview,
+	"dopuna":        statusNeedDocs,
+	"odbij":         statusRejected,
+	"odobri":        statusApproved,
+	"potvrdi-ispis": statusUnenrolled,
+}
+
+// StatusPromena je jedna stavka istorije zahteva. Istorija se samo dopunjuje.
+type StatusPromena struct {
+	Od       string    `json:"od,omitempty" bson:"od,omitempty"`
+	Na       string    `json:"na" bson:"na"`
+	Korisnik string    `json:"korisnik" bson:"korisnik"`
+	Razlog   string    `json:"razlog,omitempty" bson:"razlog,omitempty"`
+	Vreme    time.Time `json:"vreme" bson:"vreme"`
+}
+
+func canTransitionRequest(from, to string) bool {
+	return containsStatus(requestTransitions[canonicalRequestStatus(from)], canonicalRequestStatus(to))
+}
+
+func checkRequestTransition(from, to string) error {
+	if canTransitionRequest(from, to) {
+		return nil
+	}
+	if requestClosed(canonicalRequestStatus(from)) {
+		return fmt.Errorf("Zahtev je vec zavrsen (%s)", canonicalRequestStatus(from))
+	}
+	return fmt.Errorf("Prelaz iz statusa %s u %s nije dozvoljen", canonicalRequestStatus(from), canonicalRequestStatus(to))
+}
+
+func newStatusChange(claims jwt.MapClaims, from, to, reason string) StatusPromena {
+	change := StatusPromena{
+		Na:       canonicalRequestStatus(to),
+		Korisnik: strings.ToLower(strings.TrimSpace(claimString(claims, "sub"))),
+		Razlog:   strings.TrimSpace(reason),
+		Vreme:    time.Now(),
+	}
+	if from != "" {
+		change.Od = canonicalRequestStatus(from)
+	}
+	return change
+}
+
+// migrateLegacyRequestStatuses jednokratno prepisuje stare nazive statusa
+// (na_cekanju, u_proveri, prazan status) i dodaje pocetnu stavku istorije
+// zahtevima nastalim pre njenog uvodjenja. Izvrsena migracija se belezi u
+// kolekciji migracije.
+func migrateLegacyRequestStatuses(ctx context.Context, db *mongo.Database) error {
+	const name = "zahtevi_legacy_statusi"
+	migrations := db.Collection("migracije")
+	if n, err := migrations.CountDocuments(ctx, bson.M{"_id": name}); err != nil || n > 0 {
+		return err
+	}
+
+	renames := []struct {
+		filter bson.M
+		status string
+	}{
+		{bson.M{"status": "na_cekanju"}, statusSubmitted},
+		{bson.M{"status": bson.M{"$in": bson.A{"", nil}}}, statusSubmitted},
+		{bson.M{"status": bson.M{"$exists": false}}, statusSubmitted},
+		{bson.M{"status": "u_proveri"}, statusInReview},
+	}
+	for _, rename := range renames {
+		res, err := zahteviCollection.UpdateMany(ctx, rename.filter, bson.M{"$set": bson.M{"status": rename.status}})
+		if err != nil {
+			return err
+		}
+		if res.ModifiedCount > 0 {
+			log.Printf("Migration %s: %d zahtev(a) -> %s", name, res.ModifiedCount, rename.status)
+		}
+	}
+
+	cursor, err := zahteviCollection.Find(ctx, bson.M{"istorija": bson.M{"$exists": false}})
+	if err != nil {
+		return err
+	}
+	defer cursor.Close(ctx)
+	for cursor.Next(ctx) {
+		var item UpisZahtev
+		if err := cursor.Decode(&item); err != nil {
+			return err
+		}
+		entries := bson.A{StatusPromena{Na: statusSubmitted, Korisnik: item.KorisnikEmail, Vreme: item.CreatedAt}}
+		if item.Status != statusSubmitted && item.ProcessedAt != nil {
+			entries = append(entries, StatusPromena{Na: item.Status, Korisnik: item.ProcessedBy, Razlog: item.Reason, Vreme: *item.ProcessedAt})
+		}
+		if _, err := zahteviCollection.UpdateOne(ctx,
+			bson.M{"_id": item.ID, "istorija": bson.M{"$exists": false}},
+			bson.M{"$set": bson.M{"istorija": entries}},
+		); err != nil {
+			return err
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		return err
+	}
+
+	_, err = migrations.InsertOne(ctx, bson.M{"_id": name, "izvrsena_at": time.Now()})
+	return err
+}
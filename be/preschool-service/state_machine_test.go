@@ -0,0 +1,87 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+var allRequestStatuses = []string{
+	statusSubmitted, statusInReview, statusNeedDocs, statusApproved,
+	statusRejected, statusWaitingList, statusWithdrawn, statusUnenrolled,
+}
+
+func TestCanTransitionRequest(t *testing.T) {
+	tests := []struct {
+		from, to string
+		want     bool
+	}{
+		{statusSubmitted, statusInReview, true},
+		{statusSubmitted, statusApproved, true},
+		{statusInReview, statusSubmitted, false},
+		{statusNeedDocs, statusSubmitted, true},
+		{statusNeedDocs, statusNeedDocs, true},
+		{statusWaitingList, statusWaitingList, true},
+		{statusWaitingList, statusApproved, true},
+		{statusApproved, statusRejected, true},
+		{statusApproved, statusUnenrolled, true},
+		{statusApproved, statusWithdrawn, false},
+		{statusApproved, statusWaitingList, false},
+		{statusSubmitted, statusUnenrolled, false},
+		{statusRejected, statusInReview, false},
+		{statusWithdrawn, statusApproved, false},
+		{statusUnenrolled, statusApproved, false},
+		{" U_OBRADI ", "odobren", true},
+		{"", statusApproved, false},
+		{"nepoznat", statusApproved, false},
+	}
+	for _, tt := range tests {
+		if got := canTransitionRequest(tt.from, tt.to); got != tt.want {
+			t.Errorf("canTransitionRequest(%q, %q) = %v, want %v", tt.from, tt.to, got, tt.want)
+		}
+	}
+}
+
+func TestRequestTransitionsTable(t *testing.T) {
+	for from, targets := range requestTransitions {
+		if !containsStatus(allRequestStatuses, from) {
+			t.Errorf("nepoznat polazni status %q", from)
+		}
+		if requestClosed(from) {
+			t.Errorf("zavrsen status %q ne sme imati prelaze", from)
+		}
+		for _, to := range targets {
+			if !containsStatus(allRequestStatuses, to) {
+				t.Errorf("nepoznat ciljni status %q iz %q", to, from)
+			}
+		}
+	}
+	for action, to := range requestActionTargets {
+		if !containsStatus(allRequestStatuses, to) {
+			t.Errorf("akcija %q vodi u nepoznat status %q", action, to)
+		}
+	}
+}
+
+func TestCheckRequestTransitionMessages(t *testing.T) {
+	tests := []struct {
+		from, to string
+		wantErr  string
+	}{
+		{statusSubmitted, statusApproved, ""},
+		{statusWithdrawn, statusApproved, "vec zavrsen"},
+		{statusUnenrolled, statusRejected, "vec zavrsen"},
+		{statusApproved, statusWaitingList, "nije dozvoljen"},
+	}
+	for _, tt := range tests {
+		err := checkRequestTransition(tt.from, tt.to)
+		if tt.wantErr == "" {
+			if err != nil {
+				t.Errorf("checkRequestTransition(%q, %q) = %v, want nil", tt.from, tt.to, err)
+			}
+			continue
+		}
+		if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+			t.Errorf("checkRequestTransition(%q, %q) = %v, want %q", tt.from, tt.to, err, tt.wantErr)
+		}
+	}
+}
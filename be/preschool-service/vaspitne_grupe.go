@@ -0,0 +1,678 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// VaspitnaGrupa je imenovana grupa (ucionica) u vrticu sa uzrastom,
+// kapacitetom i vaspitacima. Odobreni zahtevi se rasporedjuju u grupe
+// preko vaspitna_grupa_id, a vaspitac vidi decu svojih grupa. Dete koje jos
+// nije rasporedjeno u grupu (i sva deca vrtica bez grupa) vide svi vaspitaci
+// rasporedjeni u vrtic, kako ne bi ostalo bez zaduzenog vaspitaca.
+type VaspitnaGrupa struct {
+	ID         primitive.ObjectID `json:"id" bson:"_id,omitempty"`
+	VrticID    primitive.ObjectID `json:"vrtic_id" bson:"vrtic_id"`
+	VrticNaziv string             `json:"vrtic_naziv" bson:"vrtic_naziv"`
+	Naziv      string             `json:"naziv" bson:"naziv"`
+	// Uzrast u mesecima; donja granica je ukljucena, gornja nije.
+	OdMeseci  int       `json:"od_meseci" bson:"od_meseci"`
+	DoMeseci  int       `json:"do_meseci" bson:"do_meseci"`
+	Kapacitet int       `json:"kapacitet" bson:"kapacitet"`
+	Upisano   int       `json:"upisano" bson:"upisano"`
+	Vaspitaci []string  `json:"vaspitaci" bson:"vaspitaci"`
+	CreatedAt time.Time `json:"created_at" bson:"created_at"`
+}
+
+type VaspitnaGrupaRequest struct {
+	VrticID   string   `json:"vrtic_id"`
+	Naziv     string   `json:"naziv"`
+	OdMeseci  int      `json:"od_meseci"`
+	DoMeseci  int      `json:"do_meseci"`
+	Kapacitet int      `json:"kapacitet"`
+	Vaspitaci []string `json:"vaspitaci"`
+}
+
+type RasporedDetetaRequest struct {
+	ZahtevID string `json:"zahtev_id"`
+}
+
+var vaspitneGrupeCollection *mongo.Collection
+
+var errGroupChanged = errors.New("Grupa je u medjuvremenu izmenjena, osvezite prikaz i pokusajte ponovo")
+
+func init() {
+	http.HandleFunc("/vaspitne-grupe", handleVaspitneGrupe)
+	http.HandleFunc("/vaspitne-grupe/", handleVaspitnaGrupa)
+}
+
+func validateGroupInput(req VaspitnaGrupaRequest) error {
+	if strings.TrimSpace(req.Naziv) == "" {
+		return errors.New("Naziv grupe je obavezan")
+	}
+	maxMeseci := uzrasneGrupe[len(uzrasneGrupe)-1].DoMeseci
+	if req.OdMeseci < 0 || req.DoMeseci <= req.OdMeseci || req.DoMeseci > maxMeseci {
+		return errors.New("Uzrast grupe mora biti opseg meseci izmedju 0 i 78")
+	}
+	if req.Kapacitet <= 0 {
+		return errors.New("Kapacitet grupe mora biti veci od 0")
+	}
+	return nil
+}
+
+// normalizeGroupEducators proverava da je svaki vaspitac grupe rasporedjen
+// u vrtic grupe.
+func normalizeGroupEducators(ctx context.Context, vrticID primitive.ObjectID, emails []string) ([]string, error) {
+	result := make([]string, 0, len(emails))
+	seen := map[string]bool{}
+	for _, email := range emails {
+		email = strings.ToLower(strings.TrimSpace(email))
+		if email == "" || seen[email] {
+			continue
+		}
+		seen[email] = true
+		assigned, err := educatorAssignedToVrtic(ctx, email, vrticID)
+		if err != nil {
+			return nil, err
+		}
+		if !assigned {
+			return nil, errors.New("Vaspitac " + email + " nije rasporedjen u vrtic grupe")
+		}
+		result = append(result, email)
+	}
+	return result, nil
+}
+
+func getVaspitnaGrupa(ctx context.Context, id primitive.ObjectID) (VaspitnaGrupa, error) {
+	var item VaspitnaGrupa
+	err := vaspitneGrupeCollection.FindOne(ctx, bson.M{"_id": id}).Decode(&item)
+	return item, err
+}
+
+func listVaspitneGrupe(ctx context.Context, vrticIDRaw string, scope VrticScope) ([]VaspitnaGrupa, error) {
+	filter := bson.M{}
+	if strings.TrimSpace(vrticIDRaw) != "" {
+		vrticID, err := primitive.ObjectIDFromHex(strings.TrimSpace(vrticIDRaw))
+		if err != nil {
+			return nil, errors.New("Neispravan ID vrtica")
+		}
+		filter["vrtic_id"] = vrticID
+	}
+	cursor, err := vaspitneGrupeCollection.Find(ctx, scope.apply(filter), options.Find().SetSort(bson.D{{Key: "vrtic_naziv", Value: 1}, {Key: "naziv", Value: 1}}))
+	if err != nil {
+		return nil, err
+	}
+	items := make([]VaspitnaGrupa, 0)
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func createVaspitnaGrupa(ctx context.Context, req VaspitnaGrupaRequest) (*VaspitnaGrupa, error) {
+	if err := validateGroupInput(req); err != nil {
+		return nil, err
+	}
+	vrticID, err := primitive.ObjectIDFromHex(strings.TrimSpace(req.VrticID))
+	if err != nil {
+		return nil, errors.New("Neispravan ID vrtica")
+	}
+	vrtic, err := getVrticByID(ctx, vrticID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errVrticNotFound
+		}
+		return nil, err
+	}
+	vaspitaci, err := normalizeGroupEducators(ctx, vrticID, req.Vaspitaci)
+	if err != nil {
+		return nil, err
+	}
+	item := VaspitnaGrupa{
+		VrticID:    vrticID,
+		VrticNaziv: vrtic.Naziv,
+		Naziv:      strings.TrimSpace(req.Naziv),
+		OdMeseci:   req.OdMeseci,
+		DoMeseci:   req.DoMeseci,
+		Kapacitet:  req.Kapacitet,
+		Vaspitaci:  vaspitaci,
+		CreatedAt:  time.Now(),
+	}
+	res, err := vaspitneGrupeCollection.InsertOne(ctx, item)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errors.New("Grupa sa tim nazivom vec postoji u vrticu")
+		}
+		return nil, err
+	}
+	if id, ok := res.InsertedID.(primitive.ObjectID); ok {
+		item.ID = id
+	}
+	return &item, nil
+}
+
+// updateVaspitnaGrupa menja grupu uslovno na zateceni broj dece, da se
+// kapacitet ne bi spustio ispod broja upravo rasporedjene dece.
+func updateVaspitnaGrupa(ctx context.Context, existing VaspitnaGrupa, req VaspitnaGrupaRequest) (*VaspitnaGrupa, error) {
+	if err := validateGroupInput(req); err != nil {
+		return nil, err
+	}
+	if req.Kapacitet < existing.Upisano {
+		return nil, errors.New("Kapacitet grupe ne moze biti manji od broja rasporedjene dece")
+	}
+	vaspitaci, err := normalizeGroupEducators(ctx, existing.VrticID, req.Vaspitaci)
+	if err != nil {
+		return nil, err
+	}
+	res, err := vaspitneGrupeCollection.UpdateOne(ctx,
+		bson.M{"_id": existing.ID, "upisano": existing.Upisano},
+		bson.M{"$set": bson.M{
+			"naziv":     strings.TrimSpace(req.Naziv),
+			"od_meseci": req.OdMeseci,
+			"do_meseci": req.DoMeseci,
+			"kapacitet": req.Kapacitet,
+			"vaspitaci": vaspitaci,
+		}},
+	)
+	if err != nil {
+		if mongo.IsDuplicateKeyError(err) {
+			return nil, errors.New("Grupa sa tim nazivom vec postoji u vrticu")
+		}
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, errGroupChanged
+	}
+	updated, err := getVaspitnaGrupa(ctx, existing.ID)
+	if err != nil {
+		return nil, err
+	}
+	return &updated, nil
+}
+
+func deleteVaspitnaGrupa(ctx context.Context, id primitive.ObjectID) error {
+	n, err := smeneCollection.CountDocuments(ctx, bson.M{"vaspitna_grupa_id": id})
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		return errors.New("Grupa ima smene vaspitaca; prvo ih uklonite ili premestite")
+	}
+	res, err := vaspitneGrupeCollection.DeleteOne(ctx, bson.M{"_id": id, "upisano": 0})
+	if err != nil {
+		return err
+	}
+	if res.DeletedCount == 0 {
+		if _, err := getVaspitnaGrupa(ctx, id); err != nil {
+			return err
+		}
+		return errors.New("Grupa ima rasporedjenu decu i ne moze se obrisati")
+	}
+	return nil
+}
+
+// childAgeMonths vraca uzrast deteta iz zahteva u mesecima; zahtevi bez
+// registrovanog deteta imaju samo navrsene godine.
+func childAgeMonths(ctx context.Context, item UpisZahtev, t time.Time) (int, error) {
+	if item.DeteID.IsZero() {
+		return item.BrojGodina * 12, nil
+	}
+	dete, err := getDeteByID(ctx, item.DeteID)
+	if err != nil {
+		return 0, err
+	}
+	return monthsAt(dete.DatumRodjenja, t), nil
+}
+
+// placeChildInGroup rasporedjuje odobren zahtev u grupu. Mesto u novoj
+// grupi se zauzima uslovno, zahtev se menja uslovno na prethodnu grupu, a
+// mesto u prethodnoj grupi se oslobadja tek posle uspesnog premestanja.
+func placeChildInGroup(ctx context.Context, grupa VaspitnaGrupa, zahtevID primitive.ObjectID) (*UpisZahtev, error) {
+	item, err := getRequestByID(ctx, zahtevID)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return nil, errors.New("Zahtev nije pronadjen")
+		}
+		return nil, err
+	}
+	if canonicalRequestStatus(item.Status) != statusApproved {
+		return nil, errors.New("U grupu se moze rasporediti samo dete sa odobrenim upisom")
+	}
+	if item.VrticID != grupa.VrticID {
+		return nil, errors.New("Dete nije upisano u vrtic ove grupe")
+	}
+	if item.VaspitnaGrupaID == grupa.ID {
+		return &item, nil
+	}
+	months, err := childAgeMonths(ctx, item, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	if months < grupa.OdMeseci || months >= grupa.DoMeseci {
+		return nil, errors.New("Uzrast deteta nije u opsegu grupe")
+	}
+
+	res, err := vaspitneGrupeCollection.UpdateOne(ctx,
+		bson.M{"_id": grupa.ID, "$expr": bson.M{"$lt": bson.A{"$upisano", "$kapacitet"}}},
+		bson.M{"$inc": bson.M{"upisano": 1}},
+	)
+	if err != nil {
+		return nil, err
+	}
+	if res.MatchedCount == 0 {
+		return nil, errors.New("Grupa je popunjena")
+	}
+
+	previous := bson.M{"$exists": false}
+	if !item.VaspitnaGrupaID.IsZero() {
+		previous = bson.M{"$eq": item.VaspitnaGrupaID}
+	}
+	res, err = zahteviCollection.UpdateOne(ctx,
+		bson.M{"_id": item.ID, "status": statusApproved, "vaspitna_grupa_id": previous},
+		bson.M{"$set": bson.M{"vaspitna_grupa_id": grupa.ID}},
+	)
+	if err != nil || res.MatchedCount == 0 {
+		releaseGroupSeat(ctx, grupa.ID)
+		if err != nil {
+			return nil, err
+		}
+		return nil, errRequestChanged
+	}
+	if !item.VaspitnaGrupaID.IsZero() {
+		releaseGroupSeat(ctx, item.VaspitnaGrupaID)
+	}
+
+	item.VaspitnaGrupaID = grupa.ID
+	item.Status = canonicalRequestStatus(item.Status)
+	return &item, nil
+}
+
+func removeChildFromGroup(ctx context.Context, grupa VaspitnaGrupa, zahtevID primitive.ObjectID) error {
+	res, err := zahteviCollection.UpdateOne(ctx,
+		bson.M{"_id": zahtevID, "vaspitna_grupa_id": grupa.ID},
+		bson.M{"$unset": bson.M{"vaspitna_grupa_id": ""}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errors.New("Dete nije rasporedjeno u ovu grupu")
+	}
+	releaseGroupSeat(ctx, grupa.ID)
+	return nil
+}
+
+// releaseChildGroup uklanja zahtev koji vise nije odobren iz njegove grupe.
+// Poziva se iz cleanupEnrollmentViews i bezbedno je ponoviti.
+func releaseChildGroup(ctx context.Context, item UpisZahtev) {
+	if item.VaspitnaGrupaID.IsZero() {
+		return
+	}
+	res, err := zahteviCollection.UpdateOne(ctx,
+		bson.M{"_id": item.ID, "vaspitna_grupa_id": item.VaspitnaGrupaID, "status": bson.M{"$ne": statusApproved}},
+		bson.M{"$unset": bson.M{"vaspitna_grupa_id": ""}},
+	)
+	if err != nil {
+		log.Printf("Group release warning for %s: %v", item.ID.Hex(), err)
+		return
+	}
+	if res.ModifiedCount == 1 {
+		releaseGroupSeat(ctx, item.VaspitnaGrupaID)
+	}
+}
+
+func releaseGroupSeat(ctx context.Context, id primitive.ObjectID) {
+	if _, err := vaspitneGrupeCollection.UpdateOne(ctx,
+		bson.M{"_id": id, "upisano": bson.M{"$gt": 0}},
+		bson.M{"$inc": bson.M{"upisano": -1}},
+	); err != nil {
+		log.Printf("Group seat release warning for %s: %v", id.Hex(), err)
+	}
+}
+
+func getGroupChildren(ctx context.Context, grupaID primitive.ObjectID) ([]UpisZahtev, error) {
+	return findApprovedRequests(ctx, bson.M{"vaspitna_grupa_id": grupaID})
+}
+
+func findApprovedRequests(ctx context.Context, filter bson.M) ([]UpisZahtev, error) {
+	filter["status"] = statusApproved
+	cursor, err := zahteviCollection.Find(ctx, filter, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+	items := make([]UpisZahtev, 0)
+	for cursor.Next(ctx) {
+		var item UpisZahtev
+		if err := cursor.Decode(&item); err != nil {
+			return nil, err
+		}
+		item.Status = canonicalRequestStatus(item.Status)
+		items = append(items, item)
+	}
+	return items, cursor.Err()
+}
+
+// educatorChildrenFilter vraca filter zahteva koje vaspitac sme da vidi:
+// decu iz svojih grupa i nerasporedjenu decu vrtica u koje je rasporedjen.
+func educatorChildrenFilter(ctx context.Context, email string) (bson.M, bool, error) {
+	email = strings.ToLower(strings.TrimSpace(email))
+	var grupe []VaspitnaGrupa
+	cursor, err := vaspitneGrupeCollection.Find(ctx, bson.M{"vaspitaci": email})
+	if err != nil {
+		return nil, false, err
+	}
+	if err := cursor.All(ctx, &grupe); err != nil {
+		return nil, false, err
+	}
+	assignments, err := getAssignmentsByEducator(ctx, email)
+	if err != nil {
+		return nil, false, err
+	}
+
+	or := bson.A{}
+	if len(grupe) > 0 {
+		ids := make([]primitive.ObjectID, 0, len(grupe))
+		for _, g := range grupe {
+			ids = append(ids, g.ID)
+		}
+		or = append(or, bson.M{"vaspitna_grupa_id": bson.M{"$in": ids}})
+	}
+	vrtici := make([]primitive.ObjectID, 0, len(assignments))
+	for _, a := range assignments {
+		vrtici = append(vrtici, a.VrticID)
+	}
+	if len(vrtici) > 0 {
+		or = append(or, bson.M{"vrtic_id": bson.M{"$in": vrtici}, "vaspitna_grupa_id": bson.M{"$exists": false}})
+	}
+	if len(or) == 0 {
+		return nil, false, nil
+	}
+	return bson.M{"$or": or}, true, nil
+}
+
+func vrticHasGroups(ctx context.Context, vrticID primitive.ObjectID) (bool, error) {
+	count, err := vaspitneGrupeCollection.CountDocuments(ctx, bson.M{"vrtic_id": vrticID}, options.Count().SetLimit(1))
+	return count > 0, err
+}
+
+// requestEducators vraca vaspitace zaduzene za dete iz zahteva: vaspitace
+// grupe ili, dok dete nije rasporedjeno, sve vaspitace vrtica.
+func requestEducators(ctx context.Context, item UpisZahtev) ([]string, error) {
+	if !item.VaspitnaGrupaID.IsZero() {
+		grupa, err := getVaspitnaGrupa(ctx, item.VaspitnaGrupaID)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return []string{}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		return grupa.Vaspitaci, nil
+	}
+	assignments, err := getAssignmentsByVrtic(ctx, item.VrticID)
+	if err != nil {
+		return nil, err
+	}
+	emails := make([]string, 0, len(assignments))
+	for _, assignment := range assignments {
+		emails = append(emails, assignment.VaspitacEmail)
+	}
+	return emails, nil
+}
+
+func educatorResponsibleFor(ctx context.Context, email string, item UpisZahtev) (bool, error) {
+	emails, err := requestEducators(ctx, item)
+	if err != nil {
+		return false, err
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	for _, e := range emails {
+		if e == email {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// educatorVisibleRequestIDs vraca ID-jeve odobrenih zahteva dece koju
+// vaspitac vidi; koristi se za filtriranje sastanaka i obavestenja.
+func educatorVisibleRequestIDs(ctx context.Context, email string) ([]primitive.ObjectID, error) {
+	items, err := getEducatorChildren(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]primitive.ObjectID, 0, len(items))
+	for _, item := range items {
+		ids = append(ids, item.ID)
+	}
+	return ids, nil
+}
+
+func getNotificationsByEducator(ctx context.Context, email string) ([]SimptomObavestenje, error) {
+	ids, err := educatorVisibleRequestIDs(ctx, email)
+	if err != nil {
+		return nil, err
+	}
+	cursor, err := obavestenjaCollection.Find(ctx, bson.M{"zahtev_id": bson.M{"$in": ids}}, options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}))
+	if err != nil {
+		return nil, err
+	}
+	items := make([]SimptomObavestenje, 0)
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+func ensureVaspitneGrupeIndexes(ctx context.Context) {
+	_, err := vaspitneGrupeCollection.Indexes().CreateMany(ctx, []mongo.IndexModel{
+		{Keys: bson.D{{Key: "vrtic_id", Value: 1}, {Key: "naziv", Value: 1}}, Options: options.Index().SetUnique(true)},
+		{Keys: bson.D{{Key: "vaspitaci", Value: 1}}},
+	})
+	if err != nil {
+		log.Printf("Groups index warning: %v", err)
+	}
+	_, err = zahteviCollection.Indexes().CreateOne(ctx, mongo.IndexModel{Keys: bson.D{{Key: "vaspitna_grupa_id", Value: 1}}})
+	if err != nil {
+		log.Printf("Requests index warning: %v", err)
+	}
+}
+
+func groupErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, mongo.ErrNoDocuments), strings.Contains(err.Error(), "nije pronadjen"):
+		return http.StatusNotFound
+	case errors.Is(err, errGroupChanged), errors.Is(err, errRequestChanged),
+		strings.Contains(err.Error(), "vec postoji"), strings.Contains(err.Error(), "popunjena"):
+		return http.StatusConflict
+	case strings.Contains(err.Error(), "Nemate dozvolu"):
+		return http.StatusForbidden
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+func handleVaspitneGrupe(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		scope, err := authorizeScope(claims, permGroupRead)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		items, err := listVaspitneGrupe(r.Context(), r.URL.Query().Get("vrtic_id"), scope)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(items)
+	case http.MethodPost:
+		var req VaspitnaGrupaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+			return
+		}
+		vrticID, err := primitive.ObjectIDFromHex(strings.TrimSpace(req.VrticID))
+		if err != nil {
+			http.Error(w, "Neispravan ID vrtica", http.StatusBadRequest)
+			return
+		}
+		if err := authorizeVrtic(claims, permGroupManage, vrticID); err != nil {
+			http.Error(w, err.Error(), http.StatusForbidden)
+			return
+		}
+		item, err := createVaspitnaGrupa(r.Context(), req)
+		if err != nil {
+			http.Error(w, err.Error(), groupErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(item)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleVaspitnaGrupa obradjuje /vaspitne-grupe/{id}, /vaspitne-grupe/{id}/deca
+// i /vaspitne-grupe/{id}/deca/{zahtev_id}.
+func handleVaspitnaGrupa(w http.ResponseWriter, r *http.Request) {
+	enableCORS(w)
+	if r.Method == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	claims, err := requireAuth(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusUnauthorized)
+		return
+	}
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/vaspitne-grupe/"), "/"), "/")
+	if len(parts) > 3 || (len(parts) > 1 && parts[1] != "deca") {
+		http.Error(w, "Neispravan URL grupe", http.StatusBadRequest)
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(parts[0])
+	if err != nil {
+		http.Error(w, "Neispravan ID grupe", http.StatusBadRequest)
+		return
+	}
+	grupa, err := getVaspitnaGrupa(r.Context(), id)
+	if err != nil {
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			http.Error(w, "Grupa nije pronadjena", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Greska pri citanju grupe", http.StatusInternalServerError)
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		p := principalFromClaims(claims)
+		allowed := p.CanInVrtic(permGroupRead, grupa.VrticID)
+		if !allowed && p.Can(permChildrenRead) {
+			for _, email := range grupa.Vaspitaci {
+				allowed = allowed || email == p.Email
+			}
+		}
+		if !allowed {
+			http.Error(w, errForbidden(permGroupRead).Error(), http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if len(parts) == 1 {
+			json.NewEncoder(w).Encode(grupa)
+			return
+		}
+		items, err := getGroupChildren(r.Context(), grupa.ID)
+		if err != nil {
+			http.Error(w, "Greska pri citanju dece", http.StatusInternalServerError)
+			return
+		}
+		json.NewEncoder(w).Encode(items)
+		return
+	}
+
+	if err := authorizeVrtic(claims, permGroupManage, grupa.VrticID); err != nil {
+		http.Error(w, err.Error(), http.StatusForbidden)
+		return
+	}
+
+	switch {
+	case len(parts) == 1 && r.Method == http.MethodPut:
+		var req VaspitnaGrupaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+			return
+		}
+		item, err := updateVaspitnaGrupa(r.Context(), grupa, req)
+		if err != nil {
+			http.Error(w, err.Error(), groupErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(item)
+	case len(parts) == 1 && r.Method == http.MethodDelete:
+		if err := deleteVaspitnaGrupa(r.Context(), grupa.ID); err != nil {
+			http.Error(w, err.Error(), groupErrorStatus(err))
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	case len(parts) == 2 && r.Method == http.MethodPost:
+		var req RasporedDetetaRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Neispravan JSON", http.StatusBadRequest)
+			return
+		}
+		zahtevID, err := primitive.ObjectIDFromHex(strings.TrimSpace(req.ZahtevID))
+		if err != nil {
+			http.Error(w, "Neispravan zahtev", http.StatusBadRequest)
+			return
+		}
+		item, err := placeChildInGroup(r.Context(), grupa, zahtevID)
+		if err != nil {
+			http.Error(w, err.Error(), groupErrorStatus(err))
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(item)
+	case len(parts) == 3 && r.Method == http.MethodDelete:
+		zahtevID, err := primitive.ObjectIDFromHex(parts[2])
+		if err != nil {
+			http.Error(w, "Neispravan zahtev", http.StatusBadRequest)
+			return
+		}
+		if err := removeChildFromGroup(r.Context(), grupa, zahtevID); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
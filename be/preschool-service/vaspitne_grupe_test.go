@@ -0,0 +1,72 @@
+package main
+
+import (
+	"sort"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestUnplacedChildrenVisibleToVrticEducators(t *testing.T) {
+	ctx := testMongo(t)
+	vrticID := primitive.NewObjectID()
+	for _, email := range []string{"grupa@test.rs", "vrtic@test.rs"} {
+		if _, err := rasporediCollection.InsertOne(ctx, VaspitacRaspored{VrticID: vrticID, VaspitacEmail: email}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	res, err := vaspitneGrupeCollection.InsertOne(ctx, VaspitnaGrupa{VrticID: vrticID, Naziv: "Leptirici", Vaspitaci: []string{"grupa@test.rs"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	grupaID := insertedID(res.InsertedID)
+
+	placed := UpisZahtev{VrticID: vrticID, VaspitnaGrupaID: grupaID, ImeDeteta: "Rasporedjen", Status: statusApproved}
+	unplaced := UpisZahtev{VrticID: vrticID, ImeDeteta: "Nerasporedjen", Status: statusApproved}
+	for _, item := range []*UpisZahtev{&placed, &unplaced} {
+		res, err := zahteviCollection.InsertOne(ctx, item)
+		if err != nil {
+			t.Fatal(err)
+		}
+		item.ID = insertedID(res.InsertedID)
+	}
+
+	tests := []struct {
+		email string
+		want  []string
+	}{
+		{"grupa@test.rs", []string{"Nerasporedjen", "Rasporedjen"}},
+		{"vrtic@test.rs", []string{"Nerasporedjen"}},
+		{"drugi@test.rs", []string{}},
+	}
+	for _, tt := range tests {
+		items, err := getEducatorChildren(ctx, tt.email)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := make([]string, 0, len(items))
+		for _, item := range items {
+			got = append(got, item.ImeDeteta)
+		}
+		sort.Strings(got)
+		if !equalStrings(got, tt.want) {
+			t.Fatalf("getEducatorChildren(%s) = %v, want %v", tt.email, got, tt.want)
+		}
+	}
+
+	emails, err := requestEducators(ctx, unplaced)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(emails)
+	if !equalStrings(emails, []string{"grupa@test.rs", "vrtic@test.rs"}) {
+		t.Fatalf("requestEducators(nerasporedjen) = %v", emails)
+	}
+	emails, err = requestEducators(ctx, placed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !equalStrings(emails, []string{"grupa@test.rs"}) {
+		t.Fatalf("requestEducators(rasporedjen) = %v", emails)
+	}
+}
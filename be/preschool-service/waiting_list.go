@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Kada se u vrticu oslobodi mesto (odbijanje vec odobrenog zahteva,
+// povecan kapacitet, novi konkurs), sledeci zahtevi sa liste cekanja
+// prelaze u obradu ili se odmah odobravaju, zavisno od WAITLIST_PROMOTION
+// (obrada|odobri). Roditelj dobija obavestenje u aplikaciji.
+const (
+	promotionModeReview  = "obrada"
+	promotionModeApprove = "odobri"
+
+	notificationTypeWaitingList = "lista_cekanja"
+)
+
+var systemClaims = jwt.MapClaims{"sub": "sistem"}
+
+// Obavestenja roditeljima o listi cekanja cuvaju se odvojeno od prijava
+// simptoma (obavestenja), koje vide vaspitaci i koje se brisu sa upisom.
+var roditeljObavestenjaCollection *mongo.Collection
+
+func waitingListPromotionMode() string {
+	if strings.EqualFold(strings.TrimSpace(getenvDefault("WAITLIST_PROMOTION", promotionModeReview)), promotionModeApprove) {
+		return promotionModeApprove
+	}
+	return promotionModeReview
+}
+
+// onSeatsFreed se poziva posle dogadjaja koji oslobadja mesta. Greske se
+// samo loguju, jer je osnovna operacija vec uspela.
+func onSeatsFreed(ctx context.Context, vrticID primitive.ObjectID, reason string) {
+	promoted, err := promoteWaitingList(ctx, vrticID)
+	if err != nil {
+		log.Printf("Waiting list promotion warning for vrtic %s (%s): %v", vrticID.Hex(), reason, err)
+		return
+	}
+	if promoted > 0 {
+		log.Printf("Waiting list: %d zahtev(a) pomereno u vrticu %s (%s)", promoted, vrticID.Hex(), reason)
+	}
+}
+
+// waitingListCandidates vraca zahteve sa liste cekanja po redosledu
+// kojim dobijaju mesto (isti redosled kao rang lista).
+func waitingListCandidates(ctx context.Context, vrticID primitive.ObjectID) ([]UpisZahtev, error) {
+	cursor, err := zahteviCollection.Find(ctx,
+		bson.M{"vrtic_id": vrticID, "status": statusWaitingList},
+		options.Find().SetSort(rankingSort()),
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer cursor.Close(ctx)
+
+	items := make([]UpisZahtev, 0)
+	for cursor.Next(ctx) {
+		var item UpisZahtev
+		if err := cursor.Decode(&item); err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	return items, cursor.Err()
+}
+
+func promoteWaitingList(ctx context.Context, vrticID primitive.ObjectID) (int, error) {
+	candidates, err := waitingListCandidates(ctx, vrticID)
+	if err != nil || len(candidates) == 0 {
+		return 0, err
+	}
+
+	mode := waitingListPromotionMode()
+	budget := -1
+	if mode == promotionModeReview {
+		// U obradu ide onoliko zahteva koliko ima mesta koja nisu vec
+		// "rezervisana" zahtevima koji su trenutno u obradi.
+		budget, err = freeSeatsForReview(ctx, vrticID)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	promoted := 0
+	for _, item := range candidates {
+		if budget == 0 {
+			break
+		}
+		item, err := attachActiveKonkurs(ctx, item)
+		if errors.Is(err, errNotEligibleForKonkurs) || errors.Is(err, errRequestChanged) {
+			continue
+		}
+		if err != nil {
+			return promoted, err
+		}
+
+		if mode == promotionModeApprove {
+			approved, full, err := promoteByApproval(ctx, item)
+			if err != nil {
+				return promoted, err
+			}
+			if full && item.Grupa == "" {
+				// Nema mesta; ni sledeci kandidati ne mogu dobiti mesto. Kod
+				// zahteva sa uzrasnom grupom popunjena moze biti samo ta grupa.
+				break
+			}
+			if !approved {
+				continue
+			}
+		} else {
+			err := updateRequestStatus(ctx, item.ID, systemClaims, statusWaitingList, statusInReview, "Oslobodilo se mesto. Zahtev je sa liste cekanja vracen u obradu.")
+			if errors.Is(err, errRequestChanged) {
+				continue
+			}
+			if err != nil {
+				return promoted, err
+			}
+			budget--
+		}
+		promoted++
+		notifyWaitingListPromotion(ctx, item, mode)
+	}
+	return promoted, nil
+}
+
+// promoteByApproval odobrava zahtev ako ima mesta i u vrticu i na
+// konkursu. Drugi rezultat je true kada mesta vise nema.
+func promoteByApproval(ctx context.Context, item UpisZahtev) (bool, bool, error) {
+	ok, err := reserveVrticSeat(ctx, item.VrticID, item.Grupa, item.RadnaGodina)
+	if err != nil || !ok {
+		return false, !ok, err
+	}
+	konkursReserved := false
+	if !item.KonkursID.IsZero() {
+		ok, err := reserveKonkursSeat(ctx, item.KonkursID, item.Grupa)
+		if err != nil || !ok {
+			releaseSeats(ctx, item, false)
+			return false, !ok, err
+		}
+		konkursReserved = true
+	}
+	if err := updateRequestStatus(ctx, item.ID, systemClaims, statusWaitingList, statusApproved, ""); err != nil {
+		releaseSeats(ctx, item, konkursReserved)
+		if errors.Is(err, errRequestChanged) {
+			return false, false, nil
+		}
+		return false, false, err
+	}
+	withdrawOtherPreferences(ctx, item)
+	return true, false, nil
+}
+
+func freeSeatsForReview(ctx context.Context, vrticID primitive.ObjectID) (int, error) {
+	vrtic, err := getVrticByID(ctx, vrticID)
+	if err != nil {
+		return 0, err
+	}
+	free := slobodnaMesta(vrtic)
+	if konkurs, err := getActiveKonkursByVrticID(ctx, vrticID); err == nil {
+		if free, err = freeSeatsInYear(ctx, vrtic, konkurs.RadnaGodina); err != nil {
+			return 0, err
+		}
+		if remaining := konkurs.MaxMesta - konkurs.Popunjeno; remaining < free {
+			free = remaining
+		}
+	} else if !errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, err
+	}
+	inReview, err := zahteviCollection.CountDocuments(ctx, bson.M{"vrtic_id": vrticID, "status": statusInReview})
+	if err != nil {
+		return 0, err
+	}
+	free -= int(inReview)
+	if free < 0 {
+		free = 0
+	}
+	return free, nil
+}
+
+// attachActiveKonkurs prebacuje zahtev sa zatvorenog konkursa na trenutno
+// aktivan konkurs vrtica, da bi mogao da dobije mesto iz novog konkursa.
+// Radna godina, bodovi i uzrasna grupa se racunaju iznova po pravilima i
+// datumu pocetka novog konkursa; zahtev deteta koje vise ne ispunjava
+// uslove novog konkursa ostaje gde je (errNotEligibleForKonkurs).
+func attachActiveKonkurs(ctx context.Context, item UpisZahtev) (UpisZahtev, error) {
+	if !item.KonkursID.IsZero() {
+		current, err := getKonkursByID(ctx, item.KonkursID)
+		if err == nil && current.Aktivan {
+			return item, nil
+		}
+		if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+			return item, err
+		}
+	}
+	active, err := getActiveKonkursByVrticID(ctx, item.VrticID)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return item, nil
+	}
+	if err != nil {
+		return item, err
+	}
+
+	moved, err := requestForKonkurs(ctx, item, active)
+	if err != nil {
+		return item, err
+	}
+	filter := bson.M{"_id": item.ID, "status": statusWaitingList, "konkurs_id": item.KonkursID}
+	if item.KonkursID.IsZero() {
+		filter["konkurs_id"] = bson.M{"$exists": false}
+	}
+	res, err := zahteviCollection.UpdateOne(ctx, filter, bson.M{"$set": bson.M{
+		"konkurs_id":   moved.KonkursID,
+		"radna_godina": moved.RadnaGodina,
+		"kriterijumi":  moved.Kriterijumi,
+		"bodovi":       moved.Bodovi,
+		"grupa":        moved.Grupa,
+		"broj_godina":  moved.BrojGodina,
+	}})
+	if err != nil {
+		return item, err
+	}
+	if res.MatchedCount == 0 {
+		return item, errRequestChanged
+	}
+	return moved, nil
+}
+
+var errNotEligibleForKonkurs = errors.New("Dete ne ispunjava uslove aktivnog konkursa")
+
+// requestForKonkurs vraca zahtev preracunat za konkurs: kriterijumi koje
+// novi konkurs ne boduje se izostavljaju, a grupa i uzrast se odredjuju na
+// dan njegovog pocetka.
+func requestForKonkurs(ctx context.Context, item UpisZahtev, konkurs Konkurs) (UpisZahtev, error) {
+	known := map[string]bool{}
+	for _, criterion := range konkursCriteria(konkurs) {
+		known[criterion.Sifra] = true
+	}
+	declared := make([]DeklarisaniKriterijum, 0, len(item.Kriterijumi))
+	for _, criterion := range item.Kriterijumi {
+		if known[strings.ToLower(strings.TrimSpace(criterion.Sifra))] {
+			declared = append(declared, criterion)
+		}
+	}
+	kriterijumi, bodovi, err := scoreRequest(konkurs, declared)
+	if err != nil {
+		return item, err
+	}
+
+	if !item.DeteID.IsZero() {
+		dete, err := getDeteByID(ctx, item.DeteID)
+		if errors.Is(err, mongo.ErrNoDocuments) {
+			return item, errNotEligibleForKonkurs
+		}
+		if err != nil {
+			return item, err
+		}
+		grupa, ok := ageGroupFor(dete.DatumRodjenja, konkurs.DatumPocetka)
+		if !ok {
+			return item, errNotEligibleForKonkurs
+		}
+		vrtic, err := getVrticByID(ctx, item.VrticID)
+		if err != nil {
+			return item, err
+		}
+		if err := checkGroupEligibility(vrtic, konkurs, grupa.Sifra); err != nil {
+			return item, errNotEligibleForKonkurs
+		}
+		item.Grupa = grupa.Sifra
+		item.BrojGodina = ageAt(dete.DatumRodjenja, konkurs.DatumPocetka)
+	}
+
+	item.KonkursID = konkurs.ID
+	item.RadnaGodina = konkurs.RadnaGodina
+	item.Kriterijumi = kriterijumi
+	item.Bodovi = bodovi
+	return item, nil
+}
+
+func notifyWaitingListPromotion(ctx context.Context, item UpisZahtev, mode string) {
+	poruka := "Oslobodilo se mesto u vrticu " + item.VrticNaziv + ". Zahtev za " + item.ImeDeteta + " je vracen u obradu."
+	if mode == promotionModeApprove {
+		poruka = "Oslobodilo se mesto u vrticu " + item.VrticNaziv + ". Zahtev za " + item.ImeDeteta + " je odobren."
+	}
+	_, err := roditeljObavestenjaCollection.InsertOne(ctx, SimptomObavestenje{
+		ZahtevID:      item.ID,
+		DeteID:        item.DeteID,
+		VrticID:       item.VrticID,
+		VrticNaziv:    item.VrticNaziv,
+		ImeDeteta:     item.ImeDeteta,
+		RoditeljEmail: item.KorisnikEmail,
+		Tip:           notificationTypeWaitingList,
+		Poruka:        poruka,
+		CreatedAt:     time.Now(),
+	})
+	if err != nil {
+		log.Printf("Waiting list notification warning for %s: %v", item.ID.Hex(), err)
+	}
+}
+
+// migrateParentNotifications jednokratno premesta obavestenja o listi
+// cekanja iz kolekcije prijava simptoma.
+func migrateParentNotifications(ctx context.Context, db *mongo.Database) error {
+	const name = "obavestenja_roditeljima"
+	migrations := db.Collection("migracije")
+	if n, err := migrations.CountDocuments(ctx, bson.M{"_id": name}); err != nil || n > 0 {
+		return err
+	}
+
+	filter := bson.M{"tip": notificationTypeWaitingList}
+	cursor, err := obavestenjaCollection.Find(ctx, filter)
+	if err != nil {
+		return err
+	}
+	var items []SimptomObavestenje
+	if err := cursor.All(ctx, &items); err != nil {
+		return err
+	}
+	for _, item := range items {
+		_, err := roditeljObavestenjaCollection.InsertOne(ctx, item)
+		if err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+	}
+	if _, err := obavestenjaCollection.DeleteMany(ctx, filter); err != nil {
+		return err
+	}
+	if len(items) > 0 {
+		log.Printf("Migration %s: %d obavestenje(a) premesteno", name, len(items))
+	}
+
+	_, err = migrations.InsertOne(ctx, bson.M{"_id": name, "izvrsena_at": time.Now()})
+	return err
+}
@@ -0,0 +1,47 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+func TestWaitingListNoticeStaysOutOfSymptomFeed(t *testing.T) {
+	ctx := testMongo(t)
+
+	item := UpisZahtev{
+		ID:            primitive.NewObjectID(),
+		VrticID:       primitive.NewObjectID(),
+		VrticNaziv:    "Sumica",
+		ImeDeteta:     "Mila Petrovic",
+		KorisnikEmail: "roditelj@example.com",
+	}
+	if _, err := obavestenjaCollection.InsertOne(ctx, SimptomObavestenje{
+		ZahtevID:      item.ID,
+		RoditeljEmail: item.KorisnikEmail,
+		Poruka:        "Temperatura",
+		CreatedAt:     time.Now().Add(-time.Hour),
+	}); err != nil {
+		t.Fatalf("insert simptom: %v", err)
+	}
+	notifyWaitingListPromotion(ctx, item, promotionModeApprove)
+
+	symptoms, err := obavestenjaCollection.CountDocuments(ctx, bson.M{"zahtev_id": item.ID})
+	if err != nil {
+		t.Fatalf("count obavestenja: %v", err)
+	}
+	if symptoms != 1 {
+		t.Fatalf("u kolekciji simptoma %d zapisa, ocekivano 1", symptoms)
+	}
+
+	cleanupEnrollmentViews(ctx, item)
+	items, err := getNotificationsByParent(ctx, item.KorisnikEmail)
+	if err != nil {
+		t.Fatalf("getNotificationsByParent: %v", err)
+	}
+	if len(items) != 1 || items[0].Tip != notificationTypeWaitingList {
+		t.Fatalf("roditelj vidi %+v, ocekivano samo obavestenje o listi cekanja", items)
+	}
+}
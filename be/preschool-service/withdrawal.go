@@ -0,0 +1,156 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Roditelj moze da povuce zahtev dok nije odobren ("povuci") ili da zatrazi
+// ispis vec upisanog deteta ("ispis"). Ispis postaje konacan tek kada ga
+// potvrdi administrator ili direktor vrtica ("potvrdi-ispis"); do tada dete
+// ostaje upisano. Potvrdjen ispis oslobadja mesto za listu cekanja.
+
+var withdrawableStatuses = []string{statusSubmitted, statusInReview, statusNeedDocs, statusWaitingList}
+
+// requestClosed je true za zahteve nad kojima obrada vise nije moguca.
+func requestClosed(status string) bool {
+	switch status {
+	case statusRejected, statusWithdrawn, statusUnenrolled:
+		return true
+	default:
+		return false
+	}
+}
+
+func requireRequestOwner(claims jwt.MapClaims, item UpisZahtev) error {
+	email := strings.ToLower(strings.TrimSpace(claimString(claims, "sub")))
+	if email == "" || email != strings.ToLower(strings.TrimSpace(item.KorisnikEmail)) {
+		return errors.New("Nemate dozvolu za ovaj zahtev")
+	}
+	return nil
+}
+
+func withdrawEnrollmentRequest(ctx context.Context, claims jwt.MapClaims, id primitive.ObjectID, reason string) error {
+	item, err := getRequestByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := requireRequestOwner(claims, item); err != nil {
+		return err
+	}
+	current := canonicalRequestStatus(item.Status)
+	if !containsStatus(withdrawableStatuses, current) {
+		if current == statusApproved {
+			return errors.New("Odobren zahtev se ne moze povuci, zatrazite ispis deteta")
+		}
+		return errors.New("Zahtev je vec zavrsen")
+	}
+
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		reason = "Roditelj je povukao zahtev."
+	}
+	if err := updateRequestStatus(ctx, id, claims, current, statusWithdrawn, reason); err != nil {
+		return err
+	}
+	cleanupEnrollmentViews(ctx, item)
+	// Zahtev u obradi zauzima mesto u budzetu za vracanje sa liste cekanja.
+	if current == statusInReview {
+		onSeatsFreed(ctx, item.VrticID, "povucen_zahtev")
+	}
+	return nil
+}
+
+func requestUnenrollment(ctx context.Context, claims jwt.MapClaims, id primitive.ObjectID, reason string) error {
+	item, err := getRequestByID(ctx, id)
+	if err != nil {
+		return err
+	}
+	if err := requireRequestOwner(claims, item); err != nil {
+		return err
+	}
+	if canonicalRequestStatus(item.Status) != statusApproved {
+		return errors.New("Ispis je moguc samo za upisano dete")
+	}
+	if item.IspisZatrazenAt != nil {
+		return errors.New("Ispis je vec zatrazen i ceka potvrdu")
+	}
+	reason = strings.TrimSpace(reason)
+	if reason == "" {
+		return errors.New("Unesite razlog ispisa")
+	}
+
+	res, err := zahteviCollection.UpdateOne(ctx,
+		bson.M{"_id": id, "status": statusApproved, "ispis_zatrazen_at": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"ispis_zatrazen_at": time.Now(), "ispis_razlog": reason}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errRequestChanged
+	}
+	return nil
+}
+
+// confirmUnenrollment ispisuje dete, vraca mesto u vrticu (i na konkursu)
+// i pokrece vracanje sa liste cekanja.
+func confirmUnenrollment(ctx context.Context, claims jwt.MapClaims, item UpisZahtev) error {
+	if canonicalRequestStatus(item.Status) != statusApproved || item.IspisZatrazenAt == nil {
+		return errors.New("Za ovaj zahtev nije zatrazen ispis")
+	}
+	if err := updateRequestStatus(ctx, item.ID, claims, statusApproved, statusUnenrolled, item.IspisRazlog); err != nil {
+		return err
+	}
+	releaseSeats(ctx, item, !item.KonkursID.IsZero())
+	cleanupEnrollmentViews(ctx, item)
+	onSeatsFreed(ctx, item.VrticID, "ispis")
+	return nil
+}
+
+func cancelUnenrollment(ctx context.Context, item UpisZahtev) error {
+	if canonicalRequestStatus(item.Status) != statusApproved || item.IspisZatrazenAt == nil {
+		return errors.New("Za ovaj zahtev nije zatrazen ispis")
+	}
+	res, err := zahteviCollection.UpdateOne(ctx,
+		bson.M{"_id": item.ID, "status": statusApproved, "ispis_zatrazen_at": bson.M{"$exists": true}},
+		bson.M{"$unset": bson.M{"ispis_zatrazen_at": "", "ispis_razlog": ""}},
+	)
+	if err != nil {
+		return err
+	}
+	if res.MatchedCount == 0 {
+		return errRequestChanged
+	}
+	return nil
+}
+
+// cleanupEnrollmentViews uklanja buduce sastanke i obavestenja vezana za
+// zahtev i oslobadja mesto u vaspitnoj grupi. Prikazi vaspitaca i deca po
+// rasporedu vide samo odobrene zahteve, pa dete iz njih nestaje promenom
+// statusa.
+func cleanupEnrollmentViews(ctx context.Context, item UpisZahtev) {
+	releaseChildGroup(ctx, item)
+	if _, err := sastanciCollection.DeleteMany(ctx, bson.M{"zahtev_id": item.ID, "termin": bson.M{"$gt": time.Now()}}); err != nil {
+		log.Printf("Meetings cleanup warning for %s: %v", item.ID.Hex(), err)
+	}
+	if _, err := obavestenjaCollection.DeleteMany(ctx, bson.M{"zahtev_id": item.ID}); err != nil {
+		log.Printf("Notifications cleanup warning for %s: %v", item.ID.Hex(), err)
+	}
+}
+
+func containsStatus(items []string, status string) bool {
+	for _, item := range items {
+		if item == status {
+			return true
+		}
+	}
+	return false
+}
@@ -619,10 +619,7 @@ function setRequestEditMode(item) {
   if (!el.upisForm) return;
   el.upisForm.elements["vrtic_id"].value = String(item.vrtic_id || "");
   el.upisForm.elements["ime_roditelja"].value = String(item.ime_roditelja || "");
-  el.upisForm.elements["ime_deteta"].value = String(item.ime_deteta || "");
-  el.upisForm.elements["broj_godina"].value = Number(item.broj_godina || 0) || "";
-  el.upisForm.elements["potvrda_vakcinacije"].checked = !!item.potvrda_vakcinacije;
-  el.upisForm.elements["izvod_iz_maticne_knjige"].checked = !!item.izvod_iz_maticne_knjige;
+  el.upisForm.elements["dete_id"].value = String(item.dete_id || "");
 }
 
 function resetRequestEditMode() {
@@ -771,6 +768,7 @@ function bindUpisEvents() {
       el.upisForm.reset();
       resetRequestEditMode();
       populateVrticSelect();
+      populateDeteSelect();
       if (el.upisStatus) el.upisStatus.textContent = "";
     });
   }
@@ -780,10 +778,7 @@ function bindUpisEvents() {
     const payload = {
       vrtic_id: String(formData.get("vrtic_id") || "").trim(),
       ime_roditelja: String(formData.get("ime_roditelja") || "").trim(),
-      ime_deteta: String(formData.get("ime_deteta") || "").trim(),
-      broj_godina: Number(formData.get("broj_godina") || 0),
-      potvrda_vakcinacije: formData.get("potvrda_vakcinacije") !== null,
-      izvod_iz_maticne_knjige: formData.get("izvod_iz_maticne_knjige") !== null,
+      dete_id: String(formData.get("dete_id") || "").trim(),
     };
     el.upisStatus.textContent = state.editingRequestId ? "Cuvam izmene..." : "Saljem zahtev...";
     try {
@@ -800,11 +795,13 @@ function bindUpisEvents() {
       } else {
         el.upisStatus.textContent = state.editingRequestId
           ? `Izmene su sačuvane. Trenutni status: ${statusLabel}.`
-          : `Zahtev je poslat. Trenutni status: ${statusLabel}.`;
+          : `Zahtev je poslat. Trenutni status: ${statusLabel}. Priloži dokumente u listi "Moji zahtevi za upis".`;
       }
       el.upisForm.reset();
       resetRequestEditMode();
       populateVrticSelect();
+      populateDeteSelect();
+      await fetchMyRequests();
     } catch (err) { el.upisStatus.textContent = `Greska: ${err.message || "Neuspesno"}`; }
   });
 }
@@ -1278,10 +1275,14 @@ async function downloadRequestDecisionPdf(id) {
   if (!headers) throw new Error("Prvo se uloguj.");
   const res = await fetch(`${API_VRTICI}/zahtevi-upisa/${id}/dokument`, { headers });
   if (!res.ok) throw new Error(await res.text());
+  await saveResponseAsFile(res, `zahtev-${id}.pdf`);
+}
+
+async function saveResponseAsFile(res, fallbackName) {
   const blob = await res.blob();
   const disposition = res.headers.get("Content-Disposition") || "";
   const match = disposition.match(/filename="?([^";]+)"?/i);
-  const fileName = match?.[1] || `zahtev-${id}.pdf`;
+  const fileName = match?.[1] || fallbackName;
   const url = window.URL.createObjectURL(blob);
   const a = document.createElement("a");
   a.href = url;
@@ -1530,40 +1531,97 @@ Object.assign(state, {
   educatorMeetingsData: [],
 });
 
-function boolLabel(value) {
-  return value ? "Priloženo" : "Nedostaje";
+const REQUEST_DOCUMENT_TYPES = [
+  { tip: "potvrda_vakcinacije", naziv: "Potvrda o vakcinaciji" },
+  { tip: "izvod_iz_maticne_knjige", naziv: "Izvod iz matične knjige rođenih" },
+];
+
+function findRequestDocument(item, tip) {
+  return (item?.dokumenti || []).find((doc) => doc.tip === tip) || null;
+}
+
+function documentStatusLabel(doc) {
+  if (!doc) return "Nije priložen";
+  switch (String(doc.status || "").toLowerCase()) {
+    case "prihvacen":
+      return "Prihvaćen";
+    case "odbijen":
+      return doc.razlog ? `Odbijen (${doc.razlog})` : "Odbijen";
+    default:
+      return "Na proveri";
+  }
+}
+
+function requestCanUploadDocuments(item) {
+  const status = String(item?.status || "").toLowerCase();
+  return status === "podnet" || status === "u_obradi" || status === "dopuna_dokumentacije" || status === "na_listi_cekanja";
+}
+
+function requestDocumentsComplete(item) {
+  return REQUEST_DOCUMENT_TYPES.every(({ tip }) => {
+    const doc = findRequestDocument(item, tip);
+    return doc && String(doc.status || "").toLowerCase() !== "odbijen";
+  });
 }
 
-function requestDocumentsHtml(item) {
-  return `<div class="muted">Potvrda o vakcinaciji: ${boolLabel(item.potvrda_vakcinacije)}</div>
-    <div class="muted">Izvod iz matične knjige rođenih: ${boolLabel(item.izvod_iz_maticne_knjige)}</div>`;
+function requestDocumentsHtml(item, canUpload = false) {
+  return REQUEST_DOCUMENT_TYPES.map(({ tip, naziv }) => {
+    const doc = findRequestDocument(item, tip);
+    const download = doc
+      ? `<button class="btn ghost small" type="button" data-document-download="${item.id}" data-tip="${tip}">Preuzmi</button>`
+      : "";
+    const upload = canUpload && String(doc?.status || "").toLowerCase() !== "prihvacen"
+      ? `<label class="btn ghost small">${doc ? "Zameni fajl" : "Priloži fajl"}<input type="file" accept="application/pdf,image/jpeg" hidden data-document-upload="${item.id}" data-tip="${tip}" /></label>`
+      : "";
+    const actions = download || upload ? `<div class="card-actions">${download}${upload}</div>` : "";
+    return `<div class="muted">${naziv}: ${documentStatusLabel(doc)}${doc ? ` (${doc.naziv_fajla})` : ""}</div>${actions}`;
+  }).join("");
 }
 
-async function updateRequestDocumentsPayload(id, payload) {
+async function uploadRequestDocumentFile(id, tip, file) {
+  const session = currentSession();
+  if (!session || !isUserRole(session.role)) throw new Error("Samo roditelj može da priloži dokumentaciju.");
+  const headers = authHeaders();
+  if (!headers) throw new Error("Prvo se uloguj.");
+  const body = new FormData();
+  body.append("fajl", file);
+  const res = await fetch(`${API_VRTICI}/zahtevi-upisa/${id}/dokumenti/${tip}`, { method: "POST", headers, body });
+  if (!res.ok) throw new Error(await res.text());
+  return res.json();
+}
+
+async function submitRequestDocuments(id) {
   const session = currentSession();
   if (!session || !isUserRole(session.role)) throw new Error("Samo roditelj može da dopuni dokumentaciju.");
   const headers = authHeaders();
   if (!headers) throw new Error("Prvo se uloguj.");
-  const res = await fetch(`${API_VRTICI}/zahtevi-upisa/${id}/dokumenta`, {
-    method: "PUT",
-    headers: { ...headers, "Content-Type": "application/json" },
-    body: JSON.stringify(payload),
-  });
+  const res = await fetch(`${API_VRTICI}/zahtevi-upisa/${id}/dokumenta`, { method: "PUT", headers });
   if (!res.ok) throw new Error(await res.text());
 }
 
+async function downloadRequestDocument(id, tip) {
+  const headers = authHeaders();
+  if (!headers) throw new Error("Prvo se uloguj.");
+  const res = await fetch(`${API_VRTICI}/zahtevi-upisa/${id}/dokumenti/${tip}`, { headers });
+  if (!res.ok) throw new Error(await res.text());
+  await saveResponseAsFile(res, `${tip}-${id}`);
+}
+
 renderMyRequests = function() {
   if (!el.myRequests) return;
   el.myRequests.innerHTML = "";
   state.mojePrijave.forEach((item) => {
     const canEditRequest = String(item.status || "").toLowerCase() === "dopuna_dokumentacije";
+    const submitDocsButton = canEditRequest
+      ? `<button class="btn secondary small" type="button" data-request-submit-docs="${item.id}" ${requestDocumentsComplete(item) ? "" : "disabled"}>Pošalji dopunu</button>`
+      : "";
     const pdfButton = requestCanDownloadDecision(item)
       ? `<button class="btn secondary small" type="button" data-request-pdf="${item.id}">${String(item.status || "").toLowerCase() === "odobren" ? "Preuzmi potvrdu" : "Preuzmi odbijenicu"}</button>`
       : "";
     const editButton = canEditRequest
       ? `<button class="btn ghost small" type="button" data-request-edit="${item.id}">Izmeni zahtev</button>`
       : "";
-    const actions = pdfButton || editButton ? `<div class="card-actions">${pdfButton}${editButton}</div>` : "";
+    const actions = pdfButton || editButton || submitDocsButton ? `<div class="card-actions">${pdfButton}${editButton}${submitDocsButton}</div>` : "";
     const card = document.createElement("article");
     card.className = "card";
     card.innerHTML = `<div class="${requestStatusClass(item.status)}">${requestStatusLabel(item.status)}</div>
@@ -1571,7 +1629,7 @@ renderMyRequests = function() {
       <div class="muted">Roditelj: ${item.ime_roditelja}</div>
       <div class="muted">Dete: ${item.ime_deteta}</div>
       <div class="muted">Broj godina: ${item.broj_godina}</div>
-      ${requestDocumentsHtml(item)}
+      ${requestDocumentsHtml(item, requestCanUploadDocuments(item))}
       ${requestMetaHtml(item)}
       ${actions}`;
     el.myRequests.appendChild(card);
@@ -1602,6 +1660,29 @@ renderAdminRequests = function() {
 function bindMyRequestDocumentEvents() {
   if (!el.myRequests || el.myRequests.dataset.boundDocs) return;
   el.myRequests.dataset.boundDocs = "1";
+  el.myRequests.addEventListener("change", async (e) => {
+    const input = e.target.closest("input[data-document-upload]");
+    if (!input || !input.files?.length) return;
+    try {
+      await uploadRequestDocumentFile(input.dataset.documentUpload, input.dataset.tip, input.files[0]);
+      await fetchMyRequests();
+    } catch (err) {
+      window.alert(err.message || "Dokument nije prilozen.");
+      input.value = "";
+    }
+  });
+  el.myRequests.addEventListener("click", async (e) => {
+    const submitButton = e.target.closest("button[data-request-submit-docs]");
+    if (!submitButton) return;
+    submitButton.disabled = true;
+    try {
+      await submitRequestDocuments(submitButton.dataset.requestSubmitDocs);
+      await fetchMyRequests();
+    } catch (err) {
+      window.alert(err.message || "Dopuna nije poslata.");
+      submitButton.disabled = false;
+    }
+  });
   el.myRequests.addEventListener("click", (e) => {
     const button = e.target.closest("button[data-request-edit]");
     if (!button) return;
@@ -1613,6 +1694,25 @@ function bindMyRequestDocumentEvents() {
   });
 }
 
+function bindDocumentDownloadEvents() {
+  [el.myRequests, el.adminRequests].forEach((container) => {
+    if (!container || container.dataset.boundDocumentDownload) return;
+    container.dataset.boundDocumentDownload = "1";
+    container.addEventListener("click", async (e) => {
+      const button = e.target.closest("button[data-document-download]");
+      if (!button) return;
+      button.disabled = true;
+      try {
+        await downloadRequestDocument(button.dataset.documentDownload, button.dataset.tip);
+      } catch (err) {
+        window.alert(err.message || "Dokument nije dostupan.");
+      } finally {
+        button.disabled = false;
+      }
+    });
+  });
+}
+
 function populateAssignmentVrticSelect() {
   if (!el.assignmentVrticSelect) return;
   el.assignmentVrticSelect.innerHTML = `<option value="">Izaberi vrtic</option>${state.vrtici
@@ -2049,6 +2149,7 @@ renderAll = function() {
 
 async function initExtendedEnrollmentFeatures() {
   bindMyRequestDocumentEvents();
+  bindDocumentDownloadEvents();
   bindAssignmentEvents();
   bindMeetingEvents();
   bindEducatorEvents();
@@ -2070,3 +2171,122 @@ async function initExtendedEnrollmentFeatures() {
 
 initExtendedEnrollmentFeatures();
 
+Object.assign(state, { deca: [] });
+
+Object.assign(el, {
+  deteSelect: byId("upis-dete-id"),
+  deteForm: byId("dete-form"),
+  deteStatus: byId("dete-status"),
+  decaList: byId("deca-list"),
+});
+
+async function fetchDeca() {
+  const headers = authHeaders();
+  const session = currentSession();
+  if (!headers || !session || !isUserRole(session.role)) { state.deca = []; renderDeca(); return; }
+  try {
+    const res = await fetch(`${API_VRTICI}/deca`, { headers });
+    if (!res.ok) throw new Error(await res.text());
+    state.deca = await res.json();
+    renderDeca();
+  } catch (err) {
+    if (el.decaList) el.decaList.innerHTML = `<div class='card'>${err.message || "Ne mogu da ucitam decu."}</div>`;
+  }
+}
+
+async function createDete(payload) {
+  const headers = authHeaders();
+  if (!headers) throw new Error("Prvo se uloguj.");
+  const res = await fetch(`${API_VRTICI}/deca`, {
+    method: "POST",
+    headers: { ...headers, "Content-Type": "application/json" },
+    body: JSON.stringify(payload),
+  });
+  if (!res.ok) throw new Error(await res.text());
+  return res.json();
+}
+
+async function deleteDete(id) {
+  const headers = authHeaders();
+  if (!headers) throw new Error("Prvo se uloguj.");
+  const res = await fetch(`${API_VRTICI}/deca/${id}`, { method: "DELETE", headers });
+  if (!res.ok) throw new Error(await res.text());
+}
+
+function deteLabel(item) {
+  const datum = item.datum_rodjenja ? new Date(item.datum_rodjenja).toLocaleDateString("sr-RS") : "-";
+  return `${item.ime} ${item.prezime} (${datum})`;
+}
+
+function populateDeteSelect() {
+  if (!el.deteSelect) return;
+  const selected = el.deteSelect.value;
+  el.deteSelect.innerHTML = state.deca.length
+    ? `<option value="">Izaberi dete</option>${state.deca.map((item) => `<option value="${item.id}">${deteLabel(item)}</option>`).join("")}`
+    : `<option value="">Prvo registruj dete</option>`;
+  if (selected) el.deteSelect.value = selected;
+}
+
+function renderDeca() {
+  populateDeteSelect();
+  if (!el.decaList) return;
+  el.decaList.innerHTML = "";
+  state.deca.forEach((item) => {
+    const card = document.createElement("article");
+    card.className = "card";
+    const alergije = (item.alergije || []).length ? item.alergije.join(", ") : "Nema";
+    card.innerHTML = `<h3>${item.ime} ${item.prezime}</h3>
+      <div class="muted">Datum rođenja: ${item.datum_rodjenja ? new Date(item.datum_rodjenja).toLocaleDateString("sr-RS") : "-"}</div>
+      <div class="muted">JMBG: ${item.jmbg}</div>
+      <div class="muted">Alergije: ${alergije}</div>
+      ${item.medicinske_napomene ? `<div class="muted">Napomene: ${item.medicinske_napomene}</div>` : ""}
+      <div class="card-actions"><button class="btn danger small" type="button" data-dete-delete="${item.id}">Obriši</button></div>`;
+    el.decaList.appendChild(card);
+  });
+  if (!state.deca.length) el.decaList.innerHTML = "<div class='card'>Još nema registrovane dece.</div>";
+}
+
+function bindDecaEvents() {
+  if (el.deteForm && !el.deteForm.dataset.bound) {
+    el.deteForm.dataset.bound = "1";
+    el.deteForm.addEventListener("submit", async (e) => {
+      e.preventDefault();
+      const formData = new FormData(el.deteForm);
+      const payload = {
+        ime: String(formData.get("ime") || "").trim(),
+        prezime: String(formData.get("prezime") || "").trim(),
+        datum_rodjenja: String(formData.get("datum_rodjenja") || "").trim(),
+        jmbg: String(formData.get("jmbg") || "").trim(),
+        alergije: String(formData.get("alergije") || "").split(",").map((item) => item.trim()).filter(Boolean),
+        medicinske_napomene: String(formData.get("medicinske_napomene") || "").trim(),
+      };
+      if (el.deteStatus) el.deteStatus.textContent = "Cuvam...";
+      try {
+        await createDete(payload);
+        el.deteForm.reset();
+        if (el.deteStatus) el.deteStatus.textContent = "Dete je registrovano.";
+        await fetchDeca();
+      } catch (err) { if (el.deteStatus) el.deteStatus.textContent = `Greska: ${err.message || "Neuspesno"}`; }
+    });
+  }
+  if (el.decaList && !el.decaList.dataset.bound) {
+    el.decaList.dataset.bound = "1";
+    el.decaList.addEventListener("click", async (e) => {
+      const button = e.target.closest("button[data-dete-delete]");
+      if (!button) return;
+      if (!window.confirm("Obrisati dete iz registra?")) return;
+      try {
+        await deleteDete(button.dataset.deteDelete);
+        await fetchDeca();
+      } catch (err) { window.alert(err.message || "Brisanje nije uspelo."); }
+    });
+  }
+}
+
+async function initDecaFeature() {
+  if (!el.deteSelect && !el.decaList) return;
+  bindDecaEvents();
+  await fetchDeca();
+}
+
+initDecaFeature();